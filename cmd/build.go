@@ -151,6 +151,12 @@ Build packages specifying multiple definition trees:
 			helpers.CheckErr(installerRecipe.Load(src))
 		}
 
+		if extraDirs := util.DefaultContext.Config.ExtraPackageDirs; len(extraDirs) > 0 {
+			util.DefaultContext.Info("Loading extra package dirs", extraDirs)
+			helpers.CheckErr(tree.LoadExtraDirs(extraDirs, generalRecipe, installerRecipe))
+			treePaths = append(treePaths, extraDirs...)
+		}
+
 		if fromRepo {
 			bt, err := installer.LoadBuildTree(generalRecipe, db, util.DefaultContext)
 			if err != nil {
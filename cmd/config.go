@@ -17,6 +17,7 @@ package cmd
 
 import (
 	"fmt"
+	"io/ioutil"
 
 	"github.com/mudler/luet/cmd/util"
 
@@ -29,6 +30,18 @@ var configCmd = &cobra.Command{
 	Long:    `Show luet configuration`,
 	Aliases: []string{"c"},
 	Run: func(cmd *cobra.Command, args []string) {
+		if report, _ := cmd.Flags().GetString("bug-report"); report != "" {
+			data, err := util.DefaultContext.Config.DumpForBugReport()
+			if err != nil {
+				util.DefaultContext.Fatal(err.Error())
+			}
+			if err := ioutil.WriteFile(report, data, 0600); err != nil {
+				util.DefaultContext.Fatal(err.Error())
+			}
+			util.DefaultContext.Info("Bug report written to", report)
+			return
+		}
+
 		data, err := util.DefaultContext.Config.YAML()
 		if err != nil {
 			util.DefaultContext.Fatal(err.Error())
@@ -39,5 +52,6 @@ var configCmd = &cobra.Command{
 }
 
 func init() {
+	configCmd.Flags().String("bug-report", "", "Write a zip archive with redacted diagnostic information to attach to bug reports")
 	RootCmd.AddCommand(configCmd)
 }
@@ -116,6 +116,14 @@ Create a repository from the metadata description defined in the luet.yaml confi
 			installer.WithContext(util.DefaultContext),
 		}
 
+		if compressions, _ := cmd.Flags().GetStringSlice("index-compressions"); len(compressions) > 0 {
+			c := []types.CompressionImplementation{}
+			for _, s := range compressions {
+				c = append(c, types.CompressionImplementation(s))
+			}
+			opts = append(opts, installer.WithIndexCompressions(c...))
+		}
+
 		if dockerFiles {
 			opts = append(opts, installer.WithCompilerParser(append(tree.DefaultCompilerParsers, tree.BuildDockerfileParser)...))
 			opts = append(opts, installer.WithRuntimeParser(append(tree.DefaultInstallerParsers, tree.RuntimeDockerfileParser)...))
@@ -205,6 +213,7 @@ func init() {
 	createrepoCmd.Flags().String("tree-filename", installer.TREE_TARBALL, "Repository tree filename")
 	createrepoCmd.Flags().String("meta-compression", "none", "Compression alg: none, gzip, zstd")
 	createrepoCmd.Flags().String("meta-filename", installer.REPOSITORY_METAFILE+".tar", "Repository metadata filename")
+	createrepoCmd.Flags().StringSlice("index-compressions", []string{}, "Publish the tree and metadata also with these compressions: none, gzip, zstd")
 	createrepoCmd.Flags().Bool("from-repositories", false, "Consume the user-defined repositories to pull specfiles from")
 	createrepoCmd.Flags().String("snapshot-id", "", "Unique ID to use when creating repository snapshots")
 
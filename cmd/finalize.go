@@ -0,0 +1,72 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+package cmd
+
+import (
+	helpers "github.com/mudler/luet/cmd/helpers"
+	"github.com/mudler/luet/cmd/util"
+	"github.com/mudler/luet/pkg/api/core/types"
+	installer "github.com/mudler/luet/pkg/installer"
+
+	"github.com/spf13/cobra"
+)
+
+var finalizeCmd = &cobra.Command{
+	Use:   "finalize <pkg> <pkg2> ...",
+	Short: "Run finalizers of installed packages",
+	Long: `Runs the finalizers of the packages installed in the system, e.g. after a rootfs was built in bootstrap mode.
+
+	$ luet finalize
+
+To run the finalizers of specific packages only:
+
+	$ luet finalize utils/busybox ...
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var toFinalize types.Packages
+		for _, a := range args {
+			pack, err := helpers.ParsePackageStr(a)
+			if err != nil {
+				util.DefaultContext.Fatal("Invalid package string ", a, ": ", err.Error())
+			}
+			toFinalize = append(toFinalize, pack)
+		}
+
+		// Finalizers are what we are here for
+		util.DefaultContext.Config.BootstrapMode = false
+
+		inst := installer.NewLuetInstaller(installer.LuetInstallerOptions{
+			Concurrency:         util.DefaultContext.Config.General.Concurrency,
+			SolverOptions:       util.DefaultContext.Config.Solver,
+			PackageRepositories: util.DefaultContext.Config.SystemRepositoriesOrdered(),
+			Context:             util.DefaultContext,
+		})
+
+		system := &installer.System{
+			Database: util.SystemDB(util.DefaultContext.Config),
+			Target:   util.DefaultContext.Config.System.Rootfs,
+		}
+		if err := inst.Finalize(toFinalize, system); err != nil {
+			util.DefaultContext.Fatal("Error: " + err.Error())
+		}
+	},
+}
+
+func init() {
+	finalizeCmd.Flags().StringArray("finalizer-env", []string{},
+		"Set finalizer environment in the format key=value.")
+
+	RootCmd.AddCommand(finalizeCmd)
+}
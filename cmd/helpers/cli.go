@@ -18,13 +18,10 @@ package cmd_helpers
 
 import (
 	"errors"
-	"fmt"
 	"regexp"
-	"strings"
 
 	"github.com/mudler/luet/pkg/api/core/types"
 
-	_gentoo "github.com/Sabayon/pkgs-checker/pkg/gentoo"
 	"github.com/mudler/luet/cmd/util"
 )
 
@@ -43,89 +40,9 @@ func CreateRegexArray(rgx []string) ([]*regexp.Regexp, error) {
 	return ans, nil
 }
 
-func packageData(p string) (string, string) {
-	cat := ""
-	name := ""
-	if strings.Contains(p, "/") {
-		packagedata := strings.Split(p, "/")
-		cat = packagedata[0]
-		name = packagedata[1]
-	} else {
-		name = p
-	}
-	return cat, name
-}
-
-func packageHasGentooSelector(v string) bool {
-	return (strings.HasPrefix(v, "=") || strings.HasPrefix(v, ">") ||
-		strings.HasPrefix(v, "<"))
-}
-
-func gentooVersion(gp *_gentoo.GentooPackage) string {
-
-	condition := gp.Condition.String()
-	if condition == "=" {
-		condition = ""
-	}
-
-	pkgVersion := fmt.Sprintf("%s%s%s",
-		condition,
-		gp.Version,
-		gp.VersionSuffix,
-	)
-	if gp.VersionBuild != "" {
-		pkgVersion = fmt.Sprintf("%s%s%s+%s",
-			condition,
-			gp.Version,
-			gp.VersionSuffix,
-			gp.VersionBuild,
-		)
-	}
-	return pkgVersion
-}
-
+// ParsePackageStr parses a package string, see util.ParsePackageStr
 func ParsePackageStr(p string) (*types.Package, error) {
-
-	if packageHasGentooSelector(p) {
-		gp, err := _gentoo.ParsePackageStr(p)
-		if err != nil {
-			return nil, err
-		}
-		if gp.Version == "" {
-			gp.Version = "0"
-			gp.Condition = _gentoo.PkgCondGreaterEqual
-		}
-
-		return &types.Package{
-			Name:     gp.Name,
-			Category: gp.Category,
-			Version:  gentooVersion(gp),
-			Uri:      make([]string, 0),
-		}, nil
-	}
-
-	ver := ""
-	cat := ""
-	name := ""
-
-	if strings.Contains(p, "@") {
-		packageinfo := strings.Split(p, "@")
-		ver = packageinfo[1]
-		cat, name = packageData(packageinfo[0])
-	} else {
-		cat, name = packageData(p)
-	}
-
-	if (cat != "") && ver == "" {
-		ver = ">=0"
-	}
-
-	return &types.Package{
-		Name:     name,
-		Category: cat,
-		Version:  ver,
-		Uri:      make([]string, 0),
-	}, nil
+	return util.ParsePackageStr(p)
 }
 
 func CheckErr(err error) {
@@ -68,6 +68,15 @@ To force install a package:
 		yes := viper.GetBool("yes")
 		downloadOnly, _ := cmd.Flags().GetBool("download-only")
 		relax, _ := cmd.Flags().GetBool("relax")
+		if bootstrap, _ := cmd.Flags().GetBool("bootstrap"); bootstrap {
+			util.DefaultContext.Config.BootstrapMode = true
+		}
+
+		if prepare, _ := cmd.Flags().GetBool("prepare-rootfs"); prepare {
+			if err := util.DefaultContext.Config.PrepareRootfs(util.DefaultContext.Config.System.Rootfs); err != nil {
+				util.DefaultContext.Fatal("Error: " + err.Error())
+			}
+		}
 
 		util.DefaultContext.Debug("Solver", util.DefaultContext.Config.Solver.CompactString())
 
@@ -81,7 +90,7 @@ To force install a package:
 			DownloadOnly:                downloadOnly,
 			Ask:                         !yes,
 			Relaxed:                     relax,
-			PackageRepositories:         util.DefaultContext.Config.SystemRepositories,
+			PackageRepositories:         util.DefaultContext.Config.SystemRepositoriesOrdered(),
 			Context:                     util.DefaultContext,
 		})
 
@@ -90,6 +99,9 @@ To force install a package:
 			Target:   util.DefaultContext.Config.System.Rootfs,
 		}
 		err := inst.Install(toInstall, system)
+		if inst.TraceID != "" {
+			util.DefaultContext.Info("Trace ID:", inst.TraceID)
+		}
 		if err != nil {
 			util.DefaultContext.Fatal("Error: " + err.Error())
 		}
@@ -106,6 +118,8 @@ func init() {
 	installCmd.Flags().Bool("solver-concurrent", false, "Use concurrent solver (experimental)")
 	installCmd.Flags().BoolP("yes", "y", false, "Don't ask questions")
 	installCmd.Flags().Bool("download-only", false, "Download only")
+	installCmd.Flags().Bool("bootstrap", false, "Skip finalizers, to be run later with 'luet finalize'")
+	installCmd.Flags().Bool("prepare-rootfs", false, "Create the directory structure of a fresh rootfs before installing")
 	installCmd.Flags().StringArray("finalizer-env", []string{},
 		"Set finalizer environment in the format key=value.")
 
@@ -100,7 +100,7 @@ To reinstall packages in the list:
 				Ask:                         !yes,
 				DownloadOnly:                downloadOnly,
 				Context:                     util.DefaultContext,
-				PackageRepositories:         util.DefaultContext.Config.SystemRepositories,
+				PackageRepositories:         util.DefaultContext.Config.SystemRepositoriesOrdered(),
 			})
 
 			err := inst.Swap(packs, toInstall, system)
@@ -44,7 +44,7 @@ It scans the target file system, and if finds a match with a package available i
 			Concurrency:                 util.DefaultContext.Config.General.Concurrency,
 			Force:                       force,
 			PreserveSystemEssentialData: true,
-			PackageRepositories:         util.DefaultContext.Config.SystemRepositories,
+			PackageRepositories:         util.DefaultContext.Config.SystemRepositoriesOrdered(),
 			Context:                     util.DefaultContext,
 		})
 
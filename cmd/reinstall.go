@@ -62,7 +62,7 @@ var reinstallCmd = &cobra.Command{
 			Ask:                         !yes,
 			DownloadOnly:                downloadOnly,
 			Context:                     util.DefaultContext,
-			PackageRepositories:         util.DefaultContext.Config.SystemRepositories,
+			PackageRepositories:         util.DefaultContext.Config.SystemRepositoriesOrdered(),
 		})
 
 		system := &installer.System{Database: util.SystemDB(util.DefaultContext.Config), Target: util.DefaultContext.Config.System.Rootfs}
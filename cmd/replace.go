@@ -81,7 +81,7 @@ var replaceCmd = &cobra.Command{
 			PreserveSystemEssentialData: true,
 			Ask:                         !yes,
 			DownloadOnly:                downloadOnly,
-			PackageRepositories:         util.DefaultContext.Config.SystemRepositories,
+			PackageRepositories:         util.DefaultContext.Config.SystemRepositoriesOrdered(),
 			Context:                     util.DefaultContext,
 		})
 
@@ -17,7 +17,6 @@ package cmd_repo
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 
@@ -121,9 +120,16 @@ Adds a repository to the system. URLs, local files or inline repo can be specifi
 				return
 			}
 
-			if err := ioutil.WriteFile(file, b, os.ModePerm); err != nil {
+			if err := util.DefaultContext.Config.WriteToFile(file, b, os.ModePerm); err != nil {
 				util.DefaultContext.Fatal(err)
 			}
+
+			if util.GossipNode != nil {
+				repos := append(util.DefaultContext.Config.SystemRepositories, *r)
+				if err := util.GossipNode.SetSystemRepositories(repos); err != nil {
+					util.DefaultContext.Warning("Failed sharing the repository with the gossip peers:", err.Error())
+				}
+			}
 		},
 	}
 	cmd.Flags().BoolP("yes", "y", false, "Assume yes to questions")
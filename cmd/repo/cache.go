@@ -0,0 +1,57 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package cmd_repo
+
+import (
+	"fmt"
+
+	"github.com/mudler/luet/cmd/util"
+	installer "github.com/mudler/luet/pkg/installer"
+
+	"github.com/spf13/cobra"
+)
+
+func NewRepoCacheCommand() *cobra.Command {
+	var repoCache = &cobra.Command{
+		Use:   "cache [repo1] [repo2] [OPTIONS]",
+		Short: "Download all the packages of a repository into the local cache.",
+		Example: `
+# Cache all the packages of repo1:
+$> luet repo cache repo1
+`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			concurrency, _ := cmd.Flags().GetInt("concurrency")
+			if concurrency == 0 {
+				concurrency = util.DefaultContext.Config.General.Concurrency
+			}
+
+			for _, rname := range args {
+				n, err := installer.CacheRepository(
+					util.DefaultContext.Config.General.GetParentContext(),
+					util.DefaultContext, rname, concurrency)
+				if err != nil {
+					util.DefaultContext.Fatal("Error on caching repository " + rname + ": " + err.Error())
+				}
+				util.DefaultContext.Info(fmt.Sprintf(":package: %d new packages cached from %s", n, rname))
+			}
+		},
+	}
+
+	repoCache.Flags().Int("concurrency", 0, "Number of parallel downloads, defaults to the general concurrency")
+
+	return repoCache
+}
@@ -18,6 +18,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/mudler/luet/cmd/util"
 	bus "github.com/mudler/luet/pkg/api/core/bus"
@@ -91,6 +92,8 @@ To build a package, from a tree definition:
 		}
 
 		util.DefaultContext = ctx
+		util.DefaultContext.Config.Version = version()
+		util.AcquirePidFile(util.DefaultContext)
 
 		util.DisplayVersionBanner(util.DefaultContext, version, license)
 
@@ -112,6 +115,15 @@ To build a package, from a tree definition:
 		if err != nil {
 			util.DefaultContext.Warning("failed on cleanup tmpdir:", err.Error())
 		}
+		if util.GossipNode != nil {
+			util.GossipNode.Leave(time.Second)
+		}
+		if util.ScheduledSync != nil {
+			util.ScheduledSync.Stop()
+		}
+		util.ShutdownTracing()
+		util.ReleasePidFile()
+		util.DefaultContext.Flush()
 	},
 	SilenceErrors: true,
 }
@@ -122,6 +134,10 @@ func Execute() {
 	util.HandleLock()
 
 	if err := RootCmd.Execute(); err != nil {
+		util.ReleasePidFile()
+		if util.DefaultContext != nil {
+			util.DefaultContext.Flush()
+		}
 		fmt.Println(err)
 		os.Exit(-1)
 	}
@@ -0,0 +1,67 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+package cmd
+
+import (
+	gocontext "context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mudler/luet/cmd/util"
+
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the management API",
+	Long: `Runs until interrupted, serving the JSON API to manage the system remotely.
+
+	$ luet serve
+
+The API is served when api_server.enabled is set, on api_server.listen_addr.
+The requests require the api_server.auth_token of the configuration as Bearer token.
+`,
+	// The API is served and credentials are refreshed in background
+	Annotations: map[string]string{
+		util.CommandLongRunning: "",
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := util.DefaultContext.Config
+		if !cfg.APIServer.Enabled {
+			util.DefaultContext.Fatal("The API server is disabled, set api_server.enabled to serve it")
+		}
+		if util.APIServer == nil {
+			util.DefaultContext.Fatal("The API server failed to start")
+		}
+		util.DefaultContext.Info("API server listening on", cfg.APIServer.GetListenAddr())
+
+		ctx, stop := signal.NotifyContext(cfg.General.GetParentContext(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		<-ctx.Done()
+
+		shutdown, cancel := gocontext.WithTimeout(gocontext.Background(), 30*time.Second)
+		defer cancel()
+		if err := util.APIServer.Shutdown(shutdown); err != nil {
+			util.DefaultContext.Warning("Failed stopping API server:", err.Error())
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(serveCmd)
+}
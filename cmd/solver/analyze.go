@@ -0,0 +1,78 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package cmd_solver
+
+import (
+	"fmt"
+
+	"github.com/mudler/luet/cmd/util"
+	"github.com/mudler/luet/pkg/solver"
+	"github.com/pterm/pterm"
+
+	"github.com/spf13/cobra"
+)
+
+func NewSolverAnalyzeCommand() *cobra.Command {
+	var ans = &cobra.Command{
+		Use:   "analyze <tracefile> [OPTIONS]",
+		Short: "Compute statistics from a solver profiling trace.",
+		Long: `Reads a trace written with solver profiling enabled:
+
+solver:
+  type: qlearning
+  profiling: true
+  profiling_path: /tmp/trace.jsonl
+`,
+		Example: `
+$> luet solver analyze /tmp/trace.jsonl
+`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			top, _ := cmd.Flags().GetInt("top")
+
+			steps, err := solver.ReadTrace(args[0])
+			if err != nil {
+				util.DefaultContext.Fatal("Error reading trace: " + err.Error())
+			}
+			stats := solver.AnalyzeTrace(steps)
+
+			d := pterm.TableData{
+				{"Steps", fmt.Sprint(stats.Steps)},
+				{"Runs", fmt.Sprint(stats.Runs)},
+				{"Duration", stats.Duration.String()},
+				{"Positive rewards", fmt.Sprint(stats.PositiveRewards)},
+				{"Negative rewards", fmt.Sprint(stats.NegativeRewards)},
+				{"Mean reward", fmt.Sprintf("%.3f", stats.MeanReward)},
+				{"Min/Max reward", fmt.Sprintf("%.3f / %.3f", stats.MinReward, stats.MaxReward)},
+				{"Converged at iteration", fmt.Sprint(stats.ConvergedAt)},
+			}
+			pterm.DefaultTable.WithData(d).Render()
+
+			if top > 0 && len(stats.Actions) > 0 {
+				fmt.Println()
+				a := pterm.TableData{{"Action", "Count"}}
+				for _, action := range stats.TopActions(top) {
+					a = append(a, []string{action, fmt.Sprint(stats.Actions[action])})
+				}
+				pterm.DefaultTable.WithHasHeader().WithData(a).Render()
+			}
+		},
+	}
+
+	ans.Flags().Int("top", 10, "Number of most taken actions to show")
+
+	return ans
+}
@@ -55,6 +55,9 @@ var uninstallCmd = &cobra.Command{
 		keepProtected, _ := cmd.Flags().GetBool("keep-protected-files")
 
 		util.DefaultContext.Config.ConfigProtectSkip = !keepProtected
+		if noAutoRemove, _ := cmd.Flags().GetBool("no-auto-remove"); noAutoRemove {
+			util.DefaultContext.Config.PackageAutoRemove = false
+		}
 
 		util.DefaultContext.Config.Solver.Implementation = types.SolverSingleCoreSimple
 
@@ -75,7 +78,11 @@ var uninstallCmd = &cobra.Command{
 
 		system := &installer.System{Database: util.SystemDB(util.DefaultContext.Config), Target: util.DefaultContext.Config.System.Rootfs}
 
-		if err := inst.Uninstall(system, toRemove...); err != nil {
+		err := inst.Uninstall(system, toRemove...)
+		if inst.TraceID != "" {
+			util.DefaultContext.Info("Trace ID:", inst.TraceID)
+		}
+		if err != nil {
 			util.DefaultContext.Fatal("Error: " + err.Error())
 		}
 	},
@@ -91,6 +98,7 @@ func init() {
 	uninstallCmd.Flags().Bool("solver-concurrent", false, "Use concurrent solver (experimental)")
 	uninstallCmd.Flags().BoolP("yes", "y", false, "Don't ask questions")
 	uninstallCmd.Flags().BoolP("keep-protected-files", "k", false, "Keep package protected files around")
+	uninstallCmd.Flags().Bool("no-auto-remove", false, "Don't remove dependencies not required anymore, overriding auto_remove")
 
 	RootCmd.AddCommand(uninstallCmd)
 }
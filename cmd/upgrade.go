@@ -63,12 +63,16 @@ var upgradeCmd = &cobra.Command{
 			Ask:                         !yes,
 			AutoOSCheck:                 osCheck,
 			DownloadOnly:                downloadOnly,
-			PackageRepositories:         util.DefaultContext.Config.SystemRepositories,
+			PackageRepositories:         util.DefaultContext.Config.SystemRepositoriesOrdered(),
 			Context:                     util.DefaultContext,
 		})
 
 		system := &installer.System{Database: util.SystemDB(util.DefaultContext.Config), Target: util.DefaultContext.Config.System.Rootfs}
-		if err := inst.Upgrade(system); err != nil {
+		err := inst.Upgrade(system)
+		if inst.TraceID != "" {
+			util.DefaultContext.Info("Trace ID:", inst.TraceID)
+		}
+		if err != nil {
 			util.DefaultContext.Fatal("Error: " + err.Error())
 		}
 	},
@@ -19,7 +19,6 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
 
 	registrytypes "github.com/docker/docker/api/types/registry"
@@ -73,6 +72,12 @@ It doesn't need the docker daemon to run, and allows to override default os/arch
 
 			arch, _ := cmd.Flags().GetString("arch")
 			os, _ := cmd.Flags().GetString("os")
+			if arch == "" {
+				arch = util.DefaultContext.Config.GetSystemArch()
+			}
+			if os == "" {
+				os = util.DefaultContext.Config.GetSystemOS()
+			}
 
 			err := pack(util.DefaultContext, src, dst, image, arch, os)
 			if err != nil {
@@ -82,8 +87,8 @@ It doesn't need the docker daemon to run, and allows to override default os/arch
 		},
 	}
 
-	c.Flags().String("arch", runtime.GOARCH, "Image architecture")
-	c.Flags().String("os", runtime.GOOS, "Image OS")
+	c.Flags().String("arch", "", "Image architecture (defaults to the system one)")
+	c.Flags().String("os", "", "Image OS (defaults to the system one)")
 
 	return c
 }
@@ -27,6 +27,7 @@ import (
 
 	"github.com/mudler/luet/pkg/api/core/context"
 	"github.com/mudler/luet/pkg/api/core/template"
+	"github.com/mudler/luet/pkg/api/core/types"
 	"github.com/mudler/luet/pkg/installer"
 )
 
@@ -76,6 +77,33 @@ func HandleLock() {
 	}
 }
 
+var releasePidFile func() error
+
+// AcquirePidFile writes the pid file, if configured, exiting if
+// another luet already holds it
+func AcquirePidFile(c *context.Context) {
+	if c.Config.General.PidFile == "" {
+		return
+	}
+	release, err := types.AcquirePidFile(c.Config.General.PidFile)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	releasePidFile = release
+}
+
+// ReleasePidFile removes the pid file written by AcquirePidFile
+func ReleasePidFile() {
+	if releasePidFile == nil {
+		return
+	}
+	if err := releasePidFile(); err != nil {
+		fmt.Println("failed removing pid file:", err.Error())
+	}
+	releasePidFile = nil
+}
+
 func DisplayVersionBanner(c *context.Context, version func() string, license []string) {
 	display := false
 	if len(os.Args) > 1 {
@@ -16,20 +16,29 @@
 package util
 
 import (
+	gocontext "context"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"os/user"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ipfs/go-log/v2"
 	extensions "github.com/mudler/cobra-extensions"
 	"github.com/mudler/luet/pkg/api/core/context"
 	gc "github.com/mudler/luet/pkg/api/core/garbagecollector"
+	"github.com/mudler/luet/pkg/api/core/gossip"
 	"github.com/mudler/luet/pkg/api/core/logger"
+	"github.com/mudler/luet/pkg/api/core/metrics"
+	"github.com/mudler/luet/pkg/api/core/tracing"
 	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/mudler/luet/pkg/api/server"
+	"github.com/mudler/luet/pkg/installer"
 	"github.com/mudler/luet/pkg/solver"
 	"github.com/pterm/pterm"
 	"go.uber.org/zap/zapcore"
@@ -91,12 +100,54 @@ func initConfig() {
 	viper.SetEnvKeyReplacer(replacer)
 	viper.SetTypeByDefaultValue(true)
 	// If a config file is found, read it in.
-	viper.ReadInConfig()
+	if err := viper.ReadInConfig(); err != nil {
+		return
+	}
 
+	// Merge the included configs over the main one
+	main := viper.ConfigFileUsed()
+	includes, err := types.ConfigIncludes(main)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for _, f := range includes {
+		viper.SetConfigFile(f)
+		if err := viper.MergeInConfig(); err != nil {
+			fmt.Printf("while merging config %s: %s\n", f, err)
+			os.Exit(1)
+		}
+	}
+	viper.SetConfigFile(main)
 }
 
 var DefaultContext *context.Context
 
+// GossipNode shares the config with the cluster peers, when enabled
+var GossipNode *gossip.Node
+
+// ScheduledSync syncs the repositories in background, when enabled
+var ScheduledSync *installer.ScheduledSync
+
+// APIServer serves the management API of the long running commands, when enabled
+var APIServer *http.Server
+
+// OperationsLock serializes the operations run in background on the
+// system: the scheduled syncs and the API requests
+var OperationsLock = &sync.RWMutex{}
+
+var tracingShutdown func(gocontext.Context) error
+
+// ShutdownTracing flushes the pending spans, when tracing is enabled
+func ShutdownTracing() {
+	if tracingShutdown == nil {
+		return
+	}
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), 5*time.Second)
+	defer cancel()
+	tracingShutdown(ctx)
+}
+
 // InitContext inits the context by parsing the configurations from viper
 // this is meant to be run before each command to be able to parse any override from
 // the CLI/ENV
@@ -108,19 +159,58 @@ func InitContext(cmd *cobra.Command) (ctx *context.Context, err error) {
 		return
 	}
 
+	// Older configs are migrated before being validated,
+	// Init checks the version again for the library users
+	if err = c.CheckSchemaVersion(); err != nil {
+		return
+	}
+
+	if err = c.Validate(); err != nil {
+		return
+	}
+
+	// The default repositories config dir isn't validated, it might not exist
+	if !viper.IsSet("repos_confdir") {
+		c.RepositoriesConfDir = []string{types.DefaultRepositoriesConfDir}
+	}
+
 	// Converts user-defined config into paths
 	// and creates the required directory on the system if necessary
-	c.Init()
+	if err = c.Init(); err != nil {
+		return
+	}
+
+	if err = c.SystemRepositoriesFromEnv(); err != nil {
+		return
+	}
 
 	finalizerEnvs, _ := cmd.Flags().GetStringArray("finalizer-env")
 	setCliFinalizerEnvs(c, finalizerEnvs)
 
 	c.Solver.SolverOptions = types.SolverOptions{Type: types.SolverSingleCoreSimple, Concurrency: c.General.Concurrency}
+	c.InstalledPackages = func() (types.Packages, error) {
+		return SystemDB(c).World(), nil
+	}
 
 	ctx = context.NewContext(
 		context.WithConfig(c),
 		context.WithGarbageCollector(gc.GarbageCollector(c.System.TmpDirBase)),
 	)
+	c.SystemDatabase = func() types.PackageDatabase {
+		return SystemDB(c)
+	}
+	c.OpenDatabase = func(path string) types.PackageDatabase {
+		if c.TestMode {
+			return c.TestDatabase(path, newInMemoryDatabase)
+		}
+		return boltDB(c, path)
+	}
+	c.RepositoryDatabases = func() ([]types.PackageDatabase, error) {
+		return repositoryDatabases(ctx)
+	}
+	c.PlanInstall = func(pkgs []string) (*types.InstallPlan, error) {
+		return planInstall(ctx, pkgs)
+	}
 
 	// Inits the context with the configurations loaded
 	// It reads system repositories, sets logging, and all the
@@ -145,6 +235,9 @@ func setCliFinalizerEnvs(c *types.LuetConfig, finalizerEnvs []string) error {
 
 const (
 	CommandProcessOutput = "command.process.output"
+	// CommandLongRunning annotates the commands running until interrupted,
+	// which refresh the repository credentials and serve the API in background
+	CommandLongRunning = "command.long.running"
 )
 
 func initContext(cmd *cobra.Command, c *context.Context) (err error) {
@@ -197,6 +290,10 @@ func initContext(cmd *cobra.Command, c *context.Context) (err error) {
 		opts = append(opts, logger.EnableEmoji())
 	}
 
+	if c.Config.Logging.AsyncLogging {
+		opts = append(opts, logger.WithAsync(c.Config.Logging.AsyncBufferSize))
+	}
+
 	l, err := logger.New(opts...)
 
 	c.Logger = l
@@ -206,6 +303,58 @@ func initContext(cmd *cobra.Command, c *context.Context) (err error) {
 	c.Debug("Logging level", c.Config.Logging.Level)
 	c.Debug("Debug mode", c.Config.General.Debug)
 
+	if c.Config.General.MetricsEnabled {
+		if _, err := metrics.Serve(c.Config.General.MetricsPort); err != nil {
+			c.Warning("Failed starting metrics server:", err.Error())
+		} else {
+			c.Debug("Metrics exposed on port", c.Config.General.MetricsPort)
+		}
+	}
+
+	if c.Config.General.ScheduledSync.Enabled {
+		ScheduledSync = installer.NewScheduledSync(c, nil, OperationsLock)
+		if err := ScheduledSync.Start(); err != nil {
+			c.Warning("Failed scheduling repositories sync:", err.Error())
+			ScheduledSync = nil
+		}
+	}
+
+	if c.Config.General.TracingEnabled {
+		tracingShutdown, err = tracing.Init(c.Config.General.TracingEndpoint)
+		if err != nil {
+			c.Warning("Failed initializing tracing:", err.Error())
+			err = nil
+		}
+	}
+
+	if c.Config.General.GossipEnabled {
+		GossipNode, err = gossip.New(c.Config)
+		if err != nil {
+			c.Warning("Failed starting gossip node:", err.Error())
+			err = nil
+		}
+	}
+
+	for _, w := range c.Config.ExperimentalWarnings() {
+		c.Warning(w)
+	}
+
+	if _, ok := cmd.Annotations[CommandLongRunning]; ok {
+		c.Config.StartCredentialRefresh(c.Config.General.GetParentContext(), func(err error) {
+			c.Warning("Failed refreshing repository credentials:", err.Error())
+		})
+
+		if c.Config.APIServer.Enabled {
+			system := &installer.System{Database: SystemDB(c.Config), Target: c.Config.System.Rootfs}
+			if APIServer, err = server.Serve(c, system, OperationsLock); err != nil {
+				c.Warning("Failed starting API server:", err.Error())
+				err = nil
+			} else {
+				c.Debug("API server listening on", c.Config.APIServer.GetListenAddr())
+			}
+		}
+	}
+
 	return
 }
 
@@ -216,6 +365,8 @@ func setDefaults(viper *viper.Viper) {
 	viper.SetDefault("logging.json_format", false)
 	viper.SetDefault("logging.enable_emoji", true)
 	viper.SetDefault("logging.color", true)
+	viper.SetDefault("logging.async_logging", false)
+	viper.SetDefault("logging.async_buffer_size", 1024)
 
 	viper.SetDefault("general.concurrency", runtime.NumCPU())
 	viper.SetDefault("general.debug", false)
@@ -223,6 +374,15 @@ func setDefaults(viper *viper.Viper) {
 	viper.SetDefault("general.show_build_output", true)
 	viper.SetDefault("general.fatal_warnings", false)
 	viper.SetDefault("general.http_timeout", 360)
+	viper.SetDefault("general.dry_run", false)
+	viper.SetDefault("general.metrics_enabled", false)
+	viper.SetDefault("general.metrics_port", metrics.DefaultPort)
+	viper.SetDefault("general.gossip_enabled", false)
+	viper.SetDefault("general.gossip_peers", []string{})
+	viper.SetDefault("general.pid_file", "")
+	viper.SetDefault("general.solver_workers", 1)
+	viper.SetDefault("general.finalize_parallelism", 1)
+	viper.SetDefault("general.build_timeout", "3600s")
 
 	u, err := user.Current()
 	// os/user doesn't work in from scratch environments
@@ -237,8 +397,10 @@ func setDefaults(viper *viper.Viper) {
 	viper.SetDefault("system.rootfs", "/")
 	viper.SetDefault("system.tmpdir_base", filepath.Join(os.TempDir(), "tmpluet"))
 	viper.SetDefault("system.pkgs_cache_path", "packages")
+	viper.SetDefault("system.database_backup_interval", "24h")
+	viper.SetDefault("system.database_backup_retention", 7)
+	viper.SetDefault("system.max_install_size_mb", 0)
 
-	viper.SetDefault("repos_confdir", []string{"/etc/luet/repos.conf.d"})
 	viper.SetDefault("config_protect_confdir", []string{"/etc/luet/config.protect.d"})
 	viper.SetDefault("config_protect_skip", false)
 	// TODO: Set default to false when we are ready for migration.
@@ -246,11 +408,20 @@ func setDefaults(viper *viper.Viper) {
 	viper.SetDefault("cache_repositories", []string{})
 	viper.SetDefault("system_repositories", []string{})
 	viper.SetDefault("finalizer_envs", make(map[string]string))
+	viper.SetDefault("max_repositories", 100)
+	viper.SetDefault("finalizer_timeout", "600s")
+	viper.SetDefault("credential_refresh_interval", "15m")
+	viper.SetDefault("security_advisory_refresh", "24h")
+	viper.SetDefault("signature_policy", types.DefaultSignaturePolicy)
+	viper.SetDefault("bootstrap", false)
+	viper.SetDefault("auto_remove", false)
 
 	viper.SetDefault("solver.type", "")
 	viper.SetDefault("solver.rate", 0.7)
 	viper.SetDefault("solver.discount", 1.0)
 	viper.SetDefault("solver.max_attempts", 9000)
+	viper.SetDefault("solver.conflict_strategy", "")
+	viper.SetDefault("solver.backtrack_limit", 1000)
 }
 
 // InitViper inits a new viper
@@ -278,11 +449,16 @@ func InitViper(RootCmd *cobra.Command) {
 	pflags.Float32("solver-rate", 0.7, "Solver learning rate")
 	pflags.Float32("solver-discount", 1.0, "Solver discount rate")
 	pflags.Int("solver-attempts", 9000, "Solver maximum attempts")
+	pflags.String("solver-conflict-strategy", "", "Solver conflict strategy (prefer-installed, prefer-newer, fail)")
+	pflags.String("solver-plugin", "", "Solver plugin address (unix socket or host:port), used with the grpc solver type")
+	pflags.String("solver-checkpoint", "", "File storing the qlearning solver progress, resumed if interrupted")
+	pflags.Bool("no-checkpoint", false, "Discard the solver checkpoint and start fresh")
 	pflags.Bool("live-output", true, "Show live output during build")
 
 	pflags.Bool("same-owner", true, "Maintain same owner on uncompress.")
 	pflags.Int("concurrency", runtime.NumCPU(), "Concurrency")
 	pflags.Int("http-timeout", 360, "Default timeout for http(s) requests")
+	pflags.Bool("dry-run", false, "Show what would be done without changing the system")
 
 	viper.BindPFlag("system.database_path", pflags.Lookup("system-dbpath"))
 	viper.BindPFlag("system.rootfs", pflags.Lookup("system-target"))
@@ -291,6 +467,10 @@ func InitViper(RootCmd *cobra.Command) {
 	viper.BindPFlag("solver.discount", pflags.Lookup("solver-discount"))
 	viper.BindPFlag("solver.rate", pflags.Lookup("solver-rate"))
 	viper.BindPFlag("solver.max_attempts", pflags.Lookup("solver-attempts"))
+	viper.BindPFlag("solver.conflict_strategy", pflags.Lookup("solver-conflict-strategy"))
+	viper.BindPFlag("custom_solver_plugin", pflags.Lookup("solver-plugin"))
+	viper.BindPFlag("solver.solver_checkpoint", pflags.Lookup("solver-checkpoint"))
+	viper.BindPFlag("solver.no_checkpoint", pflags.Lookup("no-checkpoint"))
 
 	viper.BindPFlag("logging.color", pflags.Lookup("color"))
 	viper.BindPFlag("logging.enable_emoji", pflags.Lookup("emoji"))
@@ -305,6 +485,7 @@ func InitViper(RootCmd *cobra.Command) {
 	viper.BindPFlag("plugin", pflags.Lookup("plugin"))
 	viper.BindPFlag("general.http_timeout", pflags.Lookup("http-timeout"))
 	viper.BindPFlag("general.show_build_output", pflags.Lookup("live-output"))
+	viper.BindPFlag("general.dry_run", pflags.Lookup("dry-run"))
 
 	// Currently I maintain this only from cli.
 	viper.BindPFlag("no_spinner", pflags.Lookup("no-spinner"))
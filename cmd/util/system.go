@@ -16,18 +16,94 @@
 package util
 
 import (
-	"path/filepath"
+	"fmt"
+	"sync"
 
+	"github.com/mudler/luet/pkg/api/core/context"
 	"github.com/mudler/luet/pkg/api/core/types"
 	pkg "github.com/mudler/luet/pkg/database"
+	"github.com/mudler/luet/pkg/installer"
 )
 
+// backupOnce runs the automatic database backup once per command
+var backupOnce sync.Once
+
 func SystemDB(c *types.LuetConfig) types.PackageDatabase {
+	if c.TestMode {
+		return c.TestDatabase(c.GetSystemDBPath(), newInMemoryDatabase)
+	}
+
+	backupOnce.Do(func() {
+		if err := c.System.BackupDBIfExpired(); err != nil && DefaultContext != nil {
+			DefaultContext.Warning(err.Error())
+		}
+	})
+
 	switch c.System.DatabaseEngine {
 	case "boltdb":
-		return pkg.NewBoltDatabase(
-			filepath.Join(c.System.DatabasePath, "luet.db"))
+		return boltDB(c, c.GetSystemDBPath())
 	default:
 		return pkg.NewInMemoryDatabase(true)
 	}
 }
+
+func newInMemoryDatabase() types.PackageDatabase {
+	return pkg.NewInMemoryDatabase(false)
+}
+
+// boltDB opens a boltdb database, wrapped with the local cache if enabled
+func boltDB(c *types.LuetConfig, path string) types.PackageDatabase {
+	db := pkg.NewBoltDatabase(path)
+	if !c.LocalCache.Enabled() {
+		return db
+	}
+	cached, err := pkg.NewCachedDatabase(db, c.LocalCache)
+	if err != nil {
+		if DefaultContext != nil {
+			DefaultContext.Warning("Local cache disabled:", err.Error())
+		}
+		return db
+	}
+	return cached
+}
+
+// repositoryDatabases syncs the system repositories and returns their
+// databases, backing types.LuetConfig.CompositePackageDatabase
+func repositoryDatabases(ctx types.Context) ([]types.PackageDatabase, error) {
+	cfg := ctx.GetConfig()
+	dbs := []types.PackageDatabase{}
+	for _, r := range installer.SystemRepositories(cfg.SystemRepositoriesOrdered(), cfg.GetSystemArch()) {
+		repo, err := r.Sync(ctx, false)
+		if err != nil {
+			return nil, err
+		}
+		dbs = append(dbs, repo.GetTree().GetDatabase())
+	}
+	return dbs, nil
+}
+
+// planInstall computes the install plan of the package strings pkgs
+// against the system repositories, backing
+// types.LuetConfig.GetFinalSystemPackagePlan
+func planInstall(ctx *context.Context, pkgs []string) (*types.InstallPlan, error) {
+	toInstall := types.Packages{}
+	for _, a := range pkgs {
+		pack, err := ParsePackageStr(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid package string %s: %w", a, err)
+		}
+		toInstall = append(toInstall, pack)
+	}
+
+	inst := installer.NewLuetInstaller(installer.LuetInstallerOptions{
+		Concurrency:         ctx.Config.General.Concurrency,
+		SolverOptions:       ctx.Config.Solver,
+		PackageRepositories: ctx.Config.SystemRepositoriesOrdered(),
+		Context:             ctx,
+	})
+
+	return inst.GetFinalSystemPackagePlan(toInstall, &installer.System{
+		Database: SystemDB(ctx.Config),
+		Target:   ctx.Config.System.Rootfs,
+	})
+}
@@ -17,6 +17,7 @@ package context
 
 import (
 	"context"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
@@ -155,6 +156,22 @@ func (c *Context) Warningf(t string, mess ...interface{}) {
 	c.Warnf(t, mess...)
 }
 
+// TempDir creates a temporary directory, under t.TempDir() in test mode
+func (c *Context) TempDir(pattern string) (string, error) {
+	if dir, ok := c.Config.TestTempDir(); ok {
+		return ioutil.TempDir(dir, pattern)
+	}
+	return c.GarbageCollector.TempDir(pattern)
+}
+
+// TempFile creates a temporary file, under t.TempDir() in test mode
+func (c *Context) TempFile(s string) (*os.File, error) {
+	if dir, ok := c.Config.TestTempDir(); ok {
+		return ioutil.TempFile(dir, s)
+	}
+	return c.GarbageCollector.TempFile(s)
+}
+
 func (c *Context) GetConfig() types.LuetConfig {
 	return *c.Config
 }
@@ -0,0 +1,54 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package context_test
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Context", func() {
+	Context("Test mode", func() {
+		It("creates temporary files in the test directory", func() {
+			ctx := context.NewContext()
+			ctx.Config.SetTestMode(GinkgoT())
+			gc := ctx.GarbageCollector.String()
+
+			dir, err := ctx.TempDir("test")
+			Expect(err).ToNot(HaveOccurred())
+			f, err := ctx.TempFile("test")
+			Expect(err).ToNot(HaveOccurred())
+			defer f.Close()
+
+			Expect(dir).To(BeADirectory())
+			Expect(strings.HasPrefix(dir, gc)).To(BeFalse())
+			Expect(strings.HasPrefix(f.Name(), gc)).To(BeFalse())
+		})
+
+		It("uses the garbage collector otherwise", func() {
+			ctx := context.NewContext()
+			dir, err := ctx.TempDir("test")
+			Expect(err).ToNot(HaveOccurred())
+			defer ctx.Clean()
+			Expect(filepath.Dir(dir)).To(Equal(ctx.GarbageCollector.String()))
+		})
+	})
+})
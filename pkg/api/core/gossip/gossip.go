@@ -0,0 +1,340 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package gossip
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pkg/errors"
+)
+
+// Keys of the config state shared between peers
+const (
+	KeySystemRepositories = "system_repositories"
+	KeyPackageHolds       = "package_holds"
+)
+
+// StateFile is the file of the system database directory
+// where the gossip state is kept between runs
+const StateFile = "gossip.json"
+
+// entry is a config value with the time it was last written.
+// Conflicts are resolved by last-write-wins, ties by origin.
+type entry struct {
+	Value     json.RawMessage `json:"value"`
+	Timestamp int64           `json:"timestamp"`
+	Origin    string          `json:"origin"`
+}
+
+func (e entry) newerThan(o entry) bool {
+	if e.Timestamp != o.Timestamp {
+		return e.Timestamp > o.Timestamp
+	}
+	return e.Origin > o.Origin
+}
+
+// persistedState is the content of StateFile. Local are the values
+// read from the local config on the last run, to detect local changes.
+type persistedState struct {
+	Entries map[string]entry           `json:"entries"`
+	Local   map[string]json.RawMessage `json:"local"`
+}
+
+type broadcast []byte
+
+func (b broadcast) Invalidates(memberlist.Broadcast) bool { return false }
+func (b broadcast) Message() []byte                       { return b }
+func (b broadcast) Finished()                             {}
+
+// Node shares the system repositories and the package holds
+// of a config with the other peers of the cluster.
+//
+// The config is only written by New, before it is used by the running
+// command. Changes received afterwards are stored in the state file
+// and applied to the config of the next run.
+type Node struct {
+	sync.Mutex
+	state      persistedState
+	statePath  string
+	list       *memberlist.Memberlist
+	broadcasts *memberlist.TransmitLimitedQueue
+}
+
+// New starts a gossip node bound to GossipBindAddr and joins GossipPeers.
+// Values changed in the local config since the last run are published
+// to the peers, then the cluster state is applied to the config.
+func New(c *types.LuetConfig) (*Node, error) {
+	key, err := c.General.GetGossipSecretKey()
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Node{statePath: filepath.Join(c.System.DatabasePath, StateFile)}
+	if err := n.load(); err != nil {
+		return nil, err
+	}
+
+	mc := memberlist.DefaultLANConfig()
+	mc.Delegate = n
+	mc.SecretKey = key
+	mc.Logger = log.New(ioutil.Discard, "", 0)
+	if c.General.GossipBindAddr != "" {
+		host, port, err := net.SplitHostPort(c.General.GossipBindAddr)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid gossip bind address")
+		}
+		mc.BindAddr = host
+		if mc.BindPort, err = strconv.Atoi(port); err != nil {
+			return nil, errors.Wrap(err, "invalid gossip bind port")
+		}
+		mc.AdvertisePort = mc.BindPort
+	}
+	// Several nodes can run on the same host
+	mc.Name = mc.Name + "-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	list, err := memberlist.Create(mc)
+	if err != nil {
+		return nil, errors.Wrap(err, "while starting gossip node")
+	}
+	n.list = list
+	n.broadcasts = &memberlist.TransmitLimitedQueue{
+		NumNodes:       list.NumMembers,
+		RetransmitMult: mc.RetransmitMult,
+	}
+
+	for k, v := range localValues(c) {
+		if err := n.setLocal(k, v); err != nil {
+			list.Shutdown()
+			return nil, err
+		}
+	}
+
+	// Joining exchanges the full state with the peers before returning
+	if len(c.General.GossipPeers) > 0 {
+		if _, err := list.Join(c.General.GossipPeers); err != nil {
+			list.Shutdown()
+			return nil, errors.Wrap(err, "while joining gossip peers")
+		}
+	}
+
+	if err := n.apply(c); err != nil {
+		list.Shutdown()
+		return nil, err
+	}
+	return n, nil
+}
+
+// Address returns the address the node is reachable at
+func (n *Node) Address() string {
+	node := n.list.LocalNode()
+	return net.JoinHostPort(node.Addr.String(), strconv.Itoa(int(node.Port)))
+}
+
+// Leave broadcasts the node departure and stops it
+func (n *Node) Leave(timeout time.Duration) error {
+	if err := n.list.Leave(timeout); err != nil {
+		return err
+	}
+	return n.list.Shutdown()
+}
+
+// State returns a config with the shared values known by the node
+func (n *Node) State() types.LuetConfig {
+	c := types.LuetConfig{}
+	n.apply(&c)
+	return c
+}
+
+// SetSystemRepositories updates the repositories and propagates them to the peers
+func (n *Node) SetSystemRepositories(r types.LuetRepositories) error {
+	return n.publish(KeySystemRepositories, r)
+}
+
+// SetPackageHolds updates the package holds and propagates them to the peers
+func (n *Node) SetPackageHolds(h []string) error {
+	return n.publish(KeyPackageHolds, h)
+}
+
+func localValues(c *types.LuetConfig) map[string]interface{} {
+	return map[string]interface{}{
+		KeySystemRepositories: c.SystemRepositories,
+		KeyPackageHolds:       c.PackageHolds,
+	}
+}
+
+// apply sets the shared values of the cluster state in c
+func (n *Node) apply(c *types.LuetConfig) error {
+	n.Lock()
+	defer n.Unlock()
+
+	for k, e := range n.state.Entries {
+		var err error
+		switch k {
+		case KeySystemRepositories:
+			r := types.LuetRepositories{}
+			if err = json.Unmarshal(e.Value, &r); err == nil {
+				c.SystemRepositories = r
+			}
+		case KeyPackageHolds:
+			h := []string{}
+			if err = json.Unmarshal(e.Value, &h); err == nil {
+				c.PackageHolds = h
+			}
+		}
+		if err != nil {
+			return errors.Wrapf(err, "invalid gossip value for %s", k)
+		}
+	}
+	return nil
+}
+
+// setLocal publishes the local value of key if it changed since the last run
+func (n *Node) setLocal(key string, v interface{}) error {
+	dat, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	n.Lock()
+	last, seen := n.state.Local[key]
+	_, known := n.state.Entries[key]
+	n.Unlock()
+	if seen && known && bytes.Equal(last, dat) {
+		return nil
+	}
+	return n.publish(key, v)
+}
+
+// publish records v as the newest value of key, and broadcasts it
+func (n *Node) publish(key string, v interface{}) error {
+	dat, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	n.Lock()
+	defer n.Unlock()
+	e := entry{Value: dat, Timestamp: time.Now().UnixNano(), Origin: n.list.LocalNode().Name}
+	n.state.Entries[key] = e
+	n.state.Local[key] = dat
+	if err := n.save(); err != nil {
+		return err
+	}
+
+	msg, err := json.Marshal(map[string]entry{key: e})
+	if err != nil {
+		return err
+	}
+	n.broadcasts.QueueBroadcast(broadcast(msg))
+	return nil
+}
+
+// load reads the state of the last run, if any
+func (n *Node) load() error {
+	n.state = persistedState{Entries: map[string]entry{}, Local: map[string]json.RawMessage{}}
+	dat, err := ioutil.ReadFile(n.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "while reading the gossip state")
+	}
+	if err := json.Unmarshal(dat, &n.state); err != nil {
+		return errors.Wrap(err, "invalid gossip state "+n.statePath)
+	}
+	if n.state.Entries == nil {
+		n.state.Entries = map[string]entry{}
+	}
+	if n.state.Local == nil {
+		n.state.Local = map[string]json.RawMessage{}
+	}
+	return nil
+}
+
+// save writes the state, the node lock must be held
+func (n *Node) save() error {
+	dat, err := json.Marshal(n.state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(n.statePath), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(n.statePath, dat, 0600)
+}
+
+// merge records the remote entries newer than the local ones
+func (n *Node) merge(remote map[string]entry) {
+	n.Lock()
+	defer n.Unlock()
+
+	changed := false
+	for k, e := range remote {
+		switch k {
+		case KeySystemRepositories, KeyPackageHolds:
+		default:
+			continue
+		}
+		if local, ok := n.state.Entries[k]; ok && !e.newerThan(local) {
+			continue
+		}
+		n.state.Entries[k] = e
+		changed = true
+	}
+	if changed {
+		n.save()
+	}
+}
+
+func (n *Node) decode(b []byte) {
+	remote := map[string]entry{}
+	if err := json.Unmarshal(b, &remote); err == nil {
+		n.merge(remote)
+	}
+}
+
+// NodeMeta implements memberlist.Delegate
+func (n *Node) NodeMeta(limit int) []byte { return []byte{} }
+
+// NotifyMsg implements memberlist.Delegate
+func (n *Node) NotifyMsg(b []byte) { n.decode(b) }
+
+// GetBroadcasts implements memberlist.Delegate
+func (n *Node) GetBroadcasts(overhead, limit int) [][]byte {
+	return n.broadcasts.GetBroadcasts(overhead, limit)
+}
+
+// LocalState implements memberlist.Delegate
+func (n *Node) LocalState(join bool) []byte {
+	n.Lock()
+	defer n.Unlock()
+	dat, _ := json.Marshal(n.state.Entries)
+	return dat
+}
+
+// MergeRemoteState implements memberlist.Delegate
+func (n *Node) MergeRemoteState(buf []byte, join bool) { n.decode(buf) }
@@ -0,0 +1,110 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package gossip_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/mudler/luet/pkg/api/core/gossip"
+	"github.com/mudler/luet/pkg/api/core/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const testKey = "MDEyMzQ1Njc4OWFiY2RlZg=="
+
+func newConfig(dir string) *types.LuetConfig {
+	c := &types.LuetConfig{}
+	c.General.GossipBindAddr = "127.0.0.1:0"
+	c.General.GossipSecretKey = testKey
+	c.System.DatabasePath = dir
+	return c
+}
+
+var _ = Describe("Gossip", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "gossip")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("requires a secret key", func() {
+		c := newConfig(dir)
+		c.General.GossipSecretKey = ""
+		_, err := New(c)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("propagates config changes to the peers", func() {
+		a := newConfig(filepath.Join(dir, "a"))
+		nodeA, err := New(a)
+		Expect(err).ToNot(HaveOccurred())
+		defer nodeA.Leave(time.Second)
+
+		b := newConfig(filepath.Join(dir, "b"))
+		b.General.GossipPeers = []string{nodeA.Address()}
+		nodeB, err := New(b)
+		Expect(err).ToNot(HaveOccurred())
+		defer nodeB.Leave(time.Second)
+
+		Expect(nodeA.SetPackageHolds([]string{"foo/*"})).ToNot(HaveOccurred())
+		Expect(nodeA.SetSystemRepositories(types.LuetRepositories{{Name: "main", Enable: true}})).ToNot(HaveOccurred())
+
+		Eventually(func() []string { return nodeB.State().PackageHolds }, 10*time.Second).Should(Equal([]string{"foo/*"}))
+		Eventually(func() int { return len(nodeB.State().SystemRepositories) }, 10*time.Second).Should(Equal(1))
+
+		// Last write wins
+		Expect(nodeB.SetPackageHolds([]string{"bar/*"})).ToNot(HaveOccurred())
+		Eventually(func() []string { return nodeA.State().PackageHolds }, 10*time.Second).Should(Equal([]string{"bar/*"}))
+	})
+
+	It("publishes the local changes on start and applies the received ones", func() {
+		a := newConfig(filepath.Join(dir, "a"))
+		nodeA, err := New(a)
+		Expect(err).ToNot(HaveOccurred())
+		defer nodeA.Leave(time.Second)
+
+		// b was changed locally since its last run
+		b := newConfig(filepath.Join(dir, "b"))
+		b.PackageHolds = []string{"foo/*"}
+		b.General.GossipPeers = []string{nodeA.Address()}
+		nodeB, err := New(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b.IsHeld(&types.Package{Category: "foo", Name: "bar"})).To(BeTrue())
+		Eventually(func() []string { return nodeA.State().PackageHolds }, 10*time.Second).Should(Equal([]string{"foo/*"}))
+		nodeB.Leave(time.Second)
+
+		// The values received from the peers are applied on the next run,
+		// the unchanged local config doesn't override them
+		Expect(nodeA.SetPackageHolds([]string{"bar/*"})).ToNot(HaveOccurred())
+		b = newConfig(filepath.Join(dir, "b"))
+		b.PackageHolds = []string{"foo/*"}
+		b.General.GossipPeers = []string{nodeA.Address()}
+		nodeB, err = New(b)
+		Expect(err).ToNot(HaveOccurred())
+		defer nodeB.Leave(time.Second)
+		Expect(b.PackageHolds).To(Equal([]string{"bar/*"}))
+	})
+})
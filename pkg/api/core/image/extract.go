@@ -17,7 +17,6 @@ package image
 
 import (
 	"archive/tar"
-	"context"
 	"io"
 	"os"
 	"path/filepath"
@@ -196,10 +195,13 @@ func ExtractReader(ctx types.Context, reader io.ReadCloser, output string, filte
 		filter = func(h *tar.Header) (bool, error) { return true, nil }
 	}
 
-	opts = append(opts, containerdarchive.WithFilter(filter))
+	e, err := systemExtractor(ctx.GetConfig().System, opts...)
+	if err != nil {
+		return 0, "", err
+	}
 
 	// Handle the extraction
-	c, err := containerdarchive.Apply(context.Background(), output, reader, opts...)
+	c, err := e.Extract(ctx.GetConfig().General.GetParentContext(), reader, output, filter)
 	if err != nil {
 		return 0, "", err
 	}
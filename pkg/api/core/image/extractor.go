@@ -0,0 +1,174 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package image
+
+import (
+	"archive/tar"
+	gocontext "context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	containerdarchive "github.com/containerd/containerd/archive"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pkg/errors"
+)
+
+// Extractor unpacks a tar stream into output, skipping the entries
+// rejected by filter. It returns the size of the extracted content.
+type Extractor interface {
+	Extract(ctx gocontext.Context, reader io.Reader, output string, filter func(h *tar.Header) (bool, error)) (int64, error)
+}
+
+// extractors are the available backends. The containerd options
+// are supported by the go one only.
+var extractors = map[string]func(opts []containerdarchive.ApplyOpt) Extractor{
+	types.ExtractorGo:     func(opts []containerdarchive.ApplyOpt) Extractor { return goExtractor{opts: opts} },
+	types.ExtractorBsdtar: func([]containerdarchive.ApplyOpt) Extractor { return bsdtarExtractor{} },
+}
+
+// NewExtractor returns the extractor of the backend, go if empty
+func NewExtractor(backend string, opts ...containerdarchive.ApplyOpt) (Extractor, error) {
+	if backend == "" {
+		backend = types.ExtractorGo
+	}
+	e, ok := extractors[backend]
+	if !ok {
+		return nil, fmt.Errorf("extractor backend '%s' is not available in this build", backend)
+	}
+	if backend != types.ExtractorGo && len(opts) > 0 {
+		return nil, fmt.Errorf("extractor backend '%s' doesn't support extraction options", backend)
+	}
+	return e(opts), nil
+}
+
+// newParallelExtractor is set by the builds supporting the parallel extraction
+var newParallelExtractor func(workers int) Extractor
+
+// NewParallelExtractor returns the go extractor writing the files of
+// the stream with the given number of workers
+func NewParallelExtractor(workers int) (Extractor, error) {
+	if newParallelExtractor == nil {
+		return nil, errors.New("parallel extraction is not available in this build")
+	}
+	return newParallelExtractor(workers), nil
+}
+
+// systemExtractor returns the extractor of the system config. The go
+// backend writes the files in parallel unless UnpackParallelism is 1
+// or containerd options are given.
+func systemExtractor(s types.LuetSystemConfig, opts ...containerdarchive.ApplyOpt) (Extractor, error) {
+	backend := s.ExtractorBackend
+	if (backend == "" || backend == types.ExtractorGo) && len(opts) == 0 && s.GetUnpackParallelism() > 1 {
+		if e, err := NewParallelExtractor(s.GetUnpackParallelism()); err == nil {
+			return e, nil
+		}
+	}
+	return NewExtractor(backend, opts...)
+}
+
+// goExtractor uses the containerd archive package
+type goExtractor struct {
+	opts []containerdarchive.ApplyOpt
+}
+
+func (e goExtractor) Extract(ctx gocontext.Context, reader io.Reader, output string, filter func(h *tar.Header) (bool, error)) (int64, error) {
+	if err := os.MkdirAll(output, os.ModePerm); err != nil {
+		return 0, err
+	}
+	opts := append(e.opts, containerdarchive.WithFilter(filter))
+	return containerdarchive.Apply(ctx, output, reader, opts...)
+}
+
+// tarFilter rewrites a tar stream keeping only the entries accepted by
+// the filter, for the backends which can't apply it themselves. As with
+// containerd, the names are cleaned before filtering and the filter can
+// modify the headers.
+type tarFilter struct {
+	*io.PipeReader
+	size int64
+	err  error
+	done chan struct{}
+}
+
+func newTarFilter(ctx gocontext.Context, reader io.Reader, filter func(h *tar.Header) (bool, error)) *tarFilter {
+	pr, pw := io.Pipe()
+	f := &tarFilter{PipeReader: pr, done: make(chan struct{})}
+	go func() {
+		defer close(f.done)
+		f.err = f.copy(ctx, reader, pw, filter)
+		if f.err != nil {
+			pw.CloseWithError(f.err)
+		} else {
+			pw.Close()
+		}
+	}()
+	return f
+}
+
+func (f *tarFilter) copy(ctx gocontext.Context, reader io.Reader, w io.Writer, filter func(h *tar.Header) (bool, error)) error {
+	tr := tar.NewReader(reader)
+	tw := tar.NewWriter(w)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return tw.Close()
+		}
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = path.Clean(hdr.Name)
+		if ok, err := filter(hdr); err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		if unsafeTarPath(hdr.Name) || (hdr.Typeflag == tar.TypeLink && unsafeTarPath(hdr.Linkname)) {
+			return fmt.Errorf("refusing to extract '%s' outside of the destination", hdr.Name)
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		n, err := io.Copy(tw, tr)
+		if err != nil {
+			return err
+		}
+		f.size += n
+	}
+}
+
+func unsafeTarPath(p string) bool {
+	p = path.Clean(strings.TrimPrefix(p, "/"))
+	return p == ".." || strings.HasPrefix(p, "../")
+}
+
+// wait stops the filter and returns the size of the entries written,
+// and the error met while filtering
+func (f *tarFilter) wait() (int64, error) {
+	f.Close()
+	<-f.done
+	if f.err != nil && !errors.Is(f.err, io.ErrClosedPipe) {
+		return f.size, f.err
+	}
+	return f.size, nil
+}
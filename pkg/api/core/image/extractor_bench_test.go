@@ -0,0 +1,85 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package image_test
+
+import (
+	"archive/tar"
+	"bytes"
+	gocontext "context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/mudler/luet/pkg/api/core/image"
+	"github.com/mudler/luet/pkg/api/core/types"
+)
+
+// BenchmarkExtract compares the go extractor with the parallel one on a
+// package with many small files:
+// go test -run=^$ -bench=Extract ./pkg/api/core/image/
+func BenchmarkExtract(b *testing.B) {
+	tmpdir, err := os.MkdirTemp("", "bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	data := make([]byte, 4*1024)
+	for i := 0; i < 20000; i++ {
+		h := &tar.Header{Name: fmt.Sprintf("usr/share/%d/%d", i%100, i), Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(h); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		b.Fatal(err)
+	}
+
+	goExtractor, err := NewExtractor(types.ExtractorGo)
+	if err != nil {
+		b.Fatal(err)
+	}
+	extractors := map[string]Extractor{"go": goExtractor}
+	for _, workers := range []int{2, 4, 8} {
+		e, err := NewParallelExtractor(workers)
+		if err != nil {
+			b.Skip(err.Error())
+		}
+		extractors[fmt.Sprintf("parallel-%d", workers)] = e
+	}
+
+	all := func(h *tar.Header) (bool, error) { return true, nil }
+	for _, name := range []string{"go", "parallel-2", "parallel-4", "parallel-8"} {
+		e := extractors[name]
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				dst := filepath.Join(tmpdir, "rootfs", fmt.Sprint(i))
+				if _, err := e.Extract(gocontext.Background(), bytes.NewReader(buf.Bytes()), dst, all); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				os.RemoveAll(dst)
+				b.StartTimer()
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package image
+
+import (
+	"archive/tar"
+	gocontext "context"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// bsdtarExtractor pipes the filtered stream to the bsdtar binary
+type bsdtarExtractor struct{}
+
+func (bsdtarExtractor) Extract(ctx gocontext.Context, reader io.Reader, output string, filter func(h *tar.Header) (bool, error)) (int64, error) {
+	if err := os.MkdirAll(output, os.ModePerm); err != nil {
+		return 0, err
+	}
+
+	f := newTarFilter(ctx, reader, filter)
+	cmd := exec.CommandContext(ctx, "bsdtar", "-x", "-p", "--numeric-owner", "-f", "-", "-C", output)
+	cmd.Stdin = f
+	out, err := cmd.CombinedOutput()
+
+	size, ferr := f.wait()
+	if ferr != nil {
+		return size, ferr
+	}
+	if err != nil {
+		return size, errors.Wrapf(err, "bsdtar failed: %s", string(out))
+	}
+	return size, nil
+}
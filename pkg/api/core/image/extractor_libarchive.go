@@ -0,0 +1,168 @@
+//go:build libarchive && cgo
+
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package image
+
+/*
+#cgo pkg-config: libarchive
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <archive.h>
+#include <archive_entry.h>
+
+static char *luet_error(struct archive *a) {
+	const char *s = archive_error_string(a);
+	return strdup(s != NULL ? s : "unknown libarchive error");
+}
+
+static char *luet_prefix(const char *dest, const char *p) {
+	size_t n = strlen(dest) + strlen(p) + 2;
+	char *s = malloc(n);
+	snprintf(s, n, "%s/%s", dest, p);
+	return s;
+}
+
+static int luet_copy_data(struct archive *in, struct archive *out) {
+	const void *buf;
+	size_t size;
+	la_int64_t offset;
+	int r;
+
+	for (;;) {
+		r = archive_read_data_block(in, &buf, &size, &offset);
+		if (r == ARCHIVE_EOF)
+			return ARCHIVE_OK;
+		if (r < ARCHIVE_OK)
+			return r;
+		r = archive_write_data_block(out, buf, size, offset);
+		if (r < ARCHIVE_OK)
+			return r;
+	}
+}
+
+// luet_extract extracts the tar stream read from fd into dest.
+// It returns NULL, or an error message to be freed.
+static char *luet_extract(int fd, const char *dest) {
+	struct archive *in = archive_read_new();
+	struct archive *out = archive_write_disk_new();
+	struct archive_entry *entry;
+	char *err = NULL;
+	char *p;
+	int r;
+
+	archive_read_support_format_tar(in);
+	archive_write_disk_set_options(out,
+		ARCHIVE_EXTRACT_TIME | ARCHIVE_EXTRACT_PERM | ARCHIVE_EXTRACT_OWNER |
+		ARCHIVE_EXTRACT_XATTR | ARCHIVE_EXTRACT_SECURE_NODOTDOT |
+		ARCHIVE_EXTRACT_SECURE_SYMLINKS);
+
+	if (archive_read_open_fd(in, fd, 10240) != ARCHIVE_OK) {
+		err = luet_error(in);
+		goto done;
+	}
+
+	for (;;) {
+		r = archive_read_next_header(in, &entry);
+		if (r == ARCHIVE_EOF)
+			break;
+		if (r < ARCHIVE_WARN) {
+			err = luet_error(in);
+			goto done;
+		}
+
+		p = luet_prefix(dest, archive_entry_pathname(entry));
+		archive_entry_copy_pathname(entry, p);
+		free(p);
+		if (archive_entry_hardlink(entry) != NULL) {
+			p = luet_prefix(dest, archive_entry_hardlink(entry));
+			archive_entry_copy_hardlink(entry, p);
+			free(p);
+		}
+
+		r = archive_write_header(out, entry);
+		if (r >= ARCHIVE_OK && archive_entry_size(entry) > 0)
+			r = luet_copy_data(in, out);
+		if (r >= ARCHIVE_WARN)
+			r = archive_write_finish_entry(out);
+		if (r < ARCHIVE_WARN) {
+			err = luet_error(out);
+			goto done;
+		}
+	}
+
+done:
+	archive_read_free(in);
+	archive_write_free(out);
+	return err;
+}
+*/
+import "C"
+
+import (
+	"archive/tar"
+	gocontext "context"
+	"errors"
+	"io"
+	"os"
+	"unsafe"
+
+	containerdarchive "github.com/containerd/containerd/archive"
+	"github.com/mudler/luet/pkg/api/core/types"
+)
+
+func init() {
+	extractors[types.ExtractorLibarchive] = func([]containerdarchive.ApplyOpt) Extractor { return libarchiveExtractor{} }
+}
+
+// libarchiveExtractor extracts the filtered stream with libarchive, fed through a pipe
+type libarchiveExtractor struct{}
+
+func (libarchiveExtractor) Extract(ctx gocontext.Context, reader io.Reader, output string, filter func(h *tar.Header) (bool, error)) (int64, error) {
+	if err := os.MkdirAll(output, os.ModePerm); err != nil {
+		return 0, err
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+
+	f := newTarFilter(ctx, reader, filter)
+	go func() {
+		io.Copy(w, f)
+		w.Close()
+	}()
+
+	dest := C.CString(output)
+	defer C.free(unsafe.Pointer(dest))
+	cerr := C.luet_extract(C.int(r.Fd()), dest)
+	r.Close()
+
+	size, ferr := f.wait()
+	if ferr != nil {
+		if cerr != nil {
+			C.free(unsafe.Pointer(cerr))
+		}
+		return size, ferr
+	}
+	if cerr != nil {
+		defer C.free(unsafe.Pointer(cerr))
+		return size, errors.New("libarchive: " + C.GoString(cerr))
+	}
+	return size, nil
+}
@@ -0,0 +1,392 @@
+//go:build linux
+
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	gocontext "context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/continuity/fs"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	whiteoutPrefix    = ".wh."
+	whiteoutOpaqueDir = whiteoutPrefix + whiteoutPrefix + ".opq"
+
+	// parallelMaxBuffered is the size of the biggest file handed to the
+	// workers, bigger ones are written while reading the stream
+	parallelMaxBuffered = 4 * 1024 * 1024
+
+	paxSchilyXattr = "SCHILY.xattr."
+)
+
+func init() {
+	newParallelExtractor = func(workers int) Extractor { return parallelExtractor{workers: workers} }
+}
+
+// parallelExtractor extracts the stream as the containerd archive package
+// does, but the regular files are written by a pool of workers
+type parallelExtractor struct {
+	workers int
+}
+
+// parallelExtraction is the state of an extraction. The path index
+// tracks the files being written by the workers, so the entries touching
+// the same paths wait for them, and the unpacked paths for the whiteouts.
+type parallelExtraction struct {
+	sync.Mutex
+	root     string
+	g        *errgroup.Group
+	pending  map[string]chan struct{}
+	unpacked map[string]struct{}
+}
+
+func (e parallelExtractor) Extract(ctx gocontext.Context, reader io.Reader, output string, filter func(h *tar.Header) (bool, error)) (int64, error) {
+	if err := os.MkdirAll(output, os.ModePerm); err != nil {
+		return 0, err
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(e.workers)
+	x := &parallelExtraction{
+		root:     filepath.Clean(output),
+		g:        g,
+		pending:  map[string]chan struct{}{},
+		unpacked: map[string]struct{}{},
+	}
+
+	size, dirs, err := x.read(gctx, reader, filter)
+	// The workers errors cancel the read, they come first
+	if werr := g.Wait(); werr != nil {
+		err = werr
+	}
+	if err != nil {
+		return size, err
+	}
+
+	// Directory mtimes are set at the end, the files created in them change it
+	for _, hdr := range dirs {
+		path, err := fs.RootPath(x.root, hdr.Name)
+		if err != nil {
+			return size, err
+		}
+		if err := chtimes(path, hdr); err != nil {
+			return size, err
+		}
+	}
+	return size, nil
+}
+
+func (x *parallelExtraction) read(ctx gocontext.Context, reader io.Reader, filter func(h *tar.Header) (bool, error)) (int64, []*tar.Header, error) {
+	var size int64
+	var dirs []*tar.Header
+
+	tr := tar.NewReader(reader)
+	for {
+		if err := ctx.Err(); err != nil {
+			return size, dirs, err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return size, dirs, nil
+		}
+		if err != nil {
+			return size, dirs, err
+		}
+		size += hdr.Size
+
+		hdr.Name = filepath.Clean(hdr.Name)
+		if ok, err := filter(hdr); err != nil {
+			return size, dirs, err
+		} else if !ok || hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		// Resolve the symlinks of the parent in the root
+		ppath, base := filepath.Split(hdr.Name)
+		ppath, err = fs.RootPath(x.root, ppath)
+		if err != nil {
+			return size, dirs, errors.Wrap(err, "failed to get root path")
+		}
+		path := filepath.Join(ppath, filepath.Join("/", base))
+		if path == x.root {
+			continue
+		}
+		if ppath != x.root {
+			parent := ppath
+			if base == "" {
+				parent = filepath.Dir(path)
+			}
+			if err := os.MkdirAll(parent, 0755); err != nil {
+				return size, dirs, err
+			}
+		}
+
+		if ok, err := x.whiteout(path); err != nil {
+			return size, dirs, errors.Wrapf(err, "failed to convert whiteout file %q", hdr.Name)
+		} else if !ok {
+			continue
+		}
+
+		// Replace what's there, unless both are directories
+		x.wait(path)
+		if fi, err := os.Lstat(path); err == nil && !(fi.IsDir() && hdr.Typeflag == tar.TypeDir) {
+			if fi.IsDir() {
+				x.waitAll()
+			}
+			if err := os.RemoveAll(path); err != nil {
+				return size, dirs, err
+			}
+		}
+
+		if hdr.Typeflag == tar.TypeReg && hdr.Size <= parallelMaxBuffered {
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return size, dirs, err
+			}
+			done := x.start(path)
+			x.g.Go(func() error {
+				defer done()
+				return createTarFile(path, x.root, hdr, bytes.NewReader(data))
+			})
+			continue
+		}
+
+		if hdr.Typeflag == tar.TypeLink {
+			if target, err := hardlinkRootPath(x.root, hdr.Linkname); err == nil {
+				x.wait(target)
+			}
+		}
+		if err := createTarFile(path, x.root, hdr, tr); err != nil {
+			return size, dirs, err
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			dirs = append(dirs, hdr)
+		}
+		x.markUnpacked(path)
+	}
+}
+
+// start marks path as being written, the returned function must
+// be called once done
+func (x *parallelExtraction) start(path string) func() {
+	ch := make(chan struct{})
+	x.Lock()
+	x.pending[path] = ch
+	x.unpacked[path] = struct{}{}
+	x.Unlock()
+	return func() {
+		x.Lock()
+		if x.pending[path] == ch {
+			delete(x.pending, path)
+		}
+		x.Unlock()
+		close(ch)
+	}
+}
+
+// wait blocks until path is written
+func (x *parallelExtraction) wait(path string) {
+	x.Lock()
+	ch := x.pending[path]
+	x.Unlock()
+	if ch != nil {
+		<-ch
+	}
+}
+
+// waitAll blocks until all the pending files are written
+func (x *parallelExtraction) waitAll() {
+	x.Lock()
+	chans := []chan struct{}{}
+	for _, ch := range x.pending {
+		chans = append(chans, ch)
+	}
+	x.Unlock()
+	for _, ch := range chans {
+		<-ch
+	}
+}
+
+func (x *parallelExtraction) markUnpacked(path string) {
+	x.Lock()
+	defer x.Unlock()
+	x.unpacked[path] = struct{}{}
+}
+
+func (x *parallelExtraction) isUnpacked(path string) bool {
+	x.Lock()
+	defer x.Unlock()
+	_, ok := x.unpacked[path]
+	return ok
+}
+
+// whiteout removes the files hidden by the whiteout entries,
+// it returns false if the entry must not be extracted
+func (x *parallelExtraction) whiteout(path string) (bool, error) {
+	base := filepath.Base(path)
+	dir := filepath.Dir(path)
+
+	switch {
+	case base == whiteoutOpaqueDir:
+		x.waitAll()
+		if _, err := os.Lstat(dir); err != nil {
+			return false, err
+		}
+		return false, filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					err = nil // parent was deleted
+				}
+				return err
+			}
+			if p == dir || x.isUnpacked(p) {
+				return nil
+			}
+			return os.RemoveAll(p)
+		})
+	case strings.HasPrefix(base, whiteoutPrefix):
+		original := filepath.Join(dir, base[len(whiteoutPrefix):])
+		if filepath.Dir(original) != dir {
+			return false, fmt.Errorf("invalid whiteout name: %v", base)
+		}
+		x.waitAll()
+		return false, os.RemoveAll(original)
+	}
+	return true, nil
+}
+
+func hardlinkRootPath(root, linkname string) (string, error) {
+	ppath, base := filepath.Split(linkname)
+	ppath, err := fs.RootPath(root, ppath)
+	if err != nil {
+		return "", err
+	}
+
+	target := filepath.Join(ppath, base)
+	if !strings.HasPrefix(target, root) {
+		target = root
+	}
+	return target, nil
+}
+
+// createTarFile creates path from the entry and applies its metadata
+func createTarFile(path, root string, hdr *tar.Header, reader io.Reader) error {
+	mode := hdr.FileInfo().Mode()
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if fi, err := os.Lstat(path); !(err == nil && fi.IsDir()) {
+			if err := os.Mkdir(path, mode); err != nil {
+				return err
+			}
+		}
+	case tar.TypeReg:
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, reader)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	case tar.TypeBlock, tar.TypeChar, tar.TypeFifo:
+		m := uint32(hdr.Mode & 07777)
+		switch hdr.Typeflag {
+		case tar.TypeBlock:
+			m |= unix.S_IFBLK
+		case tar.TypeChar:
+			m |= unix.S_IFCHR
+		case tar.TypeFifo:
+			m |= unix.S_IFIFO
+		}
+		if err := unix.Mknod(path, m, int(unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor)))); err != nil {
+			return err
+		}
+	case tar.TypeLink:
+		target, err := hardlinkRootPath(root, hdr.Linkname)
+		if err != nil {
+			return err
+		}
+		if err := os.Link(target, path); err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		if err := os.Symlink(hdr.Linkname, path); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unhandled tar header type %d", hdr.Typeflag)
+	}
+
+	if err := os.Lchown(path, hdr.Uid, hdr.Gid); err != nil {
+		return errors.Wrapf(err, "failed to Lchown %q for UID %d, GID %d", path, hdr.Uid, hdr.Gid)
+	}
+
+	for key, value := range hdr.PAXRecords {
+		if !strings.HasPrefix(key, paxSchilyXattr) {
+			continue
+		}
+		key = key[len(paxSchilyXattr):]
+		if err := unix.Lsetxattr(path, key, []byte(value), 0); err != nil {
+			if errors.Is(err, unix.ENOTSUP) || (errors.Is(err, unix.EPERM) && hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeDir) {
+				continue
+			}
+			return errors.Wrapf(err, "failed to setxattr %q for key %q", path, key)
+		}
+	}
+
+	// chmod after chown, which can change the mode
+	if hdr.Typeflag != tar.TypeSymlink {
+		if err := os.Chmod(path, mode); err != nil {
+			return err
+		}
+	}
+	return chtimes(path, hdr)
+}
+
+func chtimes(path string, hdr *tar.Header) error {
+	atime := hdr.AccessTime
+	if atime.Before(hdr.ModTime) {
+		atime = hdr.ModTime
+	}
+	ts := []unix.Timespec{timespec(atime), timespec(hdr.ModTime)}
+	return unix.UtimesNanoAt(unix.AT_FDCWD, path, ts, unix.AT_SYMLINK_NOFOLLOW)
+}
+
+// timespec bounds t to the times supported by the syscall, as containerd does
+func timespec(t time.Time) unix.Timespec {
+	if t.Before(time.Unix(0, 0)) || t.After(time.Unix(0, 1<<63-1)) {
+		t = time.Unix(0, 0)
+	}
+	return unix.NsecToTimespec(t.UnixNano())
+}
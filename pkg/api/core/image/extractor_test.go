@@ -0,0 +1,181 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package image_test
+
+import (
+	"archive/tar"
+	"bytes"
+	gocontext "context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	. "github.com/mudler/luet/pkg/api/core/image"
+	"github.com/mudler/luet/pkg/api/core/types"
+)
+
+func tarStream(files map[string]string) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, name := range []string{"etc/a", "etc/b", "../evil"} {
+		content, ok := files[name]
+		if !ok {
+			continue
+		}
+		Expect(tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})).To(Succeed())
+		_, err := tw.Write([]byte(content))
+		Expect(err).ToNot(HaveOccurred())
+	}
+	Expect(tw.Close()).To(Succeed())
+	return buf
+}
+
+var _ = Describe("Extractor", func() {
+	var dir, path string
+
+	BeforeEach(func() {
+		path = os.Getenv("PATH")
+		var err error
+		dir, err = ioutil.TempDir("", "extractor")
+		Expect(err).ToNot(HaveOccurred())
+
+		// bsdtar is faked with tar, which takes the same arguments
+		tarPath, err := exec.LookPath("tar")
+		if err == nil {
+			Expect(os.Symlink(tarPath, filepath.Join(dir, "bsdtar"))).To(Succeed())
+			os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+		}
+	})
+
+	AfterEach(func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	})
+
+	filter := func(h *tar.Header) (bool, error) {
+		if h.Name == "etc/b" {
+			return false, nil
+		}
+		h.Name = "usr/" + h.Name
+		return true, nil
+	}
+
+	for _, backend := range []string{types.ExtractorGo, types.ExtractorBsdtar} {
+		backend := backend
+		It("extracts with the "+backend+" backend", func() {
+			if _, err := exec.LookPath(backend); backend == types.ExtractorBsdtar && err != nil {
+				Skip("tar not available")
+			}
+			e, err := NewExtractor(backend)
+			Expect(err).ToNot(HaveOccurred())
+
+			out := filepath.Join(dir, "out")
+			_, err = e.Extract(gocontext.Background(), tarStream(map[string]string{"etc/a": "a", "etc/b": "b"}), out, filter)
+			Expect(err).ToNot(HaveOccurred())
+
+			data, err := ioutil.ReadFile(filepath.Join(out, "usr", "etc", "a"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal("a"))
+			Expect(filepath.Join(out, "usr", "etc", "b")).ToNot(BeAnExistingFile())
+			Expect(filepath.Join(out, "etc")).ToNot(BeADirectory())
+		})
+	}
+
+	It("refuses paths outside of the destination", func() {
+		if _, err := exec.LookPath("bsdtar"); err != nil {
+			Skip("tar not available")
+		}
+		e, err := NewExtractor(types.ExtractorBsdtar)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = e.Extract(gocontext.Background(), tarStream(map[string]string{"../evil": "x"}), filepath.Join(dir, "out"), func(h *tar.Header) (bool, error) { return true, nil })
+		Expect(err).To(HaveOccurred())
+		Expect(filepath.Join(dir, "evil")).ToNot(BeAnExistingFile())
+	})
+
+	It("extracts in parallel as the go backend", func() {
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		write := func(h *tar.Header, content string) {
+			h.Size = int64(len(content))
+			Expect(tw.WriteHeader(h)).To(Succeed())
+			_, err := tw.Write([]byte(content))
+			Expect(err).ToNot(HaveOccurred())
+		}
+		write(&tar.Header{Name: "usr/lib", Mode: 0750, Typeflag: tar.TypeDir}, "")
+		for i := 0; i < 100; i++ {
+			write(&tar.Header{Name: fmt.Sprintf("usr/lib/%d", i), Mode: 0640, Typeflag: tar.TypeReg}, fmt.Sprint(i))
+		}
+		write(&tar.Header{Name: "lib", Linkname: "usr/lib", Mode: 0777, Typeflag: tar.TypeSymlink}, "")
+		write(&tar.Header{Name: "lib/extra", Mode: 0600, Typeflag: tar.TypeReg}, "extra")
+		write(&tar.Header{Name: "usr/lib/1", Mode: 0600, Typeflag: tar.TypeReg}, "replaced")
+		write(&tar.Header{Name: "usr/bin/two", Linkname: "usr/lib/2", Mode: 0640, Typeflag: tar.TypeLink}, "")
+		Expect(tw.Close()).To(Succeed())
+
+		all := func(h *tar.Header) (bool, error) { return true, nil }
+		snapshot := func(root string) map[string]string {
+			res := map[string]string{}
+			Expect(filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+				Expect(err).ToNot(HaveOccurred())
+				rel, _ := filepath.Rel(root, p)
+				res[rel] = info.Mode().String()
+				if info.Mode().IsRegular() {
+					data, err := ioutil.ReadFile(p)
+					Expect(err).ToNot(HaveOccurred())
+					res[rel] += " " + string(data)
+				}
+				return nil
+			})).To(Succeed())
+			return res
+		}
+
+		e, err := NewExtractor(types.ExtractorGo)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = e.Extract(gocontext.Background(), bytes.NewReader(buf.Bytes()), filepath.Join(dir, "go"), all)
+		Expect(err).ToNot(HaveOccurred())
+
+		p, err := NewParallelExtractor(4)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = p.Extract(gocontext.Background(), bytes.NewReader(buf.Bytes()), filepath.Join(dir, "parallel"), all)
+		Expect(err).ToNot(HaveOccurred())
+
+		extracted := snapshot(filepath.Join(dir, "parallel"))
+		Expect(extracted).To(Equal(snapshot(filepath.Join(dir, "go"))))
+		Expect(extracted).To(HaveKeyWithValue("usr/lib/1", "-rw------- replaced"))
+		Expect(extracted).To(HaveKeyWithValue("usr/lib/extra", "-rw------- extra"))
+		Expect(extracted).To(HaveKeyWithValue("usr/bin/two", "-rw-r----- 2"))
+	})
+
+	It("is selected by the system config", func() {
+		_, err := NewExtractor("unknown")
+		Expect(err).To(HaveOccurred())
+
+		ctx := context.NewContext()
+		ctx.Config.System.ExtractorBackend = types.ExtractorBsdtar
+		_, err = NewExtractor(ctx.Config.System.ExtractorBackend, nil)
+		Expect(err).To(HaveOccurred())
+
+		out := filepath.Join(dir, "config")
+		_, _, err = ExtractReader(ctx, ioutil.NopCloser(tarStream(map[string]string{"etc/a": "a"})), out, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(filepath.Join(out, "etc", "a")).To(BeARegularFile())
+	})
+})
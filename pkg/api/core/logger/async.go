@@ -0,0 +1,81 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package logger
+
+import "sync"
+
+// DefaultAsyncBufferSize is the number of log entries buffered
+// when async logging is enabled
+const DefaultAsyncBufferSize = 1024
+
+// asyncQueue is a bounded queue of log writes drained by a background goroutine
+type asyncQueue struct {
+	sync.Mutex
+	entries chan func()
+	done    chan struct{}
+	closed  bool
+}
+
+func newAsyncQueue(size int) *asyncQueue {
+	if size <= 0 {
+		size = DefaultAsyncBufferSize
+	}
+	q := &asyncQueue{
+		entries: make(chan func(), size),
+		done:    make(chan struct{}),
+	}
+	go q.drain()
+	return q
+}
+
+func (q *asyncQueue) drain() {
+	for f := range q.entries {
+		f()
+	}
+	close(q.done)
+}
+
+// push enqueues a write, blocking if the buffer is full.
+// Once the queue is flushed, writes are performed synchronously.
+func (q *asyncQueue) push(f func()) {
+	q.Lock()
+	defer q.Unlock()
+	if q.closed {
+		f()
+		return
+	}
+	q.entries <- f
+}
+
+// flush stops accepting entries and waits for the pending ones to be written
+func (q *asyncQueue) flush() {
+	q.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.entries)
+	}
+	q.Unlock()
+	<-q.done
+}
+
+// WithAsync moves log writes to a background goroutine, buffering
+// up to size entries. Flush must be called before exiting.
+func WithAsync(size int) LoggerOptions {
+	return func(l *Logger) error {
+		l.async = newAsyncQueue(size)
+		return nil
+	}
+}
@@ -42,6 +42,7 @@ type Logger struct {
 	context     string
 	spinnerLock sync.Mutex
 	s           *pterm.SpinnerPrinter
+	async       *asyncQueue
 }
 
 // LogLevel represents a log severity level. Use the package variables as an
@@ -180,16 +181,32 @@ func (l *Logger) send(ll log.LogLevel, f string, args ...interface{}) {
 	sanitizedF := joinMsg(l.transform(f)...)
 	formatDefined := f != ""
 
+	// The caller has to be looked up before the write is possibly deferred
+	var debugArgs []interface{}
+	var debugF string
+	if log.LevelDebug == ll {
+		debugArgs = prefixCodeLine(sanitizedArgs)
+		debugF = joinMsg(prefixCodeLine(sanitizedF)...)
+	}
+
+	if l.async != nil {
+		l.async.push(func() { l.write(ll, formatDefined, sanitizedArgs, sanitizedF, debugArgs, debugF, args...) })
+		return
+	}
+	l.write(ll, formatDefined, sanitizedArgs, sanitizedF, debugArgs, debugF, args...)
+}
+
+func (l *Logger) write(ll log.LogLevel, formatDefined bool, sanitizedArgs, sanitizedF string, debugArgs []interface{}, debugF string, args ...interface{}) {
 	switch {
 	case log.LevelDebug == ll && !formatDefined:
-		pterm.Debug.Println(prefixCodeLine(sanitizedArgs)...)
+		pterm.Debug.Println(debugArgs...)
 		if l.logToFile {
-			l.fileLogger.Debug(joinMsg(prefixCodeLine(sanitizedArgs)...))
+			l.fileLogger.Debug(joinMsg(debugArgs...))
 		}
 	case log.LevelDebug == ll && formatDefined:
-		pterm.Debug.Printfln(joinMsg(prefixCodeLine(sanitizedF)...), args...)
+		pterm.Debug.Printfln(debugF, args...)
 		if l.logToFile {
-			l.fileLogger.Sugar().Debugf(joinMsg(prefixCodeLine(sanitizedF)...), args...)
+			l.fileLogger.Sugar().Debugf(debugF, args...)
 		}
 	case log.LevelError == ll && !formatDefined:
 		pterm.Error.Println(pterm.LightRed(sanitizedArgs))
@@ -255,9 +272,21 @@ func (l *Logger) Tracef(t string, args ...interface{}) {
 
 func (l *Logger) Fatal(args ...interface{}) {
 	l.send(log.LevelFatal, "", args...)
+	l.Flush()
 	os.Exit(2)
 }
 
+// Flush writes any buffered log entry. It must be called before
+// exiting when async logging is enabled.
+func (l *Logger) Flush() {
+	if l.async != nil {
+		l.async.flush()
+	}
+	if l.logToFile {
+		l.fileLogger.Sync()
+	}
+}
+
 func (l *Logger) Info(args ...interface{}) {
 	l.send(log.LevelInfo, "", args...)
 }
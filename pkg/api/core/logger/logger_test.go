@@ -19,6 +19,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/gookit/color"
 	. "github.com/mudler/luet/pkg/api/core/logger"
@@ -127,5 +128,26 @@ var _ = Describe("Context and logging", func() {
 			Expect(logs).To(ContainSubstring("foowarn"))
 			Expect(logs).To(ContainSubstring("foobar"))
 		})
+
+		It("does not lose async entries on flush", func() {
+			t, err := ioutil.TempFile("", "tree")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(t.Name()) // clean up
+
+			l, err := New(WithLevel("debug"), WithFileLogging(t.Name(), ""), WithAsync(8))
+			Expect(err).ToNot(HaveOccurred())
+
+			captureStdout(func(w io.Writer) {
+				for i := 0; i < 500; i++ {
+					l.Infof("entry %d", i)
+				}
+				l.Flush()
+			})
+
+			ll, err := ioutil.ReadFile(t.Name())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.Count(string(ll), "entry")).To(Equal(500))
+			Expect(string(ll)).To(ContainSubstring("entry 499"))
+		})
 	})
 })
@@ -27,6 +27,11 @@ func IsTerminal() bool {
 	return isatty.IsTerminal(os.Stdout.Fd())
 }
 
+// IsInputTerminal returns true if the input comes from a terminal
+func IsInputTerminal() bool {
+	return isatty.IsTerminal(os.Stdin.Fd())
+}
+
 // GetTerminalSize returns the width and the height of the active terminal.
 func GetTerminalSize() (width, height int, err error) {
 	w, h, err := term.GetSize(int(os.Stdout.Fd()))
@@ -0,0 +1,88 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefaultPort is the port the metrics server listens on if none is configured
+const DefaultPort = 9090
+
+var (
+	PackagesInstalled = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "luet_packages_installed_total",
+		Help: "Number of packages installed",
+	})
+	Downloads = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "luet_downloads_total",
+		Help: "Number of artifacts downloaded from repositories",
+	})
+	CacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "luet_cache_hits_total",
+		Help: "Number of artifacts found in the local cache",
+	})
+	SolverDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "luet_solver_duration_seconds",
+		Help:    "Time spent solving package formulas",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	// Registry holds the Go runtime metrics and the luet ones
+	Registry = prometheus.NewRegistry()
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		PackagesInstalled,
+		Downloads,
+		CacheHits,
+		SolverDuration,
+	)
+}
+
+// Serve exposes the metrics on /metrics at the given port.
+// The server runs in background until it is shut down.
+func Serve(port int) (*http.Server, error) {
+	if port == 0 {
+		port = DefaultPort
+	}
+
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(l)
+
+	return srv, nil
+}
+
+// Handler returns the HTTP handler exposing the metrics of the Registry
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
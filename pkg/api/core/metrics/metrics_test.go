@@ -0,0 +1,61 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package metrics_test
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+
+	dto "github.com/prometheus/client_model/go"
+
+	. "github.com/mudler/luet/pkg/api/core/metrics"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics", func() {
+	It("registers the luet metrics", func() {
+		PackagesInstalled.Inc()
+		Downloads.Inc()
+		CacheHits.Inc()
+		SolverDuration.Observe(0.1)
+
+		families, err := Registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+
+		types := map[string]dto.MetricType{}
+		for _, f := range families {
+			types[f.GetName()] = f.GetType()
+		}
+		Expect(types).To(HaveKeyWithValue("luet_packages_installed_total", dto.MetricType_COUNTER))
+		Expect(types).To(HaveKeyWithValue("luet_downloads_total", dto.MetricType_COUNTER))
+		Expect(types).To(HaveKeyWithValue("luet_cache_hits_total", dto.MetricType_COUNTER))
+		Expect(types).To(HaveKeyWithValue("luet_solver_duration_seconds", dto.MetricType_HISTOGRAM))
+		Expect(types).To(HaveKey("go_goroutines"))
+	})
+
+	It("exposes them over HTTP", func() {
+		srv := httptest.NewServer(Handler())
+		defer srv.Close()
+
+		resp, err := srv.Client().Get(srv.URL)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(ContainSubstring("# TYPE luet_packages_installed_total counter"))
+	})
+})
@@ -0,0 +1,56 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package tracing_test
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/mudler/luet/pkg/api/core/tracing"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ = Describe("Tracing", func() {
+	It("has no trace ID without a provider", func() {
+		ctx, span := Start(context.Background(), "noop")
+		defer span.End()
+		Expect(TraceID(ctx)).To(BeEmpty())
+	})
+
+	It("records spans and errors", func() {
+		recorder := tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		defer otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+		ctx, span := Start(context.Background(), "parent")
+		_, child := Start(ctx, "child")
+		End(child, errors.New("failure"))
+		End(span, nil)
+
+		Expect(TraceID(ctx)).To(HaveLen(32))
+		spans := recorder.Ended()
+		Expect(len(spans)).To(Equal(2))
+		Expect(spans[0].Name()).To(Equal("child"))
+		Expect(spans[0].Status().Code).To(Equal(codes.Error))
+		Expect(spans[0].Parent().TraceID().String()).To(Equal(TraceID(ctx)))
+		Expect(spans[1].Status().Code).To(Equal(codes.Unset))
+	})
+})
@@ -0,0 +1,193 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	version "github.com/mudler/luet/pkg/versioner"
+	"github.com/pkg/errors"
+)
+
+// Advisory is a known vulnerability affecting a package
+type Advisory struct {
+	ID       string `json:"id"`
+	Package  string `json:"package"`
+	Summary  string `json:"summary,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	Fixed    string `json:"fixed,omitempty"`
+}
+
+// osvVulnerability is the subset of the OSV schema luet understands.
+// Packages are matched by category/name, or by name only.
+type osvVulnerability struct {
+	ID       string `json:"id"`
+	Summary  string `json:"summary"`
+	Severity []struct {
+		Score string `json:"score"`
+	} `json:"severity"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+	Affected []struct {
+		Package struct {
+			Name string `json:"name"`
+		} `json:"package"`
+		Versions []string `json:"versions"`
+		Ranges   []struct {
+			Events []struct {
+				Introduced   string `json:"introduced"`
+				Fixed        string `json:"fixed"`
+				LastAffected string `json:"last_affected"`
+			} `json:"events"`
+		} `json:"ranges"`
+	} `json:"affected"`
+}
+
+func (v osvVulnerability) severity() string {
+	if v.DatabaseSpecific.Severity != "" {
+		return v.DatabaseSpecific.Severity
+	}
+	if len(v.Severity) > 0 {
+		return v.Severity[0].Score
+	}
+	return ""
+}
+
+// affects returns the advisory for p, if it is affected by the vulnerability
+func (v osvVulnerability) affects(p *Package) (Advisory, bool) {
+	versioner := version.DefaultVersioner()
+	for _, a := range v.Affected {
+		if a.Package.Name != p.GetCategory()+"/"+p.GetName() && a.Package.Name != p.GetName() {
+			continue
+		}
+		adv := Advisory{ID: v.ID, Package: p.HumanReadableString(), Summary: v.Summary, Severity: v.severity()}
+		for _, ver := range a.Versions {
+			if ver == p.GetVersion() {
+				return adv, true
+			}
+		}
+		// Events are ordered, each interval starts with an introduced event
+		for _, r := range a.Ranges {
+			in := false
+			for _, e := range r.Events {
+				switch {
+				case e.Introduced != "":
+					in = e.Introduced == "0" || versioner.ValidateSelector(p.GetVersion(), ">="+e.Introduced)
+				case e.Fixed != "":
+					if in && versioner.ValidateSelector(p.GetVersion(), "<"+e.Fixed) {
+						adv.Fixed = e.Fixed
+						return adv, true
+					}
+					in = false
+				case e.LastAffected != "":
+					if in && versioner.ValidateSelector(p.GetVersion(), "<="+e.LastAffected) {
+						return adv, true
+					}
+					in = false
+				}
+			}
+			if in {
+				return adv, true
+			}
+		}
+	}
+	return Advisory{}, false
+}
+
+func (c *LuetConfig) advisoryCachePath() string {
+	return filepath.Join(c.System.DatabasePath, "security_advisories.json")
+}
+
+// securityAdvisories returns the feed, fetching it if the local copy is
+// older than SecurityAdvisoryRefresh. The stale copy is used if the fetch fails.
+func (c *LuetConfig) securityAdvisories() ([]osvVulnerability, error) {
+	cache := c.advisoryCachePath()
+	fi, err := os.Stat(cache)
+	if err != nil || time.Since(fi.ModTime()) >= c.SecurityAdvisoryRefresh {
+		if ferr := c.fetchSecurityAdvisories(cache); ferr != nil && err != nil {
+			return nil, ferr
+		}
+	}
+
+	data, err := ioutil.ReadFile(cache)
+	if err != nil {
+		return nil, err
+	}
+
+	// Both plain lists and OSV query responses are accepted
+	feed := struct {
+		Vulns []osvVulnerability `json:"vulns"`
+	}{}
+	if err := json.Unmarshal(data, &feed.Vulns); err == nil {
+		return feed.Vulns, nil
+	}
+	if err := json.Unmarshal(data, &feed); err != nil {
+		return nil, errors.Wrap(err, "invalid security advisory feed")
+	}
+	return feed.Vulns, nil
+}
+
+func (c *LuetConfig) fetchSecurityAdvisories(dst string) error {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(c.SecurityAdvisoryDB)
+	if err != nil {
+		return errors.Wrap(err, "while fetching the security advisories")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("security advisory feed returned %d", resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "while fetching the security advisories")
+	}
+	tmp := dst + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// CheckSecurityAdvisories returns the advisories of SecurityAdvisoryDB
+// affecting the packages. It returns none if no feed is configured.
+func (c *LuetConfig) CheckSecurityAdvisories(pkgs Packages) ([]Advisory, error) {
+	if c.SecurityAdvisoryDB == "" || len(pkgs) == 0 {
+		return nil, nil
+	}
+
+	vulns, err := c.securityAdvisories()
+	if err != nil {
+		return nil, err
+	}
+
+	res := []Advisory{}
+	for _, p := range pkgs {
+		for _, v := range vulns {
+			if a, ok := v.affects(p); ok {
+				res = append(res, a)
+			}
+		}
+	}
+	return res, nil
+}
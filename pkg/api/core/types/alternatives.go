@@ -0,0 +1,65 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import "strings"
+
+// AlternativesAnnotation registers the alternatives provided by a package
+// as comma separated name:link:target entries, e.g.
+// python3:/usr/bin/python3:/usr/bin/python3.9
+const AlternativesAnnotation PackageAnnotation = "alternatives"
+
+// Alternative is a symlink Link to Target, selected among the
+// packages providing the alternative Name
+type Alternative struct {
+	Name, Link, Target string
+}
+
+// GetAlternatives returns the alternatives registered by the package,
+// malformed entries are skipped
+func (p *Package) GetAlternatives() []Alternative {
+	res := []Alternative{}
+	for _, e := range strings.Split(p.Annotations[AlternativesAnnotation], ",") {
+		f := strings.Split(strings.TrimSpace(e), ":")
+		if len(f) != 3 || f[0] == "" || f[1] == "" || f[2] == "" {
+			continue
+		}
+		res = append(res, Alternative{Name: f[0], Link: f[1], Target: f[2]})
+	}
+	return res
+}
+
+// IsPreferredAlternative returns true if the package is the preferred
+// provider of the alternative, or if there is no preference for it.
+// Selectors are package patterns in the category/name@version form.
+func (c *LuetConfig) IsPreferredAlternative(name string, p *Package) bool {
+	s, ok := c.AlternativeSelectors[name]
+	if !ok {
+		return true
+	}
+	b, err := parsePackagePattern(s)
+	return err == nil && b.match(p)
+}
+
+// MatchPackagePattern returns true if the package matches the
+// category/name@version pattern, where each component is a glob
+func MatchPackagePattern(pattern string, p *Package) (bool, error) {
+	b, err := parsePackagePattern(pattern)
+	if err != nil {
+		return false, err
+	}
+	return b.match(p), nil
+}
@@ -0,0 +1,79 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Annotation filter operators
+const (
+	AnnotationFilterEq       = "eq"
+	AnnotationFilterNe       = "ne"
+	AnnotationFilterContains = "contains"
+	AnnotationFilterRegex    = "regex"
+)
+
+// AnnotationFilter selects packages by the value of one of their annotations.
+// Op defaults to eq.
+type AnnotationFilter struct {
+	Key   string `yaml:"key" mapstructure:"key"`
+	Value string `yaml:"value" mapstructure:"value"`
+	Op    string `yaml:"op,omitempty" mapstructure:"op"`
+}
+
+// Validate checks the filter operator and expression
+func (f AnnotationFilter) Validate() error {
+	switch f.Op {
+	case "", AnnotationFilterEq, AnnotationFilterNe, AnnotationFilterContains:
+	case AnnotationFilterRegex:
+		if _, err := regexp.Compile(f.Value); err != nil {
+			return fmt.Errorf("invalid annotation filter regex '%s': %s", f.Value, err.Error())
+		}
+	default:
+		return fmt.Errorf("invalid annotation filter operator '%s'", f.Op)
+	}
+	return nil
+}
+
+// Match returns true if the package annotations satisfy the filter
+func (f AnnotationFilter) Match(p *Package) bool {
+	v := p.Annotations[PackageAnnotation(f.Key)]
+	switch f.Op {
+	case "", AnnotationFilterEq:
+		return v == f.Value
+	case AnnotationFilterNe:
+		return v != f.Value
+	case AnnotationFilterContains:
+		return strings.Contains(v, f.Value)
+	case AnnotationFilterRegex:
+		r, err := regexp.Compile(f.Value)
+		return err == nil && r.MatchString(v)
+	}
+	return false
+}
+
+// MatchAnnotationFilters returns true if the package satisfies all the AnnotationFilters
+func (c *LuetConfig) MatchAnnotationFilters(p *Package) bool {
+	for _, f := range c.AnnotationFilters {
+		if !f.Match(p) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+// InheritDefaultAnnotations adds the DefaultPackageAnnotations to the
+// packages. Annotations already set on a package take precedence.
+func (c *LuetConfig) InheritDefaultAnnotations(packs ...*Package) {
+	addMissingAnnotations(c.DefaultPackageAnnotations, packs...)
+}
+
+// AddMetadataExtras adds the PackageMetadataExtras to the packages
+// being installed, without overriding their annotations
+func (c *LuetConfig) AddMetadataExtras(packs ...*Package) {
+	addMissingAnnotations(c.PackageMetadataExtras, packs...)
+}
+
+func addMissingAnnotations(annotations map[string]string, packs ...*Package) {
+	for _, p := range packs {
+		if p == nil {
+			continue
+		}
+		for k, v := range annotations {
+			if _, ok := p.Annotations[PackageAnnotation(k)]; !ok {
+				p.AddAnnotation(k, v)
+			}
+		}
+	}
+}
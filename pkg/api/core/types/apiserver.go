@@ -0,0 +1,44 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import "fmt"
+
+// DefaultAPIServerAddr is the address the API server listens on if none is configured
+const DefaultAPIServerAddr = "127.0.0.1:9292"
+
+// LuetAPIServer exposes a JSON API to manage the system remotely
+type LuetAPIServer struct {
+	Enabled    bool   `yaml:"enabled,omitempty" mapstructure:"enabled"`
+	ListenAddr string `yaml:"listen_addr,omitempty" mapstructure:"listen_addr"`
+	// AuthToken is required as Bearer token by all the requests
+	AuthToken string `yaml:"auth_token,omitempty" mapstructure:"auth_token"`
+}
+
+// GetListenAddr returns the configured address or DefaultAPIServerAddr
+func (a LuetAPIServer) GetListenAddr() string {
+	if a.ListenAddr == "" {
+		return DefaultAPIServerAddr
+	}
+	return a.ListenAddr
+}
+
+func (a LuetAPIServer) validate() error {
+	if a.Enabled && a.AuthToken == "" {
+		return fmt.Errorf("api server requires an auth token")
+	}
+	return nil
+}
@@ -27,7 +27,6 @@ import (
 	"os"
 	"path"
 	"path/filepath"
-	"runtime"
 
 	"github.com/docker/docker/pkg/pools"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
@@ -37,7 +36,6 @@ import (
 	//"strconv"
 	"strings"
 
-	containerdCompression "github.com/containerd/containerd/archive/compression"
 	bus "github.com/mudler/luet/pkg/api/core/bus"
 	config "github.com/mudler/luet/pkg/api/core/config"
 	"github.com/mudler/luet/pkg/api/core/image"
@@ -64,6 +62,11 @@ type PackageArtifact struct {
 	Files             []string                        `json:"files"`
 	PackageCacheImage string                          `json:"package_cacheimage"`
 	Runtime           *types.Package                  `json:"runtime,omitempty"`
+
+	// Size is the size of the artifact archive, InstalledSize
+	// the size of its content once unpacked. Both are in bytes.
+	Size          int64 `json:"size,omitempty"`
+	InstalledSize int64 `json:"installed_size,omitempty"`
 }
 
 func ImageToArtifact(ctx types.Context, img v1.Image, t types.CompressionImplementation, output string, filter func(h *tar.Header) (bool, error)) (*PackageArtifact, error) {
@@ -227,7 +230,8 @@ func (a *PackageArtifact) GenerateFinalImage(ctx types.Context, imageName string
 	}
 	defer os.RemoveAll(tempimage.Name()) // clean up
 
-	if err := image.CreateTar(a.Path, tempimage.Name(), imageName, runtime.GOARCH, runtime.GOOS); err != nil {
+	cfg := ctx.GetConfig()
+	if err := image.CreateTar(a.Path, tempimage.Name(), imageName, cfg.GetSystemArch(), cfg.GetSystemOS()); err != nil {
 		return errors.Wrap(err, "could not create image from tar")
 	}
 
@@ -240,7 +244,29 @@ func (a *PackageArtifact) GenerateFinalImage(ctx types.Context, imageName string
 // Compress is responsible to archive and compress to the artifact Path.
 // It accepts a source path, which is the content to be archived/compressed
 // and a concurrency parameter.
+// It also records the archive and content sizes in the artifact.
 func (a *PackageArtifact) Compress(src string, concurrency int) error {
+	if err := a.compress(src, concurrency); err != nil {
+		return err
+	}
+
+	if fi, err := os.Stat(a.Path); err == nil {
+		a.Size = fi.Size()
+	}
+
+	a.InstalledSize = 0
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			a.InstalledSize += info.Size()
+		}
+		return nil
+	})
+}
+
+func (a *PackageArtifact) compress(src string, concurrency int) error {
 	switch a.CompressionType {
 
 	case types.Zstandard:
@@ -557,7 +583,7 @@ func (a *PackageArtifact) Unpack(ctx types.Context, dst string, keepPerms bool,
 	}
 	defer archiveFile.Close()
 
-	decompressed, err := containerdCompression.DecompressStream(archiveFile)
+	decompressed, err := decompressStream(archiveFile)
 	if err != nil {
 		return errors.Wrap(err, "Cannot open "+a.Path)
 	}
@@ -582,6 +608,46 @@ func (a *PackageArtifact) Unpack(ctx types.Context, dst string, keepPerms bool,
 	return err
 }
 
+// ComputeSizes records the archive and content sizes of the artifact
+// reading them from the archive at the artifact Path
+func (a *PackageArtifact) ComputeSizes() error {
+	fi, err := os.Stat(a.Path)
+	if err != nil {
+		return errors.Wrap(err, "Cannot stat "+a.Path)
+	}
+
+	archiveFile, err := os.Open(a.Path)
+	if err != nil {
+		return errors.Wrap(err, "Cannot open "+a.Path)
+	}
+	defer archiveFile.Close()
+
+	decompressed, err := decompressStream(archiveFile)
+	if err != nil {
+		return errors.Wrap(err, "Cannot open "+a.Path)
+	}
+	defer decompressed.Close()
+	tr := tar.NewReader(decompressed)
+
+	var installed int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.FileInfo().Mode().IsRegular() {
+			installed += hdr.Size
+		}
+	}
+
+	a.Size = fi.Size()
+	a.InstalledSize = installed
+	return nil
+}
+
 // FileList generates the list of file of a package from the local archive
 func (a *PackageArtifact) FileList() ([]string, error) {
 	var files []string
@@ -592,7 +658,7 @@ func (a *PackageArtifact) FileList() ([]string, error) {
 	}
 	defer archiveFile.Close()
 
-	decompressed, err := containerdCompression.DecompressStream(archiveFile)
+	decompressed, err := decompressStream(archiveFile)
 	if err != nil {
 		return files, errors.Wrap(err, "Cannot open "+a.Path)
 	}
@@ -16,21 +16,51 @@
 package artifact
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"crypto/sha512"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/mudler/luet/pkg/api/core/types"
 	"github.com/pkg/errors"
 	"github.com/rancher-sandbox/gofilecache"
 )
 
+// digestSuffix is appended to the recompressed cached files to name
+// their signed digest
+const digestSuffix = ".digest"
+
+// digestKeyFile is the key signing the digests, in the cache directory
+const digestKeyFile = "digest.key"
+
+// ErrCacheDigestMismatch is returned when a recompressed cached file
+// doesn't match the digest signed when it was stored
+var ErrCacheDigestMismatch = errors.New("cached artifact doesn't match its signed digest")
+
 type ArtifactCache struct {
 	gofilecache.Cache
+	dir string
+
+	// Compression is the algorithm artifacts are stored with,
+	// empty keeps their original compression
+	Compression types.CompressionImplementation
 }
 
 func NewCache(dir string) *ArtifactCache {
-	return &ArtifactCache{Cache: *gofilecache.InitCache(dir)}
+	return &ArtifactCache{Cache: *gofilecache.InitCache(dir), dir: dir}
+}
+
+// NewCompressedCache returns a cache storing artifacts with the given compression
+func NewCompressedCache(dir string, c types.CompressionImplementation) *ArtifactCache {
+	cache := NewCache(dir)
+	cache.Compression = c
+	return cache
 }
 
 func (c *ArtifactCache) cacheID(a *PackageArtifact) [64]byte {
@@ -53,11 +83,178 @@ func (c *ArtifactCache) Get(a *PackageArtifact) (string, error) {
 	return fileName, err
 }
 
+// GetArtifact returns a copy of a pointing to the cached archive. If the
+// archive was recompressed, it is verified against the digest signed when
+// it was stored, and the checksums are the ones of the cached file: the
+// original ones are verified before recompressing.
+func (c *ArtifactCache) GetArtifact(a *PackageArtifact) (*PackageArtifact, error) {
+	newart := a.ShallowCopy()
+	fileName, err := c.Get(a)
+	newart.Path = fileName
+	if err != nil {
+		return newart, err
+	}
+
+	t, err := DetectCompression(fileName)
+	if err != nil {
+		return newart, err
+	}
+	if !sameCompression(t, newart.CompressionType) {
+		sum := Checksums{}
+		if err := sum.Generate(&PackageArtifact{Path: fileName}); err != nil {
+			return newart, err
+		}
+		if err := c.verifyDigest(fileName, sum); err != nil {
+			return newart, err
+		}
+		newart.CompressionType = t
+		newart.Checksums = sum
+	}
+	return newart, nil
+}
+
+// digestKey returns the key signing the digests, generating it
+// the first time
+func (c *ArtifactCache) digestKey() ([]byte, error) {
+	path := filepath.Join(c.dir, digestKeyFile)
+	if dat, err := ioutil.ReadFile(path); err == nil {
+		return hex.DecodeString(strings.TrimSpace(string(dat)))
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		// Created meanwhile by another process
+		return c.digestKey()
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed creating the cache digest key")
+	}
+	defer f.Close()
+	if _, err := f.WriteString(hex.EncodeToString(key)); err != nil {
+		return nil, errors.Wrap(err, "failed writing the cache digest key")
+	}
+	return key, nil
+}
+
+func (c *ArtifactCache) digest(sum Checksums) ([]byte, error) {
+	key, err := c.digestKey()
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	for _, cs := range sum.List() {
+		mac.Write([]byte(cs[0] + ":" + cs[1] + "\n"))
+	}
+	return mac.Sum(nil), nil
+}
+
+// signDigest writes the signed digest of the cached file next to it
+func (c *ArtifactCache) signDigest(fileName string, sum Checksums) error {
+	d, err := c.digest(sum)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName+digestSuffix, []byte(hex.EncodeToString(d)), 0644)
+}
+
+func (c *ArtifactCache) verifyDigest(fileName string, sum Checksums) error {
+	dat, err := ioutil.ReadFile(fileName + digestSuffix)
+	if err != nil {
+		return errors.Wrapf(ErrCacheDigestMismatch, "%s has no digest", fileName)
+	}
+	signed, err := hex.DecodeString(strings.TrimSpace(string(dat)))
+	if err != nil {
+		return errors.Wrapf(ErrCacheDigestMismatch, "%s has an invalid digest", fileName)
+	}
+	d, err := c.digest(sum)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(d, signed) {
+		return errors.Wrapf(ErrCacheDigestMismatch, "%s", fileName)
+	}
+	return nil
+}
+
+func sameCompression(a, b types.CompressionImplementation) bool {
+	if a == "" {
+		a = types.None
+	}
+	if b == "" {
+		b = types.None
+	}
+	return a == b
+}
+
 func (c *ArtifactCache) Put(a *PackageArtifact) (gofilecache.OutputID, int64, error) {
+	if c.Compression != "" {
+		t, err := DetectCompression(a.Path)
+		if err != nil {
+			return [64]byte{}, 0, errors.Wrapf(err, "failed opening %s", a.Path)
+		}
+		if !sameCompression(t, c.Compression) {
+			return c.putRecompressed(a)
+		}
+	}
+
 	file, err := os.Open(a.Path)
 	if err != nil {
 		return [64]byte{}, 0, errors.Wrapf(err, "failed opening %s", a.Path)
 	}
 	defer file.Close()
-	return c.Cache.Put(c.cacheID(a), file)
+	return c.put(a, file)
+}
+
+// put stores the file of a, recording its package for the retention policy
+func (c *ArtifactCache) put(a *PackageArtifact, file *os.File) (gofilecache.OutputID, int64, error) {
+	out, size, err := c.Cache.Put(c.cacheID(a), file)
+	if err == nil {
+		c.writePackageRecord(out, a)
+	}
+	return out, size, err
+}
+
+// putRecompressed stores a with the cache compression, after verifying it
+// as its checksums won't match the cached file anymore. The digest of the
+// cached file is signed, so GetArtifact can detect it was altered.
+func (c *ArtifactCache) putRecompressed(a *PackageArtifact) (gofilecache.OutputID, int64, error) {
+	if len(a.Checksums) > 0 {
+		if err := a.Verify(); err != nil {
+			return [64]byte{}, 0, errors.Wrapf(err, "artifact integrity check failure for %s", a.Path)
+		}
+	}
+
+	tmp, err := os.CreateTemp("", "luet-cache")
+	if err != nil {
+		return [64]byte{}, 0, err
+	}
+	tmp.Close()
+	defer os.RemoveAll(tmp.Name())
+
+	if err := a.Recompress(tmp.Name(), c.Compression); err != nil {
+		return [64]byte{}, 0, errors.Wrapf(err, "failed recompressing %s", a.Path)
+	}
+
+	sum := Checksums{}
+	if err := sum.Generate(&PackageArtifact{Path: tmp.Name()}); err != nil {
+		return [64]byte{}, 0, err
+	}
+
+	file, err := os.Open(tmp.Name())
+	if err != nil {
+		return [64]byte{}, 0, err
+	}
+	defer file.Close()
+	out, size, err := c.put(a, file)
+	if err != nil {
+		return out, size, err
+	}
+	if err := c.signDigest(c.OutputFile(out), sum); err != nil {
+		return out, size, errors.Wrapf(err, "failed signing the digest of %s", a.Path)
+	}
+	return out, size, nil
 }
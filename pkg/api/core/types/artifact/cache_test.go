@@ -16,6 +16,7 @@
 package artifact_test
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -87,4 +88,94 @@ var _ = Describe("Cache", func() {
 			Expect(err).ToNot(HaveOccurred())
 		})
 	})
+
+	Context("Compression", func() {
+		for _, c := range []types.CompressionImplementation{types.None, types.Zstandard, types.LZ4} {
+			c := c
+			It("recompresses artifacts to "+string(c), func() {
+				tmpdir, err := ioutil.TempDir(os.TempDir(), "test")
+				Expect(err).ToNot(HaveOccurred())
+				defer os.RemoveAll(tmpdir)
+
+				src := filepath.Join(tmpdir, "src")
+				Expect(os.MkdirAll(src, os.ModePerm)).ToNot(HaveOccurred())
+				Expect(ioutil.WriteFile(filepath.Join(src, "foo"), []byte("foo"), os.ModePerm)).ToNot(HaveOccurred())
+
+				a := NewPackageArtifact(filepath.Join(tmpdir, "foo.tar"))
+				a.CompressionType = types.GZip
+				Expect(a.Compress(src, 1)).ToNot(HaveOccurred())
+				Expect(a.Hash()).ToNot(HaveOccurred())
+
+				cache := NewCompressedCache(filepath.Join(tmpdir, "cache"), c)
+				_, _, err = cache.Put(a)
+				Expect(err).ToNot(HaveOccurred())
+
+				cached, err := cache.GetArtifact(a)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(DetectCompression(cached.Path)).To(Equal(c))
+				Expect(cached.CompressionType).To(Equal(c))
+				Expect(cached.Verify()).ToNot(HaveOccurred())
+
+				rootfs := filepath.Join(tmpdir, "rootfs")
+				Expect(os.MkdirAll(rootfs, os.ModePerm)).ToNot(HaveOccurred())
+				Expect(cached.Unpack(context.NewContext(), rootfs, false)).ToNot(HaveOccurred())
+				bb, err := ioutil.ReadFile(filepath.Join(rootfs, "foo"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(bb)).To(Equal("foo"))
+
+				files, err := cached.FileList()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(files).To(Equal([]string{"foo"}))
+			})
+		}
+
+		It("refuses to cache corrupted artifacts", func() {
+			tmpdir, err := ioutil.TempDir(os.TempDir(), "test")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tmpdir)
+
+			Expect(ioutil.WriteFile(filepath.Join(tmpdir, "foo"), []byte("foo"), os.ModePerm)).ToNot(HaveOccurred())
+			a := NewPackageArtifact(filepath.Join(tmpdir, "foo.tar"))
+			a.CompressionType = types.GZip
+			Expect(a.Compress(tmpdir, 1)).ToNot(HaveOccurred())
+			a.Checksums = Checksums{"sha256": "invalid"}
+
+			cache := NewCompressedCache(filepath.Join(tmpdir, "cache"), types.Zstandard)
+			_, _, err = cache.Put(a)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("detects recompressed artifacts altered in the cache", func() {
+			tmpdir, err := ioutil.TempDir(os.TempDir(), "test")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tmpdir)
+
+			src := filepath.Join(tmpdir, "src")
+			Expect(os.MkdirAll(src, os.ModePerm)).ToNot(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(src, "foo"), []byte("foo"), os.ModePerm)).ToNot(HaveOccurred())
+			a := NewPackageArtifact(filepath.Join(tmpdir, "foo.tar"))
+			a.CompressionType = types.GZip
+			Expect(a.Compress(src, 1)).ToNot(HaveOccurred())
+			Expect(a.Hash()).ToNot(HaveOccurred())
+
+			cache := NewCompressedCache(filepath.Join(tmpdir, "cache"), types.Zstandard)
+			_, _, err = cache.Put(a)
+			Expect(err).ToNot(HaveOccurred())
+			cached, err := cache.GetArtifact(a)
+			Expect(err).ToNot(HaveOccurred())
+
+			// Same size, the cache index doesn't notice
+			dat, err := ioutil.ReadFile(cached.Path)
+			Expect(err).ToNot(HaveOccurred())
+			dat[len(dat)-1] ^= 0xff
+			Expect(ioutil.WriteFile(cached.Path, dat, 0644)).ToNot(HaveOccurred())
+
+			_, err = cache.GetArtifact(a)
+			Expect(errors.Is(err, ErrCacheDigestMismatch)).To(BeTrue())
+
+			Expect(os.Remove(cached.Path + ".digest")).ToNot(HaveOccurred())
+			_, err = cache.GetArtifact(a)
+			Expect(errors.Is(err, ErrCacheDigestMismatch)).To(BeTrue())
+		})
+	})
 })
@@ -0,0 +1,140 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package artifact
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+
+	containerdCompression "github.com/containerd/containerd/archive/compression"
+	zstd "github.com/klauspost/compress/zstd"
+	gzip "github.com/klauspost/pgzip"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pierrec/lz4/v4"
+	"github.com/pkg/errors"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	lz4Magic  = []byte{0x04, 0x22, 0x4d, 0x18}
+)
+
+// DetectCompression returns the compression of the archive at path
+// from its magic bytes
+func DetectCompression(path string) (types.CompressionImplementation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return types.None, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 4)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return types.None, err
+	}
+	return detectCompression(header[:n]), nil
+}
+
+func detectCompression(header []byte) types.CompressionImplementation {
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return types.GZip
+	case bytes.HasPrefix(header, zstdMagic):
+		return types.Zstandard
+	case bytes.HasPrefix(header, lz4Magic):
+		return types.LZ4
+	}
+	return types.None
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r readCloser) Close() error { return r.close() }
+
+// decompressStream wraps containerd's autodetection, which doesn't know about lz4
+func decompressStream(r io.Reader) (io.ReadCloser, error) {
+	buf := bufio.NewReader(r)
+	header, err := buf.Peek(len(lz4Magic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if detectCompression(header) == types.LZ4 {
+		return readCloser{Reader: lz4.NewReader(buf), close: func() error { return nil }}, nil
+	}
+	return containerdCompression.DecompressStream(buf)
+}
+
+// compressStream returns a writer compressing to w with the given algorithm
+func compressStream(w io.Writer, t types.CompressionImplementation) (io.WriteCloser, error) {
+	switch t {
+	case types.GZip:
+		return gzip.NewWriter(w), nil
+	case types.Zstandard:
+		return zstd.NewWriter(w)
+	case types.LZ4:
+		return lz4.NewWriter(w), nil
+	case types.None, "":
+		return nopWriteCloser{w}, nil
+	}
+	return nil, errors.Errorf("unsupported compression '%s'", t)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// Recompress writes the archive of the artifact to dst with the given compression
+func (a *PackageArtifact) Recompress(dst string, t types.CompressionImplementation) error {
+	src, err := os.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	decompressed, err := decompressStream(src)
+	if err != nil {
+		return errors.Wrapf(err, "while decompressing %s", a.Path)
+	}
+	defer decompressed.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	w, err := compressStream(out, t)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, decompressed); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
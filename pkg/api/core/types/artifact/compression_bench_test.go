@@ -0,0 +1,85 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package artifact_test
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	. "github.com/mudler/luet/pkg/api/core/types/artifact"
+)
+
+// BenchmarkUnpack compares the extraction speed of the cache compressions:
+// go test -run=^$ -bench=Unpack ./pkg/api/core/types/artifact/
+func BenchmarkUnpack(b *testing.B) {
+	tmpdir, err := os.MkdirTemp("", "bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// Half random, half repetitive content, as in real packages
+	src := filepath.Join(tmpdir, "src")
+	if err := os.MkdirAll(src, os.ModePerm); err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < 64; i++ {
+		data := make([]byte, 64*1024)
+		if i%2 == 0 {
+			rand.Read(data)
+		}
+		if err := os.WriteFile(filepath.Join(src, fmt.Sprint(i)), data, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	a := NewPackageArtifact(filepath.Join(tmpdir, "bench.tar"))
+	if err := a.Compress(src, 1); err != nil {
+		b.Fatal(err)
+	}
+
+	ctx := context.NewContext()
+	for _, c := range []types.CompressionImplementation{types.None, types.GZip, types.Zstandard, types.LZ4} {
+		cache := NewCompressedCache(filepath.Join(tmpdir, "cache-"+string(c)), c)
+		if _, _, err := cache.Put(a); err != nil {
+			b.Fatal(err)
+		}
+		cached, err := cache.GetArtifact(a)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(string(c), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				dst := filepath.Join(tmpdir, "rootfs", fmt.Sprint(i))
+				if err := os.MkdirAll(dst, os.ModePerm); err != nil {
+					b.Fatal(err)
+				}
+				if err := cached.Unpack(ctx, dst, false); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				os.RemoveAll(dst)
+				b.StartTimer()
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package artifact
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	version "github.com/mudler/luet/pkg/versioner"
+	"github.com/rancher-sandbox/gofilecache"
+)
+
+// packageRecordSuffix is appended to the cached files to name the
+// record of the package they belong to
+const packageRecordSuffix = ".package"
+
+// writePackageRecord records the package of a next to its cached file.
+// It is best effort, files without a record are never pruned.
+func (c *ArtifactCache) writePackageRecord(out gofilecache.OutputID, a *PackageArtifact) {
+	if a.CompileSpec == nil || a.CompileSpec.Package == nil {
+		return
+	}
+	p := a.CompileSpec.Package
+	dat, err := json.Marshal(&types.Package{Category: p.GetCategory(), Name: p.GetName(), Version: p.GetVersion()})
+	if err != nil {
+		return
+	}
+	ioutil.WriteFile(c.OutputFile(out)+packageRecordSuffix, dat, 0644)
+}
+
+type cachedPackage struct {
+	pack    *types.Package
+	file    string
+	size    int64
+	modTime time.Time
+}
+
+func (c *ArtifactCache) cachedPackages() (map[string][]cachedPackage, error) {
+	res := map[string][]cachedPackage{}
+	err := filepath.Walk(c.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, packageRecordSuffix) {
+			return nil
+		}
+
+		file := strings.TrimSuffix(path, packageRecordSuffix)
+		fi, err := os.Stat(file)
+		if err != nil {
+			os.Remove(path)
+			return nil
+		}
+		dat, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		p := &types.Package{}
+		if err := json.Unmarshal(dat, p); err != nil {
+			return nil
+		}
+		key := p.GetCategory() + "/" + p.GetName()
+		res[key] = append(res[key], cachedPackage{pack: p, file: file, size: fi.Size(), modTime: fi.ModTime()})
+		return nil
+	})
+	return res, err
+}
+
+// ApplyRetentionPolicy deletes the cached files of the package versions
+// older than the policy KeepVersions most recent ones, and the ones unused
+// for more than MaxAgeDays. It returns the bytes freed.
+func (c *ArtifactCache) ApplyRetentionPolicy(policy types.LuetRetentionPolicy) (int64, error) {
+	if !policy.Enabled() {
+		return 0, nil
+	}
+
+	packages, err := c.cachedPackages()
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-time.Duration(policy.MaxAgeDays) * 24 * time.Hour)
+	var freed int64
+	for _, cached := range packages {
+		versions := []string{}
+		seen := map[string]bool{}
+		for _, e := range cached {
+			if !seen[e.pack.GetVersion()] {
+				seen[e.pack.GetVersion()] = true
+				versions = append(versions, e.pack.GetVersion())
+			}
+		}
+
+		kept := map[string]bool{}
+		sorted := version.DefaultVersioner().Sort(versions)
+		for i, v := range sorted {
+			if policy.KeepVersions <= 0 || i >= len(sorted)-policy.KeepVersions {
+				kept[v] = true
+			}
+		}
+
+		for _, e := range cached {
+			if kept[e.pack.GetVersion()] && (policy.MaxAgeDays <= 0 || e.modTime.After(cutoff)) {
+				continue
+			}
+			if err := os.Remove(e.file); err != nil {
+				return freed, err
+			}
+			os.Remove(e.file + packageRecordSuffix)
+			os.Remove(e.file + digestSuffix)
+			freed += e.size
+		}
+	}
+	return freed, nil
+}
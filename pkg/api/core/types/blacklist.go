@@ -0,0 +1,160 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// packagePattern is a compiled package matcher in the form
+// category/name@version where each component is a glob.
+type packagePattern struct {
+	category, name, version string
+}
+
+func parsePackagePattern(s string) (packagePattern, error) {
+	b := packagePattern{category: "*", name: s, version: "*"}
+
+	if i := strings.LastIndex(b.name, "@"); i >= 0 {
+		b.version = b.name[i+1:]
+		b.name = b.name[:i]
+	}
+	if i := strings.Index(b.name, "/"); i >= 0 {
+		b.category = b.name[:i]
+		b.name = b.name[i+1:]
+	}
+
+	for _, g := range []string{b.category, b.name, b.version} {
+		if _, err := path.Match(g, ""); err != nil {
+			return b, errors.Wrapf(err, "invalid package pattern '%s'", s)
+		}
+	}
+	return b, nil
+}
+
+func (b packagePattern) match(p *Package) bool {
+	for _, m := range [][2]string{
+		{b.category, p.GetCategory()},
+		{b.name, p.GetName()},
+		{b.version, p.GetVersion()},
+	} {
+		if ok, _ := path.Match(m[0], m[1]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// maxCachedMatches bounds the entries of each blacklist match cache
+const maxCachedMatches = 4096
+
+// compiledBlacklist are the blacklist patterns, compiled once. Match
+// results are cached by package in caches taken from a pool, so
+// concurrent callers don't contend on them.
+type compiledBlacklist struct {
+	patterns []packagePattern
+	matches  sync.Pool
+}
+
+func newCompiledBlacklist(patterns []packagePattern) *compiledBlacklist {
+	b := &compiledBlacklist{patterns: patterns}
+	b.matches.New = func() interface{} { return map[string]bool{} }
+	return b
+}
+
+func (b *compiledBlacklist) match(p *Package) bool {
+	cache := b.matches.Get().(map[string]bool)
+	defer b.matches.Put(cache)
+
+	key := p.GetFingerPrint()
+	if m, ok := cache[key]; ok {
+		return m
+	}
+
+	m := false
+	for _, pattern := range b.patterns {
+		if pattern.match(p) {
+			m = true
+			break
+		}
+	}
+	if len(cache) >= maxCachedMatches {
+		for k := range cache {
+			delete(cache, k)
+		}
+	}
+	cache[key] = m
+	return m
+}
+
+// packageBlacklist holds the compiled blacklist. It is shared by the
+// copies of the config, and replaced atomically when the patterns change.
+type packageBlacklist struct {
+	compiled atomic.Pointer[compiledBlacklist]
+}
+
+func compilePatterns(patterns []string) ([]packagePattern, error) {
+	res := []packagePattern{}
+	for _, s := range patterns {
+		b, err := parsePackagePattern(s)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, b)
+	}
+	return res, nil
+}
+
+func (c *LuetConfig) compileBlacklist() error {
+	patterns, err := compilePatterns(c.PackageBlacklist)
+	if err != nil {
+		return err
+	}
+	if c.blacklist == nil {
+		c.blacklist = &packageBlacklist{}
+	}
+	c.blacklist.compiled.Store(newCompiledBlacklist(patterns))
+	return nil
+}
+
+// SetPackageBlacklist replaces the blacklist patterns and compiles them
+func (c *LuetConfig) SetPackageBlacklist(b []string) error {
+	c.PackageBlacklist = b
+	return c.compileBlacklist()
+}
+
+// IsBlacklisted returns true if the package matches any of the
+// blacklist patterns. Patterns are compiled once at config load time.
+func (c *LuetConfig) IsBlacklisted(p *Package) bool {
+	if c.blacklist != nil {
+		if b := c.blacklist.compiled.Load(); b != nil {
+			return b.match(p)
+		}
+	}
+
+	// Config wasn't initialized, invalid patterns are skipped
+	for _, s := range c.PackageBlacklist {
+		if b, err := parsePackagePattern(s); err == nil && b.match(p) {
+			return true
+		}
+	}
+	return false
+}
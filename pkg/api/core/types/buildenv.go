@@ -0,0 +1,101 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+// BuildEnvFilterAll disables the build environment filtering
+const BuildEnvFilterAll = "__ALL__"
+
+// BuildEnv filters env (in the KEY=VALUE form) returning only the
+// variables matching BuildContextEnvFilter.
+// An unset filter keeps the whole environment.
+func (c *LuetConfig) BuildEnv(env []string) []string {
+	if c.BuildContextEnvFilter == nil {
+		return env
+	}
+	for _, f := range c.BuildContextEnvFilter {
+		if f == BuildEnvFilterAll {
+			return env
+		}
+	}
+
+	res := []string{}
+	for _, e := range env {
+		name := strings.SplitN(e, "=", 2)[0]
+		for _, f := range c.BuildContextEnvFilter {
+			if ok, _ := path.Match(f, name); ok {
+				res = append(res, e)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// BuildEnvArgs returns the host environment variables passed to builds
+// as build arguments. None is passed when BuildContextEnvFilter is unset.
+func (c *LuetConfig) BuildEnvArgs() map[string]string {
+	if c.BuildContextEnvFilter == nil {
+		return nil
+	}
+	return envMap(c.BuildEnv(os.Environ()))
+}
+
+// GetBuildEnvironment returns the build-time environment merged from all
+// its sources. Later sources override earlier ones: the host environment
+// filtered by BuildContextEnvFilter, the finalizer envs, the global
+// BuildArgs, the repository BuildArgs and the package env.
+// repo and spec can be nil.
+func (c *LuetConfig) GetBuildEnvironment(repo *LuetRepository, spec *LuetCompilationSpec) map[string]string {
+	env := envMap(c.BuildEnv(os.Environ()))
+
+	for _, kv := range c.FinalizerEnvs {
+		env[kv.Key] = kv.Value
+	}
+	for k, v := range c.BuildArgs {
+		env[k] = v
+	}
+	if repo != nil {
+		for k, v := range repo.BuildArgs {
+			env[k] = v
+		}
+	}
+	if spec != nil {
+		for k, v := range envMap(spec.Env) {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// envMap converts a KEY=VALUE list to a map
+func envMap(env []string) map[string]string {
+	res := map[string]string{}
+	for _, e := range env {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) == 2 {
+			res[kv[0]] = kv[1]
+		} else {
+			res[kv[0]] = ""
+		}
+	}
+	return res
+}
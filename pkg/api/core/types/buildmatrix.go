@@ -0,0 +1,109 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// BuildVariantDefaultKey is the key of the matrix labels in the form "value"
+const BuildVariantDefaultKey = "variant"
+
+// BuildVariant is a combination of the build matrix labels of a package
+type BuildVariant struct {
+	Package string
+	Labels  map[string]string
+}
+
+func (v BuildVariant) keys() []string {
+	keys := []string{}
+	for k := range v.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Name identifies the variant, e.g. "python-3.9_ssl-on"
+func (v BuildVariant) Name() string {
+	parts := []string{}
+	for _, k := range v.keys() {
+		parts = append(parts, k+"-"+v.Labels[k])
+	}
+	return strings.Join(parts, "_")
+}
+
+// Env returns the labels as LUET_VARIANT_<KEY>=value build environment variables
+func (v BuildVariant) Env() []string {
+	env := []string{}
+	for _, k := range v.keys() {
+		key := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(k))
+		env = append(env, fmt.Sprintf("LUET_VARIANT_%s=%s", key, v.Labels[k]))
+	}
+	return env
+}
+
+// ExpandBuildMatrix returns the variants of the package atom (category/name) listed
+// in ProvidesBuildMatrix. Labels are in the "key=value" form, the ones sharing a key
+// are alternatives, and a variant is generated for every combination of the keys.
+// Packages without a matrix have no variants.
+func (c *LuetConfig) ExpandBuildMatrix(pkgAtom string) ([]BuildVariant, error) {
+	labels, ok := c.ProvidesBuildMatrix[pkgAtom]
+	if !ok || len(labels) == 0 {
+		return nil, nil
+	}
+
+	dimensions := map[string][]string{}
+	keys := []string{}
+	for _, l := range labels {
+		k, v := BuildVariantDefaultKey, l
+		if i := strings.Index(l, "="); i >= 0 {
+			k, v = strings.TrimSpace(l[:i]), strings.TrimSpace(l[i+1:])
+		}
+		if k == "" || v == "" {
+			return nil, errors.Errorf("invalid build matrix label '%s' for %s", l, pkgAtom)
+		}
+		if _, ok := dimensions[k]; !ok {
+			keys = append(keys, k)
+		}
+		for _, existing := range dimensions[k] {
+			if existing == v {
+				return nil, errors.Errorf("duplicate build matrix label '%s' for %s", l, pkgAtom)
+			}
+		}
+		dimensions[k] = append(dimensions[k], v)
+	}
+
+	variants := []BuildVariant{{Package: pkgAtom, Labels: map[string]string{}}}
+	for _, k := range keys {
+		expanded := []BuildVariant{}
+		for _, variant := range variants {
+			for _, v := range dimensions[k] {
+				l := map[string]string{k: v}
+				for kk, vv := range variant.Labels {
+					l[kk] = vv
+				}
+				expanded = append(expanded, BuildVariant{Package: pkgAtom, Labels: l})
+			}
+		}
+		variants = expanded
+	}
+	return variants, nil
+}
@@ -0,0 +1,48 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// LuetCDNConfig routes the repository downloads through a CDN
+type LuetCDNConfig struct {
+	Enabled bool   `yaml:"enabled,omitempty" mapstructure:"enabled"`
+	BaseURL string `yaml:"base_url,omitempty" mapstructure:"base_url"`
+
+	// TTL is how long the files downloaded from the CDN are cached when
+	// it doesn't send Cache-Control headers. Zero disables it.
+	TTL time.Duration `yaml:"ttl,omitempty" mapstructure:"ttl"`
+}
+
+// URL returns the CDN URL of an origin URL, appended escaped to BaseURL
+func (c LuetCDNConfig) URL(origin string) string {
+	return strings.TrimSuffix(c.BaseURL, "/") + "/" + url.PathEscape(origin)
+}
+
+func (c LuetCDNConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if u, err := url.Parse(c.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid cdn base url '%s'", c.BaseURL)
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrChecksumNotLogged is returned when the transparency log can't
+	// prove the inclusion of a checksum in its signed tree head
+	ErrChecksumNotLogged = errors.New("checksum not included in the transparency log")
+	// ErrChecksumConflict is returned when the transparency log holds
+	// a different checksum for the same package
+	ErrChecksumConflict = errors.New("a different checksum is logged for the package")
+	// ErrTreeHeadSignature is returned when the signed tree head isn't
+	// signed by the transparency log key
+	ErrTreeHeadSignature = errors.New("invalid tree head signature")
+)
+
+// SignedTreeHead is the get-sth response, see RFC 6962 section 4.3
+type SignedTreeHead struct {
+	TreeSize          uint64 `json:"tree_size"`
+	Timestamp         uint64 `json:"timestamp"`
+	SHA256RootHash    []byte `json:"sha256_root_hash"`
+	TreeHeadSignature []byte `json:"tree_head_signature"`
+}
+
+// InclusionProof is the get-proof-by-hash response, see RFC 6962 section 4.5
+type InclusionProof struct {
+	LeafIndex uint64   `json:"leaf_index"`
+	AuditPath [][]byte `json:"audit_path"`
+}
+
+// ChecksumLogEntry is submitted to the add-checksum endpoint of the log.
+// The log answers 409 if a different checksum is logged for the package.
+type ChecksumLogEntry struct {
+	Package  string `json:"package"`
+	Checksum string `json:"checksum"`
+}
+
+// LeafInput is the data of the log leaf holding the entry
+func (e ChecksumLogEntry) LeafInput() []byte {
+	return []byte(e.Package + " " + e.Checksum)
+}
+
+// NewChecksumLogEntry returns the log entry of the sha256 checksum of a package
+func NewChecksumLogEntry(p *Package, sha256sum string) ChecksumLogEntry {
+	return ChecksumLogEntry{
+		Package:  fmt.Sprintf("%s/%s@%s", p.GetCategory(), p.GetName(), p.GetVersion()),
+		Checksum: "sha256:" + sha256sum,
+	}
+}
+
+// MerkleLeafHash is the RFC 6962 hash of a leaf
+func MerkleLeafHash(data []byte) []byte {
+	h := sha256.Sum256(append([]byte{0x00}, data...))
+	return h[:]
+}
+
+// MerkleNodeHash is the RFC 6962 hash of an interior node
+func MerkleNodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// VerifyInclusion checks the audit path of the leaf at index against
+// the root of a tree of size leaves, see RFC 9162 section 2.1.3.2
+func VerifyInclusion(leafHash []byte, index, size uint64, path [][]byte, root []byte) error {
+	if index >= size {
+		return fmt.Errorf("leaf index %d out of a tree of size %d", index, size)
+	}
+
+	fn, sn := index, size-1
+	r := leafHash
+	for _, p := range path {
+		if sn == 0 {
+			return errors.New("audit path too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = MerkleNodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = MerkleNodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 || !bytes.Equal(r, root) {
+		return errors.New("audit path doesn't match the tree root")
+	}
+	return nil
+}
+
+// Verify checks the signature of the tree head with the log public key,
+// see RFC 6962 section 3.5
+func (sth SignedTreeHead) Verify(key crypto.PublicKey) error {
+	// TreeHeadSignature is a TLS DigitallySigned struct:
+	// hash and signature algorithm, 16 bit length, signature
+	sig := sth.TreeHeadSignature
+	if len(sig) < 4 || int(binary.BigEndian.Uint16(sig[2:4])) != len(sig)-4 {
+		return errors.Wrap(ErrTreeHeadSignature, "malformed signature")
+	}
+	if sig[0] != 4 {
+		return errors.Wrapf(ErrTreeHeadSignature, "unsupported hash algorithm %d", sig[0])
+	}
+
+	signed := make([]byte, 18, 18+len(sth.SHA256RootHash))
+	signed[0] = 0 // v1
+	signed[1] = 1 // tree_hash
+	binary.BigEndian.PutUint64(signed[2:], sth.Timestamp)
+	binary.BigEndian.PutUint64(signed[10:], sth.TreeSize)
+	signed = append(signed, sth.SHA256RootHash...)
+	digest := sha256.Sum256(signed)
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if sig[1] != 3 || !ecdsa.VerifyASN1(k, digest[:], sig[4:]) {
+			return ErrTreeHeadSignature
+		}
+	case *rsa.PublicKey:
+		if sig[1] != 1 || rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig[4:]) != nil {
+			return ErrTreeHeadSignature
+		}
+	default:
+		return errors.Wrapf(ErrTreeHeadSignature, "unsupported key type %T", key)
+	}
+	return nil
+}
+
+func (c *LuetConfig) validateChecksumLog() error {
+	if c.PackageChecksumDB == "" {
+		if c.PackageChecksumDBKey != "" {
+			return fmt.Errorf("checksum transparency log key set without a log")
+		}
+		return nil
+	}
+	if u, err := url.Parse(c.PackageChecksumDB); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid checksum transparency log '%s'", c.PackageChecksumDB)
+	}
+	return nil
+}
+
+func (c *LuetConfig) checksumLogKey() (crypto.PublicKey, error) {
+	dat, err := os.ReadFile(c.PackageChecksumDBKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading the transparency log key")
+	}
+	block, _ := pem.Decode(dat)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM key found in '%s'", c.PackageChecksumDBKey)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// LogPackageChecksum submits the checksum of a package to the
+// checksum_transparency_log and verifies its inclusion proof against
+// the signed tree head of the log
+func (c *LuetConfig) LogPackageChecksum(p *Package, sha256sum string) error {
+	entry := NewChecksumLogEntry(p, sha256sum)
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.checksumLogRequest(http.MethodPost, "add-checksum", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusConflict:
+		return errors.Wrapf(ErrChecksumConflict, "%s %s", entry.Package, entry.Checksum)
+	default:
+		return fmt.Errorf("add-checksum: unexpected status %s", res.Status)
+	}
+
+	var sth SignedTreeHead
+	if err := c.checksumLogGet("get-sth", &sth); err != nil {
+		return err
+	}
+	if c.PackageChecksumDBKey != "" {
+		key, err := c.checksumLogKey()
+		if err != nil {
+			return err
+		}
+		if err := sth.Verify(key); err != nil {
+			return err
+		}
+	}
+
+	leafHash := MerkleLeafHash(entry.LeafInput())
+	var proof InclusionProof
+	q := url.Values{}
+	q.Set("hash", base64.StdEncoding.EncodeToString(leafHash))
+	q.Set("tree_size", fmt.Sprint(sth.TreeSize))
+	if err := c.checksumLogGet("get-proof-by-hash?"+q.Encode(), &proof); err != nil {
+		return errors.Wrapf(ErrChecksumNotLogged, "%s: %s", entry.Package, err.Error())
+	}
+
+	if err := VerifyInclusion(leafHash, proof.LeafIndex, sth.TreeSize, proof.AuditPath, sth.SHA256RootHash); err != nil {
+		return errors.Wrapf(ErrChecksumNotLogged, "%s: %s", entry.Package, err.Error())
+	}
+	return nil
+}
+
+func (c *LuetConfig) checksumLogRequest(method, endpoint string, body io.Reader) (*http.Response, error) {
+	u := strings.TrimSuffix(c.PackageChecksumDB, "/") + "/ct/v1/" + endpoint
+	req, err := http.NewRequestWithContext(c.General.GetParentContext(), method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return http.DefaultClient.Do(req)
+}
+
+func (c *LuetConfig) checksumLogGet(endpoint string, v interface{}) error {
+	res, err := c.checksumLogRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	name := strings.SplitN(endpoint, "?", 2)[0]
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %s", name, res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return errors.Wrapf(err, "invalid %s response", name)
+	}
+	return nil
+}
@@ -98,8 +98,18 @@ const (
 	None      CompressionImplementation = "none" // e.g. tar for standard packages
 	GZip      CompressionImplementation = "gzip"
 	Zstandard CompressionImplementation = "zstd"
+	// LZ4 is only used to store artifacts in the local cache
+	LZ4 CompressionImplementation = "lz4"
 )
 
+// CompressionHintAuto picks the fastest compression to decompress
+// among the ones the repository index files are available in
+const CompressionHintAuto = "auto"
+
+// HostBuildImage is the image of the packages built on the host,
+// without a build container
+const HostBuildImage = "none"
+
 type SubPackage struct {
 	*Package
 	Includes []string `json:"includes,omitempty" yaml:"includes,omitempty"`
@@ -130,6 +140,22 @@ type LuetCompilationSpec struct {
 	Copy []CopyField `json:"copy"`
 
 	RequiresFinalImages bool `json:"requires_final_images" yaml:"requires_final_images"`
+
+	// NetworkRules are prefixed to the build steps, they are set by the
+	// compiler from the matching network policies
+	NetworkRules []string `json:"-" yaml:"-"`
+
+	// Mounts are the RUN --mount options of the build steps, e.g. the
+	// cross compilation sysroot
+	Mounts []string `json:"-" yaml:"-"`
+
+	// BuildArgs are the names of the build arguments declared in the
+	// images, they are set by the compiler from the host environment
+	BuildArgs []string `json:"-" yaml:"-"`
+
+	// fetched are the remote retrieves already downloaded
+	// into the build context by VerifySources
+	fetched map[string]bool
 }
 
 // Signature is a portion of the spec that yields a signature for the hash
@@ -298,6 +324,11 @@ func (cs *LuetCompilationSpec) GetRetrieve() []string {
 
 // IsVirtual returns true if the spec is virtual.
 // A spec is virtual if the package is empty, and it has no image source to unpack from.
+// BuildsOnHost returns true if the package opted out of the build container
+func (cs *LuetCompilationSpec) BuildsOnHost() bool {
+	return cs.GetImage() == HostBuildImage
+}
+
 func (cs *LuetCompilationSpec) IsVirtual() bool {
 	return cs.EmptyPackage() && !cs.HasImageSource()
 }
@@ -392,8 +423,16 @@ ENV PACKAGE_NAME=` + cs.Package.GetName() + `
 ENV PACKAGE_VERSION=` + cs.Package.GetVersion() + `
 ENV PACKAGE_CATEGORY=` + cs.Package.GetCategory()
 
+	for _, a := range cs.BuildArgs {
+		spec = spec + `
+ARG ` + a
+	}
+
 	if len(cs.Retrieve) > 0 {
 		for _, s := range cs.Retrieve {
+			if cs.fetched[s] {
+				continue
+			}
 			//var file string
 			// if helpers.IsValidUrl(s) {
 			// 	file = s
@@ -419,11 +458,20 @@ ENV ` + s
 
 	for _, s := range steps {
 		spec = spec + `
-RUN ` + s
+RUN ` + withMounts(cs.Mounts) + withNetworkRules(cs.NetworkRules, s)
 	}
 	return spec
 }
 
+// withMounts returns the mount flags of a RUN instruction
+func withMounts(mounts []string) string {
+	res := ""
+	for _, m := range mounts {
+		res += "--mount=" + m + " "
+	}
+	return res
+}
+
 // RenderBuildImage renders the dockerfile of the image used as a pre-build step
 func (cs *LuetCompilationSpec) RenderBuildImage() (string, error) {
 	return cs.genDockerfile(cs.GetSeedImage(), cs.GetPreBuildSteps()), nil
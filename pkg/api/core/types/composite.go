@@ -0,0 +1,253 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// compositeDatabase reads from the system database and the repository
+// databases, in this order. Writes go to the system database only.
+// Package IDs are prefixed with the index of their database, e.g. "1/<id>".
+type compositeDatabase struct {
+	dbs []PackageDatabase
+}
+
+// NewCompositePackageDatabase returns a database spanning system and the repository databases
+func NewCompositePackageDatabase(system PackageDatabase, repos ...PackageDatabase) PackageDatabase {
+	return &compositeDatabase{dbs: append([]PackageDatabase{system}, repos...)}
+}
+
+// CompositePackageDatabase returns a database spanning the system database
+// and the databases of all the synced system repositories
+func (c *LuetConfig) CompositePackageDatabase() (PackageDatabase, error) {
+	if c.SystemDatabase == nil || c.RepositoryDatabases == nil {
+		return nil, errors.New("package databases are not available")
+	}
+	repos, err := c.RepositoryDatabases()
+	if err != nil {
+		return nil, errors.Wrap(err, "while loading the repository databases")
+	}
+	return NewCompositePackageDatabase(c.SystemDatabase(), repos...), nil
+}
+
+func (db *compositeDatabase) system() PackageDatabase {
+	return db.dbs[0]
+}
+
+// merge collects the packages returned by each database, without duplicates.
+// It fails only if no package is found and a database returned an error.
+func (db *compositeDatabase) merge(f func(PackageDatabase) (Packages, error)) (Packages, error) {
+	res := Packages{}
+	seen := map[string]bool{}
+	var lastErr error
+	for _, d := range db.dbs {
+		packs, err := f(d)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, p := range packs {
+			if !seen[p.GetFingerPrint()] {
+				seen[p.GetFingerPrint()] = true
+				res = append(res, p)
+			}
+		}
+	}
+	if len(res) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return res, nil
+}
+
+func (db *compositeDatabase) Get(s string) (string, error) {
+	var err error
+	for _, d := range db.dbs {
+		var v string
+		if v, err = d.Get(s); err == nil {
+			return v, nil
+		}
+	}
+	return "", err
+}
+
+func (db *compositeDatabase) Set(k, v string) error {
+	return db.system().Set(k, v)
+}
+
+func (db *compositeDatabase) Create(id string, v []byte) (string, error) {
+	return db.system().Create(id, v)
+}
+
+func (db *compositeDatabase) Retrieve(ID string) ([]byte, error) {
+	d, id := db.parseID(ID)
+	return d.Retrieve(id)
+}
+
+func (db *compositeDatabase) parseID(ID string) (PackageDatabase, string) {
+	if i := strings.Index(ID, "/"); i > 0 {
+		if n, err := strconv.Atoi(ID[:i]); err == nil && n >= 0 && n < len(db.dbs) {
+			return db.dbs[n], ID[i+1:]
+		}
+	}
+	return db.system(), ID
+}
+
+func (db *compositeDatabase) Clone(to PackageDatabase) error {
+	for _, p := range db.World() {
+		if _, err := to.CreatePackage(p); err != nil {
+			return errors.Wrap(err, "Failed create package "+p.HumanReadableString())
+		}
+	}
+	return nil
+}
+
+func (db *compositeDatabase) Copy() (PackageDatabase, error) {
+	dbs := []PackageDatabase{}
+	for _, d := range db.dbs {
+		c, err := d.Copy()
+		if err != nil {
+			return nil, err
+		}
+		dbs = append(dbs, c)
+	}
+	return &compositeDatabase{dbs: dbs}, nil
+}
+
+func (db *compositeDatabase) GetRevdeps(p *Package) (Packages, error) {
+	return db.merge(func(d PackageDatabase) (Packages, error) { return d.GetRevdeps(p) })
+}
+
+func (db *compositeDatabase) GetPackages() []string {
+	ids := []string{}
+	for i, d := range db.dbs {
+		for _, id := range d.GetPackages() {
+			ids = append(ids, fmt.Sprintf("%d/%s", i, id))
+		}
+	}
+	return ids
+}
+
+func (db *compositeDatabase) CreatePackage(p *Package) (string, error) {
+	id, err := db.system().CreatePackage(p)
+	if err != nil {
+		return "", err
+	}
+	return "0/" + id, nil
+}
+
+func (db *compositeDatabase) GetPackage(ID string) (*Package, error) {
+	d, id := db.parseID(ID)
+	return d.GetPackage(id)
+}
+
+func (db *compositeDatabase) Clean() error {
+	return db.system().Clean()
+}
+
+func (db *compositeDatabase) FindPackage(p *Package) (*Package, error) {
+	var err error
+	for _, d := range db.dbs {
+		var found *Package
+		if found, err = d.FindPackage(p); err == nil {
+			return found, nil
+		}
+	}
+	return nil, err
+}
+
+func (db *compositeDatabase) FindPackages(p *Package) (Packages, error) {
+	return db.merge(func(d PackageDatabase) (Packages, error) { return d.FindPackages(p) })
+}
+
+func (db *compositeDatabase) UpdatePackage(p *Package) error {
+	return db.system().UpdatePackage(p)
+}
+
+func (db *compositeDatabase) GetAllPackages(packages chan *Package) error {
+	for _, p := range db.World() {
+		packages <- p
+	}
+	return nil
+}
+
+func (db *compositeDatabase) RemovePackage(p *Package) error {
+	return db.system().RemovePackage(p)
+}
+
+func (db *compositeDatabase) GetPackageFiles(p *Package) ([]string, error) {
+	var err error
+	for _, d := range db.dbs {
+		var files []string
+		if files, err = d.GetPackageFiles(p); err == nil {
+			return files, nil
+		}
+	}
+	return nil, err
+}
+
+func (db *compositeDatabase) SetPackageFiles(p *PackageFile) error {
+	return db.system().SetPackageFiles(p)
+}
+
+func (db *compositeDatabase) RemovePackageFiles(p *Package) error {
+	return db.system().RemovePackageFiles(p)
+}
+
+func (db *compositeDatabase) FindPackageVersions(p *Package) (Packages, error) {
+	return db.merge(func(d PackageDatabase) (Packages, error) { return d.FindPackageVersions(p) })
+}
+
+func (db *compositeDatabase) World() Packages {
+	res, _ := db.merge(func(d PackageDatabase) (Packages, error) { return d.World(), nil })
+	return res
+}
+
+// FindPackageCandidate returns the best candidate among the databases
+func (db *compositeDatabase) FindPackageCandidate(p *Package) (*Package, error) {
+	candidates := Packages{}
+	var err error
+	for _, d := range db.dbs {
+		var c *Package
+		if c, err = d.FindPackageCandidate(p); err == nil {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) == 0 {
+		return p, err
+	}
+	return candidates.Best(nil), nil
+}
+
+func (db *compositeDatabase) FindPackageLabel(labelKey string) (Packages, error) {
+	return db.merge(func(d PackageDatabase) (Packages, error) { return d.FindPackageLabel(labelKey) })
+}
+
+func (db *compositeDatabase) FindPackageLabelMatch(pattern string) (Packages, error) {
+	return db.merge(func(d PackageDatabase) (Packages, error) { return d.FindPackageLabelMatch(pattern) })
+}
+
+func (db *compositeDatabase) FindPackageMatch(pattern string) (Packages, error) {
+	return db.merge(func(d PackageDatabase) (Packages, error) { return d.FindPackageMatch(pattern) })
+}
+
+func (db *compositeDatabase) FindPackageByFile(pattern string) (Packages, error) {
+	return db.merge(func(d PackageDatabase) (Packages, error) { return d.FindPackageByFile(pattern) })
+}
@@ -0,0 +1,175 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ConditionalRepo is a repository enabled only when Condition holds on the host.
+// Conditions are joined with "&&", each one is either "<fact> <op> <value>",
+// with facts kernel_version, os and arch, or "cpu_has_feature <flag>".
+type ConditionalRepo struct {
+	Repository LuetRepository `yaml:"repository" mapstructure:"repository"`
+	Condition  string         `yaml:"condition" mapstructure:"condition"`
+}
+
+// ConditionFacts are the host properties conditions are evaluated against
+type ConditionFacts struct {
+	KernelVersion string
+	OS            string
+	Arch          string
+	CPUFeatures   []string
+}
+
+var cpuFlags = regexp.MustCompile(`(?m)^(flags|Features)\s*:\s*(.*)$`)
+
+// HostConditionFacts returns the facts of the running host
+func HostConditionFacts() ConditionFacts {
+	f := ConditionFacts{OS: runtime.GOOS, Arch: runtime.GOARCH}
+	if kernel, err := ioutil.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		f.KernelVersion = strings.TrimSpace(string(kernel))
+	}
+	if cpuinfo, err := ioutil.ReadFile("/proc/cpuinfo"); err == nil {
+		if m := cpuFlags.FindSubmatch(cpuinfo); m != nil {
+			f.CPUFeatures = strings.Fields(string(m[2]))
+		}
+	}
+	return f
+}
+
+// EvaluateCondition returns true if the condition holds with the given facts
+func EvaluateCondition(condition string, facts ConditionFacts) (bool, error) {
+	if strings.TrimSpace(condition) == "" {
+		return false, errors.New("empty condition")
+	}
+
+	for _, cond := range strings.Split(condition, "&&") {
+		ok, err := evaluateCondition(strings.Fields(cond), facts)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid condition '%s'", condition)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func evaluateCondition(c []string, facts ConditionFacts) (bool, error) {
+	if len(c) == 2 && c[0] == "cpu_has_feature" {
+		for _, f := range facts.CPUFeatures {
+			if strings.EqualFold(f, c[1]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	if len(c) != 3 {
+		return false, errors.New("expected '<fact> <op> <value>' or 'cpu_has_feature <flag>'")
+	}
+
+	var op func(int) bool
+	switch c[1] {
+	case "==", "=":
+		op = func(cmp int) bool { return cmp == 0 }
+	case "!=":
+		op = func(cmp int) bool { return cmp != 0 }
+	case ">=":
+		op = func(cmp int) bool { return cmp >= 0 }
+	case "<=":
+		op = func(cmp int) bool { return cmp <= 0 }
+	case ">":
+		op = func(cmp int) bool { return cmp > 0 }
+	case "<":
+		op = func(cmp int) bool { return cmp < 0 }
+	default:
+		return false, fmt.Errorf("unknown operator '%s'", c[1])
+	}
+
+	switch c[0] {
+	case "kernel_version":
+		if facts.KernelVersion == "" {
+			return false, nil
+		}
+		return op(compareVersions(facts.KernelVersion, c[2])), nil
+	case "os":
+		return op(strings.Compare(facts.OS, c[2])), nil
+	case "arch":
+		return op(strings.Compare(facts.Arch, c[2])), nil
+	}
+	return false, fmt.Errorf("unknown fact '%s'", c[0])
+}
+
+var versionPrefix = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*`)
+
+// compareVersions compares the numeric dotted prefixes of the versions,
+// e.g. 5.15.0-91-generic is 5.15.0
+func compareVersions(a, b string) int {
+	va := strings.Split(versionPrefix.FindString(a), ".")
+	vb := strings.Split(versionPrefix.FindString(b), ".")
+	for i := 0; i < len(va) || i < len(vb); i++ {
+		var na, nb int
+		if i < len(va) {
+			na, _ = strconv.Atoi(va[i])
+		}
+		if i < len(vb) {
+			nb, _ = strconv.Atoi(vb[i])
+		}
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// EvaluateConditionalRepositories adds the conditional repositories
+// whose conditions hold on the host to the system repositories
+func (c *LuetConfig) EvaluateConditionalRepositories() error {
+	facts := HostConditionFacts()
+	facts.OS, facts.Arch = c.GetSystemOS(), c.GetSystemArch()
+	return c.EvaluateConditionalRepositoriesWith(facts)
+}
+
+// EvaluateConditionalRepositoriesWith is EvaluateConditionalRepositories with the given facts
+func (c *LuetConfig) EvaluateConditionalRepositoriesWith(facts ConditionFacts) error {
+	for _, r := range c.ConditionalRepositories {
+		ok, err := EvaluateCondition(r.Condition, facts)
+		if err != nil {
+			return errors.Wrapf(err, "conditional repository %s", r.Repository.Name)
+		}
+		if !ok {
+			continue
+		}
+		if _, err := c.GetSystemRepository(r.Repository.Name); err == nil {
+			continue
+		}
+		if err := c.AddSystemRepository(r.Repository); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -16,17 +16,23 @@
 package types
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/mudler/luet/pkg/api/core/config"
 	fileHelper "github.com/mudler/luet/pkg/helpers/file"
 
+	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
 	"gopkg.in/yaml.v2"
 )
 
@@ -50,6 +56,11 @@ type LuetLoggingConfig struct {
 
 	// NoSpinner disable spinner
 	NoSpinner bool `yaml:"no_spinner" mapstructure:"no_spinner"`
+
+	// AsyncLogging moves log writes to a background goroutine
+	AsyncLogging bool `yaml:"async_logging" mapstructure:"async_logging"`
+	// AsyncBufferSize is the number of entries buffered with async logging
+	AsyncBufferSize int `yaml:"async_buffer_size" mapstructure:"async_buffer_size"`
 }
 
 // LuetGeneralConfig is the general configuration structure
@@ -62,6 +73,67 @@ type LuetGeneralConfig struct {
 	FatalWarns      bool `yaml:"fatal_warnings,omitempty" mapstructure:"fatal_warnings"`
 	HTTPTimeout     int  `yaml:"http_timeout,omitempty" mapstructure:"http_timeout"`
 	Quiet           bool `yaml:"quiet" mapstructure:"quiet"`
+
+	// DryRun simulates operations without touching the system
+	DryRun bool `yaml:"dry_run,omitempty" mapstructure:"dry_run"`
+
+	// ParentContext is the context all the luet operations derive from,
+	// cancelling it aborts them
+	ParentContext context.Context `yaml:"-" mapstructure:"-" json:"-"`
+
+	// MetricsEnabled exposes Prometheus metrics on MetricsPort
+	MetricsEnabled bool `yaml:"metrics_enabled,omitempty" mapstructure:"metrics_enabled"`
+	MetricsPort    int  `yaml:"metrics_port,omitempty" mapstructure:"metrics_port"`
+
+	// GossipEnabled shares the system repositories and the package holds
+	// with GossipPeers. GossipBindAddr is in the host:port form.
+	// GossipSecretKey is the base64 AES key encrypting the traffic,
+	// shared by all the peers.
+	GossipEnabled   bool     `yaml:"gossip_enabled,omitempty" mapstructure:"gossip_enabled"`
+	GossipBindAddr  string   `yaml:"gossip_bind_addr,omitempty" mapstructure:"gossip_bind_addr"`
+	GossipPeers     []string `yaml:"gossip_peers,omitempty" mapstructure:"gossip_peers"`
+	GossipSecretKey string   `yaml:"gossip_secret_key,omitempty" mapstructure:"gossip_secret_key"`
+
+	// TracingEnabled exports OpenTelemetry spans of the luet operations
+	// to the OTLP gRPC TracingEndpoint
+	TracingEnabled  bool   `yaml:"tracing_enabled,omitempty" mapstructure:"tracing_enabled"`
+	TracingEndpoint string `yaml:"tracing_endpoint,omitempty" mapstructure:"tracing_endpoint"`
+
+	// PidFile holds the pid of the running luet, preventing a second
+	// instance from starting. Disabled when empty.
+	PidFile string `yaml:"pid_file,omitempty" mapstructure:"pid_file"`
+
+	// SolverWorkers is the number of solvers run in parallel when
+	// installing independent groups of packages
+	SolverWorkers int `yaml:"solver_workers,omitempty" mapstructure:"solver_workers"`
+
+	// FinalizeParallelism is the number of finalizers run in parallel.
+	// Finalizers of packages sharing files still run one after the other.
+	FinalizeParallelism int `yaml:"finalize_parallelism,omitempty" mapstructure:"finalize_parallelism"`
+
+	// BuildTimeout caps the build of each package, from the container
+	// start to the artifact collection. Zero disables it.
+	BuildTimeout time.Duration `yaml:"build_timeout,omitempty" mapstructure:"build_timeout"`
+
+	// BuildContainerImage is the build image of the packages whose spec has
+	// no image source. Packages setting image: none are built on the host.
+	BuildContainerImage string `yaml:"build_container_image,omitempty" mapstructure:"build_container_image"`
+
+	// LocaleWhitelist are the locales whose share/locale message catalogs
+	// are installed, e.g. en_US. Empty keeps all of them.
+	LocaleWhitelist []string `yaml:"locale_whitelist,omitempty" mapstructure:"locale_whitelist"`
+
+	// ScheduledSync syncs the system repositories on a cron schedule
+	ScheduledSync LuetScheduledSync `yaml:"scheduled_sync,omitempty" mapstructure:"scheduled_sync"`
+}
+
+// GetParentContext returns the parent context of luet operations,
+// defaulting to context.Background()
+func (g LuetGeneralConfig) GetParentContext() context.Context {
+	if g.ParentContext == nil {
+		return context.Background()
+	}
+	return g.ParentContext
 }
 
 // LuetSolverOptions this is the option struct for the luet solver
@@ -72,6 +144,30 @@ type LuetSolverOptions struct {
 	Discount       float32    `yaml:"discount,omitempty" mapstructure:"discount"`
 	MaxAttempts    int        `yaml:"max_attempts,omitempty" mapstructure:"max_attempts"`
 	Implementation SolverType `yaml:"implementation,omitempty" mapstructure:"implementation"`
+
+	// ConflictResolutionStrategy is one of prefer-installed, prefer-newer or fail.
+	// Empty leaves conflicts to the resolver.
+	ConflictResolutionStrategy string `yaml:"conflict_strategy,omitempty" mapstructure:"conflict_strategy"`
+
+	// BacktrackLimit caps the unsat attempts made while resolving
+	// conflicts, 0 means unlimited
+	BacktrackLimit int `yaml:"backtrack_limit,omitempty" mapstructure:"backtrack_limit"`
+
+	// InstallRetriesOnConflict is how many times the install solution is
+	// computed again after a conflict, relaxing the version constraint of
+	// the lowest priority package each time
+	InstallRetriesOnConflict int `yaml:"conflict_retries,omitempty" mapstructure:"conflict_retries"`
+
+	// SolverProfiling writes a JSON-lines trace of the qlearning
+	// steps to SolverProfilingPath, see luet solver analyze
+	SolverProfiling     bool   `yaml:"profiling,omitempty" mapstructure:"profiling"`
+	SolverProfilingPath string `yaml:"profiling_path,omitempty" mapstructure:"profiling_path"`
+
+	// SolverCheckpointFile stores the qlearning progress while resolving,
+	// an interrupted resolution of the same targets is resumed from it.
+	// NoCheckpoint discards the existing checkpoint, starting fresh.
+	SolverCheckpointFile string `yaml:"solver_checkpoint,omitempty" mapstructure:"solver_checkpoint"`
+	NoCheckpoint         bool   `yaml:"-" mapstructure:"no_checkpoint"`
 }
 
 // CompactString returns a compact string to display solver options over CLI
@@ -89,12 +185,71 @@ type LuetSystemConfig struct {
 	Rootfs         string `yaml:"rootfs" mapstructure:"rootfs"`
 	PkgsCachePath  string `yaml:"pkgs_cache_path" mapstructure:"pkgs_cache_path"`
 	TmpDirBase     string `yaml:"tmpdir_base" mapstructure:"tmpdir_base"`
+
+	// DatabaseBackupInterval is the minimum time between two automatic
+	// backups of the system database. Zero disables automatic backups.
+	DatabaseBackupInterval time.Duration `yaml:"database_backup_interval,omitempty" mapstructure:"database_backup_interval"`
+
+	// DatabaseBackupRetention is the number of database backups kept,
+	// the oldest are removed. Zero keeps all of them.
+	DatabaseBackupRetention int `yaml:"database_backup_retention,omitempty" mapstructure:"database_backup_retention"`
+
+	// InstallProgressCallback is called by the installer after each package
+	// is installed, with the package atom, the current step and the total steps
+	InstallProgressCallback func(pkg string, step, total int) `yaml:"-" mapstructure:"-" json:"-"`
+
+	// MaxInstallSizeMB caps the size of a single installation, 0 means unlimited
+	MaxInstallSizeMB int64 `yaml:"max_install_size_mb,omitempty" mapstructure:"max_install_size_mb"`
+
+	// CapabilityDrop and CapabilityAdd adjust the ambient capabilities
+	// inherited by finalizer processes, e.g. CAP_NET_ADMIN
+	CapabilityDrop []string `yaml:"capability_drop,omitempty" mapstructure:"capability_drop"`
+	CapabilityAdd  []string `yaml:"capability_add,omitempty" mapstructure:"capability_add"`
+
+	// CacheCompressionAlgo is one of none, gzip, zstd or lz4. Artifacts
+	// are recompressed when written to the cache, empty keeps them as they are.
+	CacheCompressionAlgo string `yaml:"cache_compression,omitempty" mapstructure:"cache_compression"`
+
+	// ExtractorBackend is the implementation unpacking packages and images:
+	// go (default), bsdtar or libarchive, which requires the libarchive build tag
+	ExtractorBackend string `yaml:"extractor_backend,omitempty" mapstructure:"extractor_backend"`
+
+	// UnpackParallelism is the number of files of a package written
+	// concurrently by the go extractor, 1 disables it.
+	// See DefaultUnpackParallelism.
+	UnpackParallelism int `yaml:"unpack_parallelism,omitempty" mapstructure:"unpack_parallelism"`
 }
 
+const (
+	ExtractorGo         = "go"
+	ExtractorBsdtar     = "bsdtar"
+	ExtractorLibarchive = "libarchive"
+)
+
+// DefaultUnpackParallelism is used when UnpackParallelism is not set
+const DefaultUnpackParallelism = 4
+
+// GetUnpackParallelism returns the number of files written concurrently while extracting
+func (s *LuetSystemConfig) GetUnpackParallelism() int {
+	if s.UnpackParallelism == 0 {
+		return DefaultUnpackParallelism
+	}
+	return s.UnpackParallelism
+}
+
+const (
+	SnapshotBtrfs = "btrfs"
+	SnapshotZFS   = "zfs"
+)
+
 // Init reads the config and replace user-defined paths with
 // absolute paths where necessary, and construct the paths for the cache
 // and database on the real system
 func (c *LuetConfig) Init() error {
+	if err := c.CheckSchemaVersion(); err != nil {
+		return err
+	}
+
 	if err := c.System.init(); err != nil {
 		return err
 	}
@@ -108,6 +263,14 @@ func (c *LuetConfig) Init() error {
 		return err
 	}
 
+	if err := c.EvaluateConditionalRepositories(); err != nil {
+		return err
+	}
+
+	if err := c.compileBlacklist(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -146,6 +309,123 @@ func (s LuetSystemConfig) GetRepoDatabaseDirPath(name string) string {
 	return dbpath
 }
 
+// DefaultRepositoriesConfDir is the repositories config dir used when
+// none is configured, it is not required to exist
+const DefaultRepositoriesConfDir = "/etc/luet/repos.conf.d"
+
+// DatabaseFile is the name of the boltdb database files
+const DatabaseFile = "luet.db"
+
+// GetSystemDBPath returns the path of the system database: the boltdb file,
+// or the database directory for the other engines
+func (s LuetSystemConfig) GetSystemDBPath() string {
+	if s.DatabaseEngine == "boltdb" {
+		return filepath.Join(s.DatabasePath, DatabaseFile)
+	}
+	return s.DatabasePath
+}
+
+// GetSystemDBPath returns the path of the active system database
+func (c *LuetConfig) GetSystemDBPath() string {
+	return c.System.GetSystemDBPath()
+}
+
+// GetSystemRepoDatabase returns the database of a system repository, written
+// in its directory when a cached repository is synced. Bolt databases are
+// opened on each operation, so no handle is kept open.
+func (c *LuetConfig) GetSystemRepoDatabase(name string) (PackageDatabase, error) {
+	if _, err := c.GetSystemRepository(name); err != nil {
+		return nil, err
+	}
+	if c.OpenDatabase == nil {
+		return nil, errors.New("no database backend available")
+	}
+
+	path := filepath.Join(c.System.GetRepoDatabaseDirPath(name), DatabaseFile)
+	if !c.TestMode && !fileHelper.Exists(path) {
+		return nil, errors.Wrapf(ErrRepositoryNotCached, "repository %s", name)
+	}
+	return c.OpenDatabase(path), nil
+}
+
+// GetFinalSystemPackagePlan returns the packages installing pkgs would
+// install, upgrade and remove in the system, with the estimated sizes.
+// Nothing is written to the system.
+func (c *LuetConfig) GetFinalSystemPackagePlan(pkgs []string) (*InstallPlan, error) {
+	if c.PlanInstall == nil {
+		return nil, errors.New("no installer available")
+	}
+	return c.PlanInstall(pkgs)
+}
+
+// BackupDB copies the system boltdb database to a timestamped .bak file
+// in the same directory, within a read transaction so the copy is
+// consistent. Backups exceeding DatabaseBackupRetention are removed.
+func (s *LuetSystemConfig) BackupDB() error {
+	if s.DatabaseEngine != "boltdb" {
+		return nil
+	}
+
+	src := s.GetSystemDBPath()
+	if !fileHelper.Exists(src) {
+		return nil
+	}
+
+	db, err := bbolt.Open(src, 0600, &bbolt.Options{ReadOnly: true, Timeout: 30 * time.Second})
+	if err != nil {
+		return errors.Wrap(err, "while opening the system database for backup")
+	}
+	defer db.Close()
+
+	dst := fmt.Sprintf("%s.%s.bak", src, time.Now().Format("20060102150405"))
+	if err := db.View(func(tx *bbolt.Tx) error {
+		return tx.CopyFile(dst, 0600)
+	}); err != nil {
+		return errors.Wrap(err, "while backing up the system database")
+	}
+	return s.pruneDBBackups()
+}
+
+// dbBackups returns the database backups, from the oldest
+func (s *LuetSystemConfig) dbBackups() []string {
+	backups, _ := filepath.Glob(s.GetSystemDBPath() + ".*.bak")
+	sort.Strings(backups)
+	return backups
+}
+
+// pruneDBBackups removes the oldest backups exceeding DatabaseBackupRetention
+func (s *LuetSystemConfig) pruneDBBackups() error {
+	backups := s.dbBackups()
+	if s.DatabaseBackupRetention <= 0 || len(backups) <= s.DatabaseBackupRetention {
+		return nil
+	}
+	for _, b := range backups[:len(backups)-s.DatabaseBackupRetention] {
+		if err := os.Remove(b); err != nil {
+			return errors.Wrap(err, "while removing old database backups")
+		}
+	}
+	return nil
+}
+
+// lastDBBackup returns the modification time of the most recent database backup
+func (s *LuetSystemConfig) lastDBBackup() (last time.Time) {
+	for _, b := range s.dbBackups() {
+		if fi, err := os.Stat(b); err == nil && fi.ModTime().After(last) {
+			last = fi.ModTime()
+		}
+	}
+	return
+}
+
+// BackupDBIfExpired backups the system database if the last backup
+// is older than DatabaseBackupInterval
+func (s *LuetSystemConfig) BackupDBIfExpired() error {
+	if s.DatabaseBackupInterval <= 0 || time.Since(s.lastDBBackup()) < s.DatabaseBackupInterval {
+		return nil
+	}
+	return s.BackupDB()
+}
+
 func (s *LuetSystemConfig) setDBPath() error {
 	dbpath := filepath.Join(
 		s.Rootfs,
@@ -200,6 +480,9 @@ func (f Finalizers) Slice() (sl []string) {
 // all the configuration fields.
 // It includes, Logging, General, System and Solver sub configurations.
 type LuetConfig struct {
+	// ConfigSchemaVersion is the schema version the config was written for
+	ConfigSchemaVersion int `yaml:"schema_version,omitempty" mapstructure:"schema_version"`
+
 	Logging LuetLoggingConfig `yaml:"logging,omitempty" mapstructure:"logging"`
 	General LuetGeneralConfig `yaml:"general,omitempty" mapstructure:"general"`
 	System  LuetSystemConfig  `yaml:"system" mapstructure:"system"`
@@ -211,15 +494,617 @@ type LuetConfig struct {
 	ConfigFromHost       bool             `yaml:"config_from_host,omitempty" mapstructure:"config_from_host"`
 	SystemRepositories   LuetRepositories `yaml:"repositories,omitempty" mapstructure:"repositories"`
 
+	// ConditionalRepositories are added to the system repositories
+	// when their condition holds on the host
+	ConditionalRepositories []ConditionalRepo `yaml:"conditional_repos,omitempty" mapstructure:"conditional_repos"`
+
 	FinalizerEnvs Finalizers `json:"finalizer_envs,omitempty" yaml:"finalizer_envs,omitempty" mapstructure:"finalizer_envs,omitempty"`
 
+	// FinalizerEnvValidation maps finalizer env keys to the regex
+	// their whole value must match. See ValidateFinalizerEnvs.
+	FinalizerEnvValidation map[string]string `yaml:"finalizer_env_validation,omitempty" mapstructure:"finalizer_env_validation"`
+
+	// SecurityAdvisoryDB is the URL of an OSV JSON feed the packages to
+	// install are checked against. It is cached locally and fetched again
+	// after SecurityAdvisoryRefresh, see CheckSecurityAdvisories.
+	SecurityAdvisoryDB      string        `yaml:"security_advisory_db,omitempty" mapstructure:"security_advisory_db"`
+	SecurityAdvisoryRefresh time.Duration `yaml:"security_advisory_refresh,omitempty" mapstructure:"security_advisory_refresh"`
+
+	// CustomSolverPlugin is the unix socket or TCP address of an external
+	// solver plugin, used when the solver type is "grpc"
+	CustomSolverPlugin string `yaml:"custom_solver_plugin,omitempty" mapstructure:"custom_solver_plugin"`
+
+	// EnableExperimentalFeatures lists the unstable features to enable,
+	// see IsExperimentalEnabled
+	EnableExperimentalFeatures []string `yaml:"experimental,omitempty" mapstructure:"experimental"`
+
+	// PackageInstallOrder breaks the ties between the packages of the same
+	// dependency layer: topological (default), alphabetical, size-asc or size-desc
+	PackageInstallOrder string `yaml:"install_order,omitempty" mapstructure:"install_order"`
+
+	// DefaultPackageAnnotations are added to every built package,
+	// see InheritDefaultAnnotations
+	DefaultPackageAnnotations map[string]string `yaml:"default_annotations,omitempty" mapstructure:"default_annotations"`
+
+	// SolverConstraintExpansion collects the constraints of the dependency
+	// graph of the packages to install upfront, dropping the redundant
+	// ones, instead of feeding all the known packages to the solver
+	SolverConstraintExpansion bool `yaml:"expand_constraints,omitempty" mapstructure:"expand_constraints"`
+
+	// RepositoryCDN downloads the repository files through a CDN,
+	// falling back to the origin URLs
+	RepositoryCDN LuetCDNConfig `yaml:"cdn,omitempty" mapstructure:"cdn"`
+
+	// RepositoryVerification refuses the synced repository indexes
+	// which aren't signed by one of its trusted keys
+	RepositoryVerification LuetRepositoryVerification `yaml:"repo_verification,omitempty" mapstructure:"repo_verification"`
+
+	// TrustOnFirstUse pins the signing key served by a repository the
+	// first time it is synced, refusing indexes signed by other keys after
+	TrustOnFirstUse bool `yaml:"trust_on_first_use,omitempty" mapstructure:"trust_on_first_use"`
+
+	// StorageQuota refuses installs which would take the packages
+	// cache or the system database over their size limits
+	StorageQuota LuetStorageQuota `yaml:"storage_quota,omitempty" mapstructure:"storage_quota"`
+
+	// PeerReview requires the approval of a quorum of peers before installs
+	PeerReview LuetPeerReview `yaml:"peer_review,omitempty" mapstructure:"peer_review"`
+
+	// LocalCache caches the packages read from the boltdb databases
+	LocalCache LuetLocalCache `yaml:"local_cache,omitempty" mapstructure:"local_cache"`
+
+	// PackageRetentionPolicy prunes the old package versions from
+	// the packages cache after upgrades
+	PackageRetentionPolicy LuetRetentionPolicy `yaml:"retention_policy,omitempty" mapstructure:"retention_policy"`
+
+	// PackageMetadataExtras are added to the annotations of the
+	// packages stored in the system database when installed
+	PackageMetadataExtras map[string]string `yaml:"metadata_extras,omitempty" mapstructure:"metadata_extras"`
+
+	// AlternativeSelectors maps alternative names to the package patterns
+	// of their preferred providers, see AlternativesAnnotation
+	AlternativeSelectors map[string]string `yaml:"alternatives,omitempty" mapstructure:"alternatives"`
+
+	// SnapshottingBackend snapshots the rootfs before the operations
+	// changing it, rolling back to the snapshot when they fail: btrfs or zfs.
+	// btrfs replaces the rootfs subvolume, so it must not be mounted nor hold
+	// the system database. Empty disables snapshots.
+	SnapshottingBackend string `yaml:"snapshotting_backend,omitempty" mapstructure:"snapshotting_backend"`
+
+	// RepositoryFallbackChain lists, in order, the system repositories
+	// artifacts are downloaded from when their repository is unavailable.
+	// Unlike priorities, it's only about availability: the fallback
+	// repositories can be disabled.
+	RepositoryFallbackChain []string `yaml:"fallback_chain,omitempty" mapstructure:"fallback_chain"`
+
+	// RepositoryCompressionHint is the compression of the repository index
+	// files fetched when the repositories publish several: none, gzip, zstd,
+	// or auto to pick the fastest to decompress. Empty uses the default one.
+	RepositoryCompressionHint string `yaml:"preferred_compression,omitempty" mapstructure:"preferred_compression"`
+
+	// InstallManifest records the installed packages for auditing
+	InstallManifest LuetInstallManifest `yaml:"install_manifest,omitempty" mapstructure:"install_manifest"`
+
+	// APIServer serves the management API alongside the long running commands
+	APIServer LuetAPIServer `yaml:"api_server,omitempty" mapstructure:"api_server"`
+
+	// CrossCompile sets the cross compilation environment of the builds
+	// and mounts its sysroot in the build containers
+	CrossCompile LuetCrossCompile `yaml:"cross_compile,omitempty" mapstructure:"cross_compile"`
+
+	// PackageBlacklist is a list of category/name@version glob patterns
+	// of packages which are never installed
+	PackageBlacklist []string `yaml:"package_blacklist,omitempty" mapstructure:"package_blacklist"`
+
+	// PackageHolds are category/name@version glob patterns
+	// of installed packages which are not upgraded
+	PackageHolds []string `yaml:"package_holds,omitempty" mapstructure:"package_holds"`
+
+	// LicenseFilter lists SPDX license identifiers, e.g. MIT. In whitelist
+	// mode (default) only packages with one of them are installed, in
+	// blacklist mode packages with one of them are refused.
+	LicenseFilter     []string `yaml:"allowed_licenses,omitempty" mapstructure:"allowed_licenses"`
+	LicenseFilterMode string   `yaml:"license_filter_mode,omitempty" mapstructure:"license_filter_mode"`
+
+	// AutoAcceptLicenses are licenses accepted without prompting
+	// for consent, "*" accepts all of them
+	AutoAcceptLicenses []string `yaml:"auto_accept_licenses,omitempty" mapstructure:"auto_accept_licenses"`
+
+	// MaxRepositories caps the number of system repositories, 0 means unlimited
+	MaxRepositories int `yaml:"max_repositories,omitempty" mapstructure:"max_repositories"`
+
+	// SymlinkPackages are symlinks created after installing matching packages
+	SymlinkPackages []SymlinkRule `yaml:"symlink_rules,omitempty" mapstructure:"symlink_rules"`
+
+	// BuildContextEnvFilter is a list of glob patterns of host environment
+	// variables passed to builds as build arguments. "__ALL__" disables
+	// filtering.
+	BuildContextEnvFilter []string `yaml:"build_env_filter,omitempty" mapstructure:"build_env_filter"`
+
+	// BuildArgs are variables set in every build, see GetBuildEnvironment
+	BuildArgs map[string]string `yaml:"build_args,omitempty" mapstructure:"build_args"`
+
+	// ProvideVirtualPackages are packages provided by the host,
+	// considered installed when resolving dependencies
+	ProvideVirtualPackages []VirtualPackage `yaml:"host_provides,omitempty" mapstructure:"host_provides"`
+
+	// ProvidesBuildMatrix maps package atoms to their variant labels,
+	// a build is run for each combination. See ExpandBuildMatrix.
+	ProvidesBuildMatrix map[string][]string `yaml:"build_matrix,omitempty" mapstructure:"build_matrix"`
+
+	// NetworkPolicies restrict the network access of matching package builds
+	NetworkPolicies []NetworkPolicy `yaml:"network_policies,omitempty" mapstructure:"network_policies"`
+
+	// ExtraPackageDirs are package trees loaded at build time in addition
+	// to the ones given on the command line, see tree.LoadExtraDirs
+	ExtraPackageDirs []string `yaml:"extra_package_dirs,omitempty" mapstructure:"extra_package_dirs"`
+
+	// BuildSandbox disables the network and sets the read-only bind mounts
+	// of all the builds, overriding the network policies
+	BuildSandbox LuetBuildSandbox `yaml:"build_sandbox,omitempty" mapstructure:"build_sandbox"`
+
+	// PackageSourceIntegrity aborts the builds whose retrieved sources
+	// don't match the SRC_URI_HASH checksums of their specs
+	PackageSourceIntegrity LuetSourceIntegrity `yaml:"source_integrity,omitempty" mapstructure:"source_integrity"`
+
+	// RunHooksOnHost runs finalizers on the host, with the rootfs path in
+	// LUET_ROOTFS, instead of chrooted in the rootfs.
+	RunHooksOnHost bool `yaml:"hooks_on_host,omitempty" mapstructure:"hooks_on_host"`
+
+	// RootfsReadOnlyMounts are host paths bind mounted read-only at the
+	// same path in the rootfs while the finalizers run, e.g. /etc/ssl/certs
+	RootfsReadOnlyMounts []string `yaml:"rootfs_ro_mounts,omitempty" mapstructure:"rootfs_ro_mounts"`
+
+	// FinalizerTimeout is the maximum duration of a package finalizer, 0 disables it
+	FinalizerTimeout time.Duration `yaml:"finalizer_timeout,omitempty" mapstructure:"finalizer_timeout"`
+
+	// BootstrapMode skips finalizers while packages are installed, e.g. when
+	// building a rootfs from scratch. They can be run later with "luet finalize".
+	BootstrapMode bool `yaml:"bootstrap,omitempty" mapstructure:"bootstrap"`
+
+	// PackageAutoRemove removes the packages pulled in as dependencies
+	// which are not required by any other package after an uninstall
+	PackageAutoRemove bool `yaml:"auto_remove,omitempty" mapstructure:"auto_remove"`
+
+	// SkipProvides are virtual packages whose provides are ignored by
+	// the solver, to avoid false conflicts between their providers
+	SkipProvides []string `yaml:"skip_provides,omitempty" mapstructure:"skip_provides"`
+
+	// RootfsLayout is the filesystem layout convention of the rootfs:
+	// fhs (default), usrmerge or custom. With custom, LayoutMapping
+	// redirects package paths, e.g. "bin": "usr/bin".
+	RootfsLayout  string            `yaml:"rootfs_layout,omitempty" mapstructure:"rootfs_layout"`
+	LayoutMapping map[string]string `yaml:"layout_mapping,omitempty" mapstructure:"layout_mapping"`
+
+	// PackageRequiresConsent are patterns of packages which
+	// are installed only after an explicit confirmation
+	PackageRequiresConsent []string `yaml:"requires_consent,omitempty" mapstructure:"requires_consent"`
+
+	// PackageInteractiveInstall prompts before extracting each package
+	// when running in a terminal, --yes accepts all of them
+	PackageInteractiveInstall bool `yaml:"interactive_install,omitempty" mapstructure:"interactive_install"`
+
+	// DocumentationStrip skips man pages, info pages and documentation
+	// when extracting packages
+	DocumentationStrip bool `yaml:"strip_docs,omitempty" mapstructure:"strip_docs"`
+
+	// GlobalExcludePatterns are glob patterns of files skipped during package extraction
+	GlobalExcludePatterns []string `yaml:"global_excludes,omitempty" mapstructure:"global_excludes"`
+	// PackageExcludePatterns overrides GlobalExcludePatterns for a package atom
+	PackageExcludePatterns map[string][]string `yaml:"package_excludes,omitempty" mapstructure:"package_excludes"`
+
+	// Vault settings used to retrieve repository credentials.
+	// VaultRepoCreds maps a repository name to its secret path.
+	VaultAddress   string            `yaml:"vault_address,omitempty" mapstructure:"vault_address"`
+	VaultToken     string            `yaml:"vault_token,omitempty" mapstructure:"vault_token"`
+	VaultRoleID    string            `yaml:"vault_role_id,omitempty" mapstructure:"vault_role_id"`
+	VaultSecretID  string            `yaml:"vault_secret_id,omitempty" mapstructure:"vault_secret_id"`
+	VaultRepoCreds map[string]string `yaml:"vault_repo_credentials,omitempty" mapstructure:"vault_repo_credentials"`
+
+	// VaultSecretTTL is how long the secrets without a lease duration,
+	// as the KV version 2 ones, are cached. Defaults to DefaultVaultSecretTTL.
+	VaultSecretTTL time.Duration `yaml:"vault_secret_ttl,omitempty" mapstructure:"vault_secret_ttl"`
+
+	// RepositoryCredentialRefresh is how long before their expiry Vault
+	// secrets and OAuth tokens are refreshed in background
+	RepositoryCredentialRefresh time.Duration `yaml:"credential_refresh_interval,omitempty" mapstructure:"credential_refresh_interval"`
+
+	// PackageSignaturePolicy is how signature failures are handled: ignore, warn or error.
+	// Signatures are checked on docker repositories, see VerifySignatures.
+	PackageSignaturePolicy string `yaml:"signature_policy,omitempty" mapstructure:"signature_policy"`
+
+	// LayeredConfig are config files merged after this one, in order.
+	// See ConfigIncludes.
+	LayeredConfig []string `yaml:"include,omitempty" mapstructure:"include"`
+
+	// PostSyncHooks are executables run after each repository sync,
+	// with the repository name as argument
+	PostSyncHooks []string `yaml:"post_sync_hooks,omitempty" mapstructure:"post_sync_hooks"`
+
+	// SystemRepositoryWeights are the weights of the repositories, keyed by name.
+	// Among repositories with the same priority serving an identical package,
+	// one is picked in proportion to its weight. Unlisted repositories weigh 1,
+	// zero disables them.
+	SystemRepositoryWeights map[string]int `yaml:"repository_weights,omitempty" mapstructure:"repository_weights"`
+
+	// TrustLevel is the least trusted repository level used for
+	// installing packages: stable, testing or unstable
+	TrustLevel string `yaml:"trust_level,omitempty" mapstructure:"trust_level"`
+
+	// RepositoryCachePriority selects the repository data used on sync:
+	// cache-first (default) fetches it only when the cache is older than
+	// a day, live-first always fetches it falling back to the cache, and
+	// cache-only never touches the network
+	RepositoryCachePriority string `yaml:"repo_cache_priority,omitempty" mapstructure:"repo_cache_priority"`
+
+	// RepositoryProtocol is the protocol used to download from http
+	// repositories: http1, http2 (default) or http3, which uses QUIC
+	// for https urls
+	RepositoryProtocol string `yaml:"repo_protocol,omitempty" mapstructure:"repo_protocol"`
+
+	// EnvironmentSnapshotOnFailure dumps the config, the install plan and
+	// the environment to TmpDirBase when an install fails
+	EnvironmentSnapshotOnFailure bool `yaml:"env_snapshot_on_failure,omitempty" mapstructure:"env_snapshot_on_failure"`
+
+	// PackageChecksumDB is the URL of an RFC 6962 transparency log the
+	// checksums of the downloaded artifacts are submitted to. Downloads
+	// fail unless the log proves the inclusion of the checksum.
+	PackageChecksumDB string `yaml:"checksum_transparency_log,omitempty" mapstructure:"checksum_transparency_log"`
+
+	// PackageChecksumDBKey is the path of the PEM public key of the
+	// transparency log, verifying the signature of its tree heads
+	PackageChecksumDBKey string `yaml:"checksum_transparency_log_key,omitempty" mapstructure:"checksum_transparency_log_key"`
+
+	// PlatformOverride is the os/arch platform the system is managed as,
+	// instead of the running host one. See GetSystemOS and GetSystemArch.
+	PlatformOverride string `yaml:"platform_override,omitempty" mapstructure:"platform_override"`
+
+	// PostSolveHook is called with the plan computed by the solver,
+	// it can alter it before it gets executed. Packages are installed
+	// in the order of the returned plan, upgrades first, and are checked
+	// against the blacklist and the allowed licenses. Returning a nil
+	// plan aborts the operation.
+	PostSolveHook func(plan *InstallPlan) (*InstallPlan, error) `yaml:"-" mapstructure:"-" json:"-"`
+
+	// RepoSyncFilter selects the index entries kept while syncing a
+	// repository. When nil, all the packages are synced.
+	RepoSyncFilter func(repo *LuetRepository, p *Package) bool `yaml:"-" mapstructure:"-" json:"-"`
+
+	// AnnotationFilters restricts the packages available to the solver
+	// to the ones with matching annotations
+	AnnotationFilters []AnnotationFilter `yaml:"annotation_filters,omitempty" mapstructure:"annotation_filters"`
+
 	ConfigProtectConfFiles []config.ConfigProtectConfFile `yaml:"-" mapstructure:"-"`
 
+	// Version is the luet version and InstalledPackages lists the system
+	// packages, both are set by the cli and used in bug reports
+	Version           string                   `yaml:"-" mapstructure:"-" json:"-"`
+	InstalledPackages func() (Packages, error) `yaml:"-" mapstructure:"-" json:"-"`
+
+	// SystemDatabase and RepositoryDatabases return the system database and
+	// the databases of the synced repositories, see CompositePackageDatabase
+	SystemDatabase      func() PackageDatabase            `yaml:"-" mapstructure:"-" json:"-"`
+	RepositoryDatabases func() ([]PackageDatabase, error) `yaml:"-" mapstructure:"-" json:"-"`
+
+	// OpenDatabase opens the database stored at path, see GetSystemRepoDatabase
+	OpenDatabase func(path string) PackageDatabase `yaml:"-" mapstructure:"-" json:"-"`
+
+	// PlanInstall computes the plan of installing the packages in the
+	// system, see GetFinalSystemPackagePlan
+	PlanInstall func(pkgs []string) (*InstallPlan, error) `yaml:"-" mapstructure:"-" json:"-"`
+
+	// TestMode redirects the writes away from the system, see SetTestMode.
+	// It can't be set from a config file.
+	TestMode bool     `yaml:"-" mapstructure:"-" json:"-"`
+	TestingT TestingT `yaml:"-" mapstructure:"-" json:"-"`
+
+	blacklist     *packageBlacklist
+	testFiles     *memFiles
+	testDatabases *memDatabases
 }
 
+// ErrInstallSizeLimitExceeded is returned when an installation exceeds MaxInstallSizeMB
+var ErrInstallSizeLimitExceeded = errors.New("install size limit exceeded")
+
+// ErrConsentRequired is returned when a package requires consent
+// to be installed, and it can't be asked
+var ErrConsentRequired = errors.New("package requires consent to be installed")
+
+// ErrTooManyRepositories is returned when the system repositories exceed MaxRepositories
+var ErrTooManyRepositories = errors.New("too many repositories")
+
 // AddSystemRepository is just syntax sugar to add a repository in the system set
-func (c *LuetConfig) AddSystemRepository(r LuetRepository) {
+func (c *LuetConfig) AddSystemRepository(r LuetRepository) error {
+	if c.MaxRepositories > 0 && len(c.SystemRepositories) >= c.MaxRepositories {
+		return errors.Wrapf(ErrTooManyRepositories, "can't add repository %s, maximum is %d", r.Name, c.MaxRepositories)
+	}
 	c.SystemRepositories = append(c.SystemRepositories, r)
+	return nil
+}
+
+// shellIdentifier matches the valid names of environment variables
+var shellIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validRootfs checks the rootfs is an absolute or a valid relative path,
+// which is a directory if it exists
+func validRootfs(rootfs string) error {
+	if rootfs == "" {
+		return nil
+	}
+	if strings.ContainsRune(rootfs, 0) {
+		return fmt.Errorf("invalid rootfs '%s'", rootfs)
+	}
+	abs, err := fileHelper.Rel2Abs(rootfs)
+	if err != nil {
+		return errors.Wrapf(err, "invalid rootfs '%s'", rootfs)
+	}
+	if fi, err := os.Stat(abs); err == nil && !fi.IsDir() {
+		return fmt.Errorf("invalid rootfs '%s': not a directory", rootfs)
+	}
+	return nil
+}
+
+// Validate checks the configuration consistency, it returns
+// all the errors found
+func (c *LuetConfig) Validate() error {
+	var errs error
+
+	switch c.System.DatabaseEngine {
+	case "", "boltdb", "memory":
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("invalid database engine '%s'", c.System.DatabaseEngine))
+	}
+
+	if c.System.DatabaseBackupRetention < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("invalid database backup retention %d", c.System.DatabaseBackupRetention))
+	}
+
+	rootfsErr := validRootfs(c.System.Rootfs)
+	if rootfsErr != nil {
+		errs = multierror.Append(errs, rootfsErr)
+	}
+
+	if c.Solver.LearnRate < 0 || c.Solver.LearnRate > 1 {
+		errs = multierror.Append(errs, fmt.Errorf("invalid solver learn rate %v, must be between 0 and 1", c.Solver.LearnRate))
+	}
+	if c.Solver.Discount < 0 || c.Solver.Discount > 1 {
+		errs = multierror.Append(errs, fmt.Errorf("invalid solver discount %v, must be between 0 and 1", c.Solver.Discount))
+	}
+
+	for _, dir := range c.RepositoriesConfDir {
+		// Repositories are read from the rootfs, see loadRepositories
+		if !c.ConfigFromHost && rootfsErr == nil {
+			dir = filepath.Join(c.System.Rootfs, dir)
+		}
+		if !fileHelper.Exists(dir) {
+			errs = multierror.Append(errs, fmt.Errorf("repositories config dir %s doesn't exist", dir))
+		}
+	}
+
+	for _, kv := range c.FinalizerEnvs {
+		if !shellIdentifier.MatchString(kv.Key) {
+			errs = multierror.Append(errs, fmt.Errorf("invalid finalizer env name '%s'", kv.Key))
+		}
+	}
+
+	switch c.Solver.ConflictResolutionStrategy {
+	case "", ConflictPreferInstalled, ConflictPreferNewer, ConflictFail:
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("invalid conflict resolution strategy '%s'", c.Solver.ConflictResolutionStrategy))
+	}
+
+	if c.Solver.InstallRetriesOnConflict < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("invalid conflict retries %d", c.Solver.InstallRetriesOnConflict))
+	}
+
+	if !IsValidTrustLevel(c.TrustLevel) {
+		errs = multierror.Append(errs, fmt.Errorf("invalid trust level '%s'", c.TrustLevel))
+	}
+	for _, r := range c.SystemRepositories {
+		if !IsValidTrustLevel(r.TrustLevel) {
+			errs = multierror.Append(errs, fmt.Errorf("invalid trust level '%s' for repository %s", r.TrustLevel, r.Name))
+		}
+	}
+
+	switch c.RepositoryCachePriority {
+	case "", RepoCacheLiveFirst, RepoCacheCacheFirst, RepoCacheCacheOnly:
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("invalid repository cache priority '%s'", c.RepositoryCachePriority))
+	}
+
+	switch c.RepositoryProtocol {
+	case "", RepoProtocolHTTP1, RepoProtocolHTTP2, RepoProtocolHTTP3:
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("invalid repository protocol '%s'", c.RepositoryProtocol))
+	}
+
+	if c.PlatformOverride != "" {
+		if _, _, err := parsePlatform(c.PlatformOverride); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	for name, w := range c.SystemRepositoryWeights {
+		if w < 0 {
+			errs = multierror.Append(errs, fmt.Errorf("invalid weight %d for repository %s", w, name))
+		}
+	}
+
+	for _, err := range c.ValidateFinalizerEnvs() {
+		errs = multierror.Append(errs, err)
+	}
+
+	for _, m := range c.RootfsReadOnlyMounts {
+		if !filepath.IsAbs(m) || filepath.Clean(m) == "/" {
+			errs = multierror.Append(errs, fmt.Errorf("invalid rootfs read-only mount '%s'", m))
+		}
+	}
+
+	for _, f := range c.AnnotationFilters {
+		if err := f.Validate(); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	for _, s := range c.PackageRequiresConsent {
+		if _, err := parsePackagePattern(s); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	for _, s := range c.AlternativeSelectors {
+		if _, err := parsePackagePattern(s); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	for _, s := range c.PackageHolds {
+		if _, err := parsePackagePattern(s); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	if c.General.GossipEnabled {
+		if _, err := c.General.GetGossipSecretKey(); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	switch CompressionImplementation(c.System.CacheCompressionAlgo) {
+	case "", None, GZip, Zstandard, LZ4:
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("invalid cache compression '%s'", c.System.CacheCompressionAlgo))
+	}
+
+	switch c.System.ExtractorBackend {
+	case "", ExtractorGo, ExtractorBsdtar, ExtractorLibarchive:
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("invalid extractor backend '%s'", c.System.ExtractorBackend))
+	}
+
+	if c.System.UnpackParallelism < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("invalid unpack parallelism %d", c.System.UnpackParallelism))
+	}
+
+	if c.General.FinalizeParallelism < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("invalid finalize parallelism %d", c.General.FinalizeParallelism))
+	}
+
+	if err := c.validateChecksumLog(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	if err := c.RepositoryCDN.validate(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	if err := c.RepositoryVerification.validate(c.TrustOnFirstUse); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	if err := c.StorageQuota.validate(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	if err := c.PeerReview.validate(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	if err := c.LocalCache.validate(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	if err := c.BuildSandbox.validate(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	if err := c.PackageSourceIntegrity.validate(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	if err := c.PackageRetentionPolicy.validate(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	if err := c.CrossCompile.validate(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	if err := c.APIServer.validate(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	if err := c.InstallManifest.validate(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	if err := c.General.ScheduledSync.validate(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	switch c.RepositoryCompressionHint {
+	case "", CompressionHintAuto, string(None), string(GZip), string(Zstandard):
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("invalid preferred compression '%s'", c.RepositoryCompressionHint))
+	}
+
+	switch c.SnapshottingBackend {
+	case "", SnapshotBtrfs, SnapshotZFS:
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("invalid snapshotting backend '%s'", c.SnapshottingBackend))
+	}
+
+	switch c.PackageInstallOrder {
+	case "", InstallOrderTopological, InstallOrderAlphabetical, InstallOrderSizeAsc, InstallOrderSizeDesc:
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("invalid install order '%s'", c.PackageInstallOrder))
+	}
+
+	switch c.LicenseFilterMode {
+	case "", LicenseFilterWhitelist, LicenseFilterBlacklist:
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("invalid license filter mode '%s'", c.LicenseFilterMode))
+	}
+
+	switch c.PackageSignaturePolicy {
+	case "", SignaturePolicyIgnore, SignaturePolicyWarn, SignaturePolicyError:
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("invalid signature policy '%s'", c.PackageSignaturePolicy))
+	}
+
+	switch c.RootfsLayout {
+	case "", RootfsLayoutFHS, RootfsLayoutUsrMerge:
+	case RootfsLayoutCustom:
+		if len(c.LayoutMapping) == 0 {
+			errs = multierror.Append(errs, errors.New("custom rootfs layout requires a layout mapping"))
+		}
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("invalid rootfs layout '%s'", c.RootfsLayout))
+	}
+
+	for _, r := range c.ConditionalRepositories {
+		if _, err := EvaluateCondition(r.Condition, ConditionFacts{}); err != nil {
+			errs = multierror.Append(errs, errors.Wrapf(err, "conditional repository %s", r.Repository.Name))
+		}
+	}
+
+	for atom := range c.ProvidesBuildMatrix {
+		if _, err := c.ExpandBuildMatrix(atom); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	for _, v := range c.ProvideVirtualPackages {
+		if v.Name == "" || v.Version == "" {
+			errs = multierror.Append(errs, fmt.Errorf("host provided package '%s/%s' needs a name and a version", v.Category, v.Name))
+		}
+	}
+
+	if c.MaxRepositories > 0 && len(c.SystemRepositories) > c.MaxRepositories {
+		errs = multierror.Append(errs, errors.Wrapf(ErrTooManyRepositories, "%d repositories configured, maximum is %d", len(c.SystemRepositories), c.MaxRepositories))
+	}
+
+	return errs
 }
 
 // SetFinalizerEnv sets a k,v couple among the finalizers
@@ -243,6 +1128,56 @@ func (c *LuetConfig) SetFinalizerEnv(k, v string) {
 	c.FinalizerEnvs = envs
 }
 
+// ErrFinalizerKeyNotFound is returned when removing a finalizer env which is not set
+var ErrFinalizerKeyNotFound = errors.New("finalizer env key not found")
+
+// RemoveFinalizer removes the finalizer env with the given key
+func (c *LuetConfig) RemoveFinalizer(k string) error {
+	envs := []FinalizerEnv{}
+	for _, kv := range c.FinalizerEnvs {
+		if kv.Key != k {
+			envs = append(envs, kv)
+		}
+	}
+	if len(envs) == len(c.FinalizerEnvs) {
+		return errors.Wrap(ErrFinalizerKeyNotFound, k)
+	}
+
+	c.FinalizerEnvs = envs
+	return nil
+}
+
+// ClearFinalizerEnvs removes all the finalizer envs
+func (c *LuetConfig) ClearFinalizerEnvs() {
+	c.FinalizerEnvs = Finalizers{}
+}
+
+// ValidateFinalizerEnvs checks the finalizer envs against the regexes of
+// FinalizerEnvValidation. Envs which are not set are not checked.
+func (c *LuetConfig) ValidateFinalizerEnvs() []error {
+	var errs []error
+
+	keys := []string{}
+	for k := range c.FinalizerEnvValidation {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		re, err := regexp.Compile("^(?:" + c.FinalizerEnvValidation[k] + ")$")
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "invalid validation regex for finalizer env %s", k))
+			continue
+		}
+		for _, kv := range c.FinalizerEnvs {
+			if kv.Key == k && !re.MatchString(kv.Value) {
+				errs = append(errs, fmt.Errorf("finalizer env %s value '%s' doesn't match '%s'", k, kv.Value, c.FinalizerEnvValidation[k]))
+			}
+		}
+	}
+	return errs
+}
+
 // YAML returns the config in yaml format
 func (c *LuetConfig) YAML() ([]byte, error) {
 	return yaml.Marshal(c)
@@ -297,8 +1232,9 @@ func (c *LuetConfig) loadRepositories() error {
 				continue
 			}
 
-
-			c.AddSystemRepository(*r)
+			if err := c.AddSystemRepository(*r); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
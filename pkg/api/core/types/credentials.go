@@ -0,0 +1,390 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+)
+
+// RepositoryCredentialsEnvPrefix is the prefix of the environment variables
+// holding repository credentials, in the form LUET_REPO_AUTH_<NAME>_<KEY>=value.
+// It is distinct from the LUET_REPO_<N>_ variables defining repositories.
+const RepositoryCredentialsEnvPrefix = "LUET_REPO_AUTH_"
+
+// GetRepositoryCredentials returns the authentication of the repository,
+// looking up in order the environment, Vault, the keyring and the
+// repository configuration.
+func (c *LuetConfig) GetRepositoryCredentials(r *LuetRepository) (map[string]string, error) {
+	if auth := repositoryCredentialsFromEnv(r.Name, os.Environ()); len(auth) > 0 {
+		return auth, nil
+	}
+
+	if path, ok := c.VaultRepoCreds[r.Name]; ok && c.VaultAddress != "" {
+		auth, err := c.vault().read(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "while reading credentials of repository %s from vault", r.Name)
+		}
+		if len(auth) > 0 {
+			return auth, nil
+		}
+	}
+
+	auth, err := keyringCredentials(r.Name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while reading credentials of repository %s from the keyring", r.Name)
+	}
+	if len(auth) > 0 {
+		return auth, nil
+	}
+
+	if r.Authentication[OAuthTokenURLKey] != "" {
+		auth, err := oauthToken(r.Authentication, false)
+		if err != nil {
+			return nil, errors.Wrapf(err, "while requesting a token for repository %s", r.Name)
+		}
+		return auth, nil
+	}
+
+	return r.Authentication, nil
+}
+
+func repositoryCredentialsFromEnv(name string, env []string) map[string]string {
+	prefix := RepositoryCredentialsEnvPrefix + envName(name) + "_"
+	auth := map[string]string{}
+	for _, e := range env {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 || !strings.HasPrefix(kv[0], prefix) {
+			continue
+		}
+		auth[strings.ToLower(strings.TrimPrefix(kv[0], prefix))] = kv[1]
+	}
+	return auth
+}
+
+func envName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+type cachedCredential struct {
+	data    map[string]string
+	expires time.Time
+}
+
+// credentialCache holds the Vault secrets and the OAuth tokens until they expire.
+// It is shared as the config is copied around by value.
+var credentialCache = struct {
+	sync.Mutex
+	secrets map[string]cachedCredential
+}{secrets: map[string]cachedCredential{}}
+
+// DefaultVaultSecretTTL is how long the Vault secrets without a lease,
+// as the KV version 2 ones, are cached if VaultSecretTTL is not set
+const DefaultVaultSecretTTL = 5 * time.Minute
+
+// credentialExpiry returns when the cached credential expires
+func credentialExpiry(key string) (time.Time, bool) {
+	credentialCache.Lock()
+	defer credentialCache.Unlock()
+	s, ok := credentialCache.secrets[key]
+	return s.expires, ok
+}
+
+// cachedCredentials returns the cached credential if not expired.
+// The lock is not held while fetching them, so concurrent lookups
+// of other credentials don't wait for the requests.
+func cachedCredentials(key string) (map[string]string, bool) {
+	credentialCache.Lock()
+	defer credentialCache.Unlock()
+	s, ok := credentialCache.secrets[key]
+	if !ok || !time.Now().Before(s.expires) {
+		return nil, false
+	}
+	return s.data, true
+}
+
+func cacheCredentials(key string, data map[string]string, ttl time.Duration) {
+	credentialCache.Lock()
+	defer credentialCache.Unlock()
+	credentialCache.secrets[key] = cachedCredential{data: data, expires: time.Now().Add(ttl)}
+}
+
+type vaultClient struct {
+	address, token, roleID, secretID string
+	ttl                              time.Duration
+	client                           *http.Client
+}
+
+func (c *LuetConfig) vault() *vaultClient {
+	return &vaultClient{
+		address:  strings.TrimSuffix(c.VaultAddress, "/"),
+		token:    c.VaultToken,
+		roleID:   c.VaultRoleID,
+		secretID: c.VaultSecretID,
+		ttl:      c.VaultSecretTTL,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type vaultResponse struct {
+	LeaseDuration int                    `json:"lease_duration"`
+	Data          map[string]interface{} `json:"data"`
+	Auth          struct {
+		ClientToken string `json:"client_token"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+func (v *vaultClient) do(method, path, token string, body interface{}) (*vaultResponse, error) {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest(method, v.address+"/v1/"+strings.TrimPrefix(path, "/"), &payload)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	res := &vaultResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		return nil, errors.Wrap(err, "invalid vault response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault returned %d: %s", resp.StatusCode, strings.Join(res.Errors, ", "))
+	}
+	return res, nil
+}
+
+func (v *vaultClient) login() (string, error) {
+	if v.token != "" || v.roleID == "" {
+		return v.token, nil
+	}
+	res, err := v.do(http.MethodPost, "auth/approle/login", "", map[string]string{
+		"role_id":   v.roleID,
+		"secret_id": v.secretID,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "approle login failed")
+	}
+	return res.Auth.ClientToken, nil
+}
+
+// read returns the secret at path, KV version 1 and 2 are both supported
+func (v *vaultClient) read(path string) (map[string]string, error) {
+	return v.get(path, false)
+}
+
+func (v *vaultClient) key(path string) string {
+	return v.address + "/" + path
+}
+
+// get reads the secret at path, bypassing the cache if forced
+func (v *vaultClient) get(path string, force bool) (map[string]string, error) {
+	key := v.key(path)
+	if s, ok := cachedCredentials(key); ok && !force {
+		return s, nil
+	}
+
+	token, err := v.login()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := v.do(http.MethodGet, path, token, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data := res.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+	secret := map[string]string{}
+	for k, val := range data {
+		secret[k] = fmt.Sprintf("%v", val)
+	}
+
+	ttl := time.Duration(res.LeaseDuration) * time.Second
+	if ttl <= 0 {
+		ttl = v.ttl
+	}
+	if ttl <= 0 {
+		ttl = DefaultVaultSecretTTL
+	}
+	cacheCredentials(key, secret, ttl)
+	return secret, nil
+}
+
+// Repository authentication keys of the OAuth2 client credentials flow.
+// The token obtained is set as "bearer" and "registrytoken".
+const (
+	OAuthTokenURLKey     = "token_url"
+	OAuthClientIDKey     = "client_id"
+	OAuthClientSecretKey = "client_secret"
+	OAuthScopeKey        = "scope"
+)
+
+type oauthResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	Error       string `json:"error"`
+}
+
+func oauthKey(auth map[string]string) string {
+	return auth[OAuthTokenURLKey] + "#" + auth[OAuthClientIDKey]
+}
+
+// oauthToken exchanges the client credentials for a token, bypassing the cache if forced
+func oauthToken(auth map[string]string, force bool) (map[string]string, error) {
+	key := oauthKey(auth)
+	if s, ok := cachedCredentials(key); ok && !force {
+		return s, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {auth[OAuthClientIDKey]},
+		"client_secret": {auth[OAuthClientSecretKey]},
+	}
+	if scope := auth[OAuthScopeKey]; scope != "" {
+		form.Set("scope", scope)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.PostForm(auth[OAuthTokenURLKey], form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	res := &oauthResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		return nil, errors.Wrap(err, "invalid token response")
+	}
+	if resp.StatusCode != http.StatusOK || res.AccessToken == "" {
+		return nil, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, res.Error)
+	}
+
+	token := map[string]string{"bearer": res.AccessToken, "registrytoken": res.AccessToken}
+	if res.ExpiresIn > 0 {
+		cacheCredentials(key, token, time.Duration(res.ExpiresIn)*time.Second)
+	}
+	return token, nil
+}
+
+// tokenCredentials returns the cache key of the expiring credentials of the
+// repository, and a function fetching them again. It is nil if there are none.
+func (c *LuetConfig) tokenCredentials(r LuetRepository) (string, func() error) {
+	if len(repositoryCredentialsFromEnv(r.Name, os.Environ())) > 0 {
+		return "", nil
+	}
+	if path, ok := c.VaultRepoCreds[r.Name]; ok && c.VaultAddress != "" {
+		v := c.vault()
+		return v.key(path), func() error {
+			_, err := v.get(path, true)
+			return err
+		}
+	}
+	if r.Authentication[OAuthTokenURLKey] != "" {
+		auth := r.Authentication
+		return oauthKey(auth), func() error {
+			_, err := oauthToken(auth, true)
+			return err
+		}
+	}
+	return "", nil
+}
+
+// RefreshRepositoryCredentials fetches again the token based credentials of the
+// system repositories expiring within RepositoryCredentialRefresh
+func (c *LuetConfig) RefreshRepositoryCredentials() error {
+	var errs error
+	for _, r := range c.SystemRepositories {
+		key, refresh := c.tokenCredentials(r)
+		if refresh == nil {
+			continue
+		}
+		if expires, ok := credentialExpiry(key); ok && time.Until(expires) >= c.RepositoryCredentialRefresh {
+			continue
+		}
+		if err := refresh(); err != nil {
+			errs = multierror.Append(errs, errors.Wrapf(err, "while refreshing credentials of repository %s", r.Name))
+		}
+	}
+	return errs
+}
+
+// StartCredentialRefresh refreshes the repository credentials in background
+// until ctx is done. Errors are passed to onError.
+func (c *LuetConfig) StartCredentialRefresh(ctx context.Context, onError func(error)) {
+	if c.RepositoryCredentialRefresh <= 0 {
+		return
+	}
+
+	cfg := *c
+	cfg.SystemRepositories = append(LuetRepositories{}, c.SystemRepositories...)
+
+	interval := cfg.RepositoryCredentialRefresh / 3
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			if err := cfg.RefreshRepositoryCredentials(); err != nil && onError != nil {
+				onError(err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
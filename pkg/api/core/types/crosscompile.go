@@ -0,0 +1,72 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import "fmt"
+
+const (
+	// CrossCompileSysroot is where the sysroot is mounted in the build container
+	CrossCompileSysroot = "/sysroot"
+	// CrossCompileSysrootContext is the name of the build context holding the sysroot
+	CrossCompileSysrootContext = "sysroot"
+)
+
+// LuetCrossCompile builds the packages for TargetArch on a HostArch host,
+// e.g. x86_64 and aarch64
+type LuetCrossCompile struct {
+	HostArch    string `yaml:"host_arch,omitempty" mapstructure:"host_arch"`
+	TargetArch  string `yaml:"target_arch,omitempty" mapstructure:"target_arch"`
+	SysrootPath string `yaml:"sysroot,omitempty" mapstructure:"sysroot"`
+}
+
+// Enabled returns true if a target arch is set
+func (c LuetCrossCompile) Enabled() bool {
+	return c.TargetArch != ""
+}
+
+// Env returns the build environment of cross compilations
+func (c LuetCrossCompile) Env() []string {
+	if !c.Enabled() {
+		return nil
+	}
+	env := []string{
+		"CROSSCOMPILE=1",
+		fmt.Sprintf("HOST=%s-linux-gnu", c.HostArch),
+		fmt.Sprintf("TARGET=%s-linux-gnu", c.TargetArch),
+	}
+	if c.SysrootPath != "" {
+		env = append(env, "SYSROOT="+CrossCompileSysroot)
+	}
+	return env
+}
+
+// Mounts returns the RUN mounts of the sysroot build context
+func (c LuetCrossCompile) Mounts() []string {
+	if !c.Enabled() || c.SysrootPath == "" {
+		return nil
+	}
+	return []string{fmt.Sprintf("type=bind,from=%s,target=%s", CrossCompileSysrootContext, CrossCompileSysroot)}
+}
+
+func (c LuetCrossCompile) validate() error {
+	if c.Enabled() && c.HostArch == "" {
+		return fmt.Errorf("cross compiling to %s requires a host arch", c.TargetArch)
+	}
+	if !c.Enabled() && c.SysrootPath != "" {
+		return fmt.Errorf("a sysroot requires a cross compilation target arch")
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"path"
+	"strings"
+)
+
+// DocumentationDirs are the share directories whose content
+// is skipped with strip_docs
+var DocumentationDirs = []string{"share/man", "share/doc", "share/info", "share/gtk-doc"}
+
+// IsDocumentationStripped returns true if strip_docs is enabled and the
+// file is below one of the DocumentationDirs, e.g. usr/share/man/man1/ls.1
+func (c *LuetConfig) IsDocumentationStripped(file string) bool {
+	if !c.DocumentationStrip {
+		return false
+	}
+
+	p := path.Clean("/" + file)
+	for _, d := range DocumentationDirs {
+		if strings.Contains(p, "/"+d+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EnvironmentSnapshot is the state dumped when an install fails,
+// see EnvironmentSnapshotOnFailure
+type EnvironmentSnapshot struct {
+	Time        string      `yaml:"time"`
+	Error       string      `yaml:"error"`
+	Plan        interface{} `yaml:"plan,omitempty"`
+	Config      interface{} `yaml:"config"`
+	Environment []string    `yaml:"environment"`
+}
+
+// WriteEnvironmentSnapshot writes the snapshot of a failed install to
+// TmpDirBase/luet-failure-<timestamp>.yaml and returns its path.
+// Secrets are redacted from the config and the environment.
+func (c *LuetConfig) WriteEnvironmentSnapshot(plan *InstallPlan, failure error) (string, error) {
+	cfg, secrets, err := c.redactedYAML()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	snapshot := EnvironmentSnapshot{
+		Time:        now.Format(time.RFC3339),
+		Environment: redactEnviron(os.Environ(), secrets),
+	}
+	if failure != nil {
+		snapshot.Error = string(scrub([]byte(failure.Error()), secrets))
+	}
+	if err := yaml.Unmarshal(cfg, &snapshot.Config); err != nil {
+		return "", err
+	}
+	if plan != nil {
+		// Go through JSON, the plan is tagged for it
+		data, err := json.Marshal(plan)
+		if err != nil {
+			return "", err
+		}
+		if err := yaml.Unmarshal(data, &snapshot.Plan); err != nil {
+			return "", err
+		}
+	}
+
+	data, err := yaml.Marshal(snapshot)
+	if err != nil {
+		return "", err
+	}
+
+	dir := c.System.TmpDirBase
+	if !c.TestMode {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return "", err
+		}
+	}
+	path := filepath.Join(dir, fmt.Sprintf("luet-failure-%s.yaml", now.Format("20060102150405")))
+	return path, c.WriteToFile(path, data, 0600)
+}
+
+// redactEnviron redacts the values of the secret looking variables,
+// and the config secrets leaking in the others
+func redactEnviron(env []string, secrets []string) []string {
+	res := []string{}
+	for _, kv := range env {
+		k, v := kv, ""
+		if i := strings.Index(kv, "="); i >= 0 {
+			k, v = kv[:i], kv[i+1:]
+		}
+		if secretKey.MatchString(k) {
+			v = redacted
+		}
+		res = append(res, k+"="+string(scrub([]byte(v), secrets)))
+	}
+	return res
+}
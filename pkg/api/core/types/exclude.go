@@ -0,0 +1,51 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"path"
+	"strings"
+)
+
+// GetExcludePatterns returns the file exclusion patterns for the package.
+// An entry in PackageExcludePatterns keyed by the package atom (category/name)
+// overrides the global ones.
+func (c *LuetConfig) GetExcludePatterns(p *Package) []string {
+	if patterns, ok := c.PackageExcludePatterns[p.GetCategory()+"/"+p.GetName()]; ok {
+		return patterns
+	}
+	return c.GlobalExcludePatterns
+}
+
+// IsFileExcluded returns true if the file, relative to the package root,
+// has to be skipped while installing the package. A pattern matching
+// a directory excludes all its content.
+func (c *LuetConfig) IsFileExcluded(p *Package, file string) bool {
+	patterns := c.GetExcludePatterns(p)
+	if len(patterns) == 0 {
+		return false
+	}
+
+	file = strings.TrimPrefix(path.Clean("/"+file), "/")
+	for f := file; f != "." && f != ""; f = path.Dir(f) {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(strings.TrimPrefix(pattern, "/"), f); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import "fmt"
+
+// IsExperimentalEnabled returns true if the feature is listed in
+// EnableExperimentalFeatures. Absent features keep their stable behavior.
+func (c *LuetConfig) IsExperimentalEnabled(feature string) bool {
+	for _, f := range c.EnableExperimentalFeatures {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// ExperimentalWarnings returns the warnings to print on startup,
+// one for each enabled experimental feature
+func (c *LuetConfig) ExperimentalWarnings() []string {
+	res := []string{}
+	seen := map[string]bool{}
+	for _, f := range c.EnableExperimentalFeatures {
+		if f == "" || seen[f] {
+			continue
+		}
+		seen[f] = true
+		res = append(res, fmt.Sprintf("Experimental feature '%s' is enabled; behavior may change without notice", f))
+	}
+	return res
+}
@@ -0,0 +1,45 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// IsHeld returns true if the installed package matches any of the
+// package_holds patterns. Invalid patterns are skipped.
+func (c *LuetConfig) IsHeld(p *Package) bool {
+	for _, s := range c.PackageHolds {
+		if b, err := parsePackagePattern(s); err == nil && b.match(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetGossipSecretKey returns the decoded key encrypting the gossip traffic
+func (c LuetGeneralConfig) GetGossipSecretKey() ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(c.GossipSecretKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gossip secret key: %w", err)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	}
+	return nil, fmt.Errorf("invalid gossip secret key: must be 16, 24 or 32 bytes, base64 encoded")
+}
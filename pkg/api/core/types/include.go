@@ -0,0 +1,74 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+var ErrCircularConfigInclude = errors.New("circular config include")
+
+type configIncludes struct {
+	LayeredConfig []string `json:"include"`
+}
+
+// ConfigIncludes returns the files included by the config at path, in the
+// order they have to be merged: each file comes before the ones it includes,
+// so later files override earlier ones. Relative paths are resolved from the
+// directory of the including file.
+func ConfigIncludes(path string) ([]string, error) {
+	return configIncludesFrom(path, []string{})
+}
+
+func configIncludesFrom(path string, stack []string) ([]string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range stack {
+		if p == path {
+			return nil, errors.Wrapf(ErrCircularConfigInclude, "%s is included by itself", path)
+		}
+	}
+	stack = append(stack, path)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while reading config %s", path)
+	}
+	inc := &configIncludes{}
+	if err := yaml.Unmarshal(data, inc); err != nil {
+		return nil, errors.Wrapf(err, "while parsing config %s", path)
+	}
+
+	res := []string{}
+	for _, i := range inc.LayeredConfig {
+		if !filepath.IsAbs(i) {
+			i = filepath.Join(filepath.Dir(path), i)
+		}
+		nested, err := configIncludesFrom(i, stack)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, filepath.Clean(i))
+		res = append(res, nested...)
+	}
+	return res, nil
+}
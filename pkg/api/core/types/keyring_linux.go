@@ -0,0 +1,51 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// keyringCredentials reads the credentials of the repository from the
+// user keyring. It returns nil if there is no key for the repository.
+func keyringCredentials(name string) (map[string]string, error) {
+	id, err := unix.KeyctlSearch(unix.KEY_SPEC_USER_KEYRING, "user", RepositoryCredentialsKeyringPrefix+name, 0)
+	switch err {
+	case nil:
+	case unix.ENOKEY, unix.EKEYEXPIRED, unix.EKEYREVOKED, unix.ENOSYS:
+		return nil, nil
+	default:
+		return nil, err
+	}
+
+	size, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if _, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0); err != nil {
+		return nil, err
+	}
+
+	auth := map[string]string{}
+	if err := json.Unmarshal(buf, &auth); err != nil {
+		return nil, errors.Wrap(err, "invalid keyring credentials")
+	}
+	return auth, nil
+}
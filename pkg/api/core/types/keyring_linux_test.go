@@ -0,0 +1,60 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/sys/unix"
+)
+
+var _ = Describe("Keyring credentials", func() {
+	It("reads credentials from the keyring after vault", func() {
+		name := fmt.Sprintf("keyring-%d", time.Now().UnixNano())
+		id, err := unix.AddKey("user", types.RepositoryCredentialsKeyringPrefix+name,
+			[]byte(`{"username": "keyring"}`), unix.KEY_SPEC_USER_KEYRING)
+		if err != nil {
+			Skip("the user keyring is not available: " + err.Error())
+		}
+		defer unix.KeyctlInt(unix.KEYCTL_UNLINK, id, unix.KEY_SPEC_USER_KEYRING, 0, 0)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"lease_duration": 60, "data": {"data": {"username": "vault"}}}`))
+		}))
+		defer server.Close()
+
+		c := &types.LuetConfig{
+			VaultAddress:   server.URL,
+			VaultToken:     "s.token",
+			VaultRepoCreds: map[string]string{name: "secret/data/luet"},
+		}
+		repo := &types.LuetRepository{Name: name, Authentication: map[string]string{"username": "config"}}
+		auth, err := c.GetRepositoryCredentials(repo)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(auth).To(Equal(map[string]string{"username": "vault"}))
+
+		c.VaultRepoCreds = nil
+		auth, err = c.GetRepositoryCredentials(repo)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(auth).To(Equal(map[string]string{"username": "keyring"}))
+	})
+})
@@ -0,0 +1,85 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	RootfsLayoutFHS      = "fhs"
+	RootfsLayoutUsrMerge = "usrmerge"
+	RootfsLayoutCustom   = "custom"
+)
+
+// UsrMergeMapping are the directories which are symlinks to /usr in a usrmerge layout
+var UsrMergeMapping = map[string]string{
+	"bin":  "usr/bin",
+	"lib":  "usr/lib",
+	"sbin": "usr/sbin",
+}
+
+// GetLayoutMapping returns the path redirections of the configured rootfs layout,
+// relative to the rootfs
+func (c *LuetConfig) GetLayoutMapping() map[string]string {
+	var m map[string]string
+	switch c.RootfsLayout {
+	case RootfsLayoutUsrMerge:
+		m = UsrMergeMapping
+	case RootfsLayoutCustom:
+		m = c.LayoutMapping
+	}
+
+	res := map[string]string{}
+	for from, to := range m {
+		from = strings.TrimPrefix(path.Clean("/"+from), "/")
+		to = strings.TrimPrefix(path.Clean("/"+to), "/")
+		if from != "" && from != to {
+			res[from] = to
+		}
+	}
+	return res
+}
+
+// MapLayoutPath redirects a path relative to the rootfs according to the
+// layout mapping. The longest matching directory prefix wins.
+func (c *LuetConfig) MapLayoutPath(file string) string {
+	m := c.GetLayoutMapping()
+	if len(m) == 0 {
+		return file
+	}
+
+	prefixes := []string{}
+	for from := range m {
+		prefixes = append(prefixes, from)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	abs := strings.HasPrefix(file, "/")
+	f := strings.TrimPrefix(path.Clean("/"+file), "/")
+	for _, from := range prefixes {
+		if f == from || strings.HasPrefix(f, from+"/") {
+			f = m[from] + strings.TrimPrefix(f, from)
+			break
+		}
+	}
+	if abs {
+		return "/" + f
+	}
+	return f
+}
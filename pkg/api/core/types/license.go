@@ -0,0 +1,72 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import "strings"
+
+const (
+	LicenseFilterWhitelist = "whitelist"
+	LicenseFilterBlacklist = "blacklist"
+)
+
+// IsLicenseAllowed returns true if the license of the package passes the
+// LicenseFilter. Licenses are compared to the filter case-insensitively,
+// packages without a license are refused in whitelist mode.
+func (c *LuetConfig) IsLicenseAllowed(p *Package) bool {
+	if len(c.LicenseFilter) == 0 {
+		return true
+	}
+
+	listed := false
+	for _, l := range c.LicenseFilter {
+		if strings.EqualFold(strings.TrimSpace(l), strings.TrimSpace(p.GetLicense())) {
+			listed = true
+			break
+		}
+	}
+
+	if c.LicenseFilterMode == LicenseFilterBlacklist {
+		return !listed
+	}
+	return listed
+}
+
+// IsLicenseAutoAccepted returns true if the license is listed in
+// AutoAcceptLicenses, compared case-insensitively, or "*" is
+func (c *LuetConfig) IsLicenseAutoAccepted(license string) bool {
+	license = strings.TrimSpace(license)
+	if license == "" {
+		return false
+	}
+	for _, l := range c.AutoAcceptLicenses {
+		l = strings.TrimSpace(l)
+		if l == "*" || strings.EqualFold(l, license) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiresConsent returns true if the package matches any of
+// the requires_consent patterns. Invalid patterns are skipped.
+func (c *LuetConfig) RequiresConsent(p *Package) bool {
+	for _, s := range c.PackageRequiresConsent {
+		if b, err := parsePackagePattern(s); err == nil && b.match(p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	LocalCacheLRU = "lru"
+	LocalCacheARC = "arc"
+
+	// DefaultLocalCacheEntries is the size of the local cache
+	// when max_entries isn't set
+	DefaultLocalCacheEntries = 1024
+)
+
+// LuetLocalCache caches in memory the packages read from
+// the boltdb databases. An empty Type disables the cache,
+// a zero TTL keeps the entries until they are evicted.
+type LuetLocalCache struct {
+	Type       string        `yaml:"type,omitempty" mapstructure:"type"`
+	MaxEntries int           `yaml:"max_entries,omitempty" mapstructure:"max_entries"`
+	TTL        time.Duration `yaml:"ttl,omitempty" mapstructure:"ttl"`
+}
+
+// Enabled returns true if a cache type is set
+func (l LuetLocalCache) Enabled() bool {
+	return l.Type != ""
+}
+
+// GetMaxEntries returns the cache size, defaulting to DefaultLocalCacheEntries
+func (l LuetLocalCache) GetMaxEntries() int {
+	if l.MaxEntries <= 0 {
+		return DefaultLocalCacheEntries
+	}
+	return l.MaxEntries
+}
+
+func (l LuetLocalCache) validate() error {
+	switch l.Type {
+	case "", LocalCacheLRU, LocalCacheARC:
+	default:
+		return fmt.Errorf("invalid local cache type '%s'", l.Type)
+	}
+	if l.MaxEntries < 0 || l.TTL < 0 {
+		return fmt.Errorf("local cache size and ttl can't be negative")
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"path"
+	"strings"
+)
+
+// IsLocaleExcluded returns true if the file is a share/locale/*/LC_MESSAGES/*.mo
+// message catalog of a locale not in the LocaleWhitelist. Locales are
+// compared without their encoding and modifier, e.g. en_US.UTF-8 is en_US.
+func (g LuetGeneralConfig) IsLocaleExcluded(file string) bool {
+	if len(g.LocaleWhitelist) == 0 {
+		return false
+	}
+
+	parts := strings.Split(strings.TrimPrefix(path.Clean("/"+file), "/"), "/")
+	n := len(parts)
+	if n < 5 || parts[n-5] != "share" || parts[n-4] != "locale" ||
+		parts[n-2] != "LC_MESSAGES" || path.Ext(parts[n-1]) != ".mo" {
+		return false
+	}
+
+	locale := localeCode(parts[n-3])
+	for _, l := range g.LocaleWhitelist {
+		if localeCode(l) == locale {
+			return false
+		}
+	}
+	return true
+}
+
+func localeCode(l string) string {
+	if i := strings.IndexAny(l, ".@"); i >= 0 {
+		l = l[:i]
+	}
+	return strings.TrimSpace(l)
+}
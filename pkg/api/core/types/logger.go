@@ -39,4 +39,5 @@ type Logger interface {
 	Spinner()
 	Ask() bool
 	Screen(string)
+	Flush()
 }
@@ -0,0 +1,32 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import "github.com/pkg/errors"
+
+// LuetInstallManifest appends a YAML document listing the installed
+// packages to Path after each successful transaction
+type LuetInstallManifest struct {
+	Enabled bool   `yaml:"enabled,omitempty" mapstructure:"enabled"`
+	Path    string `yaml:"path,omitempty" mapstructure:"path"`
+}
+
+func (m LuetInstallManifest) validate() error {
+	if m.Enabled && m.Path == "" {
+		return errors.New("install manifest requires a path")
+	}
+	return nil
+}
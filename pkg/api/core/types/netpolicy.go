@@ -0,0 +1,118 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NetworkPolicy restricts the egress traffic of the builds of the packages
+// matching PackagePattern. A policy without AllowedHosts and BlockedPorts
+// disables the network altogether.
+type NetworkPolicy struct {
+	PackagePattern string   `yaml:"package" mapstructure:"package"`
+	AllowedHosts   []string `yaml:"allowed_hosts,omitempty" mapstructure:"allowed_hosts"`
+	BlockedPorts   []int    `yaml:"blocked_ports,omitempty" mapstructure:"blocked_ports"`
+}
+
+// Matches returns true if the policy applies to the package
+func (n NetworkPolicy) Matches(p *Package) bool {
+	b, err := parsePackagePattern(n.PackagePattern)
+	if err != nil {
+		return false
+	}
+	return b.match(p)
+}
+
+// GetNetworkPolicies returns the network policies matching the package
+func (c *LuetConfig) GetNetworkPolicies(p *Package) (res []NetworkPolicy) {
+	for _, n := range c.NetworkPolicies {
+		if n.Matches(p) {
+			res = append(res, n)
+		}
+	}
+	return
+}
+
+// NetworkIsolated returns true if any of the policies disables the network
+func NetworkIsolated(policies []NetworkPolicy) bool {
+	for _, n := range policies {
+		if len(n.AllowedHosts) == 0 && len(n.BlockedPorts) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// NetworkRules returns the iptables commands enforcing the union of the
+// policies inside a build container. Blocked ports take precedence over
+// allowed hosts, and once a host is allowed all the others are rejected.
+func NetworkRules(policies []NetworkPolicy) []string {
+	hosts := map[string]bool{}
+	ports := map[int]bool{}
+	for _, n := range policies {
+		for _, h := range n.AllowedHosts {
+			hosts[h] = true
+		}
+		for _, p := range n.BlockedPorts {
+			ports[p] = true
+		}
+	}
+
+	rules := []string{}
+	sortedPorts := []int{}
+	for p := range ports {
+		sortedPorts = append(sortedPorts, p)
+	}
+	sort.Ints(sortedPorts)
+	for _, p := range sortedPorts {
+		for _, proto := range []string{"tcp", "udp"} {
+			rules = append(rules, fmt.Sprintf("iptables -A OUTPUT -p %s --dport %d -j REJECT", proto, p))
+		}
+	}
+
+	if len(hosts) == 0 {
+		return rules
+	}
+
+	rules = append(rules,
+		"iptables -A OUTPUT -o lo -j ACCEPT",
+		"iptables -A OUTPUT -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT",
+		// Allowed hosts are resolved when the rules are added
+		"iptables -A OUTPUT -p udp --dport 53 -j ACCEPT",
+		"iptables -A OUTPUT -p tcp --dport 53 -j ACCEPT",
+	)
+	sortedHosts := []string{}
+	for h := range hosts {
+		sortedHosts = append(sortedHosts, h)
+	}
+	sort.Strings(sortedHosts)
+	for _, h := range sortedHosts {
+		rules = append(rules, "iptables -A OUTPUT -d "+h+" -j ACCEPT")
+	}
+	return append(rules, "iptables -A OUTPUT -j REJECT")
+}
+
+// withNetworkRules prefixes a build step with the network rules, the
+// step doesn't run if the rules can't be applied
+func withNetworkRules(rules []string, step string) string {
+	if len(rules) == 0 {
+		return step
+	}
+	return strings.Join(rules, " && ") + " && (" + step + ")"
+}
@@ -43,6 +43,9 @@ type PackageAnnotation string
 
 const (
 	ConfigProtectAnnotation PackageAnnotation = "config_protect"
+	// DependencyAnnotation marks the installed packages which were
+	// pulled in as dependencies, and not requested
+	DependencyAnnotation PackageAnnotation = "installed_as_dependency"
 )
 
 const (
@@ -0,0 +1,190 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrPeerReviewRejected is returned when a peer rejected the install
+	ErrPeerReviewRejected = errors.New("install rejected by peer review")
+	// ErrPeerReviewQuorum is returned when less than quorum_size peers approved the install
+	ErrPeerReviewQuorum = errors.New("peer review quorum not reached")
+)
+
+// LuetPeerReview requires the approval of quorum_size peers before
+// installing packages. The proposed packages are POSTed as a
+// PeerReviewRequest to each of the peer endpoints, which answer with
+// a PeerReviewResponse.
+type LuetPeerReview struct {
+	Enabled       bool     `yaml:"enabled,omitempty" mapstructure:"enabled"`
+	QuorumSize    int      `yaml:"quorum_size,omitempty" mapstructure:"quorum_size"`
+	PeerEndpoints []string `yaml:"peer_endpoints,omitempty" mapstructure:"peer_endpoints"`
+}
+
+// PeerReviewPackage is a package proposed for install
+type PeerReviewPackage struct {
+	Category string `json:"category"`
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+}
+
+// PeerReviewRequest is the body sent to the peers, see PeerReviewRequestSchema
+type PeerReviewRequest struct {
+	Hostname  string              `json:"hostname"`
+	Timestamp time.Time           `json:"timestamp"`
+	Packages  []PeerReviewPackage `json:"packages"`
+}
+
+// PeerReviewResponse is the answer of a peer, see PeerReviewResponseSchema.
+// Approvals must carry the signature of the reviewer.
+type PeerReviewResponse struct {
+	Approved  bool   `json:"approved"`
+	Reviewer  string `json:"reviewer"`
+	Signature string `json:"signature,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// PeerReviewRequestSchema is the JSON schema of PeerReviewRequest
+const PeerReviewRequestSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "PeerReviewRequest",
+  "type": "object",
+  "required": ["hostname", "timestamp", "packages"],
+  "properties": {
+    "hostname": {"type": "string"},
+    "timestamp": {"type": "string", "format": "date-time"},
+    "packages": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["category", "name", "version"],
+        "properties": {
+          "category": {"type": "string"},
+          "name": {"type": "string"},
+          "version": {"type": "string"}
+        }
+      }
+    }
+  }
+}`
+
+// PeerReviewResponseSchema is the JSON schema of PeerReviewResponse
+const PeerReviewResponseSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "PeerReviewResponse",
+  "type": "object",
+  "required": ["approved", "reviewer"],
+  "properties": {
+    "approved": {"type": "boolean"},
+    "reviewer": {"type": "string"},
+    "signature": {"type": "string"},
+    "reason": {"type": "string"}
+  },
+  "if": {"properties": {"approved": {"const": true}}},
+  "then": {"required": ["signature"]}
+}`
+
+func (r LuetPeerReview) validate() error {
+	if !r.Enabled {
+		return nil
+	}
+	if len(r.PeerEndpoints) == 0 {
+		return fmt.Errorf("peer review is enabled without peer endpoints")
+	}
+	if r.QuorumSize < 1 || r.QuorumSize > len(r.PeerEndpoints) {
+		return fmt.Errorf("peer review quorum must be between 1 and the number of peers, got %d", r.QuorumSize)
+	}
+	return nil
+}
+
+// RequestPeerReview submits the packages to all the peers and returns
+// the approvals once the quorum is reached. Any rejection aborts
+// with ErrPeerReviewRejected, unreachable peers don't count as approvals.
+func (c *LuetConfig) RequestPeerReview(packs Packages) ([]PeerReviewResponse, error) {
+	hostname, _ := os.Hostname()
+	req := PeerReviewRequest{Hostname: hostname, Timestamp: time.Now().UTC()}
+	for _, p := range packs {
+		req.Packages = append(req.Packages, PeerReviewPackage{Category: p.GetCategory(), Name: p.GetName(), Version: p.GetVersion()})
+	}
+	sort.Slice(req.Packages, func(i, j int) bool {
+		return req.Packages[i].Category+"/"+req.Packages[i].Name < req.Packages[j].Category+"/"+req.Packages[j].Name
+	})
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs error
+	approvals := []PeerReviewResponse{}
+	for _, endpoint := range c.PeerReview.PeerEndpoints {
+		resp, err := c.peerReview(endpoint, body)
+		switch {
+		case err != nil:
+			errs = multierror.Append(errs, errors.Wrapf(err, "peer %s", endpoint))
+		case !resp.Approved:
+			return nil, errors.Wrapf(ErrPeerReviewRejected, "by %s: %s", resp.Reviewer, resp.Reason)
+		default:
+			approvals = append(approvals, resp)
+		}
+	}
+
+	if len(approvals) < c.PeerReview.QuorumSize {
+		err := errors.Wrapf(ErrPeerReviewQuorum, "%d of %d approvals", len(approvals), c.PeerReview.QuorumSize)
+		if errs != nil {
+			err = errors.Wrap(err, errs.Error())
+		}
+		return nil, err
+	}
+	return approvals, nil
+}
+
+func (c *LuetConfig) peerReview(endpoint string, body []byte) (PeerReviewResponse, error) {
+	var resp PeerReviewResponse
+
+	req, err := http.NewRequestWithContext(c.General.GetParentContext(), http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return resp, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return resp, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return resp, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return resp, errors.Wrap(err, "invalid response")
+	}
+	if resp.Approved && resp.Signature == "" {
+		return resp, errors.New("approval without signature")
+	}
+	return resp, nil
+}
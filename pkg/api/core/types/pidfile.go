@@ -0,0 +1,90 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+var ErrDaemonAlreadyRunning = errors.New("another luet instance is already running")
+
+// pidRunning returns true if a process with the given pid exists
+func pidRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+func readPidFile(path string) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// AcquirePidFile writes the pid of the process to path, failing with
+// ErrDaemonAlreadyRunning if it holds the pid of a running process.
+// Stale pid files are replaced. The returned function removes the file.
+func AcquirePidFile(path string) (func() error, error) {
+	for i := 0; i < 2; i++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, errors.Wrapf(err, "while writing pid file %s", path)
+			}
+			return func() error { return releasePidFile(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, errors.Wrapf(err, "while creating pid file %s", path)
+		}
+
+		if pid, err := readPidFile(path); err == nil && pidRunning(pid) {
+			return nil, errors.Wrapf(ErrDaemonAlreadyRunning, "pid %d in %s", pid, path)
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "while removing stale pid file %s", path)
+		}
+	}
+	return nil, errors.Errorf("pid file %s keeps being recreated", path)
+}
+
+// releasePidFile removes the pid file, unless it was taken over by another process
+func releasePidFile(path string) error {
+	pid, err := readPidFile(path)
+	if os.IsNotExist(err) || (err == nil && pid != os.Getpid()) {
+		return nil
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,48 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+// PackageUpgrade is a package replaced by a newer version
+type PackageUpgrade struct {
+	From *Package `json:"from"`
+	To   *Package `json:"to"`
+}
+
+// InstallPlan is the summary of the changes an installation
+// is going to apply to the system
+type InstallPlan struct {
+	Install Packages         `json:"install,omitempty"`
+	Upgrade []PackageUpgrade `json:"upgrade,omitempty"`
+	Remove  Packages         `json:"remove,omitempty"`
+
+	// Estimated sizes in bytes. DownloadSize doesn't count
+	// artifacts which are already in the cache.
+	DownloadSize int64 `json:"download_size"`
+	InstallSize  int64 `json:"install_size"`
+
+	// SecurityWarnings are the known vulnerabilities of the packages to install
+	SecurityWarnings []Advisory `json:"security_warnings,omitempty"`
+}
+
+// IsUpgrade returns true if the package is the target of an upgrade in the plan
+func (p *InstallPlan) IsUpgrade(pack *Package) bool {
+	for _, u := range p.Upgrade {
+		if u.To.GetFingerPrint() == pack.GetFingerPrint() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// parsePlatform splits a platform in the os/arch form
+func parsePlatform(p string) (os, arch string, err error) {
+	parts := strings.Split(p, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid platform '%s', expected os/arch", p)
+	}
+	return parts[0], parts[1], nil
+}
+
+// GetSystemOS returns the OS of the system, taken from
+// PlatformOverride if set or from the running host otherwise
+func (c *LuetConfig) GetSystemOS() string {
+	if os, _, err := parsePlatform(c.PlatformOverride); err == nil {
+		return os
+	}
+	return runtime.GOOS
+}
+
+// GetSystemArch returns the architecture of the system, taken from
+// PlatformOverride if set or from the running host otherwise
+func (c *LuetConfig) GetSystemArch() string {
+	if _, arch, err := parsePlatform(c.PlatformOverride); err == nil {
+		return arch
+	}
+	return runtime.GOARCH
+}
@@ -0,0 +1,43 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import "sync"
+
+// InstallProgress reports the install steps to a progress callback.
+// It is safe to use from concurrent workers, steps are always
+// reported in increasing order.
+type InstallProgress struct {
+	sync.Mutex
+	callback    func(pkg string, step, total int)
+	step, total int
+}
+
+// NewInstallProgress returns a tracker for total steps. A nil callback is a no-op.
+func NewInstallProgress(callback func(pkg string, step, total int), total int) *InstallProgress {
+	return &InstallProgress{callback: callback, total: total}
+}
+
+// Step marks pkg as done and notifies the callback
+func (p *InstallProgress) Step(pkg string) {
+	if p == nil || p.callback == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.step++
+	p.callback(pkg, p.step, p.total)
+}
@@ -0,0 +1,49 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+// IsProvideSuppressed returns true if the virtual package is listed in skip_provides
+func (c *LuetConfig) IsProvideSuppressed(virtualName string) bool {
+	for _, s := range c.SkipProvides {
+		if s == virtualName {
+			return true
+		}
+	}
+	return false
+}
+
+// StripProvides returns the package without the provides suppressed
+// by the config. The package is returned as-is if none is suppressed.
+func (c *LuetConfig) StripProvides(p *Package) *Package {
+	if len(c.SkipProvides) == 0 {
+		return p
+	}
+
+	provides := []*Package{}
+	for _, pr := range p.GetProvides() {
+		if c.IsProvideSuppressed(pr.GetName()) || c.IsProvideSuppressed(pr.GetCategory()+"/"+pr.GetName()) {
+			continue
+		}
+		provides = append(provides, pr)
+	}
+	if len(provides) == len(p.GetProvides()) {
+		return p
+	}
+
+	stripped := p.Clone()
+	stripped.SetProvides(provides)
+	return stripped
+}
@@ -0,0 +1,81 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"fmt"
+
+	fileHelper "github.com/mudler/luet/pkg/helpers/file"
+	"github.com/pkg/errors"
+)
+
+const (
+	StorageComponentCache    = "cache"
+	StorageComponentDatabase = "database"
+)
+
+// LuetStorageQuota caps the disk space taken by luet, zero values are unlimited
+type LuetStorageQuota struct {
+	// CacheMaxGB caps the size of the packages cache
+	CacheMaxGB float64 `yaml:"cache_max_gb,omitempty" mapstructure:"cache_max_gb"`
+	// DatabaseMaxMB caps the size of the system database
+	DatabaseMaxMB float64 `yaml:"database_max_mb,omitempty" mapstructure:"database_max_mb"`
+}
+
+func (q LuetStorageQuota) validate() error {
+	if q.CacheMaxGB < 0 || q.DatabaseMaxMB < 0 {
+		return fmt.Errorf("storage quotas can't be negative")
+	}
+	return nil
+}
+
+// StorageQuotaExceeded is returned when an operation would take the
+// Component over its storage quota. Sizes are in bytes.
+type StorageQuotaExceeded struct {
+	Component string
+	Limit     int64
+	Projected int64
+}
+
+func (e *StorageQuotaExceeded) Error() string {
+	return fmt.Sprintf("storage quota of the %s exceeded: %d bytes projected, limit is %d bytes", e.Component, e.Projected, e.Limit)
+}
+
+// CheckStorageQuota returns a StorageQuotaExceeded error if the packages
+// cache or the system database would exceed their quota once they grow
+// by the given number of bytes
+func (c *LuetConfig) CheckStorageQuota(cacheGrowth, databaseGrowth int64) error {
+	for _, q := range []struct {
+		component, path string
+		limit           float64
+		growth          int64
+	}{
+		{StorageComponentCache, c.System.PkgsCachePath, c.StorageQuota.CacheMaxGB * 1024 * 1024 * 1024, cacheGrowth},
+		{StorageComponentDatabase, c.GetSystemDBPath(), c.StorageQuota.DatabaseMaxMB * 1024 * 1024, databaseGrowth},
+	} {
+		if q.limit <= 0 {
+			continue
+		}
+		used, err := fileHelper.DiskUsage(q.path)
+		if err != nil {
+			return errors.Wrapf(err, "computing the size of the %s", q.component)
+		}
+		if projected := used + q.growth; projected > int64(q.limit) {
+			return &StorageQuotaExceeded{Component: q.component, Limit: int64(q.limit), Projected: projected}
+		}
+	}
+	return nil
+}
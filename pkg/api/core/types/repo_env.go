@@ -0,0 +1,75 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var repoEnvRegexp = regexp.MustCompile(`^LUET_REPO_(\d+)_(NAME|URL|TYPE)=(.*)$`)
+
+// SystemRepositoriesFromEnv adds the repositories defined by the
+// LUET_REPO_<N>_NAME, LUET_REPO_<N>_URL and LUET_REPO_<N>_TYPE
+// environment variables, in the order of N. All the three variables
+// are required for each repository.
+func (c *LuetConfig) SystemRepositoriesFromEnv() error {
+	repos := map[int]map[string]string{}
+	for _, e := range os.Environ() {
+		m := repoEnvRegexp.FindStringSubmatch(e)
+		if m == nil {
+			continue
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return errors.Wrapf(err, "invalid repository index in %s", e)
+		}
+		if _, ok := repos[n]; !ok {
+			repos[n] = map[string]string{}
+		}
+		repos[n][m[2]] = m[3]
+	}
+
+	indexes := []int{}
+	for n := range repos {
+		indexes = append(indexes, n)
+	}
+	sort.Ints(indexes)
+
+	for _, n := range indexes {
+		vars := repos[n]
+		missing := []string{}
+		for _, k := range []string{"NAME", "URL", "TYPE"} {
+			if vars[k] == "" {
+				missing = append(missing, "LUET_REPO_"+strconv.Itoa(n)+"_"+k)
+			}
+		}
+		if len(missing) > 0 {
+			return errors.Errorf("incomplete repository %d from the environment, missing %s", n, strings.Join(missing, ", "))
+		}
+
+		r := NewLuetRepository(vars["NAME"], vars["TYPE"], "", []string{vars["URL"]}, 9999, true, false)
+		if err := c.AddSystemRepository(*r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
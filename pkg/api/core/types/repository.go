@@ -16,12 +16,31 @@
 package types
 
 import (
+	"errors"
 	"fmt"
 	"runtime"
 
 	"gopkg.in/yaml.v2"
 )
 
+// Repository cache priorities, see LuetConfig.RepositoryCachePriority
+const (
+	RepoCacheLiveFirst  = "live-first"
+	RepoCacheCacheFirst = "cache-first"
+	RepoCacheCacheOnly  = "cache-only"
+)
+
+// Repository download protocols, see LuetConfig.RepositoryProtocol
+const (
+	RepoProtocolHTTP1 = "http1"
+	RepoProtocolHTTP2 = "http2"
+	RepoProtocolHTTP3 = "http3"
+)
+
+// ErrRepositoryNotCached is returned when a repository is synced in
+// cache-only mode and it has no cached data
+var ErrRepositoryNotCached = errors.New("repository data is not cached")
+
 type LuetRepository struct {
 	Name           string            `json:"name" yaml:"name" mapstructure:"name"`
 	Description    string            `json:"description,omitempty" yaml:"description,omitempty" mapstructure:"description"`
@@ -36,6 +55,8 @@ type LuetRepository struct {
 	MetaPath       string            `json:"metapath,omitempty" yaml:"metapath,omitempty" mapstructure:"metapath"`
 	Verify         bool              `json:"verify,omitempty" yaml:"verify,omitempty" mapstructure:"verify"`
 	Arch           string            `json:"arch,omitempty" yaml:"arch,omitempty" mapstructure:"arch"`
+	TrustLevel     string            `json:"trust_level,omitempty" yaml:"trust_level,omitempty" mapstructure:"trust_level"`
+	BuildArgs      map[string]string `json:"build_args,omitempty" yaml:"build_args,omitempty" mapstructure:"build_args"`
 
 	ReferenceID string `json:"reference,omitempty" yaml:"reference,omitempty" mapstructure:"reference"`
 
@@ -52,14 +73,24 @@ func (r *LuetRepository) String() string {
 
 // Enabled returns a boolean indicating if the repository should be considered enabled or not
 func (r *LuetRepository) Enabled() bool {
-	return r.Arch != "" && r.Arch == runtime.GOARCH && !r.Enable || r.Enable
+	return r.EnabledOn(runtime.GOARCH)
+}
+
+// EnabledOn is Enabled for a system of the given architecture
+func (r *LuetRepository) EnabledOn(arch string) bool {
+	return r.Arch != "" && r.Arch == arch && !r.Enable || r.Enable
 }
 
 type LuetRepositories []LuetRepository
 
 func (l LuetRepositories) Enabled() (res LuetRepositories) {
+	return l.EnabledOn(runtime.GOARCH)
+}
+
+// EnabledOn returns the repositories enabled on a system of the given architecture
+func (l LuetRepositories) EnabledOn(arch string) (res LuetRepositories) {
 	for _, r := range l {
-		if r.Enabled() {
+		if r.EnabledOn(arch) {
 			res = append(res, r)
 		}
 	}
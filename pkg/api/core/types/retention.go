@@ -0,0 +1,39 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import "fmt"
+
+// LuetRetentionPolicy prunes the old package versions from the packages
+// cache, zero values disable its rules
+type LuetRetentionPolicy struct {
+	// KeepVersions is the number of most recent versions of each package kept
+	KeepVersions int `yaml:"keep_versions,omitempty" mapstructure:"keep_versions"`
+	// MaxAgeDays deletes the cached versions unused for more days
+	MaxAgeDays int `yaml:"max_age_days,omitempty" mapstructure:"max_age_days"`
+}
+
+// Enabled returns true if any of the rules is set
+func (r LuetRetentionPolicy) Enabled() bool {
+	return r.KeepVersions > 0 || r.MaxAgeDays > 0
+}
+
+func (r LuetRetentionPolicy) validate() error {
+	if r.KeepVersions < 0 || r.MaxAgeDays < 0 {
+		return fmt.Errorf("retention policy values can't be negative")
+	}
+	return nil
+}
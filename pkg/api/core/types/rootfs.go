@@ -0,0 +1,113 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+)
+
+// RootfsDirs are the top-level directories of a fresh rootfs,
+// with their permissions
+var RootfsDirs = map[string]os.FileMode{
+	"bin":       0755,
+	"boot":      0755,
+	"dev":       0755,
+	"etc":       0755,
+	"home":      0755,
+	"lib":       0755,
+	"media":     0755,
+	"mnt":       0755,
+	"opt":       0755,
+	"proc":      0555,
+	"root":      0700,
+	"run":       0755,
+	"sbin":      0755,
+	"srv":       0755,
+	"sys":       0555,
+	"tmp":       os.ModeSticky | 0777,
+	"usr":       0755,
+	"usr/bin":   0755,
+	"usr/lib":   0755,
+	"usr/sbin":  0755,
+	"usr/share": 0755,
+	"var":       0755,
+	"var/cache": 0755,
+	"var/lib":   0755,
+	"var/log":   0755,
+	"var/tmp":   os.ModeSticky | 0777,
+}
+
+// PrepareRootfs creates the directory structure of a fresh rootfs in
+// targetDir, following the configured layout, and initializes an
+// empty system database in it
+func (c *LuetConfig) PrepareRootfs(targetDir string) error {
+	for dir, mode := range RootfsDirs {
+		if _, ok := UsrMergeMapping[dir]; ok && c.RootfsLayout == RootfsLayoutUsrMerge {
+			continue
+		}
+		p := filepath.Join(targetDir, dir)
+		if err := os.MkdirAll(p, 0755); err != nil {
+			return errors.Wrapf(err, "while creating /%s", dir)
+		}
+		// Chmod isn't affected by the umask
+		if err := os.Chmod(p, mode); err != nil {
+			return errors.Wrapf(err, "while setting permissions of /%s", dir)
+		}
+	}
+
+	if c.RootfsLayout == RootfsLayoutUsrMerge {
+		for from, to := range UsrMergeMapping {
+			link := filepath.Join(targetDir, from)
+			if _, err := os.Lstat(link); err == nil {
+				continue
+			}
+			if err := os.Symlink(to, link); err != nil {
+				return errors.Wrapf(err, "while creating symlink /%s", from)
+			}
+		}
+	}
+
+	return c.System.prepareDB(targetDir)
+}
+
+// prepareDB creates the system database below targetDir
+func (s LuetSystemConfig) prepareDB(targetDir string) error {
+	dbpath := s.DatabasePath
+	// DatabasePath is already rooted in Rootfs once the config is initialized
+	if rel, err := filepath.Rel(s.Rootfs, dbpath); s.Rootfs != "" && err == nil && !strings.HasPrefix(rel, "..") {
+		dbpath = rel
+	}
+	s.DatabasePath = filepath.Join(targetDir, dbpath)
+
+	if err := os.MkdirAll(s.DatabasePath, 0755); err != nil {
+		return errors.Wrap(err, "while creating the database directory")
+	}
+
+	if s.DatabaseEngine != "boltdb" {
+		return nil
+	}
+	db, err := bbolt.Open(s.GetSystemDBPath(), 0600, &bbolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return errors.Wrap(err, "while initializing the database")
+	}
+	return db.Close()
+}
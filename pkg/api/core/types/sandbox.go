@@ -0,0 +1,67 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+)
+
+// BuildSandboxContext prefixes the names of the build contexts
+// of the read-only bind mounts, e.g. sandbox0
+const BuildSandboxContext = "sandbox"
+
+// LuetBuildSandbox isolates the package builds, regardless of
+// the package specs and of the network policies
+type LuetBuildSandbox struct {
+	NetworkDisabled bool `yaml:"network_disabled,omitempty" mapstructure:"network_disabled"`
+
+	// ReadOnlyBindMounts are host paths mounted read-only at
+	// the same path in the build steps
+	ReadOnlyBindMounts []string `yaml:"readonly_bind_mounts,omitempty" mapstructure:"readonly_bind_mounts"`
+}
+
+// Enabled returns true if the sandbox restricts the builds
+func (s LuetBuildSandbox) Enabled() bool {
+	return s.NetworkDisabled || len(s.ReadOnlyBindMounts) > 0
+}
+
+// BuildContexts returns the build contexts of the bind mounts, name to path
+func (s LuetBuildSandbox) BuildContexts() map[string]string {
+	res := map[string]string{}
+	for i, m := range s.ReadOnlyBindMounts {
+		res[BuildSandboxContext+strconv.Itoa(i)] = m
+	}
+	return res
+}
+
+// Mounts returns the RUN mounts of the bind mounts
+func (s LuetBuildSandbox) Mounts() (res []string) {
+	for i, m := range s.ReadOnlyBindMounts {
+		res = append(res, fmt.Sprintf("type=bind,from=%s%d,target=%s,readonly", BuildSandboxContext, i, m))
+	}
+	return
+}
+
+func (s LuetBuildSandbox) validate() error {
+	for _, m := range s.ReadOnlyBindMounts {
+		if !filepath.IsAbs(m) {
+			return fmt.Errorf("build sandbox bind mount '%s' is not an absolute path", m)
+		}
+	}
+	return nil
+}
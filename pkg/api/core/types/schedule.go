@@ -0,0 +1,39 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+)
+
+// LuetScheduledSync syncs the system repositories periodically
+// while luet runs as a service
+type LuetScheduledSync struct {
+	Enabled bool `yaml:"enabled,omitempty" mapstructure:"enabled"`
+	// CronExpr is a standard 5 fields cron expression, e.g. "0 3 * * *"
+	CronExpr string `yaml:"cron_expr,omitempty" mapstructure:"cron_expr"`
+}
+
+func (s LuetScheduledSync) validate() error {
+	if !s.Enabled {
+		return nil
+	}
+	if _, err := cron.ParseStandard(s.CronExpr); err != nil {
+		return errors.Wrapf(err, "invalid scheduled sync cron expression '%s'", s.CronExpr)
+	}
+	return nil
+}
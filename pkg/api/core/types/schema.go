@@ -0,0 +1,66 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// CurrentSchemaVersion is the version of the config schema
+// understood by this luet
+const CurrentSchemaVersion = 1
+
+var ErrFutureSchemaVersion = errors.New("config schema version is newer than supported")
+
+// schemaMigrations upgrade a config from the version they are keyed
+// with to the next one
+var schemaMigrations = map[int]func(c *LuetConfig) error{
+	// Configs without schema_version are the same as version 1
+	0: func(c *LuetConfig) error { return nil },
+}
+
+// CheckSchemaVersion refuses configs written for a newer luet,
+// and migrates the older ones to CurrentSchemaVersion
+func (c *LuetConfig) CheckSchemaVersion() error {
+	switch {
+	case c.ConfigSchemaVersion > CurrentSchemaVersion:
+		return errors.Wrapf(ErrFutureSchemaVersion, "got %d, supported up to %d", c.ConfigSchemaVersion, CurrentSchemaVersion)
+	case c.ConfigSchemaVersion < CurrentSchemaVersion:
+		return c.MigrateFrom(c.ConfigSchemaVersion)
+	}
+	return nil
+}
+
+// MigrateFrom upgrades the config from the given schema version
+// to CurrentSchemaVersion
+func (c *LuetConfig) MigrateFrom(version int) error {
+	if version < 0 || version > CurrentSchemaVersion {
+		return fmt.Errorf("invalid config schema version %d", version)
+	}
+	for v := version; v < CurrentSchemaVersion; v++ {
+		migrate, ok := schemaMigrations[v]
+		if !ok {
+			return fmt.Errorf("no migration available from config schema version %d", v)
+		}
+		if err := migrate(c); err != nil {
+			return errors.Wrapf(err, "while migrating config from schema version %d", v)
+		}
+	}
+	c.ConfigSchemaVersion = CurrentSchemaVersion
+	return nil
+}
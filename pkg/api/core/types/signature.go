@@ -0,0 +1,50 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+const (
+	// SignaturePolicyIgnore skips signature checks entirely
+	SignaturePolicyIgnore = "ignore"
+	// SignaturePolicyWarn checks the signatures of the repositories with
+	// verify enabled, failures are logged and the packages installed anyway
+	SignaturePolicyWarn = "warn"
+	// SignaturePolicyError checks the signatures of all the repositories
+	// supporting them, unsigned or invalid packages are refused
+	SignaturePolicyError = "error"
+
+	// DefaultSignaturePolicy is warn during the transition to error
+	DefaultSignaturePolicy = SignaturePolicyWarn
+)
+
+// GetSignaturePolicy returns the signature policy, defaulting to DefaultSignaturePolicy
+func (c *LuetConfig) GetSignaturePolicy() string {
+	if c.PackageSignaturePolicy == "" {
+		return DefaultSignaturePolicy
+	}
+	return c.PackageSignaturePolicy
+}
+
+// VerifySignatures returns true if the signatures of a
+// repository with the given verify setting have to be checked
+func (c *LuetConfig) VerifySignatures(repoVerify bool) bool {
+	switch c.GetSignaturePolicy() {
+	case SignaturePolicyIgnore:
+		return false
+	case SignaturePolicyError:
+		return true
+	}
+	return repoVerify
+}
@@ -25,6 +25,13 @@ const (
 	SolverSingleCoreSimple SolverType = 0
 )
 
+// Conflict resolution strategies, see LuetSolverOptions.ConflictResolutionStrategy
+const (
+	ConflictPreferInstalled = "prefer-installed"
+	ConflictPreferNewer     = "prefer-newer"
+	ConflictFail            = "fail"
+)
+
 // PackageSolver is an interface to a generic package solving algorithm
 type PackageSolver interface {
 	SetDefinitionDatabase(PackageDatabase)
@@ -51,6 +58,13 @@ type PackageSolver interface {
 type SolverOptions struct {
 	Type        SolverType `yaml:"type,omitempty"`
 	Concurrency int        `yaml:"concurrency,omitempty"`
+
+	// BacktrackLimit caps the unsat attempts made while resolving conflicts
+	BacktrackLimit int `yaml:"backtrack_limit,omitempty"`
+
+	// ExpandConstraints solves only the constraints reachable from
+	// the wanted and the installed packages
+	ExpandConstraints bool `yaml:"expand_constraints,omitempty"`
 }
 
 // PackageResolver assists PackageSolver on unsat cases
@@ -0,0 +1,190 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	SourceIntegritySHA256  = "sha256"
+	SourceIntegritySHA512  = "sha512"
+	SourceIntegrityBlake2b = "blake2b"
+)
+
+// SourceURIHashEnv is the spec env holding the checksums of the
+// retrieved sources, space separated in the retrieve order
+const SourceURIHashEnv = "SRC_URI_HASH"
+
+// ErrSourceIntegrity is returned when a source archive doesn't
+// match the checksum declared in the spec
+var ErrSourceIntegrity = errors.New("source archive checksum mismatch")
+
+// LuetSourceIntegrity verifies the sources retrieved by the package
+// builds against the SRC_URI_HASH checksums of the specs
+type LuetSourceIntegrity struct {
+	Enabled bool `yaml:"enabled,omitempty" mapstructure:"enabled"`
+
+	// Policy is the checksum algorithm, sha256 (default), sha512 or blake2b
+	Policy string `yaml:"policy,omitempty" mapstructure:"policy"`
+}
+
+func (s LuetSourceIntegrity) validate() error {
+	switch s.Policy {
+	case "", SourceIntegritySHA256, SourceIntegritySHA512, SourceIntegrityBlake2b:
+		return nil
+	default:
+		return fmt.Errorf("invalid source integrity policy '%s'", s.Policy)
+	}
+}
+
+func (s LuetSourceIntegrity) hasher() hash.Hash {
+	switch s.Policy {
+	case SourceIntegritySHA512:
+		return sha512.New()
+	case SourceIntegrityBlake2b:
+		h, _ := blake2b.New512(nil)
+		return h
+	default:
+		return sha256.New()
+	}
+}
+
+// Sum returns the hex checksum of the file with the policy algorithm
+func (s LuetSourceIntegrity) Sum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := s.hasher()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (s LuetSourceIntegrity) verify(file, sum string) error {
+	actual, err := s.Sum(file)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(actual, sum) {
+		return errors.Wrapf(ErrSourceIntegrity, "%s: expected %s, got %s", filepath.Base(file), sum, actual)
+	}
+	return nil
+}
+
+func isRemoteSource(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// SourceURIHashes returns the checksums declared in SRC_URI_HASH
+func (cs *LuetCompilationSpec) SourceURIHashes() []string {
+	for _, e := range cs.Env {
+		if k, v, ok := strings.Cut(e, "="); ok && k == SourceURIHashEnv {
+			return strings.Fields(strings.Trim(v, `"'`))
+		}
+	}
+	return nil
+}
+
+// VerifySources checks the retrieved sources of the build context dir,
+// see CopyRetrieves, against the SRC_URI_HASH checksums. Remote sources
+// are downloaded into dir and verified, instead of being added by the
+// build, which doesn't check them.
+func (cs *LuetCompilationSpec) VerifySources(ctx context.Context, dir string, s LuetSourceIntegrity) error {
+	hashes := cs.SourceURIHashes()
+	if len(hashes) != len(cs.Retrieve) {
+		return errors.Wrapf(ErrSourceIntegrity, "%d retrieved sources but %d checksums in %s", len(cs.Retrieve), len(hashes), SourceURIHashEnv)
+	}
+
+	for i, r := range cs.Retrieve {
+		if isRemoteSource(r) {
+			file, err := downloadSource(ctx, r, dir)
+			if err != nil {
+				return errors.Wrapf(err, "while downloading %s", r)
+			}
+			if err := s.verify(file, hashes[i]); err != nil {
+				os.RemoveAll(file)
+				return err
+			}
+			if cs.fetched == nil {
+				cs.fetched = map[string]bool{}
+			}
+			cs.fetched[r] = true
+			continue
+		}
+
+		matches, _ := filepath.Glob(cs.Rel(r))
+		if len(matches) != 1 {
+			return errors.Wrapf(ErrSourceIntegrity, "%s matches %d files, checksums apply to single files", r, len(matches))
+		}
+		if err := s.verify(filepath.Join(dir, filepath.Base(matches[0])), hashes[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downloadSource downloads a remote source into dir, named after the
+// last component of its path as the build ADD would
+func downloadSource(ctx context.Context, src, dir string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	name := path.Base(req.URL.Path)
+	if name == "/" || name == "." {
+		name = "index.html"
+	}
+	file := filepath.Join(dir, name)
+	f, err := os.Create(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, res.Body); err != nil {
+		return "", err
+	}
+	return file, nil
+}
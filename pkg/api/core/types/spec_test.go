@@ -16,9 +16,16 @@
 package types_test
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/mudler/luet/pkg/api/core/types"
 	. "github.com/mudler/luet/pkg/api/core/types"
@@ -185,6 +192,17 @@ RUN echo bar > /test2`))
 
 	})
 
+	ginkgo.It("Prefixes the build steps with the network rules", func() {
+		lspec := &LuetCompilationSpec{
+			Package:      &Package{Name: "a", Category: "test", Version: "1.0"},
+			Steps:        []string{"echo foo"},
+			NetworkRules: []string{"iptables -A OUTPUT -j REJECT"},
+		}
+		dockerfile, err := lspec.RenderStepImage("alpine")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(dockerfile).To(HaveSuffix("\nRUN iptables -A OUTPUT -j REJECT && (echo foo)"))
+	})
+
 	ginkgo.It("Renders retrieve and env fields", func() {
 		generalRecipe := tree.NewGeneralRecipe(pkg.NewInMemoryDatabase(false))
 
@@ -255,4 +273,98 @@ RUN echo foo > /test
 RUN echo bar > /test2`))
 
 	})
+	ginkgo.Context("Source integrity", func() {
+		var dir, buildDir string
+		var ts *httptest.Server
+
+		ginkgo.BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "sources")
+			Expect(err).ToNot(HaveOccurred())
+			buildDir = filepath.Join(dir, "build")
+			Expect(os.MkdirAll(buildDir, os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "local.tar"), []byte("local"), 0644)).To(Succeed())
+
+			ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("remote"))
+			}))
+		})
+
+		ginkgo.AfterEach(func() {
+			ts.Close()
+			os.RemoveAll(dir)
+		})
+
+		spec := func(hashes ...string) *LuetCompilationSpec {
+			lspec := &LuetCompilationSpec{
+				Package:  &Package{Name: "a", Category: "test", Version: "1.0"},
+				Retrieve: []string{"local.tar", ts.URL + "/remote.tar.gz"},
+				Env:      []string{"SRC_URI_HASH=" + strings.Join(hashes, " ")},
+			}
+			lspec.SetOutputPath(dir)
+			Expect(lspec.CopyRetrieves(buildDir)).To(Succeed())
+			return lspec
+		}
+
+		sha256sum := func(s string) string {
+			h := sha256.Sum256([]byte(s))
+			return hex.EncodeToString(h[:])
+		}
+
+		ginkgo.It("downloads and verifies the retrieved sources", func() {
+			lspec := spec(sha256sum("local"), sha256sum("remote"))
+			Expect(lspec.VerifySources(context.Background(), buildDir, LuetSourceIntegrity{Enabled: true})).To(Succeed())
+
+			content, err := ioutil.ReadFile(filepath.Join(buildDir, "remote.tar.gz"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(Equal("remote"))
+
+			// The verified download is in the build context, the build doesn't fetch it again
+			dockerfile, err := lspec.RenderBuildImage()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dockerfile).To(ContainSubstring("ADD local.tar /luetbuild/"))
+			Expect(dockerfile).ToNot(ContainSubstring("ADD " + ts.URL))
+		})
+
+		ginkgo.It("fails on corrupted archives", func() {
+			lspec := spec(sha256sum("local"), sha256sum("remote"))
+			Expect(ioutil.WriteFile(filepath.Join(buildDir, "local.tar"), []byte("corrupted"), 0644)).To(Succeed())
+			err := lspec.VerifySources(context.Background(), buildDir, LuetSourceIntegrity{Enabled: true})
+			Expect(errors.Is(err, ErrSourceIntegrity)).To(BeTrue())
+
+			lspec = spec(sha256sum("local"), sha256sum("corrupted"))
+			err = lspec.VerifySources(context.Background(), buildDir, LuetSourceIntegrity{Enabled: true})
+			Expect(errors.Is(err, ErrSourceIntegrity)).To(BeTrue())
+			Expect(filepath.Join(buildDir, "remote.tar.gz")).ToNot(BeAnExistingFile())
+
+			dockerfile, err := lspec.RenderBuildImage()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dockerfile).To(ContainSubstring("ADD " + ts.URL))
+		})
+
+		ginkgo.It("requires a checksum for each source", func() {
+			err := spec(sha256sum("local")).VerifySources(context.Background(), buildDir, LuetSourceIntegrity{Enabled: true})
+			Expect(errors.Is(err, ErrSourceIntegrity)).To(BeTrue())
+		})
+
+		ginkgo.It("uses the policy algorithm", func() {
+			s := LuetSourceIntegrity{Enabled: true, Policy: SourceIntegritySHA512}
+			local, err := s.Sum(filepath.Join(dir, "local.tar"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(local).To(HaveLen(128))
+
+			Expect(spec(local, sha256sum("remote")).VerifySources(context.Background(), buildDir, s)).ToNot(Succeed())
+
+			s.Policy = SourceIntegrityBlake2b
+			blake, err := s.Sum(filepath.Join(dir, "local.tar"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(blake).ToNot(Equal(local))
+			Expect(ioutil.WriteFile(filepath.Join(dir, "remote"), []byte("remote"), 0644)).To(Succeed())
+			remote, err := s.Sum(filepath.Join(dir, "remote"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(spec(blake, remote).VerifySources(context.Background(), buildDir, s)).To(Succeed())
+
+			Expect((&LuetConfig{PackageSourceIntegrity: LuetSourceIntegrity{Policy: "md5"}}).Validate()).To(HaveOccurred())
+		})
+	})
 })
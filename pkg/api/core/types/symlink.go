@@ -0,0 +1,45 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+// SymlinkRule creates a symlink at To pointing to From after
+// a package matching PackagePattern is installed.
+// From and To are relative to the rootfs.
+type SymlinkRule struct {
+	PackagePattern string `yaml:"package" mapstructure:"package"`
+	From           string `yaml:"from" mapstructure:"from"`
+	To             string `yaml:"to" mapstructure:"to"`
+}
+
+// Matches returns true if the rule applies to the package.
+// Patterns are in the category/name@version glob form used by the blacklist.
+func (r SymlinkRule) Matches(p *Package) bool {
+	b, err := parsePackagePattern(r.PackagePattern)
+	if err != nil {
+		return false
+	}
+	return b.match(p)
+}
+
+// GetSymlinkRules returns the symlink rules matching the package
+func (c *LuetConfig) GetSymlinkRules(p *Package) (res []SymlinkRule) {
+	for _, r := range c.SymlinkPackages {
+		if r.Matches(p) {
+			res = append(res, r)
+		}
+	}
+	return
+}
@@ -0,0 +1,38 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import "runtime"
+
+// ArchLabel is the package label (or annotation) holding the
+// architecture a package was built for
+const ArchLabel = "arch"
+
+// ArchSyncFilter returns a RepoSyncFilter which keeps only the packages
+// built for arch, or for the running architecture if arch is empty.
+// Packages without an architecture label are always kept.
+func ArchSyncFilter(arch string) func(*LuetRepository, *Package) bool {
+	if arch == "" {
+		arch = runtime.GOARCH
+	}
+	return func(_ *LuetRepository, p *Package) bool {
+		a, ok := p.Labels[ArchLabel]
+		if !ok {
+			a, ok = p.Annotations[PackageAnnotation(ArchLabel)]
+		}
+		return !ok || a == "" || a == arch
+	}
+}
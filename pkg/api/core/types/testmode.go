@@ -0,0 +1,102 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// TestingT is the subset of testing.T used by the test mode
+type TestingT interface {
+	TempDir() string
+}
+
+// memFiles holds the files written in test mode
+type memFiles struct {
+	sync.Mutex
+	files map[string][]byte
+}
+
+// memDatabases holds the in-memory databases used in test mode, by path
+type memDatabases struct {
+	sync.Mutex
+	dbs map[string]PackageDatabase
+}
+
+// SetTestMode enables the test mode: the system database is kept in memory,
+// temporary files are created in t.TempDir() and WriteToFile doesn't
+// touch the filesystem.
+func (c *LuetConfig) SetTestMode(t TestingT) {
+	c.TestMode = true
+	c.TestingT = t
+	c.testFiles = &memFiles{files: map[string][]byte{}}
+	c.testDatabases = &memDatabases{dbs: map[string]PackageDatabase{}}
+}
+
+// TestDatabase returns the in-memory database standing for the one at
+// path in test mode, created with newDB on first use. The copies of the
+// config share the same databases.
+func (c *LuetConfig) TestDatabase(path string, newDB func() PackageDatabase) PackageDatabase {
+	if c.testDatabases == nil {
+		c.testDatabases = &memDatabases{dbs: map[string]PackageDatabase{}}
+	}
+	c.testDatabases.Lock()
+	defer c.testDatabases.Unlock()
+	path = filepath.Clean(path)
+	if db, ok := c.testDatabases.dbs[path]; ok {
+		return db
+	}
+	db := newDB()
+	c.testDatabases.dbs[path] = db
+	return db
+}
+
+// WriteToFile writes data to the file, or to memory in test mode
+func (c *LuetConfig) WriteToFile(path string, data []byte, perm os.FileMode) error {
+	if !c.TestMode {
+		return ioutil.WriteFile(path, data, perm)
+	}
+
+	if c.testFiles == nil {
+		c.testFiles = &memFiles{files: map[string][]byte{}}
+	}
+	c.testFiles.Lock()
+	defer c.testFiles.Unlock()
+	c.testFiles.files[filepath.Clean(path)] = append([]byte{}, data...)
+	return nil
+}
+
+// ReadTestFile returns the content of a file written with WriteToFile in test mode
+func (c *LuetConfig) ReadTestFile(path string) ([]byte, bool) {
+	if c.testFiles == nil {
+		return nil, false
+	}
+	c.testFiles.Lock()
+	defer c.testFiles.Unlock()
+	data, ok := c.testFiles.files[filepath.Clean(path)]
+	return data, ok
+}
+
+// TestTempDir returns the directory temporary files are created in test mode
+func (c *LuetConfig) TestTempDir() (string, bool) {
+	if !c.TestMode || c.TestingT == nil {
+		return "", false
+	}
+	return c.TestingT.TempDir(), true
+}
@@ -0,0 +1,60 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+// Trust levels, from the most to the least trusted
+const (
+	TrustStable   = "stable"
+	TrustTesting  = "testing"
+	TrustUnstable = "unstable"
+)
+
+var trustLevels = map[string]int{
+	TrustStable:   0,
+	TrustTesting:  1,
+	TrustUnstable: 2,
+}
+
+// IsValidTrustLevel returns true if l is a known trust level or empty
+func IsValidTrustLevel(l string) bool {
+	_, ok := trustLevels[l]
+	return ok || l == ""
+}
+
+func trustRank(l, def string) int {
+	if r, ok := trustLevels[l]; ok {
+		return r
+	}
+	return trustLevels[def]
+}
+
+// GetTrustedRepositories returns the system repositories allowed by the
+// configured trust level. Repositories without a trust level are considered
+// stable, and no filtering is done if the config has no trust level.
+func (c *LuetConfig) GetTrustedRepositories() LuetRepositories {
+	if c.TrustLevel == "" {
+		return c.SystemRepositories
+	}
+
+	max := trustRank(c.TrustLevel, TrustUnstable)
+	res := LuetRepositories{}
+	for _, r := range c.SystemRepositories {
+		if trustRank(r.TrustLevel, TrustStable) <= max {
+			res = append(res, r)
+		}
+	}
+	return res
+}
@@ -0,0 +1,101 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+)
+
+// ErrRepoSignatureInvalid is returned when the index of a repository
+// isn't signed by any of the trusted keys
+var ErrRepoSignatureInvalid = errors.New("invalid repository signature")
+
+// LuetRepositoryVerification checks the detached GPG signature
+// of the repository indexes on sync
+type LuetRepositoryVerification struct {
+	Enabled bool `yaml:"enabled,omitempty" mapstructure:"enabled"`
+
+	// TrustedKeys are paths to armored GPG public keys
+	TrustedKeys []string `yaml:"trusted_keys,omitempty" mapstructure:"trusted_keys"`
+}
+
+func (v LuetRepositoryVerification) validate(tofu bool) error {
+	if v.Enabled && !tofu && len(v.TrustedKeys) == 0 {
+		return fmt.Errorf("repository verification is enabled without trusted keys")
+	}
+	return nil
+}
+
+// TrustedKeysDir is the directory of the system database holding
+// the keys pinned with trust_on_first_use
+const TrustedKeysDir = "trusted_keys"
+
+// GetTrustedKeyPath returns the path of the pinned key of a repository.
+// Path separators in the name are replaced, so the key is always
+// in the trusted keys directory.
+func (s LuetSystemConfig) GetTrustedKeyPath(name string) string {
+	name = strings.NewReplacer("/", "_", `\`, "_").Replace(name)
+	return filepath.Join(s.DatabasePath, TrustedKeysDir, name+".asc")
+}
+
+func (v LuetRepositoryVerification) keyRing() (openpgp.EntityList, error) {
+	keyring := openpgp.EntityList{}
+	for _, k := range v.TrustedKeys {
+		f, err := os.Open(k)
+		if err != nil {
+			return nil, errors.Wrapf(err, "opening trusted key '%s'", k)
+		}
+		keys, err := openpgp.ReadArmoredKeyRing(f)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading trusted key '%s'", k)
+		}
+		keyring = append(keyring, keys...)
+	}
+	return keyring, nil
+}
+
+// Verify checks the armored detached signature of file against the
+// trusted keys, returning ErrRepoSignatureInvalid when it doesn't match
+func (v LuetRepositoryVerification) Verify(file, signature string) error {
+	keyring, err := v.keyRing()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sig, err := os.Open(signature)
+	if err != nil {
+		return err
+	}
+	defer sig.Close()
+
+	if _, err := openpgp.CheckArmoredDetachedSignature(keyring, f, sig); err != nil {
+		return errors.Wrap(ErrRepoSignatureInvalid, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+// VirtualPackage is a package provided by the host, e.g. in a chroot the
+// libc of the host system. The solver considers it installed.
+type VirtualPackage struct {
+	Name     string `yaml:"name" mapstructure:"name"`
+	Category string `yaml:"category" mapstructure:"category"`
+	Version  string `yaml:"version" mapstructure:"version"`
+}
+
+// Package returns the package the host provides
+func (v VirtualPackage) Package() *Package {
+	return &Package{Name: v.Name, Category: v.Category, Version: v.Version}
+}
+
+// GetHostProvides returns the packages provided by the host
+func (c *LuetConfig) GetHostProvides() Packages {
+	res := Packages{}
+	for _, v := range c.ProvideVirtualPackages {
+		res = append(res, v.Package())
+	}
+	return res
+}
@@ -0,0 +1,76 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// GetRepositoryWeight returns the weight of the repository in
+// SystemRepositoryWeights, 1 if it isn't listed
+func (c *LuetConfig) GetRepositoryWeight(name string) int {
+	if w, ok := c.SystemRepositoryWeights[name]; ok {
+		return w
+	}
+	return 1
+}
+
+// SystemRepositoriesOrdered returns the trusted system repositories sorted by
+// priority, the heaviest first among the ones with the same priority.
+// Repositories with zero weight are never selected and are left out.
+func (c *LuetConfig) SystemRepositoriesOrdered() LuetRepositories {
+	res := LuetRepositories{}
+	for _, r := range c.GetTrustedRepositories() {
+		if c.GetRepositoryWeight(r.Name) > 0 {
+			res = append(res, r)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Priority != res[j].Priority {
+			return res[i].Priority < res[j].Priority
+		}
+		return c.GetRepositoryWeight(res[i].Name) > c.GetRepositoryWeight(res[j].Name)
+	})
+	return res
+}
+
+// PickRepository chooses one of the repositories at random, with a probability
+// proportional to its weight. It returns "" if all the weights are zero.
+func (c *LuetConfig) PickRepository(names []string) string {
+	total := 0
+	for _, n := range names {
+		if w := c.GetRepositoryWeight(n); w > 0 {
+			total += w
+		}
+	}
+	if total == 0 {
+		return ""
+	}
+
+	r := rand.Intn(total)
+	for _, n := range names {
+		w := c.GetRepositoryWeight(n)
+		if w <= 0 {
+			continue
+		}
+		if r < w {
+			return n
+		}
+		r -= w
+	}
+	return ""
+}
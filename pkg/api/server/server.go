@@ -0,0 +1,256 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/mudler/luet/pkg/installer"
+)
+
+// Server is the management API of a system. Operations
+// changing the system are run one at a time, and not
+// while the system is read.
+type Server struct {
+	lock   *sync.RWMutex
+	ctx    types.Context
+	system *installer.System
+	token  string
+}
+
+// PackagesRequest is the body of the install and remove requests.
+// Packages without version match any version.
+type PackagesRequest struct {
+	Packages []*types.Package `json:"packages"`
+}
+
+// SyncRequest is the body of the repository sync requests,
+// all the enabled repositories are synced if empty
+type SyncRequest struct {
+	Repositories []string `json:"repositories"`
+}
+
+// PackageInfo is a package listed by the API
+type PackageInfo struct {
+	Category string `json:"category"`
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+}
+
+type response struct {
+	Error    string                 `json:"error,omitempty"`
+	Packages []PackageInfo          `json:"packages,omitempty"`
+	Repos    []types.LuetRepository `json:"repositories,omitempty"`
+	Synced   []string               `json:"synced,omitempty"`
+}
+
+// New returns a Server managing system with the context configuration.
+// lock is shared with the other operations on the system, if nil the
+// server operations are only serialized between themselves.
+func New(ctx types.Context, system *installer.System, lock *sync.RWMutex) *Server {
+	if lock == nil {
+		lock = &sync.RWMutex{}
+	}
+	return &Server{lock: lock, ctx: ctx, system: system, token: ctx.GetConfig().APIServer.AuthToken}
+}
+
+// Serve starts the API server configured in the context.
+// The server runs in background until it is shut down.
+func Serve(ctx types.Context, system *installer.System, lock *sync.RWMutex) (*http.Server, error) {
+	l, err := net.Listen("tcp", ctx.GetConfig().APIServer.GetListenAddr())
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &http.Server{Handler: New(ctx, system, lock).Handler()}
+	go srv.Serve(l)
+
+	return srv, nil
+}
+
+// Handler returns the HTTP handler of the API, requiring the auth token
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/install", s.post(s.install))
+	mux.HandleFunc("/remove", s.post(s.remove))
+	mux.HandleFunc("/repo/sync", s.post(s.sync))
+	mux.HandleFunc("/packages", s.get(s.packages))
+	mux.HandleFunc("/repos", s.get(s.repos))
+	return s.authenticated(mux)
+}
+
+func (s *Server) authenticated(next http.Handler) http.Handler {
+	expected := []byte("Bearer " + s.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if s.token == "" || subtle.ConstantTimeCompare(got, expected) != 1 {
+			reply(w, http.StatusUnauthorized, response{Error: "unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) get(f func(*http.Request) (response, error)) http.HandlerFunc {
+	return s.method(http.MethodGet, func(r *http.Request) (response, error) {
+		s.lock.RLock()
+		defer s.lock.RUnlock()
+		return f(r)
+	})
+}
+
+func (s *Server) post(f func(*http.Request) (response, error)) http.HandlerFunc {
+	return s.method(http.MethodPost, func(r *http.Request) (response, error) {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		return f(r)
+	})
+}
+
+func (s *Server) method(m string, f func(*http.Request) (response, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != m {
+			reply(w, http.StatusMethodNotAllowed, response{Error: fmt.Sprintf("method %s not allowed", r.Method)})
+			return
+		}
+		resp, err := f(r)
+		if err != nil {
+			s.ctx.Warning("API request", r.URL.Path, "failed:", err.Error())
+			reply(w, http.StatusInternalServerError, response{Error: err.Error()})
+			return
+		}
+		reply(w, http.StatusOK, resp)
+	}
+}
+
+func reply(w http.ResponseWriter, status int, resp response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) installer() *installer.LuetInstaller {
+	cfg := s.ctx.GetConfig()
+	return installer.NewLuetInstaller(installer.LuetInstallerOptions{
+		Concurrency:                 cfg.General.Concurrency,
+		SolverOptions:               cfg.Solver,
+		PreserveSystemEssentialData: true,
+		CheckConflicts:              true,
+		PackageRepositories:         cfg.SystemRepositoriesOrdered(),
+		Context:                     s.ctx,
+	})
+}
+
+func readPackages(r *http.Request) (types.Packages, error) {
+	req := &PackagesRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return nil, fmt.Errorf("invalid request: %s", err.Error())
+	}
+	if len(req.Packages) == 0 {
+		return nil, fmt.Errorf("no packages given")
+	}
+	for _, p := range req.Packages {
+		if p.Version == "" {
+			p.Version = ">=0"
+		}
+	}
+	return req.Packages, nil
+}
+
+func packageInfos(packs types.Packages) []PackageInfo {
+	res := []PackageInfo{}
+	for _, p := range packs {
+		res = append(res, PackageInfo{Category: p.GetCategory(), Name: p.GetName(), Version: p.GetVersion()})
+	}
+	return res
+}
+
+func (s *Server) install(r *http.Request) (response, error) {
+	packs, err := readPackages(r)
+	if err != nil {
+		return response{}, err
+	}
+	if err := s.installer().Install(packs, s.system); err != nil {
+		return response{}, err
+	}
+	return response{Packages: packageInfos(packs)}, nil
+}
+
+func (s *Server) remove(r *http.Request) (response, error) {
+	packs, err := readPackages(r)
+	if err != nil {
+		return response{}, err
+	}
+	if err := s.installer().Uninstall(s.system, packs...); err != nil {
+		return response{}, err
+	}
+	return response{Packages: packageInfos(packs)}, nil
+}
+
+func (s *Server) packages(r *http.Request) (response, error) {
+	return response{Packages: packageInfos(s.system.Database.World())}, nil
+}
+
+func (s *Server) repos(r *http.Request) (response, error) {
+	repos := []types.LuetRepository{}
+	for _, repo := range s.ctx.GetConfig().SystemRepositories {
+		// Never expose the repository credentials
+		repo.Authentication = nil
+		repos = append(repos, repo)
+	}
+	return response{Repos: repos}, nil
+}
+
+func (s *Server) sync(r *http.Request) (response, error) {
+	req := &SyncRequest{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			return response{}, fmt.Errorf("invalid request: %s", err.Error())
+		}
+	}
+
+	cfg := s.ctx.GetConfig()
+	repos := types.LuetRepositories{}
+	if len(req.Repositories) == 0 {
+		for _, repo := range cfg.SystemRepositories {
+			if repo.EnabledOn(cfg.GetSystemArch()) {
+				repos = append(repos, repo)
+			}
+		}
+	}
+	for _, name := range req.Repositories {
+		repo, err := cfg.GetSystemRepository(name)
+		if err != nil {
+			return response{}, err
+		}
+		repos = append(repos, *repo)
+	}
+
+	synced := []string{}
+	for _, repo := range repos {
+		if _, err := installer.NewSystemRepository(repo).Sync(s.ctx, true); err != nil {
+			return response{}, fmt.Errorf("while syncing repository %s: %s", repo.Name, err.Error())
+		}
+		synced = append(synced, repo.Name)
+	}
+	return response{Synced: synced}, nil
+}
@@ -0,0 +1,141 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package server_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	. "github.com/mudler/luet/pkg/api/server"
+	pkg "github.com/mudler/luet/pkg/database"
+	"github.com/mudler/luet/pkg/installer"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("API Server", func() {
+	var srv *httptest.Server
+	var system *installer.System
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "apiserver")
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx := context.NewContext()
+		ctx.Config.APIServer = types.LuetAPIServer{AuthToken: "secret"}
+		ctx.Config.SystemRepositories = types.LuetRepositories{
+			{Name: "main", Type: "http", Urls: []string{"https://example.com"}, Enable: true, Authentication: map[string]string{"token": "foo"}},
+		}
+
+		system = &installer.System{Database: pkg.NewInMemoryDatabase(false), Target: dir}
+		p := &types.Package{Category: "app", Name: "foo", Version: "1.0"}
+		_, err = system.Database.CreatePackage(p)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(system.Database.SetPackageFiles(&types.PackageFile{PackageFingerprint: p.GetFingerPrint()})).ToNot(HaveOccurred())
+
+		srv = httptest.NewServer(New(ctx, system, nil).Handler())
+	})
+
+	AfterEach(func() {
+		srv.Close()
+		os.RemoveAll(dir)
+	})
+
+	request := func(method, path, token, body string) (int, map[string]interface{}) {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := srv.Client().Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+
+		res := map[string]interface{}{}
+		Expect(json.NewDecoder(resp.Body).Decode(&res)).ToNot(HaveOccurred())
+		return resp.StatusCode, res
+	}
+
+	It("requires the auth token", func() {
+		status, _ := request(http.MethodGet, "/packages", "", "")
+		Expect(status).To(Equal(http.StatusUnauthorized))
+		status, _ = request(http.MethodGet, "/packages", "wrong", "")
+		Expect(status).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("lists the installed packages", func() {
+		status, res := request(http.MethodGet, "/packages", "secret", "")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(res["packages"]).To(ConsistOf(map[string]interface{}{"category": "app", "name": "foo", "version": "1.0"}))
+	})
+
+	It("lists the repositories without credentials", func() {
+		status, res := request(http.MethodGet, "/repos", "secret", "")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(res["repositories"]).To(HaveLen(1))
+		repo := res["repositories"].([]interface{})[0].(map[string]interface{})
+		Expect(repo["name"]).To(Equal("main"))
+		Expect(repo).ToNot(HaveKey("auth"))
+	})
+
+	It("removes packages", func() {
+		status, _ := request(http.MethodGet, "/remove", "secret", "")
+		Expect(status).To(Equal(http.StatusMethodNotAllowed))
+
+		status, res := request(http.MethodPost, "/remove", "secret", "")
+		Expect(status).To(Equal(http.StatusInternalServerError))
+		Expect(res["error"]).To(ContainSubstring("invalid request"))
+
+		status, res = request(http.MethodPost, "/remove", "secret", `{"packages":[{"category":"app","name":"foo"}]}`)
+		Expect(status).To(Equal(http.StatusOK), "%v", res)
+		Expect(system.Database.World()).To(BeEmpty())
+	})
+
+	It("reads the system under the lock shared with the other operations", func() {
+		lock := &sync.RWMutex{}
+		ctx := context.NewContext()
+		ctx.Config.APIServer = types.LuetAPIServer{AuthToken: "secret"}
+		srv.Close()
+		srv = httptest.NewServer(New(ctx, system, lock).Handler())
+
+		lock.Lock()
+		done := make(chan int)
+		go func() {
+			defer GinkgoRecover()
+			status, _ := request(http.MethodGet, "/packages", "secret", "")
+			done <- status
+		}()
+		Consistently(done, 200*time.Millisecond).ShouldNot(Receive())
+		lock.Unlock()
+		Eventually(done, 5*time.Second).Should(Receive(Equal(http.StatusOK)))
+	})
+
+	It("refuses to sync unknown repositories", func() {
+		status, res := request(http.MethodPost, "/repo/sync", "secret", `{"repositories":["foo"]}`)
+		Expect(status).To(Equal(http.StatusInternalServerError))
+		Expect(res["error"]).ToNot(BeEmpty())
+	})
+})
@@ -15,6 +15,8 @@
 
 package box
 
+import "context"
+
 type Box interface {
 	Run() error
 	Exec() error
@@ -28,6 +30,9 @@ type DefaultBox struct {
 	Args                  []string
 	HostMounts            []string
 	Stdin, Stdout, Stderr bool
+
+	// Context kills the box when done, if set
+	Context context.Context
 }
 
 func NewBox(cmd string, args, hostmounts, env []string, rootfs string, stdin, stdout, stderr bool) Box {
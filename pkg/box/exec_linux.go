@@ -118,6 +118,9 @@ func (b *DefaultBox) Run() error {
 	}
 
 	cmd := exec.Command("/proc/self/exe", execCmd...)
+	if b.Context != nil {
+		cmd = exec.CommandContext(b.Context, "/proc/self/exe", execCmd...)
+	}
 	if b.Stdin {
 		cmd.Stdin = os.Stdin
 	}
@@ -16,7 +16,9 @@
 package backend
 
 import (
+	"context"
 	"os/exec"
+	"sort"
 
 	"github.com/mudler/luet/pkg/api/core/types"
 	"github.com/pkg/errors"
@@ -34,6 +36,22 @@ type Options struct {
 	Destination    string
 	Context        string
 	BackendArgs    []string
+	// Network is the network mode of the build, e.g. none
+	Network string
+	// Parent bounds the backend commands, which are killed once it is done
+	Parent context.Context
+	// BuildContexts are additional named build contexts, name to path
+	BuildContexts map[string]string
+	// BuildArgs are the build arguments of the build, name to value
+	BuildArgs map[string]string
+}
+
+// command returns the backend command bound to the Parent context of opts
+func command(opts Options, name string, args ...string) *exec.Cmd {
+	if opts.Parent == nil {
+		return exec.Command(name, args...)
+	}
+	return exec.CommandContext(opts.Parent, name, args...)
 }
 
 func runCommand(ctx types.Context, cmd *exec.Cmd) error {
@@ -69,6 +87,26 @@ func genBuildCommand(opts Options) []string {
 	if context == "" {
 		context = "."
 	}
-	buildarg := append(opts.BackendArgs, "-f", opts.DockerFileName, "-t", opts.ImageName, context)
+	buildarg := append([]string{}, opts.BackendArgs...)
+	if opts.Network != "" {
+		buildarg = append(buildarg, "--network", opts.Network)
+	}
+	names := []string{}
+	for name := range opts.BuildContexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buildarg = append(buildarg, "--build-context", name+"="+opts.BuildContexts[name])
+	}
+	names = []string{}
+	for name := range opts.BuildArgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buildarg = append(buildarg, "--build-arg", name+"="+opts.BuildArgs[name])
+	}
+	buildarg = append(buildarg, "-f", opts.DockerFileName, "-t", opts.ImageName, context)
 	return append([]string{"build"}, buildarg...)
 }
@@ -17,6 +17,7 @@ package backend
 
 import (
 	"io"
+	"os"
 	"os/exec"
 
 	"github.com/google/go-containerregistry/pkg/crane"
@@ -47,8 +48,12 @@ func (s *SimpleDocker) BuildImage(opts Options) error {
 
 	buildarg := genBuildCommand(opts)
 	s.ctx.Info(":whale2: Building image " + name)
-	cmd := exec.Command("docker", buildarg...)
+	cmd := command(opts, "docker", buildarg...)
 	cmd.Dir = opts.SourcePath
+	if len(opts.BuildContexts) > 0 {
+		// Named build contexts are supported only by BuildKit
+		cmd.Env = append(os.Environ(), "DOCKER_BUILDKIT=1")
+	}
 	err := runCommand(s.ctx, cmd)
 	if err != nil {
 		return err
@@ -93,7 +98,7 @@ func (s *SimpleDocker) DownloadImage(opts Options) error {
 	s.ctx.Spinner()
 	defer s.ctx.SpinnerStop()
 
-	cmd := exec.Command("docker", buildarg...)
+	cmd := command(opts, "docker", buildarg...)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		return errors.Wrap(err, "Failed pulling image: "+string(out))
@@ -142,7 +147,7 @@ func (s *SimpleDocker) Push(opts Options) error {
 	s.ctx.Spinner()
 	defer s.ctx.SpinnerStop()
 
-	out, err := exec.Command("docker", pusharg...).CombinedOutput()
+	out, err := command(opts, "docker", pusharg...).CombinedOutput()
 	if err != nil {
 		return errors.Wrap(err, "Failed pushing image: "+string(out))
 	}
@@ -238,7 +243,7 @@ func (s *SimpleDocker) ExportImage(opts Options) error {
 	s.ctx.Spinner()
 	defer s.ctx.SpinnerStop()
 
-	out, err := exec.Command("docker", buildarg...).CombinedOutput()
+	out, err := command(opts, "docker", buildarg...).CombinedOutput()
 	if err != nil {
 		return errors.Wrap(err, "Failed exporting image: "+string(out))
 	}
@@ -49,7 +49,7 @@ func (s *SimpleImg) BuildImage(opts Options) error {
 
 	s.ctx.Info(":tea: Building image " + name)
 
-	cmd := exec.Command("img", buildarg...)
+	cmd := command(opts, "img", buildarg...)
 	cmd.Dir = opts.SourcePath
 	err := runCommand(s.ctx, cmd)
 	if err != nil {
@@ -109,7 +109,7 @@ func (s *SimpleImg) DownloadImage(opts Options) error {
 	s.ctx.Spinner()
 	defer s.ctx.SpinnerStop()
 
-	cmd := exec.Command("img", buildarg...)
+	cmd := command(opts, "img", buildarg...)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		return errors.Wrap(err, "Failed downloading image: "+string(out))
@@ -174,7 +174,7 @@ func (s *SimpleImg) ExportImage(opts Options) error {
 	s.ctx.Spinner()
 	defer s.ctx.SpinnerStop()
 
-	out, err := exec.Command("img", buildarg...).CombinedOutput()
+	out, err := command(opts, "img", buildarg...).CombinedOutput()
 	if err != nil {
 		return errors.Wrap(err, "Failed exporting image: "+string(out))
 	}
@@ -187,7 +187,7 @@ func (s *SimpleImg) Push(opts Options) error {
 	bus.Manager.Publish(bus.EventImagePrePush, opts)
 
 	pusharg := []string{"push", name}
-	out, err := exec.Command("img", pusharg...).CombinedOutput()
+	out, err := command(opts, "img", pusharg...).CombinedOutput()
 	if err != nil {
 		return errors.Wrap(err, "Failed pushing image: "+string(out))
 	}
@@ -0,0 +1,59 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler_test
+
+import (
+	"os"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	. "github.com/mudler/luet/pkg/compiler"
+	"github.com/mudler/luet/pkg/compiler/backend"
+	pkg "github.com/mudler/luet/pkg/database"
+	"github.com/mudler/luet/pkg/tree"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Build environment", func() {
+	It("passes the filtered host variables as build arguments", func() {
+		os.Setenv("LUET_TEST_BUILD_ENV", "value")
+		defer os.Unsetenv("LUET_TEST_BUILD_ENV")
+
+		generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+		Expect(generalRecipe.Load("../../tests/fixtures/buildtree")).To(Succeed())
+
+		ctx := context.NewContext()
+		ctx.Config.BuildContextEnvFilter = []string{"LUET_TEST_*"}
+
+		opts := &backend.Options{}
+		dockerfiles := &[]string{}
+		c := NewLuetCompiler(recordingBackend{opts: opts, dockerfiles: dockerfiles}, generalRecipe.GetDatabase(), WithContext(ctx))
+
+		spec, err := c.FromPackage(&types.Package{Name: "enman", Category: "app-admin", Version: "1.4.0"})
+		Expect(err).ToNot(HaveOccurred())
+
+		spec.SetOutputPath(GinkgoT().TempDir())
+		_, err = c.Compile(false, spec)
+		Expect(err).To(HaveOccurred())
+
+		Expect(opts.BuildArgs).To(Equal(map[string]string{"LUET_TEST_BUILD_ENV": "value"}))
+		Expect(*dockerfiles).ToNot(BeEmpty())
+		for _, d := range *dockerfiles {
+			Expect(d).To(ContainSubstring("\nARG LUET_TEST_BUILD_ENV"))
+		}
+	})
+})
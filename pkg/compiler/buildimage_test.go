@@ -0,0 +1,83 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	. "github.com/mudler/luet/pkg/compiler"
+	pkg "github.com/mudler/luet/pkg/database"
+	"github.com/mudler/luet/pkg/tree"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Build container image", func() {
+	var c *LuetCompiler
+
+	BeforeEach(func() {
+		dir := GinkgoT().TempDir()
+		for name, build := range map[string]string{
+			"default":  "steps:\n- echo default\n",
+			"override": "image: alpine\nsteps:\n- echo override\n",
+			"host":     "image: none\nsteps:\n- mkdir -p $DESTDIR/usr/bin && echo $PACKAGE_NAME > $DESTDIR/usr/bin/host\n",
+		} {
+			p := filepath.Join(dir, "test", name, "1.0")
+			Expect(os.MkdirAll(p, os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(p, "definition.yaml"), []byte("category: test\nname: "+name+"\nversion: \"1.0\"\n"), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(p, "build.yaml"), []byte(build), 0600)).To(Succeed())
+		}
+
+		generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+		Expect(generalRecipe.Load(dir)).To(Succeed())
+
+		ctx := context.NewContext()
+		ctx.Config.General.BuildContainerImage = "luet/builder"
+		c = NewLuetCompiler(hangingBackend{}, generalRecipe.GetDatabase(), WithContext(ctx))
+	})
+
+	It("is the image of the specs without one", func() {
+		spec, err := c.FromPackage(&types.Package{Name: "default", Category: "test", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.GetImage()).To(Equal("luet/builder"))
+	})
+
+	It("is overridden by the package image", func() {
+		spec, err := c.FromPackage(&types.Package{Name: "override", Category: "test", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.GetImage()).To(Equal("alpine"))
+	})
+
+	It("builds on the host with image none", func() {
+		spec, err := c.FromPackage(&types.Package{Name: "host", Category: "test", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.BuildsOnHost()).To(BeTrue())
+
+		spec.SetOutputPath(GinkgoT().TempDir())
+		a, err := c.Compile(false, spec)
+		Expect(err).ToNot(HaveOccurred())
+
+		dst := GinkgoT().TempDir()
+		Expect(a.Unpack(context.NewContext(), dst, false)).To(Succeed())
+		dat, err := ioutil.ReadFile(filepath.Join(dst, "usr", "bin", "host"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(dat)).To(Equal("host\n"))
+	})
+})
@@ -17,6 +17,7 @@ package compiler
 
 import (
 	"bytes"
+	gocontext "context"
 	"crypto/md5"
 	"fmt"
 	"io"
@@ -26,6 +27,7 @@ import (
 	"path/filepath"
 
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -68,6 +70,12 @@ type LuetCompiler struct {
 	Backend  CompilerBackend
 	Database types.PackageDatabase
 	Options  types.CompilerOptions
+
+	// variant is the build matrix combination compiled, see withVariant
+	variant *types.BuildVariant
+
+	// buildCtx bounds the backend commands of a package build, see compileWithTimeout
+	buildCtx gocontext.Context
 }
 
 func NewCompiler(p ...types.CompilerOption) *LuetCompiler {
@@ -140,23 +148,83 @@ func (cs *LuetCompiler) CompileWithReverseDeps(keepPermissions bool, ps *types.L
 
 // CompileParallel compiles the supplied compilationspecs in parallel
 // to note, no specific heuristic is implemented, and the specs are run in parallel as they are.
+// Packages with a build matrix are compiled once per variant afterwards.
 func (cs *LuetCompiler) CompileParallel(keepPermissions bool, ps *types.LuetCompilationspecs) ([]*artifact.PackageArtifact, []error) {
+	cfg := cs.Options.Context.GetConfig()
+	plain := types.NewLuetCompilationspecs()
+	matrix := map[*types.LuetCompilationSpec][]types.BuildVariant{}
+	for _, p := range ps.All() {
+		variants, err := cfg.ExpandBuildMatrix(p.GetPackage().GetPackageName())
+		if err != nil {
+			return nil, []error{err}
+		}
+		if len(variants) == 0 {
+			plain.Add(p)
+			continue
+		}
+		matrix[p] = variants
+	}
+
+	artifacts, errs := cs.compileParallel(keepPermissions, plain)
+	for _, p := range ps.All() {
+		for _, v := range matrix[p] {
+			a, err := cs.compileVariant(keepPermissions, p, v)
+			artifacts = append(artifacts, a...)
+			errs = append(errs, err...)
+		}
+	}
+	return artifacts, errs
+}
+
+// withVariant returns a copy of the compiler which adds the variant labels
+// to the build environment of its package, see types.BuildVariant.Env
+func (cs *LuetCompiler) withVariant(v types.BuildVariant) *LuetCompiler {
+	c := *cs
+	c.variant = &v
+	return &c
+}
+
+// compileVariant compiles the spec with the variant in a subdirectory
+// of its output path named after it
+func (cs *LuetCompiler) compileVariant(keepPermissions bool, p *types.LuetCompilationSpec, v types.BuildVariant) ([]*artifact.PackageArtifact, []error) {
+	cs.Options.Context.Info(":hammer: Build matrix of", p.GetPackage().HumanReadableString(), "variant", v.Name())
+	vcs := cs.withVariant(v)
+	spec, err := vcs.FromPackage(p.GetPackage())
+	if err != nil {
+		return nil, []error{errors.Wrapf(err, "while generating variant %s", v.Name())}
+	}
+	spec.SetOutputPath(filepath.Join(p.GetOutputPath(), v.Name()))
+
+	specs := types.NewLuetCompilationspecs(spec)
+	return vcs.compileParallel(keepPermissions, specs)
+}
+
+func (cs *LuetCompiler) compileParallel(keepPermissions bool, ps *types.LuetCompilationspecs) ([]*artifact.PackageArtifact, []error) {
 	all := make(chan *types.LuetCompilationSpec)
 	artifacts := []*artifact.PackageArtifact{}
 	mutex := &sync.Mutex{}
-	errors := make(chan error, ps.Len())
+	errors := make(chan error, ps.Len()+1)
 	var wg = new(sync.WaitGroup)
 	for i := 0; i < cs.Options.Concurrency; i++ {
 		wg.Add(1)
 		go cs.compilerWorker(i, wg, all, &artifacts, mutex, cs.Options.Concurrency, keepPermissions, errors)
 	}
 
+	parent := cs.Options.Context.GetConfig().General.GetParentContext()
+SPECS:
 	for _, p := range ps.All() {
-		all <- p
+		select {
+		case all <- p:
+		case <-parent.Done():
+			break SPECS
+		}
 	}
 
 	close(all)
 	wg.Wait()
+	if err := parent.Err(); err != nil {
+		errors <- err
+	}
 	close(errors)
 
 	var allErrors []error
@@ -372,6 +440,43 @@ func (cs *LuetCompiler) buildPackageImage(image, buildertaggedImage, packageImag
 		}
 	}
 
+	cfg := cs.Options.Context.GetConfig()
+	if cfg.PackageSourceIntegrity.Enabled && len(p.GetRetrieve()) > 0 {
+		if err := p.VerifySources(cfg.General.GetParentContext(), buildDir, cfg.PackageSourceIntegrity); err != nil {
+			return builderOpts, runnerOpts, errors.Wrap(err, "Source integrity check failure")
+		}
+		cs.Options.Context.Debug(pkgTag, "sources verified")
+	}
+	policies := cfg.GetNetworkPolicies(p.GetPackage())
+	network := ""
+	if cfg.BuildSandbox.NetworkDisabled || types.NetworkIsolated(policies) {
+		network = "none"
+	} else {
+		p.NetworkRules = types.NetworkRules(policies)
+	}
+
+	var buildContexts map[string]string
+	if mounts := cfg.CrossCompile.Mounts(); len(mounts) > 0 {
+		p.Mounts = mounts
+		buildContexts = map[string]string{types.CrossCompileSysrootContext: cfg.CrossCompile.SysrootPath}
+	}
+	if mounts := cfg.BuildSandbox.Mounts(); len(mounts) > 0 {
+		p.Mounts = append(cfg.CrossCompile.Mounts(), mounts...)
+		if buildContexts == nil {
+			buildContexts = map[string]string{}
+		}
+		for name, path := range cfg.BuildSandbox.BuildContexts() {
+			buildContexts[name] = path
+		}
+	}
+
+	buildArgs := cfg.BuildEnvArgs()
+	p.BuildArgs = []string{}
+	for name := range buildArgs {
+		p.BuildArgs = append(p.BuildArgs, name)
+	}
+	sort.Strings(p.BuildArgs)
+
 	// First we create the builder image
 	if err := p.WriteBuildImageDefinition(filepath.Join(buildDir, p.GetPackage().ImageID()+"-builder.dockerfile")); err != nil {
 		return builderOpts, runnerOpts, errors.Wrap(err, "Could not generate image definition")
@@ -398,6 +503,10 @@ func (cs *LuetCompiler) buildPackageImage(image, buildertaggedImage, packageImag
 		DockerFileName: p.GetPackage().ImageID() + "-builder.dockerfile",
 		Destination:    p.Rel(p.GetPackage().GetFingerPrint() + "-builder.image.tar"),
 		BackendArgs:    cs.Options.BackendArgs,
+		Network:        network,
+		Parent:         cs.buildCtx,
+		BuildContexts:  buildContexts,
+		BuildArgs:      buildArgs,
 	}
 	runnerOpts = backend.Options{
 		ImageName:      packageImage,
@@ -405,6 +514,10 @@ func (cs *LuetCompiler) buildPackageImage(image, buildertaggedImage, packageImag
 		DockerFileName: p.GetPackage().ImageID() + ".dockerfile",
 		Destination:    p.Rel(p.GetPackage().GetFingerPrint() + ".image.tar"),
 		BackendArgs:    cs.Options.BackendArgs,
+		Network:        network,
+		Parent:         cs.buildCtx,
+		BuildContexts:  buildContexts,
+		BuildArgs:      buildArgs,
 	}
 
 	buildAndPush := func(opts backend.Options) error {
@@ -448,6 +561,18 @@ func (cs *LuetCompiler) buildPackageImage(image, buildertaggedImage, packageImag
 	return builderOpts, runnerOpts, nil
 }
 
+// annotatedRuntime returns the runtime package of p, adding the default
+// annotations to both of them before the artifact metadata is written
+func (cs *LuetCompiler) annotatedRuntime(p *types.Package) (*types.Package, error) {
+	runtime, err := p.GetRuntimePackage()
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting runtime package for '%s'", p.HumanReadableString())
+	}
+	cfg := cs.Options.Context.GetConfig()
+	cfg.InheritDefaultAnnotations(p, runtime)
+	return runtime, nil
+}
+
 func (cs *LuetCompiler) genArtifact(p *types.LuetCompilationSpec, builderOpts, runnerOpts backend.Options, concurrency int, keepPermissions bool) (*artifact.PackageArtifact, error) {
 
 	// generate *artifact.PackageArtifact
@@ -475,7 +600,11 @@ func (cs *LuetCompiler) genArtifact(p *types.LuetCompilationSpec, builderOpts, r
 
 		a.CompileSpec = p
 		a.CompileSpec.GetPackage().SetBuildTimestamp(time.Now().String())
-		err = a.WriteYAML(p.GetOutputPath())
+		runtime, err := cs.annotatedRuntime(a.CompileSpec.GetPackage())
+		if err != nil {
+			return a, err
+		}
+		err = a.WriteYAML(p.GetOutputPath(), artifact.WithRuntimePackage(runtime))
 		if err != nil {
 			return a, errors.Wrap(err, "Failed while writing metadata file")
 		}
@@ -511,7 +640,11 @@ func (cs *LuetCompiler) genArtifact(p *types.LuetCompilationSpec, builderOpts, r
 
 	a.CompileSpec.GetPackage().SetBuildTimestamp(time.Now().String())
 
-	err = a.WriteYAML(p.GetOutputPath())
+	runtime, err := cs.annotatedRuntime(a.CompileSpec.GetPackage())
+	if err != nil {
+		return a, err
+	}
+	err = a.WriteYAML(p.GetOutputPath(), artifact.WithRuntimePackage(runtime))
 	if err != nil {
 		return a, errors.Wrap(err, "Failed while writing metadata file")
 	}
@@ -562,6 +695,8 @@ func (cs *LuetCompiler) buildSubPackage(a *artifact.PackageArtifact, sub *types.
 	subArtifact.CompileSpec.Package = sub.Package
 	subArtifact.Runtime = sub.Package
 	subArtifact.CompileSpec.GetPackage().SetBuildTimestamp(time.Now().String())
+	cfg := cs.Options.Context.GetConfig()
+	cfg.InheritDefaultAnnotations(sub.Package)
 
 	err = subArtifact.WriteYAML(spec.GetOutputPath(), artifact.WithRuntimePackage(sub.Package))
 	if err != nil {
@@ -620,7 +755,7 @@ func (cs *LuetCompiler) finalizeImages(a *artifact.PackageArtifact, p *types.Lue
 		if err := a.GenerateFinalImage(cs.Options.Context, imageID, cs.GetBackend(), true); err != nil {
 			return errors.Wrap(err, "while creating final image")
 		}
-		if err := cs.Backend.Push(backend.Options{ImageName: imageID}); err != nil {
+		if err := cs.Backend.Push(backend.Options{ImageName: imageID, Parent: cs.buildCtx}); err != nil {
 			return errors.Wrapf(err, "Could not push image: %s", imageID)
 		}
 	}
@@ -637,7 +772,7 @@ func (cs *LuetCompiler) finalizeImages(a *artifact.PackageArtifact, p *types.Lue
 		if err := metadataArchive.GenerateFinalImage(cs.Options.Context, metadataImageID, cs.Backend, keepPermissions); err != nil {
 			return errors.Wrap(err, "Failed generating metadata tree "+metadataImageID)
 		}
-		if err = cs.Backend.Push(backend.Options{ImageName: metadataImageID}); err != nil {
+		if err = cs.Backend.Push(backend.Options{ImageName: metadataImageID, Parent: cs.buildCtx}); err != nil {
 			return errors.Wrapf(err, "Could not push image: %s", metadataImageID)
 		}
 	}
@@ -753,6 +888,13 @@ func (cs *LuetCompiler) compileWithImage(image, builderHash string, packageTagHa
 	keepPermissions, keepImg bool,
 	p *types.LuetCompilationSpec, generateArtifact bool) (*artifact.PackageArtifact, error) {
 
+	if p.BuildsOnHost() {
+		if !generateArtifact {
+			return &artifact.PackageArtifact{}, nil
+		}
+		return cs.compileOnHost(p, concurrency)
+	}
+
 	// If it is a virtual, check if we have to generate an empty artifact or not.
 	if generateArtifact && p.IsVirtual() {
 		return cs.genArtifact(p, backend.Options{}, backend.Options{}, concurrency, keepPermissions)
@@ -796,10 +938,10 @@ func (cs *LuetCompiler) compileWithImage(image, builderHash string, packageTagHa
 		switch {
 		case remoteImageAvailable:
 			cs.Options.Context.Debug("Images available remotely for", p.Package.HumanReadableString(), "generating artifact from remote images:", resolved)
-			return cs.genArtifact(p, backend.Options{ImageName: builderResolved}, backend.Options{ImageName: resolved}, concurrency, keepPermissions)
+			return cs.genArtifact(p, backend.Options{ImageName: builderResolved, Parent: cs.buildCtx}, backend.Options{ImageName: resolved, Parent: cs.buildCtx}, concurrency, keepPermissions)
 		case localImageAvailable:
 			cs.Options.Context.Debug("Images locally available for", p.Package.HumanReadableString(), "generating artifact from image:", resolved)
-			return cs.genArtifact(p, backend.Options{ImageName: remoteBuildertaggedImage}, backend.Options{ImageName: packageImage}, concurrency, keepPermissions)
+			return cs.genArtifact(p, backend.Options{ImageName: remoteBuildertaggedImage, Parent: cs.buildCtx}, backend.Options{ImageName: packageImage, Parent: cs.buildCtx}, concurrency, keepPermissions)
 		default:
 			cs.Options.Context.Debug("Images not available for", p.Package.HumanReadableString())
 		}
@@ -857,7 +999,10 @@ func (cs *LuetCompiler) FromDatabase(db types.PackageDatabase, minimum bool, dst
 }
 
 func (cs *LuetCompiler) ComputeDepTree(p *types.LuetCompilationSpec, db types.PackageDatabase) (types.PackagesAssertions, error) {
-	s := solver.NewResolver(cs.Options.SolverOptions.SolverOptions, pkg.NewInMemoryDatabase(false), db, pkg.NewInMemoryDatabase(false), solver.NewSolverFromOptions(cs.Options.SolverOptions))
+	opts := cs.Options.SolverOptions.SolverOptions
+	opts.BacktrackLimit = cs.Options.SolverOptions.BacktrackLimit
+	opts.ExpandConstraints = cs.Options.Context.GetConfig().SolverConstraintExpansion
+	s := solver.NewResolver(opts, pkg.NewInMemoryDatabase(false), db, pkg.NewInMemoryDatabase(false), solver.NewSolverFromOptions(cs.Options.SolverOptions))
 
 	solution, err := s.Install(types.Packages{p.GetPackage()})
 	if err != nil {
@@ -1283,7 +1428,7 @@ func (cs *LuetCompiler) compile(concurrency int, keepPermissions bool, generateF
 			localGenerateArtifact = *generateFinalArtifact
 		}
 
-		a, err := cs.compileWithImage(p.GetImage(), packageHashTree.BuilderImageHash, targetAssertion.Hash.PackageHash, concurrency, keepPermissions, cs.Options.KeepImg, p, localGenerateArtifact)
+		a, err := cs.compileWithTimeout(p.GetImage(), packageHashTree.BuilderImageHash, targetAssertion.Hash.PackageHash, concurrency, keepPermissions, cs.Options.KeepImg, p, localGenerateArtifact)
 		if err != nil {
 			return nil, errors.Wrap(err, "building direct image")
 		}
@@ -1369,7 +1514,7 @@ func (cs *LuetCompiler) compile(concurrency int, keepPermissions bool, generateF
 				cs.Options.Context.Debug(pkgTag, " :wrench: Compiling "+compileSpec.GetPackage().HumanReadableString()+" from tree")
 			}
 
-			a, err := cs.compileWithImage(
+			a, err := cs.compileWithTimeout(
 				sourceImage,
 				buildHash,
 				assertion.Hash.PackageHash,
@@ -1407,7 +1552,7 @@ func (cs *LuetCompiler) compile(concurrency int, keepPermissions bool, generateF
 		resolvedSourceImage := cs.resolveExistingImageHash(packageHashTree.SourceHash, p)
 		cs.Options.Context.Info(":rocket: All dependencies are satisfied, building package requested by the user", p.GetPackage().HumanReadableString())
 		cs.Options.Context.Info(":package:", p.GetPackage().HumanReadableString(), " Using image: ", resolvedSourceImage)
-		a, err := cs.compileWithImage(resolvedSourceImage, packageHashTree.BuilderImageHash, targetAssertion.Hash.PackageHash, concurrency, keepPermissions, cs.Options.KeepImg, p, localGenerateArtifact)
+		a, err := cs.compileWithTimeout(resolvedSourceImage, packageHashTree.BuilderImageHash, targetAssertion.Hash.PackageHash, concurrency, keepPermissions, cs.Options.KeepImg, p, localGenerateArtifact)
 		if err != nil {
 			return a, err
 		}
@@ -1592,7 +1737,14 @@ func (cs *LuetCompiler) FromPackage(p *types.Package) (*types.LuetCompilationSpe
 	}
 	newSpec.BuildOptions = &opts
 
+	if cs.variant != nil && cs.variant.Package == pack.GetPackageName() {
+		newSpec.Env = append(newSpec.Env, cs.variant.Env()...)
+	}
+	cfg := cs.Options.Context.GetConfig()
+	newSpec.Env = append(newSpec.Env, cfg.CrossCompile.Env()...)
+
 	cs.inheritSpecBuildOptions(newSpec)
+	cs.inheritBuildImage(newSpec)
 
 	// Update the package in the compiler database to catch updates from NewLuetCompilationSpec
 	if err := cs.Database.UpdatePackage(newSpec.Package); err != nil {
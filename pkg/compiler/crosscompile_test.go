@@ -0,0 +1,79 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	. "github.com/mudler/luet/pkg/compiler"
+	"github.com/mudler/luet/pkg/compiler/backend"
+	pkg "github.com/mudler/luet/pkg/database"
+	"github.com/mudler/luet/pkg/tree"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+// recordingBackend fails the builds after recording their options
+// and the dockerfiles of their build context
+type recordingBackend struct {
+	hangingBackend
+	opts        *backend.Options
+	dockerfiles *[]string
+}
+
+func (r recordingBackend) BuildImage(opts backend.Options) error {
+	*r.opts = opts
+	files, err := filepath.Glob(filepath.Join(opts.SourcePath, "*.dockerfile"))
+	Expect(err).ToNot(HaveOccurred())
+	for _, f := range files {
+		dat, err := ioutil.ReadFile(f)
+		Expect(err).ToNot(HaveOccurred())
+		*r.dockerfiles = append(*r.dockerfiles, string(dat))
+	}
+	return errors.New("recorded")
+}
+
+var _ = Describe("Cross compile", func() {
+	It("builds with the cross compilation environment and sysroot", func() {
+		generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+		Expect(generalRecipe.Load("../../tests/fixtures/buildtree")).To(Succeed())
+
+		ctx := context.NewContext()
+		ctx.Config.CrossCompile = types.LuetCrossCompile{HostArch: "x86_64", TargetArch: "aarch64", SysrootPath: "/opt/sysroot"}
+
+		opts := &backend.Options{}
+		dockerfiles := &[]string{}
+		c := NewLuetCompiler(recordingBackend{opts: opts, dockerfiles: dockerfiles}, generalRecipe.GetDatabase(), WithContext(ctx))
+
+		spec, err := c.FromPackage(&types.Package{Name: "enman", Category: "app-admin", Version: "1.4.0"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(spec.Env).To(ContainElements("CROSSCOMPILE=1", "HOST=x86_64-linux-gnu", "TARGET=aarch64-linux-gnu"))
+
+		spec.SetOutputPath(GinkgoT().TempDir())
+		_, err = c.Compile(false, spec)
+		Expect(err).To(HaveOccurred())
+
+		Expect(opts.BuildContexts).To(Equal(map[string]string{"sysroot": "/opt/sysroot"}))
+		Expect(*dockerfiles).To(ContainElement(And(
+			ContainSubstring("\nENV TARGET=aarch64-linux-gnu"),
+			ContainSubstring("\nRUN --mount=type=bind,from=sysroot,target=/sysroot "),
+		)))
+	})
+})
@@ -0,0 +1,117 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	artifact "github.com/mudler/luet/pkg/api/core/types/artifact"
+	"github.com/mudler/luet/pkg/compiler/backend"
+	fileHelper "github.com/mudler/luet/pkg/helpers/file"
+	"github.com/pkg/errors"
+)
+
+// inheritBuildImage sets build_container_image as the image of the
+// specs which have steps but no image source
+func (cs *LuetCompiler) inheritBuildImage(p *types.LuetCompilationSpec) {
+	img := cs.Options.Context.GetConfig().General.BuildContainerImage
+	if img == "" || p.HasImageSource() || p.EmptyPackage() {
+		return
+	}
+	cs.Options.Context.Debug(p.GetPackage().HumanReadableString(), "Using the default build image", img)
+	p.SetImage(img)
+}
+
+// compileOnHost runs the prelude and the steps of the package on the host,
+// from a copy of the package directory. The artifact is the content of
+// the DESTDIR of the steps.
+func (cs *LuetCompiler) compileOnHost(p *types.LuetCompilationSpec, concurrency int) (*artifact.PackageArtifact, error) {
+	pkgTag := ":package: " + p.GetPackage().HumanReadableString()
+	if cs.Options.Context.GetConfig().BuildSandbox.Enabled() {
+		return nil, errors.Errorf("%s can't be built on the host with the build sandbox enabled", p.GetPackage().HumanReadableString())
+	}
+	cs.Options.Context.Info(pkgTag, ":computer: Building on the host")
+
+	buildDir, err := cs.Options.Context.TempDir("hostbuild")
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not create tempdir")
+	}
+	defer os.RemoveAll(buildDir)
+
+	workDir := filepath.Join(buildDir, "luetbuild")
+	destDir := filepath.Join(buildDir, "rootfs")
+	if err := fileHelper.CopyDir(p.GetPackage().GetPath(), workDir); err != nil {
+		return nil, errors.Wrap(err, "while copying the package directory")
+	}
+	if err := os.MkdirAll(destDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	env := append(os.Environ(),
+		"PACKAGE_NAME="+p.GetPackage().GetName(),
+		"PACKAGE_VERSION="+p.GetPackage().GetVersion(),
+		"PACKAGE_CATEGORY="+p.GetPackage().GetCategory(),
+		"DESTDIR="+destDir,
+	)
+	env = append(env, p.Env...)
+
+	for _, step := range append(p.GetPreBuildSteps(), p.BuildSteps()...) {
+		if err := cs.runHostStep(step, workDir, env); err != nil {
+			return nil, errors.Wrapf(err, "while running '%s'", step)
+		}
+	}
+
+	a := artifact.NewPackageArtifact(p.Rel(p.GetPackage().GetFingerPrint() + ".package.tar"))
+	a.CompressionType = cs.Options.CompressionType
+	if err := a.Compress(destDir, concurrency); err != nil {
+		return nil, errors.Wrap(err, "Error met while creating package archive")
+	}
+
+	a.CompileSpec = p
+	a.CompileSpec.GetPackage().SetBuildTimestamp(time.Now().String())
+	runtime, err := cs.annotatedRuntime(a.CompileSpec.GetPackage())
+	if err != nil {
+		return a, err
+	}
+	if err := a.WriteYAML(p.GetOutputPath(), artifact.WithRuntimePackage(runtime)); err != nil {
+		return a, errors.Wrap(err, "Failed while writing metadata file")
+	}
+	cs.Options.Context.Success(pkgTag, "   :white_check_mark: done (host build)")
+	return a, nil
+}
+
+func (cs *LuetCompiler) runHostStep(step, dir string, env []string) error {
+	var cmd *exec.Cmd
+	if cs.buildCtx != nil {
+		cmd = exec.CommandContext(cs.buildCtx, "sh", "-c", step)
+	} else {
+		cmd = exec.Command("sh", "-c", step)
+	}
+	cmd.Dir = dir
+	cmd.Env = env
+
+	writer := backend.NewBackendWriter(!cs.Options.Context.GetConfig().General.ShowBuildOutput, cs.Options.Context)
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "Failed running command: %s", writer.GetCombinedOutput())
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	. "github.com/mudler/luet/pkg/compiler"
+	"github.com/mudler/luet/pkg/compiler/backend"
+	pkg "github.com/mudler/luet/pkg/database"
+	"github.com/mudler/luet/pkg/tree"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Source integrity", func() {
+	It("aborts the build when a source archive is corrupted", func() {
+		generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+		Expect(generalRecipe.Load("../../tests/fixtures/buildtree")).To(Succeed())
+
+		ctx := context.NewContext()
+		ctx.Config.PackageSourceIntegrity = types.LuetSourceIntegrity{Enabled: true}
+
+		opts := &backend.Options{}
+		dockerfiles := &[]string{}
+		c := NewLuetCompiler(recordingBackend{opts: opts, dockerfiles: dockerfiles}, generalRecipe.GetDatabase(), WithContext(ctx))
+
+		spec, err := c.FromPackage(&types.Package{Name: "enman", Category: "app-admin", Version: "1.4.0"})
+		Expect(err).ToNot(HaveOccurred())
+
+		sum := sha256.Sum256([]byte("source"))
+		spec.SetOutputPath(GinkgoT().TempDir())
+		spec.Retrieve = []string{"enman-1.4.0.tar.gz"}
+		spec.Env = append(spec.Env, "SRC_URI_HASH="+hex.EncodeToString(sum[:]))
+		Expect(ioutil.WriteFile(filepath.Join(spec.GetOutputPath(), "enman-1.4.0.tar.gz"), []byte("corrupted"), 0644)).To(Succeed())
+
+		_, err = c.Compile(false, spec)
+		Expect(errors.Is(err, types.ErrSourceIntegrity)).To(BeTrue())
+		Expect(*dockerfiles).To(BeEmpty())
+
+		// The build starts once the archive matches
+		Expect(ioutil.WriteFile(filepath.Join(spec.GetOutputPath(), "enman-1.4.0.tar.gz"), []byte("source"), 0644)).To(Succeed())
+		_, err = c.Compile(false, spec)
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, types.ErrSourceIntegrity)).To(BeFalse())
+		Expect(*dockerfiles).ToNot(BeEmpty())
+	})
+})
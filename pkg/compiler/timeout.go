@@ -0,0 +1,70 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	artifact "github.com/mudler/luet/pkg/api/core/types/artifact"
+)
+
+// ErrBuildTimeout is returned when the build of Package
+// took longer than the configured build_timeout
+type ErrBuildTimeout struct {
+	Package  string
+	Duration time.Duration
+}
+
+func (e *ErrBuildTimeout) Error() string {
+	return fmt.Sprintf("build of %s timed out after %s", e.Package, e.Duration)
+}
+
+// withBuildContext returns a copy of the compiler whose backend
+// commands are killed once ctx is done
+func (cs *LuetCompiler) withBuildContext(ctx context.Context) *LuetCompiler {
+	c := *cs
+	c.buildCtx = ctx
+	return &c
+}
+
+// compileWithTimeout runs compileWithImage with the build_timeout deadline,
+// which covers the whole build of the package up to its artifact
+func (cs *LuetCompiler) compileWithTimeout(image, builderHash string, packageTagHash string,
+	concurrency int,
+	keepPermissions, keepImg bool,
+	p *types.LuetCompilationSpec, generateArtifact bool) (*artifact.PackageArtifact, error) {
+
+	general := cs.Options.Context.GetConfig().General
+	if general.BuildTimeout <= 0 {
+		return cs.compileWithImage(image, builderHash, packageTagHash, concurrency, keepPermissions, keepImg, p, generateArtifact)
+	}
+
+	ctx, cancel := context.WithTimeout(general.GetParentContext(), general.BuildTimeout)
+	defer cancel()
+
+	a, err := cs.withBuildContext(ctx).compileWithImage(image, builderHash, packageTagHash, concurrency, keepPermissions, keepImg, p, generateArtifact)
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		cs.Options.Context.Error(":alarm_clock: Build of", p.GetPackage().HumanReadableString(), "timed out after", general.BuildTimeout.String())
+		return nil, &ErrBuildTimeout{Package: p.GetPackage().HumanReadableString(), Duration: general.BuildTimeout}
+	}
+	return a, err
+}
@@ -0,0 +1,72 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package compiler_test
+
+import (
+	"os"
+	"time"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	. "github.com/mudler/luet/pkg/compiler"
+	"github.com/mudler/luet/pkg/compiler/backend"
+	pkg "github.com/mudler/luet/pkg/database"
+	"github.com/mudler/luet/pkg/tree"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+// hangingBackend never finishes building until the build is cancelled
+type hangingBackend struct {
+	*backend.SimpleDocker
+}
+
+func (hangingBackend) BuildImage(opts backend.Options) error {
+	<-opts.Parent.Done()
+	return opts.Parent.Err()
+}
+
+func (hangingBackend) DownloadImage(backend.Options) error { return errors.New("not available") }
+func (hangingBackend) RemoveImage(backend.Options) error   { return nil }
+func (hangingBackend) ImageExists(string) bool             { return false }
+func (hangingBackend) ImageAvailable(string) bool          { return false }
+
+var _ = Describe("Build timeout", func() {
+	It("aborts builds running longer than build_timeout", func() {
+		generalRecipe := tree.NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+		Expect(generalRecipe.Load("../../tests/fixtures/buildtree")).To(Succeed())
+
+		ctx := context.NewContext()
+		ctx.Config.General.BuildTimeout = 100 * time.Millisecond
+		c := NewLuetCompiler(hangingBackend{}, generalRecipe.GetDatabase(), WithContext(ctx))
+
+		spec, err := c.FromPackage(&types.Package{Name: "enman", Category: "app-admin", Version: "1.4.0"})
+		Expect(err).ToNot(HaveOccurred())
+		tmpdir, err := os.MkdirTemp("", "timeout")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(tmpdir)
+		spec.SetOutputPath(tmpdir)
+
+		_, err = c.Compile(false, spec)
+		Expect(err).To(HaveOccurred())
+
+		timeout := &ErrBuildTimeout{}
+		Expect(errors.As(err, &timeout)).To(BeTrue())
+		Expect(timeout.Package).To(Equal("app-admin/enman-1.4.0"))
+		Expect(timeout.Duration).To(Equal(100 * time.Millisecond))
+	})
+})
@@ -0,0 +1,170 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"sync/atomic"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pkg/errors"
+)
+
+// CacheStats are the lookups served by the local cache
+type CacheStats struct {
+	Hits, Misses        uint64
+	HitRatio, MissRatio float64
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+type localCache interface {
+	Get(key interface{}) (interface{}, bool)
+	Purge()
+}
+
+// CachedDatabase caches the package lookups of a PackageDatabase,
+// the cache is purged by every write to the packages
+type CachedDatabase struct {
+	types.PackageDatabase
+
+	cache        localCache
+	add          func(key, value interface{})
+	ttl          time.Duration
+	hits, misses uint64
+}
+
+// NewCachedDatabase wraps db with the configured local cache
+func NewCachedDatabase(db types.PackageDatabase, c types.LuetLocalCache) (*CachedDatabase, error) {
+	cdb := &CachedDatabase{PackageDatabase: db, ttl: c.TTL}
+
+	switch c.Type {
+	case types.LocalCacheARC:
+		cache, err := lru.NewARC(c.GetMaxEntries())
+		if err != nil {
+			return nil, err
+		}
+		cdb.cache, cdb.add = cache, cache.Add
+	case types.LocalCacheLRU:
+		cache, err := lru.New(c.GetMaxEntries())
+		if err != nil {
+			return nil, err
+		}
+		cdb.cache, cdb.add = cache, func(k, v interface{}) { cache.Add(k, v) }
+	default:
+		return nil, errors.Errorf("invalid local cache type '%s'", c.Type)
+	}
+	return cdb, nil
+}
+
+// LocalCacheStats returns the hits and misses of the cache
+func (db *CachedDatabase) LocalCacheStats() CacheStats {
+	s := CacheStats{Hits: atomic.LoadUint64(&db.hits), Misses: atomic.LoadUint64(&db.misses)}
+	if total := s.Hits + s.Misses; total > 0 {
+		s.HitRatio = float64(s.Hits) / float64(total)
+		s.MissRatio = float64(s.Misses) / float64(total)
+	}
+	return s
+}
+
+// lookup returns the cached result of key, calling get on misses
+// and expired entries. Errors aren't cached.
+func (db *CachedDatabase) lookup(key string, get func() (interface{}, error)) (interface{}, error) {
+	if v, ok := db.cache.Get(key); ok {
+		e := v.(cacheEntry)
+		if db.ttl == 0 || time.Now().Before(e.expires) {
+			atomic.AddUint64(&db.hits, 1)
+			return e.value, nil
+		}
+	}
+	atomic.AddUint64(&db.misses, 1)
+
+	v, err := get()
+	if err != nil {
+		return nil, err
+	}
+	db.add(key, cacheEntry{value: v, expires: time.Now().Add(db.ttl)})
+	return v, nil
+}
+
+// Packages are cloned so callers can't modify the cached ones
+func clonePackages(packs types.Packages) types.Packages {
+	res := make(types.Packages, len(packs))
+	for i, p := range packs {
+		res[i] = p.Clone()
+	}
+	return res
+}
+
+func (db *CachedDatabase) lookupPackage(key string, get func() (*types.Package, error)) (*types.Package, error) {
+	v, err := db.lookup(key, func() (interface{}, error) { return get() })
+	if err != nil {
+		return nil, err
+	}
+	return v.(*types.Package).Clone(), nil
+}
+
+func (db *CachedDatabase) lookupPackages(key string, get func() (types.Packages, error)) (types.Packages, error) {
+	v, err := db.lookup(key, func() (interface{}, error) { return get() })
+	if err != nil {
+		return nil, err
+	}
+	return clonePackages(v.(types.Packages)), nil
+}
+
+func (db *CachedDatabase) GetPackage(ID string) (*types.Package, error) {
+	return db.lookupPackage("id:"+ID, func() (*types.Package, error) { return db.PackageDatabase.GetPackage(ID) })
+}
+
+func (db *CachedDatabase) FindPackage(p *types.Package) (*types.Package, error) {
+	return db.lookupPackage("find:"+p.GetFingerPrint(), func() (*types.Package, error) { return db.PackageDatabase.FindPackage(p) })
+}
+
+func (db *CachedDatabase) FindPackageCandidate(p *types.Package) (*types.Package, error) {
+	return db.lookupPackage("candidate:"+p.GetFingerPrint(), func() (*types.Package, error) { return db.PackageDatabase.FindPackageCandidate(p) })
+}
+
+func (db *CachedDatabase) FindPackages(p *types.Package) (types.Packages, error) {
+	return db.lookupPackages("packages:"+p.GetFingerPrint(), func() (types.Packages, error) { return db.PackageDatabase.FindPackages(p) })
+}
+
+func (db *CachedDatabase) FindPackageVersions(p *types.Package) (types.Packages, error) {
+	return db.lookupPackages("versions:"+p.GetPackageName(), func() (types.Packages, error) { return db.PackageDatabase.FindPackageVersions(p) })
+}
+
+func (db *CachedDatabase) CreatePackage(p *types.Package) (string, error) {
+	defer db.cache.Purge()
+	return db.PackageDatabase.CreatePackage(p)
+}
+
+func (db *CachedDatabase) UpdatePackage(p *types.Package) error {
+	defer db.cache.Purge()
+	return db.PackageDatabase.UpdatePackage(p)
+}
+
+func (db *CachedDatabase) RemovePackage(p *types.Package) error {
+	defer db.cache.Purge()
+	return db.PackageDatabase.RemovePackage(p)
+}
+
+func (db *CachedDatabase) Clean() error {
+	defer db.cache.Purge()
+	return db.PackageDatabase.Clean()
+}
@@ -0,0 +1,101 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package database_test
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	. "github.com/mudler/luet/pkg/database"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cached Database", func() {
+	var db *CachedDatabase
+	a := types.NewPackage("A", "1.0", []*types.Package{}, []*types.Package{})
+
+	newDB := func(c types.LuetLocalCache) *CachedDatabase {
+		tmpfile, err := ioutil.TempFile(os.TempDir(), "tests")
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(os.Remove, tmpfile.Name())
+
+		cached, err := NewCachedDatabase(NewBoltDatabase(tmpfile.Name()), c)
+		Expect(err).ToNot(HaveOccurred())
+		return cached
+	}
+
+	for _, t := range []string{types.LocalCacheLRU, types.LocalCacheARC} {
+		t := t
+		It("caches the lookups with "+t, func() {
+			db = newDB(types.LuetLocalCache{Type: t, MaxEntries: 10})
+			_, err := db.CreatePackage(a)
+			Expect(err).ToNot(HaveOccurred())
+
+			for i := 0; i < 4; i++ {
+				pack, err := db.FindPackage(a)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(pack.GetFingerPrint()).To(Equal(a.GetFingerPrint()))
+			}
+			stats := db.LocalCacheStats()
+			Expect(stats.Hits).To(Equal(uint64(3)))
+			Expect(stats.Misses).To(Equal(uint64(1)))
+			Expect(stats.HitRatio).To(Equal(0.75))
+			Expect(stats.MissRatio).To(Equal(0.25))
+		})
+	}
+
+	It("is purged on writes", func() {
+		db = newDB(types.LuetLocalCache{Type: types.LocalCacheLRU})
+		_, err := db.CreatePackage(a)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = db.FindPackage(a)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(db.RemovePackage(a)).To(Succeed())
+		_, err = db.FindPackage(a)
+		Expect(err).To(HaveOccurred())
+		Expect(db.LocalCacheStats().Hits).To(BeZero())
+	})
+
+	It("expires the entries after the ttl", func() {
+		db = newDB(types.LuetLocalCache{Type: types.LocalCacheLRU, TTL: 50 * time.Millisecond})
+		_, err := db.CreatePackage(a)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = db.FindPackage(a)
+		Expect(err).ToNot(HaveOccurred())
+		time.Sleep(100 * time.Millisecond)
+		_, err = db.FindPackage(a)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(db.LocalCacheStats().Misses).To(Equal(uint64(2)))
+	})
+
+	It("doesn't share the cached packages", func() {
+		db = newDB(types.LuetLocalCache{Type: types.LocalCacheARC})
+		_, err := db.CreatePackage(a)
+		Expect(err).ToNot(HaveOccurred())
+
+		pack, err := db.FindPackage(a)
+		Expect(err).ToNot(HaveOccurred())
+		pack.Version = "2.0"
+		pack, err = db.FindPackage(a)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pack.GetVersion()).To(Equal("1.0"))
+	})
+})
@@ -46,6 +46,9 @@ import (
 	"github.com/theupdateframework/notary/tuf/data"
 )
 
+// ErrImageVerification is returned when an image content trust verification fails
+var ErrImageVerification = errors.New("failed verifying image")
+
 const (
 	filePrefix         = "file://"
 	fileImageSeparator = ":/"
@@ -142,7 +145,7 @@ func DownloadAndExtractDockerImage(ctx luettypes.Context, image, dest string, au
 	if verify {
 		img, err := verifyImage(image, auth)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed verifying image")
+			return nil, errors.Wrap(ErrImageVerification, err.Error())
 		}
 		image = img
 	}
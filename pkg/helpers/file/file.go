@@ -117,6 +117,26 @@ func ListDir(dir string) ([]string, error) {
 	return content, err
 }
 
+// DiskUsage returns the size in bytes of the file, or of all the regular
+// files in the directory. Missing paths take no space.
+func DiskUsage(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path,
+		func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if info.Mode().IsRegular() {
+				size += info.Size()
+			}
+			return nil
+		})
+	return size, err
+}
+
 // DirectoryIsEmpty Checks wether the directory is empty or not
 func DirectoryIsEmpty(dir string) (bool, error) {
 	f, err := os.Open(dir)
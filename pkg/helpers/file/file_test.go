@@ -29,8 +29,8 @@ import (
 var _ = Describe("Helpers", func() {
 	Context("Exists", func() {
 		It("Detect existing and not-existing files", func() {
-			Expect(fileHelper.Exists("../../tests/fixtures/buildtree/app-admin/enman/1.4.0/build.yaml")).To(BeTrue())
-			Expect(fileHelper.Exists("../../tests/fixtures/buildtree/app-admin/enman/1.4.0/build.yaml.not.exists")).To(BeFalse())
+			Expect(fileHelper.Exists("../../../tests/fixtures/buildtree/app-admin/enman/1.4.0/build.yaml")).To(BeTrue())
+			Expect(fileHelper.Exists("../../../tests/fixtures/buildtree/app-admin/enman/1.4.0/build.yaml.not.exists")).To(BeFalse())
 		})
 	})
 
@@ -51,6 +51,21 @@ var _ = Describe("Helpers", func() {
 		})
 	})
 
+	Context("DiskUsage", func() {
+		It("Sums the size of the files", func() {
+			testDir, err := ioutil.TempDir(os.TempDir(), "test")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(testDir)
+			Expect(os.MkdirAll(filepath.Join(testDir, "sub"), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(testDir, "foo"), make([]byte, 10), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(testDir, "sub", "bar"), make([]byte, 5), 0600)).To(Succeed())
+
+			Expect(fileHelper.DiskUsage(testDir)).To(Equal(int64(15)))
+			Expect(fileHelper.DiskUsage(filepath.Join(testDir, "foo"))).To(Equal(int64(10)))
+			Expect(fileHelper.DiskUsage(filepath.Join(testDir, "missing"))).To(Equal(int64(0)))
+		})
+	})
+
 	Context("Orders dir and files correctly", func() {
 		It("puts files first and folders at end", func() {
 			testDir, err := ioutil.TempDir(os.TempDir(), "test")
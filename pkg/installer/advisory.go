@@ -0,0 +1,63 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+)
+
+// securityWarnings checks the packages against the security advisory feed,
+// warning about the affected ones. Failing to read the feed is not fatal.
+func (l *LuetInstaller) securityWarnings(packs types.Packages) []types.Advisory {
+	cfg := l.Options.Context.GetConfig()
+	advisories, err := cfg.CheckSecurityAdvisories(packs)
+	if err != nil {
+		l.Options.Context.Warning("Failed checking security advisories:", err.Error())
+		return nil
+	}
+
+	sort.Slice(advisories, func(i, j int) bool {
+		if advisories[i].Package != advisories[j].Package {
+			return advisories[i].Package < advisories[j].Package
+		}
+		return advisories[i].ID < advisories[j].ID
+	})
+	for _, a := range advisories {
+		msg := fmt.Sprintf("%s is affected by %s", a.Package, a.ID)
+		if a.Severity != "" {
+			msg += " (" + a.Severity + ")"
+		}
+		if a.Summary != "" {
+			msg += ": " + a.Summary
+		}
+		if a.Fixed != "" {
+			msg += ", fixed in " + a.Fixed
+		}
+		l.Options.Context.Warning(msg)
+	}
+	return advisories
+}
+
+func matchedPackages(matches map[string]ArtifactMatch) types.Packages {
+	packs := types.Packages{}
+	for _, m := range matches {
+		packs = append(packs, m.Package)
+	}
+	return packs
+}
@@ -0,0 +1,148 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pkg/errors"
+)
+
+// UpdateAlternative points the links of the alternative name to the
+// targets registered by the installed package matching the provider
+// pattern. Existing links are replaced, other files are never overwritten.
+func (s *System) UpdateAlternative(name, provider string) error {
+	world := s.Database.World()
+	sort.Slice(world, func(i, j int) bool { return world[i].HumanReadableString() < world[j].HumanReadableString() })
+
+	alternatives := []types.Alternative{}
+	for _, p := range world {
+		match, err := types.MatchPackagePattern(provider, p)
+		if err != nil {
+			return err
+		}
+		if !match {
+			continue
+		}
+		for _, a := range p.GetAlternatives() {
+			if a.Name == name {
+				alternatives = append(alternatives, a)
+			}
+		}
+		if len(alternatives) > 0 {
+			break
+		}
+	}
+	if len(alternatives) == 0 {
+		return fmt.Errorf("no installed package matching '%s' provides the alternative '%s'", provider, name)
+	}
+
+	for _, a := range alternatives {
+		link := filepath.Join(s.Target, a.Link)
+		if fi, err := os.Lstat(link); err == nil {
+			if fi.Mode()&os.ModeSymlink == 0 {
+				return fmt.Errorf("'%s' of the alternative '%s' exists and is not a link", a.Link, name)
+			}
+			if err := os.Remove(link); err != nil {
+				return errors.Wrapf(err, "while removing '%s'", a.Link)
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(link), os.ModePerm); err != nil {
+			return err
+		}
+		if err := os.Symlink(a.Target, link); err != nil {
+			return errors.Wrapf(err, "while linking '%s' to '%s'", a.Link, a.Target)
+		}
+	}
+	return nil
+}
+
+// updateAlternatives selects the alternatives registered by the installed
+// packages, unless the alternatives config prefers another provider.
+// Alternatives of the removed packages which are not provided anymore
+// by the installed ones fall back to another installed provider,
+// or their link is dropped.
+func (l *LuetInstaller) updateAlternatives(toInstall map[string]ArtifactMatch, removed types.Packages, s *System) error {
+	cfg := l.Options.Context.GetConfig()
+
+	packs := matchedPackages(toInstall)
+	sort.Slice(packs, func(i, j int) bool { return packs[i].GetFingerPrint() < packs[j].GetFingerPrint() })
+
+	updated := map[string]bool{}
+	for _, p := range packs {
+		if _, err := s.Database.FindPackage(p); err != nil {
+			// Not installed, e.g. declined by the user
+			continue
+		}
+		for _, a := range p.GetAlternatives() {
+			if updated[a.Name] || !cfg.IsPreferredAlternative(a.Name, p) {
+				continue
+			}
+			updated[a.Name] = true
+			if err := s.UpdateAlternative(a.Name, alternativeProvider(p)); err != nil {
+				return errors.Wrapf(err, "while updating the alternative '%s'", a.Name)
+			}
+			l.Options.Context.Info(fmt.Sprintf("Alternative %s provided by %s", a.Name, p.HumanReadableString()))
+		}
+	}
+
+	for _, r := range removed {
+		for _, a := range r.GetAlternatives() {
+			if updated[a.Name] {
+				continue
+			}
+			updated[a.Name] = true
+			if err := l.reselectAlternative(a, s); err != nil {
+				return errors.Wrapf(err, "while updating the alternative '%s'", a.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// reselectAlternative links the alternative to the first preferred installed
+// provider, or removes its link if it points to a target that is gone
+func (l *LuetInstaller) reselectAlternative(a types.Alternative, s *System) error {
+	cfg := l.Options.Context.GetConfig()
+
+	world := s.Database.World()
+	sort.Slice(world, func(i, j int) bool { return world[i].HumanReadableString() < world[j].HumanReadableString() })
+	for _, p := range world {
+		for _, pa := range p.GetAlternatives() {
+			if pa.Name != a.Name || !cfg.IsPreferredAlternative(a.Name, p) {
+				continue
+			}
+			l.Options.Context.Info(fmt.Sprintf("Alternative %s provided by %s", a.Name, p.HumanReadableString()))
+			return s.UpdateAlternative(a.Name, alternativeProvider(p))
+		}
+	}
+
+	link := filepath.Join(s.Target, a.Link)
+	target, err := os.Readlink(link)
+	if err != nil || target != a.Target {
+		return nil
+	}
+	l.Options.Context.Info(fmt.Sprintf("Alternative %s has no providers left, removing %s", a.Name, a.Link))
+	return os.Remove(link)
+}
+
+func alternativeProvider(p *types.Package) string {
+	return fmt.Sprintf("%s/%s@%s", p.GetCategory(), p.GetName(), p.GetVersion())
+}
@@ -0,0 +1,111 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Alternatives", func() {
+	var dir string
+	var system *System
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "alternatives")
+		Expect(err).ToNot(HaveOccurred())
+		system = &System{Database: pkg.NewInMemoryDatabase(false), Target: dir}
+
+		for _, v := range []string{"3.9", "3.10"} {
+			p := &types.Package{Category: "lang", Name: "python", Version: v}
+			p.AddAnnotation(string(types.AlternativesAnnotation), "python3:/usr/bin/python3:/usr/bin/python"+v)
+			_, err := system.Database.CreatePackage(p)
+			Expect(err).ToNot(HaveOccurred())
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("links the alternative to the provider", func() {
+		link := filepath.Join(dir, "usr", "bin", "python3")
+
+		Expect(system.UpdateAlternative("python3", "lang/python@3.9")).To(Succeed())
+		Expect(os.Readlink(link)).To(Equal("/usr/bin/python3.9"))
+
+		Expect(system.UpdateAlternative("python3", "lang/python@3.10")).To(Succeed())
+		Expect(os.Readlink(link)).To(Equal("/usr/bin/python3.10"))
+	})
+
+	It("fails without providers", func() {
+		Expect(system.UpdateAlternative("python3", "lang/pypy")).ToNot(Succeed())
+		Expect(system.UpdateAlternative("perl", "lang/python")).ToNot(Succeed())
+	})
+
+	It("doesn't overwrite files", func() {
+		Expect(os.MkdirAll(filepath.Join(dir, "usr", "bin"), os.ModePerm)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "usr", "bin", "python3"), []byte("foo"), 0600)).To(Succeed())
+		Expect(system.UpdateAlternative("python3", "lang/python@3.9")).ToNot(Succeed())
+	})
+
+	It("falls back to the remaining providers when swapping a provider out", func() {
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		packs := writeArtifacts(dir, 2)
+
+		repo, err := GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		inst := NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 1, Context: ctx,
+			PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+		})
+
+		link := filepath.Join(dir, "usr", "bin", "python3")
+		Expect(system.UpdateAlternative("python3", "lang/python@3.10")).To(Succeed())
+
+		Expect(inst.Swap(types.Packages{{Category: "lang", Name: "python", Version: "3.10"}}, packs[:1], system)).To(Succeed())
+		Expect(os.Readlink(link)).To(Equal("/usr/bin/python3.9"))
+
+		Expect(inst.Swap(types.Packages{{Category: "lang", Name: "python", Version: "3.9"}}, packs[1:], system)).To(Succeed())
+		_, err = os.Lstat(link)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+})
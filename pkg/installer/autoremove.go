@@ -0,0 +1,174 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pkg/errors"
+)
+
+// isDependency returns true if p was installed as a dependency
+func isDependency(p *types.Package) bool {
+	return p.Annotations[types.DependencyAnnotation] == "true"
+}
+
+// asDependency returns a copy of p marked as installed as a dependency
+func asDependency(p *types.Package) *types.Package {
+	dep := p.Clone()
+	dep.Annotations = map[types.PackageAnnotation]string{}
+	for k, v := range p.Annotations {
+		dep.Annotations[k] = v
+	}
+	dep.Annotations[types.DependencyAnnotation] = "true"
+	return dep
+}
+
+// markDependency marks the installed p as installed as a dependency
+func markDependency(s *System, p *types.Package) error {
+	installed, err := s.Database.FindPackage(p)
+	if err != nil {
+		return err
+	}
+	if err := s.Database.UpdatePackage(asDependency(installed)); err != nil {
+		return errors.Wrapf(err, "failed marking %s as dependency", p.HumanReadableString())
+	}
+	return nil
+}
+
+// markRequested clears the dependency mark of the installed versions of
+// the requested packages, so they are not removed as orphans anymore.
+// It runs once the install succeeded, nothing is marked in dry run.
+func (l *LuetInstaller) markRequested(s *System, requested types.Packages) error {
+	if l.dryRun() {
+		return nil
+	}
+	for _, r := range requested {
+		vers, _ := s.Database.FindPackageVersions(r)
+		for _, v := range vers {
+			if !isDependency(v) {
+				continue
+			}
+			delete(v.Annotations, types.DependencyAnnotation)
+			if err := s.Database.UpdatePackage(v); err != nil {
+				return errors.Wrapf(err, "failed marking %s as requested", v.HumanReadableString())
+			}
+		}
+	}
+	return nil
+}
+
+// requires returns true if one of the requirements of p is c,
+// or a virtual package c provides
+func requires(p, c *types.Package) bool {
+	for _, r := range p.GetRequires() {
+		if r.AtomMatches(c) {
+			return true
+		}
+		for _, provided := range c.GetProvides() {
+			if r.AtomMatches(provided) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// orphans returns the installed packages which were pulled in as
+// dependencies of the removed ones and that no other installed
+// package requires anymore
+func orphans(installed, removed types.Packages) types.Packages {
+	candidates := types.Packages{}
+	for _, c := range installed {
+		if !isDependency(c) {
+			continue
+		}
+		for _, p := range removed {
+			if requires(p, c) {
+				candidates = append(candidates, c)
+			}
+		}
+	}
+
+	res := types.Packages{}
+CANDIDATES:
+	for _, c := range candidates.Unique() {
+		for _, p := range installed {
+			if !p.Matches(c) && requires(p, c) {
+				continue CANDIDATES
+			}
+		}
+		res = append(res, c)
+	}
+	return res
+}
+
+// autoRemove removes recursively the dependencies of the removed packages
+// that are not needed anymore, if enabled in the config
+func (l *LuetInstaller) autoRemove(s *System, removed types.Packages) error {
+	if !l.Options.Context.GetConfig().PackageAutoRemove {
+		return nil
+	}
+
+	toRemove := orphans(s.Database.World(), removed)
+	if len(toRemove) == 0 {
+		return nil
+	}
+
+	l.Options.Context.Info(":recycle: Removing dependencies not required anymore:", packsToList(toRemove))
+	o := Option{
+		Force:          l.Options.Force,
+		CheckConflicts: l.Options.CheckConflicts,
+	}
+	toUninstall, uninstall, err := l.generateUninstallFn(o, s, map[string]interface{}{}, toRemove...)
+	if err != nil {
+		return errors.Wrap(err, "while computing orphans uninstall")
+	}
+	if err := uninstall(); err != nil {
+		return errors.Wrap(err, "while removing orphans")
+	}
+	return l.autoRemove(s, toUninstall)
+}
+
+// plannedOrphans returns the dependencies autoRemove would remove
+// along with the removed packages, without changing the system
+func (l *LuetInstaller) plannedOrphans(s *System, removed types.Packages) types.Packages {
+	if !l.Options.Context.GetConfig().PackageAutoRemove {
+		return nil
+	}
+
+	installed := withoutPackages(s.Database.World(), removed)
+	res := types.Packages{}
+	for toRemove := orphans(installed, removed); len(toRemove) > 0; toRemove = orphans(installed, toRemove) {
+		res = append(res, toRemove...)
+		installed = withoutPackages(installed, toRemove)
+	}
+	return res
+}
+
+// withoutPackages returns the packages not matching any of the excluded ones
+func withoutPackages(packs, excluded types.Packages) types.Packages {
+	res := types.Packages{}
+PACKAGES:
+	for _, p := range packs {
+		for _, e := range excluded {
+			if p.Matches(e) {
+				continue PACKAGES
+			}
+		}
+		res = append(res, p)
+	}
+	return res
+}
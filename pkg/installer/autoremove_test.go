@@ -0,0 +1,280 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	artifact "github.com/mudler/luet/pkg/api/core/types/artifact"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Auto remove", func() {
+	It("removes dependencies not required anymore", func() {
+		fakeroot, err := ioutil.TempDir("", "autoremove")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(fakeroot)
+
+		C := types.NewPackage("C", "1.0", []*types.Package{}, []*types.Package{})
+		C.Category = "test"
+		B := types.NewPackage("B", "1.0", []*types.Package{C}, []*types.Package{})
+		B.Category = "test"
+		A := types.NewPackage("A", "1.0", []*types.Package{B}, []*types.Package{})
+		A.Category = "test"
+		D := types.NewPackage("D", "1.0", []*types.Package{C}, []*types.Package{})
+		D.Category = "test"
+
+		// Only B and C were pulled in as dependencies
+		B.AddAnnotation(string(types.DependencyAnnotation), "true")
+		C.AddAnnotation(string(types.DependencyAnnotation), "true")
+
+		system := &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+		for _, p := range []*types.Package{A, B, C, D} {
+			_, err := system.Database.CreatePackage(p)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(system.Database.SetPackageFiles(&types.PackageFile{PackageFingerprint: p.GetFingerPrint()})).ToNot(HaveOccurred())
+		}
+
+		ctx := context.NewContext()
+		ctx.Config.PackageAutoRemove = true
+		inst := NewLuetInstaller(LuetInstallerOptions{Concurrency: 1, CheckConflicts: true, Context: ctx})
+		Expect(inst.Uninstall(system, A)).ToNot(HaveOccurred())
+
+		Expect(len(system.Database.World())).To(Equal(2))
+		_, err = system.Database.FindPackage(B)
+		Expect(err).To(HaveOccurred())
+		_, err = system.Database.FindPackage(C)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(inst.Uninstall(system, D)).ToNot(HaveOccurred())
+		Expect(system.Database.World()).To(BeEmpty())
+	})
+
+	It("keeps the dependency mark if the install fails", func() {
+		dir, err := ioutil.TempDir("", "autoremove")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		packs := writeArtifacts(dir, 2)
+
+		repo, err := GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+		system := &System{Database: pkg.NewInMemoryDatabase(false), Target: filepath.Join(dir, "root")}
+		dep := packs[0].Clone()
+		dep.AddAnnotation(string(types.DependencyAnnotation), "true")
+		_, err = system.Database.CreatePackage(dep)
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		Expect(ctx.Config.SetPackageBlacklist([]string{"test/p1"})).To(Succeed())
+		inst := NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 1, Context: ctx,
+			PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+		})
+		Expect(inst.Install(packs, system)).To(HaveOccurred())
+
+		installed, err := system.Database.FindPackage(packs[0])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(installed.Annotations[types.DependencyAnnotation]).To(Equal("true"))
+	})
+
+	It("resolves the virtual packages provided by the dependencies", func() {
+		fakeroot, err := ioutil.TempDir("", "autoremove")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(fakeroot)
+
+		V := &types.Package{Category: "virtual", Name: "V", Version: ">=0"}
+		P := types.NewPackage("P", "1.0", []*types.Package{}, []*types.Package{})
+		P.Category = "test"
+		P.SetProvides([]*types.Package{V})
+		A := types.NewPackage("A", "1.0", []*types.Package{V}, []*types.Package{})
+		A.Category = "test"
+		D := types.NewPackage("D", "1.0", []*types.Package{V}, []*types.Package{})
+		D.Category = "test"
+
+		// P was pulled in as the provider of V
+		P.AddAnnotation(string(types.DependencyAnnotation), "true")
+
+		system := &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+		for _, p := range []*types.Package{A, D, P} {
+			_, err := system.Database.CreatePackage(p)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(system.Database.SetPackageFiles(&types.PackageFile{PackageFingerprint: p.GetFingerPrint()})).ToNot(HaveOccurred())
+		}
+
+		ctx := context.NewContext()
+		ctx.Config.PackageAutoRemove = true
+		inst := NewLuetInstaller(LuetInstallerOptions{Concurrency: 1, CheckConflicts: true, Context: ctx})
+
+		// D still requires V
+		Expect(inst.Uninstall(system, A)).ToNot(HaveOccurred())
+		_, err = system.Database.FindPackage(P)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(inst.Uninstall(system, D)).ToNot(HaveOccurred())
+		Expect(system.Database.World()).To(BeEmpty())
+	})
+
+	It("lists the dependencies not required anymore in dry run", func() {
+		fakeroot, err := ioutil.TempDir("", "autoremove")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(fakeroot)
+
+		C := types.NewPackage("C", "1.0", []*types.Package{}, []*types.Package{})
+		C.Category = "test"
+		B := types.NewPackage("B", "1.0", []*types.Package{C}, []*types.Package{})
+		B.Category = "test"
+		A := types.NewPackage("A", "1.0", []*types.Package{B}, []*types.Package{})
+		A.Category = "test"
+		B.AddAnnotation(string(types.DependencyAnnotation), "true")
+		C.AddAnnotation(string(types.DependencyAnnotation), "true")
+
+		system := &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+		for _, p := range []*types.Package{A, B, C} {
+			_, err := system.Database.CreatePackage(p)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(system.Database.SetPackageFiles(&types.PackageFile{PackageFingerprint: p.GetFingerPrint()})).ToNot(HaveOccurred())
+		}
+
+		ctx := context.NewContext()
+		ctx.Config.PackageAutoRemove = true
+		ctx.Config.General.DryRun = true
+		inst := NewLuetInstaller(LuetInstallerOptions{Concurrency: 1, CheckConflicts: true, Context: ctx})
+		Expect(inst.Uninstall(system, A)).ToNot(HaveOccurred())
+
+		Expect(system.Database.World()).To(HaveLen(3))
+		Expect(inst.DryRunPlan.Actions).To(ConsistOf(
+			DryRunAction{Type: DryRunRemove, Target: A.HumanReadableString(), Reason: "uninstall"},
+			DryRunAction{Type: DryRunRemove, Target: B.HumanReadableString(), Reason: "not required anymore"},
+			DryRunAction{Type: DryRunRemove, Target: C.HumanReadableString(), Reason: "not required anymore"},
+		))
+	})
+
+	Context("Installed packages", func() {
+		var dir string
+		var inst *LuetInstaller
+		var system *System
+		a := &types.Package{Category: "test", Name: "a", Version: "1.0"}
+		b := &types.Package{Category: "test", Name: "b", Version: "1.0"}
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "autoremove")
+			Expect(err).ToNot(HaveOccurred())
+
+			repodir := filepath.Join(dir, "repo")
+			for _, f := range [][2]string{
+				{"a", "requires:\n- category: test\n  name: b\n  version: \">=0\"\n"},
+				{"b", ""},
+			} {
+				p := &types.Package{Category: "test", Name: f[0], Version: "1.0"}
+				p.Path = filepath.Join(dir, "tree", p.Name)
+				Expect(os.MkdirAll(p.Path, os.ModePerm)).ToNot(HaveOccurred())
+				Expect(ioutil.WriteFile(filepath.Join(p.Path, types.PackageDefinitionFile),
+					[]byte("category: test\nname: "+p.Name+"\nversion: \"1.0\"\n"+f[1]), 0600)).ToNot(HaveOccurred())
+
+				src := filepath.Join(dir, "src", p.Name)
+				Expect(os.MkdirAll(src, os.ModePerm)).ToNot(HaveOccurred())
+				Expect(ioutil.WriteFile(filepath.Join(src, p.Name), []byte(p.Name), 0600)).ToNot(HaveOccurred())
+
+				Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+				art := artifact.NewPackageArtifact(filepath.Join(repodir, p.GetFingerPrint()+".package.tar"))
+				Expect(art.Compress(src, 1)).ToNot(HaveOccurred())
+				art.CompileSpec = &types.LuetCompilationSpec{Package: p}
+				Expect(art.WriteYAML(repodir)).ToNot(HaveOccurred())
+			}
+
+			repo, err := GenerateRepository(
+				WithName("test"),
+				WithType("disk"),
+				WithUrls(repodir),
+				WithPriority(1),
+				WithSource(repodir),
+				WithTree(filepath.Join(dir, "tree")),
+				WithContext(context.NewContext()),
+				WithDatabase(pkg.NewInMemoryDatabase(false)),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+			ctx := context.NewContext()
+			ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+			ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+			ctx.Config.PackageAutoRemove = true
+			inst = NewLuetInstaller(LuetInstallerOptions{
+				Concurrency: 1, Context: ctx, CheckConflicts: true,
+				PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+			})
+
+			fakeroot := filepath.Join(dir, "root")
+			Expect(os.MkdirAll(fakeroot, os.ModePerm)).ToNot(HaveOccurred())
+			system = &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("removes the dependencies pulled in by the install", func() {
+			Expect(inst.Install(types.Packages{a}, system)).ToNot(HaveOccurred())
+			Expect(system.Database.World()).To(HaveLen(2))
+
+			Expect(inst.Uninstall(system, a)).ToNot(HaveOccurred())
+			Expect(system.Database.World()).To(BeEmpty())
+		})
+
+		It("keeps the packages installed explicitly", func() {
+			Expect(inst.Install(types.Packages{a, b}, system)).ToNot(HaveOccurred())
+
+			Expect(inst.Uninstall(system, a)).ToNot(HaveOccurred())
+			Expect(system.Database.World()).To(HaveLen(1))
+			_, err := system.Database.FindPackage(b)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("keeps dependencies requested explicitly afterwards", func() {
+			Expect(inst.Install(types.Packages{a}, system)).ToNot(HaveOccurred())
+			Expect(inst.Install(types.Packages{b}, system)).ToNot(HaveOccurred())
+
+			Expect(inst.Uninstall(system, a)).ToNot(HaveOccurred())
+			_, err := system.Database.FindPackage(b)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+})
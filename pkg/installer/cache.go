@@ -0,0 +1,100 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/mudler/luet/pkg/api/core/types/artifact"
+	"github.com/pkg/errors"
+)
+
+// CacheRepository syncs the named system repository and downloads all its
+// artifacts in the packages cache. Artifacts already in cache are skipped.
+// It returns the number of artifacts newly cached.
+func CacheRepository(ctx context.Context, c types.Context, name string, concurrency int) (int, error) {
+	cfg := c.GetConfig()
+	repo, err := cfg.GetSystemRepository(name)
+	if err != nil {
+		return 0, err
+	}
+
+	synced, err := NewSystemRepository(*repo).Sync(c, false)
+	if err != nil {
+		return 0, errors.Wrapf(err, "while syncing repository %s", name)
+	}
+
+	cache := artifact.NewCache(cfg.System.PkgsCachePath)
+	toCache := []*artifact.PackageArtifact{}
+	for _, a := range synced.GetIndex() {
+		if _, err := cache.Get(a); err != nil {
+			toCache = append(toCache, a)
+		}
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var cached int64
+	var errs error
+	errsLock := &sync.Mutex{}
+	all := make(chan *artifact.PackageArtifact)
+	wg := new(sync.WaitGroup)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cli := synced.Client(c)
+			for a := range all {
+				if _, err := cli.DownloadArtifact(a); err != nil {
+					errsLock.Lock()
+					errs = multierror.Append(errs, err)
+					errsLock.Unlock()
+					continue
+				}
+				atomic.AddInt64(&cached, 1)
+			}
+		}()
+	}
+
+ARTIFACTS:
+	for _, a := range toCache {
+		select {
+		case all <- a:
+		case <-ctx.Done():
+			break ARTIFACTS
+		}
+	}
+	close(all)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	return int(cached), errs
+}
+
+// ApplyRetentionPolicy prunes the packages cache with the configured
+// retention policy, returning the bytes freed
+func (l *LuetInstaller) ApplyRetentionPolicy() (int64, error) {
+	cfg := l.Options.Context.GetConfig()
+	return artifact.NewCache(cfg.System.PkgsCachePath).ApplyRetentionPolicy(cfg.PackageRetentionPolicy)
+}
@@ -0,0 +1,133 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	gocontext "context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/mudler/luet/pkg/api/core/types/artifact"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cache repository", func() {
+	It("downloads the missing artifacts in cache", func() {
+		dir, err := ioutil.TempDir("", "cacherepo")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		writeArtifacts(dir, 3)
+
+		repo, err := GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		ctx.Config.SystemRepositories = types.LuetRepositories{*repo.LuetRepository}
+
+		n, err := CacheRepository(gocontext.Background(), ctx, "test", 2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(3))
+
+		n, err = CacheRepository(gocontext.Background(), ctx, "test", 2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(0))
+	})
+})
+
+var _ = Describe("Retention policy", func() {
+	var dir string
+	var ctx *context.Context
+	var cached map[string]*artifact.PackageArtifact
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "retention")
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx = context.NewContext()
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		cache := artifact.NewCache(ctx.Config.System.PkgsCachePath)
+
+		cached = map[string]*artifact.PackageArtifact{}
+		for _, v := range []string{"1.0", "1.2", "1.10"} {
+			f := filepath.Join(dir, "foo-"+v+".tar")
+			Expect(ioutil.WriteFile(f, []byte("foo "+v), 0600)).ToNot(HaveOccurred())
+			a := artifact.NewPackageArtifact(f)
+			a.CompileSpec = &types.LuetCompilationSpec{Package: &types.Package{Category: "test", Name: "foo", Version: v}}
+			_, _, err := cache.Put(a)
+			Expect(err).ToNot(HaveOccurred())
+			cached[v] = a
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	isCached := func(v string) bool {
+		_, err := artifact.NewCache(ctx.Config.System.PkgsCachePath).Get(cached[v])
+		return err == nil
+	}
+
+	It("keeps the most recent versions", func() {
+		ctx.Config.PackageRetentionPolicy.KeepVersions = 2
+		freed, err := NewLuetInstaller(LuetInstallerOptions{Context: ctx}).ApplyRetentionPolicy()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(freed).To(Equal(int64(len("foo 1.0"))))
+		Expect(isCached("1.0")).To(BeFalse())
+		Expect(isCached("1.2")).To(BeTrue())
+		Expect(isCached("1.10")).To(BeTrue())
+	})
+
+	It("deletes the versions older than the max age", func() {
+		cache := artifact.NewCache(ctx.Config.System.PkgsCachePath)
+		f, err := cache.Get(cached["1.2"])
+		Expect(err).ToNot(HaveOccurred())
+		old := time.Now().Add(-72 * time.Hour)
+		Expect(os.Chtimes(f, old, old)).ToNot(HaveOccurred())
+
+		ctx.Config.PackageRetentionPolicy.MaxAgeDays = 2
+		freed, err := NewLuetInstaller(LuetInstallerOptions{Context: ctx}).ApplyRetentionPolicy()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(freed).To(Equal(int64(len("foo 1.2"))))
+		Expect(isCached("1.0")).To(BeTrue())
+		Expect(isCached("1.2")).To(BeFalse())
+		Expect(isCached("1.10")).To(BeTrue())
+	})
+})
@@ -0,0 +1,148 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	gocontext "context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/mudler/luet/pkg/api/core/types/artifact"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// writeArtifacts creates a tree and a disk repository of n packages without
+// going through the compiler
+func writeArtifacts(dir string, n int) types.Packages {
+	packs := types.Packages{}
+	for i := 0; i < n; i++ {
+		p := &types.Package{Category: "test", Name: fmt.Sprintf("p%d", i), Version: "1.0"}
+		p.Path = filepath.Join(dir, "tree", p.Category, p.Name)
+		Expect(os.MkdirAll(p.Path, os.ModePerm)).ToNot(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(p.Path, types.PackageDefinitionFile),
+			[]byte(fmt.Sprintf("category: %s\nname: %s\nversion: \"%s\"\n", p.Category, p.Name, p.Version)), 0600)).ToNot(HaveOccurred())
+
+		src := filepath.Join(dir, "src", p.Name)
+		Expect(os.MkdirAll(src, os.ModePerm)).ToNot(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(src, p.Name), []byte(p.Name), 0600)).ToNot(HaveOccurred())
+
+		a := artifact.NewPackageArtifact(filepath.Join(dir, "repo", p.GetFingerPrint()+".package.tar"))
+		Expect(a.Compress(src, 1)).ToNot(HaveOccurred())
+		a.CompileSpec = &types.LuetCompilationSpec{Package: p}
+		Expect(a.WriteYAML(filepath.Join(dir, "repo"))).ToNot(HaveOccurred())
+		packs = append(packs, &types.Package{Category: p.Category, Name: p.Name, Version: p.Version})
+	}
+	return packs
+}
+
+var _ = Describe("Parent context", func() {
+	It("aborts an install when cancelled", func() {
+		dir, err := ioutil.TempDir("", "cancel")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		packs := writeArtifacts(dir, 10)
+
+		repo, err := GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+		parent, cancel := gocontext.WithCancel(gocontext.Background())
+		defer cancel()
+
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		ctx.Config.General.ParentContext = parent
+		ctx.Config.System.InstallProgressCallback = func(string, int, int) { cancel() }
+
+		inst := NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 2, Context: ctx,
+			PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+		})
+
+		fakeroot := filepath.Join(dir, "root")
+		Expect(os.MkdirAll(fakeroot, os.ModePerm)).ToNot(HaveOccurred())
+		system := &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+
+		goroutines := runtime.NumGoroutine()
+		err = inst.Install(packs, system)
+		Expect(errors.Is(err, gocontext.Canceled)).To(BeTrue())
+		Eventually(runtime.NumGoroutine).Should(BeNumerically("<=", goroutines))
+	})
+
+	It("fails the install if some downloads fail", func() {
+		dir, err := ioutil.TempDir("", "cancel")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		packs := writeArtifacts(dir, 3)
+
+		repo, err := GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+		Expect(os.Remove(filepath.Join(repodir, packs[1].GetFingerPrint()+".package.tar"))).To(Succeed())
+
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+
+		inst := NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 2, Context: ctx,
+			PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+		})
+
+		fakeroot := filepath.Join(dir, "root")
+		Expect(os.MkdirAll(fakeroot, os.ModePerm)).ToNot(HaveOccurred())
+		system := &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+
+		err = inst.Install(packs, system)
+		Expect(err).To(MatchError(ContainSubstring("Failed downloading package p1")))
+		Expect(system.Database.World()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,127 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCapabilityNotPermitted is returned when adding a capability
+// which luet doesn't have itself
+var ErrCapabilityNotPermitted = errors.New("capability not in the permitted set")
+
+// capabilities maps the Linux capability names to their numbers
+var capabilities = map[string]uintptr{
+	"CAP_CHOWN":              0,
+	"CAP_DAC_OVERRIDE":       1,
+	"CAP_DAC_READ_SEARCH":    2,
+	"CAP_FOWNER":             3,
+	"CAP_FSETID":             4,
+	"CAP_KILL":               5,
+	"CAP_SETGID":             6,
+	"CAP_SETUID":             7,
+	"CAP_SETPCAP":            8,
+	"CAP_LINUX_IMMUTABLE":    9,
+	"CAP_NET_BIND_SERVICE":   10,
+	"CAP_NET_BROADCAST":      11,
+	"CAP_NET_ADMIN":          12,
+	"CAP_NET_RAW":            13,
+	"CAP_IPC_LOCK":           14,
+	"CAP_IPC_OWNER":          15,
+	"CAP_SYS_MODULE":         16,
+	"CAP_SYS_RAWIO":          17,
+	"CAP_SYS_CHROOT":         18,
+	"CAP_SYS_PTRACE":         19,
+	"CAP_SYS_PACCT":          20,
+	"CAP_SYS_ADMIN":          21,
+	"CAP_SYS_BOOT":           22,
+	"CAP_SYS_NICE":           23,
+	"CAP_SYS_RESOURCE":       24,
+	"CAP_SYS_TIME":           25,
+	"CAP_SYS_TTY_CONFIG":     26,
+	"CAP_MKNOD":              27,
+	"CAP_LEASE":              28,
+	"CAP_AUDIT_WRITE":        29,
+	"CAP_AUDIT_CONTROL":      30,
+	"CAP_SETFCAP":            31,
+	"CAP_MAC_OVERRIDE":       32,
+	"CAP_MAC_ADMIN":          33,
+	"CAP_SYSLOG":             34,
+	"CAP_WAKE_ALARM":         35,
+	"CAP_BLOCK_SUSPEND":      36,
+	"CAP_AUDIT_READ":         37,
+	"CAP_PERFMON":            38,
+	"CAP_BPF":                39,
+	"CAP_CHECKPOINT_RESTORE": 40,
+}
+
+// parseCapability accepts capability names with or without
+// the CAP_ prefix, in any case
+func parseCapability(name string) (uintptr, error) {
+	n := strings.ToUpper(name)
+	if !strings.HasPrefix(n, "CAP_") {
+		n = "CAP_" + n
+	}
+	c, ok := capabilities[n]
+	if !ok {
+		return 0, errors.Errorf("unknown capability '%s'", name)
+	}
+	return c, nil
+}
+
+// withCapabilities runs f with the ambient capabilities adjusted, so
+// they are inherited by the processes it spawns. Capabilities are per
+// thread: f runs on a dedicated thread which is discarded afterwards,
+// leaving the rest of the process untouched.
+func withCapabilities(add, drop []string, f func() error) error {
+	if len(add) == 0 && len(drop) == 0 {
+		return f()
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		// Never unlocked, the thread exits with the goroutine
+		runtime.LockOSThread()
+
+		for _, name := range drop {
+			c, err := parseCapability(name)
+			if err != nil {
+				errc <- err
+				return
+			}
+			if err := lowerAmbient(c); err != nil {
+				errc <- errors.Wrapf(err, "while dropping capability %s", name)
+				return
+			}
+		}
+		for _, name := range add {
+			c, err := parseCapability(name)
+			if err != nil {
+				errc <- err
+				return
+			}
+			if err := raiseAmbient(c); err != nil {
+				errc <- errors.Wrapf(err, "while adding capability %s", name)
+				return
+			}
+		}
+		errc <- f()
+	}()
+	return <-errc
+}
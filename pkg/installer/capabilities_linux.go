@@ -0,0 +1,42 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import "golang.org/x/sys/unix"
+
+// raiseAmbient adds the capability to the inheritable and ambient sets
+// of the current thread. It fails with ErrCapabilityNotPermitted if
+// it isn't in the permitted set.
+func raiseAmbient(c uintptr) error {
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	data := [2]unix.CapUserData{}
+	if err := unix.Capget(&hdr, &data[0]); err != nil {
+		return err
+	}
+	if data[c/32].Permitted&(1<<(c%32)) == 0 {
+		return ErrCapabilityNotPermitted
+	}
+	data[c/32].Inheritable |= 1 << (c % 32)
+	if err := unix.Capset(&hdr, &data[0]); err != nil {
+		return err
+	}
+	return unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, c, 0, 0)
+}
+
+// lowerAmbient removes the capability from the ambient set of the current thread
+func lowerAmbient(c uintptr) error {
+	return unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_LOWER, c, 0, 0)
+}
@@ -0,0 +1,45 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"os"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/mudler/luet/pkg/api/core/types/artifact"
+	"github.com/pkg/errors"
+)
+
+// logChecksum submits the checksum of a downloaded artifact to the
+// checksum_transparency_log, failing unless its inclusion is proven.
+// Refused artifacts are dropped from the cache.
+func (l *LuetInstaller) logChecksum(m ArtifactMatch, a *artifact.PackageArtifact, ctx types.Context) error {
+	cfg := ctx.GetConfig()
+	if cfg.PackageChecksumDB == "" {
+		return nil
+	}
+
+	sum := artifact.Checksums{}
+	if err := sum.Generate(a); err != nil {
+		return errors.Wrap(err, "computing the artifact checksum")
+	}
+	if err := cfg.LogPackageChecksum(m.Package, sum[string(artifact.SHA256)]); err != nil {
+		os.RemoveAll(a.Path)
+		return errors.Wrap(err, "checksum transparency log")
+	}
+	ctx.Debug("Checksum of", m.Package.HumanReadableString(), "is included in the transparency log")
+	return nil
+}
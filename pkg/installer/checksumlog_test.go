@@ -0,0 +1,227 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// checksumLog is an in memory RFC 6962 log of package checksums
+type checksumLog struct {
+	sync.Mutex
+	key    *ecdsa.PrivateKey
+	leaves [][]byte
+	sums   map[string]string
+}
+
+func (l *checksumLog) add(e types.ChecksumLogEntry) bool {
+	if sum, ok := l.sums[e.Package]; ok {
+		return sum == e.Checksum
+	}
+	l.sums[e.Package] = e.Checksum
+	l.leaves = append(l.leaves, types.MerkleLeafHash(e.LeafInput()))
+	return true
+}
+
+func splitPoint(n int) int {
+	k := 1
+	for k*2 < n {
+		k *= 2
+	}
+	return k
+}
+
+func treeHash(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		h := sha256.Sum256(nil)
+		return h[:]
+	case 1:
+		return leaves[0]
+	}
+	k := splitPoint(len(leaves))
+	return types.MerkleNodeHash(treeHash(leaves[:k]), treeHash(leaves[k:]))
+}
+
+func auditPath(m int, leaves [][]byte) [][]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := splitPoint(len(leaves))
+	if m < k {
+		return append(auditPath(m, leaves[:k]), treeHash(leaves[k:]))
+	}
+	return append(auditPath(m-k, leaves[k:]), treeHash(leaves[:k]))
+}
+
+func (l *checksumLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.Lock()
+	defer l.Unlock()
+
+	switch r.URL.Path {
+	case "/ct/v1/add-checksum":
+		var e types.ChecksumLogEntry
+		Expect(json.NewDecoder(r.Body).Decode(&e)).To(Succeed())
+		if !l.add(e) {
+			w.WriteHeader(http.StatusConflict)
+		}
+	case "/ct/v1/get-sth":
+		sth := types.SignedTreeHead{TreeSize: uint64(len(l.leaves)), Timestamp: 1, SHA256RootHash: treeHash(l.leaves)}
+		signed := []byte{0, 1}
+		signed = binary.BigEndian.AppendUint64(signed, sth.Timestamp)
+		signed = binary.BigEndian.AppendUint64(signed, sth.TreeSize)
+		digest := sha256.Sum256(append(signed, sth.SHA256RootHash...))
+		sig, err := ecdsa.SignASN1(rand.Reader, l.key, digest[:])
+		Expect(err).ToNot(HaveOccurred())
+		sth.TreeHeadSignature = binary.BigEndian.AppendUint16([]byte{4, 3}, uint16(len(sig)))
+		sth.TreeHeadSignature = append(sth.TreeHeadSignature, sig...)
+		json.NewEncoder(w).Encode(sth)
+	case "/ct/v1/get-proof-by-hash":
+		hash, _ := base64.StdEncoding.DecodeString(r.URL.Query().Get("hash"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("tree_size"))
+		for i, leaf := range l.leaves[:size] {
+			if string(leaf) == string(hash) {
+				json.NewEncoder(w).Encode(types.InclusionProof{LeafIndex: uint64(i), AuditPath: auditPath(i, l.leaves[:size])})
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func writePublicKey(path string, k *ecdsa.PrivateKey) {
+	der, err := x509.MarshalPKIXPublicKey(&k.PublicKey)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644)).To(Succeed())
+}
+
+var _ = Describe("Checksum transparency log", func() {
+	var dir string
+	var packs types.Packages
+	var repo *LuetSystemRepository
+	var log *checksumLog
+	var ts *httptest.Server
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "ctlog")
+		Expect(err).ToNot(HaveOccurred())
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		packs = writeArtifacts(dir, 3)
+
+		repo, err = GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		log = &checksumLog{key: key, sums: map[string]string{}}
+		for _, p := range []string{"other/a@1", "other/b@1", "other/c@1", "other/d@1", "other/e@1"} {
+			log.add(types.ChecksumLogEntry{Package: p, Checksum: "sha256:00"})
+		}
+		ts = httptest.NewServer(log)
+		writePublicKey(filepath.Join(dir, "log.pem"), key)
+	})
+
+	AfterEach(func() {
+		ts.Close()
+		os.RemoveAll(dir)
+	})
+
+	install := func(key string) (*System, error) {
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath, _ = ioutil.TempDir(dir, "cache")
+		ctx.Config.PackageChecksumDB = ts.URL
+		ctx.Config.PackageChecksumDBKey = key
+
+		inst := NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 1, Context: ctx,
+			PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+		})
+
+		fakeroot, _ := ioutil.TempDir(dir, "root")
+		system := &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+		return system, inst.Install(packs, system)
+	}
+
+	It("logs the checksums of the downloaded artifacts", func() {
+		system, err := install(filepath.Join(dir, "log.pem"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(system.Database.World())).To(Equal(3))
+		Expect(log.leaves).To(HaveLen(8))
+		Expect(log.sums).To(HaveKey("test/p0@1.0"))
+
+		// Logged checksums are proven again on later downloads
+		_, err = install(filepath.Join(dir, "log.pem"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(log.leaves).To(HaveLen(8))
+	})
+
+	It("refuses artifacts which don't match the logged checksum", func() {
+		log.add(types.ChecksumLogEntry{Package: "test/p1@1.0", Checksum: "sha256:00"})
+
+		system, err := install("")
+		Expect(errors.Is(err, types.ErrChecksumConflict)).To(BeTrue())
+		Expect(system.Database.World()).To(BeEmpty())
+	})
+
+	It("refuses tree heads which aren't signed by the log key", func() {
+		other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		writePublicKey(filepath.Join(dir, "other.pem"), other)
+
+		_, err = install(filepath.Join(dir, "other.pem"))
+		Expect(errors.Is(err, types.ErrTreeHeadSignature)).To(BeTrue())
+	})
+})
@@ -0,0 +1,125 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	fileHelper "github.com/mudler/luet/pkg/helpers/file"
+)
+
+type downloadURL struct {
+	url string
+	cdn bool
+}
+
+// downloadURLs returns the URLs p is downloaded from. With the CDN
+// enabled, each origin URL is preceded by its CDN one.
+func (c *HttpClient) downloadURLs(p string) []downloadURL {
+	cdn := c.context.GetConfig().RepositoryCDN
+	res := []downloadURL{}
+	for _, uri := range c.RepoData.Urls {
+		u, err := url.Parse(uri)
+		if err != nil {
+			continue
+		}
+		u.Path = path.Join(u.Path, p)
+		if cdn.Enabled {
+			res = append(res, downloadURL{url: cdn.URL(u.String()), cdn: true})
+		}
+		res = append(res, downloadURL{url: u.String()})
+	}
+	return res
+}
+
+func (c *HttpClient) cdnCachePath(u string) string {
+	return filepath.Join(c.context.GetConfig().System.PkgsCachePath, "cdn", fmt.Sprintf("%x", sha256.Sum256([]byte(u))))
+}
+
+// cdnCacheGet returns a copy of the file cached for the CDN URL, if it
+// didn't expire yet
+func (c *HttpClient) cdnCacheGet(u string) (string, bool) {
+	cached := c.cdnCachePath(u)
+	dat, err := ioutil.ReadFile(cached + ".expires")
+	if err != nil {
+		return "", false
+	}
+	expires, err := time.Parse(time.RFC3339, string(dat))
+	if err != nil || time.Now().After(expires) || !fileHelper.Exists(cached) {
+		return "", false
+	}
+
+	file, err := c.context.TempFile("HttpClient")
+	if err != nil {
+		return "", false
+	}
+	file.Close()
+	if err := fileHelper.CopyFile(cached, file.Name()); err != nil {
+		os.RemoveAll(file.Name())
+		return "", false
+	}
+	return file.Name(), true
+}
+
+// cdnCachePut caches a file downloaded from the CDN for as long as its
+// Cache-Control header allows, or for the configured TTL if there is none
+func (c *HttpClient) cdnCachePut(u, src string, header http.Header) {
+	cfg := c.context.GetConfig()
+	ttl := cfg.RepositoryCDN.TTL
+	if cc := header.Get("Cache-Control"); cc != "" {
+		ttl = cacheControlMaxAge(cc)
+	}
+	if ttl <= 0 || cfg.System.PkgsCachePath == "" {
+		return
+	}
+
+	cached := c.cdnCachePath(u)
+	if err := os.MkdirAll(filepath.Dir(cached), os.ModePerm); err != nil {
+		return
+	}
+	if err := fileHelper.CopyFile(src, cached); err != nil {
+		c.context.Debug("Failed caching", u, err.Error())
+		return
+	}
+	ioutil.WriteFile(cached+".expires", []byte(time.Now().Add(ttl).Format(time.RFC3339)), 0644)
+}
+
+// cacheControlMaxAge returns how long a response can be cached according
+// to its Cache-Control header, zero if it can't
+func cacheControlMaxAge(cc string) (maxAge time.Duration) {
+	for _, d := range strings.Split(cc, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		switch {
+		case d == "no-store" || d == "no-cache" || d == "private":
+			return 0
+		case strings.HasPrefix(d, "max-age="):
+			if s, err := strconv.Atoi(strings.TrimPrefix(d, "max-age=")); err == nil {
+				maxAge = time.Duration(s) * time.Second
+			}
+		}
+	}
+	return
+}
@@ -22,8 +22,10 @@ import (
 	"path"
 	"path/filepath"
 
+	"github.com/containerd/containerd/images"
 	registrytypes "github.com/docker/docker/api/types/registry"
 	"github.com/docker/go-units"
+	"github.com/mudler/luet/pkg/api/core/metrics"
 	luettypes "github.com/mudler/luet/pkg/api/core/types"
 	"github.com/pkg/errors"
 
@@ -52,11 +54,23 @@ func NewDockerClient(r RepoData, ctx luettypes.Context) *DockerClient {
 	json.Unmarshal(dat, auth)
 
 	return &DockerClient{RepoData: r, auth: auth,
-		Cache:   artifact.NewCache(ctx.GetConfig().System.PkgsCachePath),
+		Cache:   artifact.NewCompressedCache(ctx.GetConfig().System.PkgsCachePath, luettypes.CompressionImplementation(ctx.GetConfig().System.CacheCompressionAlgo)),
 		context: ctx,
 	}
 }
 
+// pullImage downloads and extracts the image, checking its
+// signature according to the signature policy
+func (c *DockerClient) pullImage(imageName, dest string) (*images.Image, error) {
+	cfg := c.context.GetConfig()
+	info, err := docker.DownloadAndExtractDockerImage(c.context, imageName, dest, c.auth, cfg.VerifySignatures(c.RepoData.Verify))
+	if errors.Is(err, docker.ErrImageVerification) && cfg.GetSignaturePolicy() == luettypes.SignaturePolicyWarn {
+		c.context.Warning("Signature of", imageName, "can't be verified, proceeding as the signature policy is warn:", err.Error())
+		return docker.DownloadAndExtractDockerImage(c.context, imageName, dest, c.auth, false)
+	}
+	return info, err
+}
+
 func (c *DockerClient) DownloadArtifact(a *artifact.PackageArtifact) (*artifact.PackageArtifact, error) {
 	//var u *url.URL = nil
 	var err error
@@ -68,6 +82,7 @@ func (c *DockerClient) DownloadArtifact(a *artifact.PackageArtifact) (*artifact.
 
 	resultingArtifact, err := c.CacheGet(a)
 	if err == nil {
+		metrics.CacheHits.Inc()
 		return resultingArtifact, nil
 	}
 
@@ -98,7 +113,7 @@ func (c *DockerClient) DownloadArtifact(a *artifact.PackageArtifact) (*artifact.
 		c.context.Info("Downloading image", imageName)
 
 		// imageName := fmt.Sprintf("%s/%s", uri, artifact.GetCompileSpec().GetPackage().GetPackageImageName())
-		info, err := docker.DownloadAndExtractDockerImage(c.context, imageName, temp, c.auth, c.RepoData.Verify)
+		info, err := c.pullImage(imageName, temp)
 		if err != nil {
 			c.context.Warning(fmt.Sprintf(errImageDownloadMsg, imageName, err.Error()))
 			continue
@@ -126,6 +141,7 @@ func (c *DockerClient) DownloadArtifact(a *artifact.PackageArtifact) (*artifact.
 			continue
 		}
 		downloaded = true
+		metrics.Downloads.Inc()
 
 		return c.CacheGet(resultingArtifact)
 	}
@@ -158,7 +174,7 @@ func (c *DockerClient) DownloadFile(name string) (string, error) {
 		imageName := fmt.Sprintf("%s:%s", uri, helpers.SanitizeImageString(name))
 		c.context.Info("Downloading", imageName)
 
-		info, err := docker.DownloadAndExtractDockerImage(c.context, imageName, temp, c.auth, c.RepoData.Verify)
+		info, err := c.pullImage(imageName, temp)
 		if err != nil {
 			c.context.Warning(fmt.Sprintf(errImageDownloadMsg, imageName, err.Error()))
 			continue
@@ -16,21 +16,23 @@
 package client
 
 import (
+	"crypto/tls"
 	"fmt"
 	"math"
 	"net/http"
-	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"time"
 
+	"github.com/mudler/luet/pkg/api/core/metrics"
 	"github.com/mudler/luet/pkg/api/core/types"
 	"github.com/mudler/luet/pkg/api/core/types/artifact"
 	"github.com/pkg/errors"
 	"github.com/pterm/pterm"
 
 	"github.com/cavaliercoder/grab"
+	"github.com/quic-go/quic-go/http3"
 )
 
 type HttpClient struct {
@@ -42,23 +44,63 @@ type HttpClient struct {
 func NewHttpClient(r RepoData, ctx types.Context) *HttpClient {
 	return &HttpClient{
 		RepoData: r,
-		Cache:    artifact.NewCache(ctx.GetConfig().System.PkgsCachePath),
+		Cache:    artifact.NewCompressedCache(ctx.GetConfig().System.PkgsCachePath, types.CompressionImplementation(ctx.GetConfig().System.CacheCompressionAlgo)),
 		context:  ctx,
 	}
 }
 
-func NewGrabClient(timeout int) *grab.Client {
+func NewGrabClient(timeout int, protocol string) *grab.Client {
 	return &grab.Client{
 		UserAgent: "grab",
 		HTTPClient: &http.Client{
-			Timeout: time.Duration(timeout) * time.Second,
-			Transport: &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
-			},
+			Timeout:   time.Duration(timeout) * time.Second,
+			Transport: NewTransport(protocol, nil),
 		},
 	}
 }
 
+// NewTransport returns the transport of the repository protocol, http2 if
+// empty. The TLS connections use tlsConfig, if not nil.
+func NewTransport(protocol string, tlsConfig *tls.Config) http.RoundTripper {
+	t := &http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		TLSClientConfig:   tlsConfig,
+		ForceAttemptHTTP2: true,
+	}
+
+	switch protocol {
+	case types.RepoProtocolHTTP1:
+		t.ForceAttemptHTTP2 = false
+		// A non-nil empty map disables HTTP/2
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	case types.RepoProtocolHTTP3:
+		return &http3Transport{quic: &http3.RoundTripper{TLSClientConfig: tlsConfig}, fallback: t}
+	}
+	return t
+}
+
+// http3Transport sends the https requests over QUIC, and the plain
+// http ones with the fallback transport
+type http3Transport struct {
+	quic     *http3.RoundTripper
+	fallback http.RoundTripper
+}
+
+func (t *http3Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Scheme == "https" {
+		return t.quic.RoundTrip(r)
+	}
+	return t.fallback.RoundTrip(r)
+}
+
+// CloseIdleConnections closes the QUIC connections and the idle ones of the fallback
+func (t *http3Transport) CloseIdleConnections() {
+	t.quic.Close()
+	if c, ok := t.fallback.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
 func (c *HttpClient) prepareReq(dst, url string) (*grab.Request, error) {
 
 	req, err := grab.NewRequest(dst, url)
@@ -66,7 +108,9 @@ func (c *HttpClient) prepareReq(dst, url string) (*grab.Request, error) {
 		return nil, err
 	}
 
-	if val, ok := c.RepoData.Authentication["token"]; ok {
+	if val, ok := c.RepoData.Authentication["bearer"]; ok {
+		req.HTTPRequest.Header.Set("Authorization", "Bearer "+val)
+	} else if val, ok := c.RepoData.Authentication["token"]; ok {
 		req.HTTPRequest.Header.Set("Authorization", "token "+val)
 	} else if val, ok := c.RepoData.Authentication["basic"]; ok {
 		req.HTTPRequest.Header.Set("Authorization", "Basic "+val)
@@ -91,26 +135,35 @@ func (c *HttpClient) DownloadFile(p string) (string, error) {
 	}
 	defer os.RemoveAll(temp)
 
-	client := NewGrabClient(c.context.GetConfig().General.HTTPTimeout)
+	client := NewGrabClient(c.context.GetConfig().General.HTTPTimeout, c.context.GetConfig().RepositoryProtocol)
+	defer client.HTTPClient.(*http.Client).CloseIdleConnections()
 
-	for _, uri := range c.RepoData.Urls {
+	urls := c.downloadURLs(p)
+	for _, u := range urls {
+		if u.cdn {
+			if cached, ok := c.cdnCacheGet(u.url); ok {
+				c.context.Debug("Using cached", p, "from", u.url)
+				return cached, nil
+			}
+		}
+	}
+
+	for _, u := range urls {
 		file, err = c.context.TempFile("HttpClient")
 		if err != nil {
-			c.context.Debug("Failed downloading", p, "from", uri)
+			c.context.Debug("Failed downloading", p, "from", u.url)
 
 			continue
 		}
-		c.context.Debug("Downloading artifact", p, "from", uri)
+		c.context.Debug("Downloading artifact", p, "from", u.url)
 
-		u, err := url.Parse(uri)
+		req, err := c.prepareReq(file.Name(), u.url)
 		if err != nil {
 			continue
 		}
-		u.Path = path.Join(u.Path, p)
-
-		req, err := c.prepareReq(file.Name(), u.String())
-		if err != nil {
-			continue
+		if u.cdn {
+			// Repository credentials are for the origin only
+			req.HTTPRequest.Header.Del("Authorization")
 		}
 
 		resp := client.Do(req)
@@ -149,6 +202,9 @@ func (c *HttpClient) DownloadFile(p string) (string, error) {
 		if err = resp.Err(); err != nil {
 			continue
 		}
+		if u.cdn {
+			c.cdnCachePut(u.url, file.Name(), resp.HTTPResponse.Header)
+		}
 
 		c.context.Info("Downloaded", p, "of",
 			fmt.Sprintf("%.2f", (float64(resp.BytesComplete())/1000)/1000), "MB (",
@@ -170,13 +226,7 @@ func (c *HttpClient) DownloadFile(p string) (string, error) {
 }
 
 func (c *HttpClient) CacheGet(a *artifact.PackageArtifact) (*artifact.PackageArtifact, error) {
-	newart := a.ShallowCopy()
-
-	fileName, err := c.Cache.Get(a)
-
-	newart.Path = fileName
-
-	return newart, err
+	return c.Cache.GetArtifact(a)
 }
 
 func (c *HttpClient) DownloadArtifact(a *artifact.PackageArtifact) (*artifact.PackageArtifact, error) {
@@ -185,6 +235,7 @@ func (c *HttpClient) DownloadArtifact(a *artifact.PackageArtifact) (*artifact.Pa
 	newart, err := c.CacheGet(a)
 	// Check if file is already in cache
 	if err == nil {
+		metrics.CacheHits.Inc()
 		return newart, nil
 	}
 
@@ -192,10 +243,13 @@ func (c *HttpClient) DownloadArtifact(a *artifact.PackageArtifact) (*artifact.Pa
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed downloading %s", artifactName)
 	}
+	metrics.Downloads.Inc()
 
 	defer os.RemoveAll(d)
 	newart.Path = d
-	c.Cache.Put(newart)
+	if _, _, err := c.Cache.Put(newart); err != nil {
+		return nil, errors.Wrapf(err, "failed storing %s in the cache", artifactName)
+	}
 
 	return c.CacheGet(newart)
 }
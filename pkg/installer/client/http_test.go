@@ -16,18 +16,24 @@
 package client_test
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 
 	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
 	"github.com/mudler/luet/pkg/api/core/types/artifact"
 	fileHelper "github.com/mudler/luet/pkg/helpers/file"
 	. "github.com/mudler/luet/pkg/installer/client"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/quic-go/quic-go/http3"
 )
 
 var _ = Describe("Http client", func() {
@@ -39,6 +45,7 @@ var _ = Describe("Http client", func() {
 			tmpdir, err := ioutil.TempDir("", "test")
 			Expect(err).ToNot(HaveOccurred())
 			defer os.RemoveAll(tmpdir) // clean up
+			ctx.Config.System.PkgsCachePath = filepath.Join(tmpdir, "cache")
 			Expect(err).ToNot(HaveOccurred())
 			ts := httptest.NewServer(http.FileServer(http.Dir(tmpdir)))
 			defer ts.Close()
@@ -57,6 +64,7 @@ var _ = Describe("Http client", func() {
 			tmpdir, err := ioutil.TempDir("", "test")
 			Expect(err).ToNot(HaveOccurred())
 			defer os.RemoveAll(tmpdir) // clean up
+			ctx.Config.System.PkgsCachePath = filepath.Join(tmpdir, "cache")
 			Expect(err).ToNot(HaveOccurred())
 			ts := httptest.NewServer(http.FileServer(http.Dir(tmpdir)))
 			defer ts.Close()
@@ -71,4 +79,132 @@ var _ = Describe("Http client", func() {
 		})
 
 	})
+
+	Context("With a CDN", func() {
+		var origin, cdn *httptest.Server
+		var cdnHits, originHits int
+		var cacheControl string
+		var ctx *context.Context
+		var tmpdir string
+
+		BeforeEach(func() {
+			var err error
+			tmpdir, err = ioutil.TempDir("", "cdn")
+			Expect(err).ToNot(HaveOccurred())
+			cdnHits, originHits = 0, 0
+			cacheControl = "max-age=60"
+
+			origin = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					originHits++
+				}
+				w.Write([]byte("origin"))
+			}))
+			cdn = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					cdnHits++
+				}
+				Expect(r.Header.Get("Authorization")).To(BeEmpty())
+				if r.URL.EscapedPath() != "/"+url.PathEscape(origin.URL+"/repo/test.txt") {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Header().Set("Cache-Control", cacheControl)
+				w.Write([]byte("cdn"))
+			}))
+
+			ctx = context.NewContext()
+			ctx.Config.System.PkgsCachePath = tmpdir
+			ctx.Config.RepositoryCDN = types.LuetCDNConfig{Enabled: true, BaseURL: cdn.URL}
+		})
+
+		AfterEach(func() {
+			origin.Close()
+			cdn.Close()
+			os.RemoveAll(tmpdir)
+		})
+
+		download := func(p string) string {
+			c := NewHttpClient(RepoData{Urls: []string{origin.URL + "/repo"}, Authentication: map[string]string{"token": "secret"}}, ctx)
+			path, err := c.DownloadFile(p)
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(path)
+			content, err := fileHelper.Read(path)
+			Expect(err).ToNot(HaveOccurred())
+			return content
+		}
+
+		It("downloads from the CDN and caches according to Cache-Control", func() {
+			Expect(download("test.txt")).To(Equal("cdn"))
+			Expect(download("test.txt")).To(Equal("cdn"))
+			Expect(cdnHits).To(Equal(1))
+			Expect(originHits).To(Equal(0))
+		})
+
+		It("doesn't cache what the CDN forbids", func() {
+			cacheControl = "no-store"
+			Expect(download("test.txt")).To(Equal("cdn"))
+			Expect(download("test.txt")).To(Equal("cdn"))
+			Expect(cdnHits).To(Equal(2))
+		})
+
+		It("falls back to the origin", func() {
+			Expect(download("other.txt")).To(Equal("origin"))
+			Expect(cdnHits).To(Equal(1))
+			Expect(originHits).To(Equal(1))
+		})
+	})
+
+	Context("Repository protocol", func() {
+		var ts *httptest.Server
+		var tlsConfig *tls.Config
+		proto := func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Proto))
+		}
+
+		BeforeEach(func() {
+			ts = httptest.NewUnstartedServer(http.HandlerFunc(proto))
+			ts.EnableHTTP2 = true
+			ts.StartTLS()
+			pool := x509.NewCertPool()
+			pool.AddCert(ts.Certificate())
+			tlsConfig = &tls.Config{RootCAs: pool}
+		})
+
+		AfterEach(func() {
+			ts.Close()
+		})
+
+		get := func(t http.RoundTripper, url string) string {
+			c := &http.Client{Transport: t}
+			defer c.CloseIdleConnections()
+			resp, err := c.Get(url)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			data, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			return string(data)
+		}
+
+		It("negotiates http1 and http2", func() {
+			Expect(get(NewTransport(types.RepoProtocolHTTP1, tlsConfig), ts.URL)).To(Equal("HTTP/1.1"))
+			Expect(get(NewTransport(types.RepoProtocolHTTP2, tlsConfig), ts.URL)).To(Equal("HTTP/2.0"))
+			Expect(get(NewTransport("", tlsConfig), ts.URL)).To(Equal("HTTP/2.0"))
+		})
+
+		It("negotiates http3", func() {
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			srv := &http3.Server{Handler: http.HandlerFunc(proto), TLSConfig: http3.ConfigureTLSConfig(ts.TLS.Clone())}
+			go srv.Serve(conn)
+			defer srv.Close()
+
+			t := NewTransport(types.RepoProtocolHTTP3, tlsConfig)
+			Expect(get(t, "https://"+conn.LocalAddr().String())).To(Equal("HTTP/3.0"))
+			// Plain http falls back to TCP
+			plain := httptest.NewServer(http.HandlerFunc(proto))
+			defer plain.Close()
+			Expect(get(t, plain.URL)).To(Equal("HTTP/1.1"))
+		})
+	})
 })
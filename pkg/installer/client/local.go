@@ -20,6 +20,7 @@ import (
 	"path"
 	"path/filepath"
 
+	"github.com/mudler/luet/pkg/api/core/metrics"
 	"github.com/mudler/luet/pkg/api/core/types"
 	"github.com/mudler/luet/pkg/api/core/types/artifact"
 	fileHelper "github.com/mudler/luet/pkg/helpers/file"
@@ -34,7 +35,7 @@ type LocalClient struct {
 
 func NewLocalClient(r RepoData, ctx types.Context) *LocalClient {
 	return &LocalClient{
-		Cache:    artifact.NewCache(ctx.GetConfig().System.PkgsCachePath),
+		Cache:    artifact.NewCompressedCache(ctx.GetConfig().System.PkgsCachePath, types.CompressionImplementation(ctx.GetConfig().System.CacheCompressionAlgo)),
 		RepoData: r,
 		context:  ctx,
 	}
@@ -48,6 +49,7 @@ func (c *LocalClient) DownloadArtifact(a *artifact.PackageArtifact) (*artifact.P
 	newart, err := c.CacheGet(a)
 	// Check if file is already in cache
 	if err == nil {
+		metrics.CacheHits.Inc()
 		return newart, nil
 	}
 
@@ -55,21 +57,19 @@ func (c *LocalClient) DownloadArtifact(a *artifact.PackageArtifact) (*artifact.P
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed downloading %s", artifactName)
 	}
+	metrics.Downloads.Inc()
 	defer os.RemoveAll(d)
 
 	newart.Path = d
-	c.Cache.Put(newart)
+	if _, _, err := c.Cache.Put(newart); err != nil {
+		return nil, errors.Wrapf(err, "failed storing %s in the cache", artifactName)
+	}
 
 	return c.CacheGet(newart)
 }
 
 func (c *LocalClient) CacheGet(a *artifact.PackageArtifact) (*artifact.PackageArtifact, error) {
-	newart := a.ShallowCopy()
-	fileName, err := c.Cache.Get(a)
-
-	newart.Path = fileName
-
-	return newart, err
+	return c.Cache.GetArtifact(a)
 }
 
 func (c *LocalClient) DownloadFile(name string) (string, error) {
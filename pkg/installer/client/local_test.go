@@ -36,6 +36,7 @@ var _ = Describe("Local client", func() {
 			tmpdir, err := ioutil.TempDir("", "test")
 			Expect(err).ToNot(HaveOccurred())
 			defer os.RemoveAll(tmpdir) // clean up
+			ctx.Config.System.PkgsCachePath = filepath.Join(tmpdir, "cache")
 
 			// write the whole body at once
 			err = ioutil.WriteFile(filepath.Join(tmpdir, "test.txt"), []byte(`test`), os.ModePerm)
@@ -52,6 +53,7 @@ var _ = Describe("Local client", func() {
 			tmpdir, err := ioutil.TempDir("", "test")
 			Expect(err).ToNot(HaveOccurred())
 			defer os.RemoveAll(tmpdir) // clean up
+			ctx.Config.System.PkgsCachePath = filepath.Join(tmpdir, "cache")
 
 			// write the whole body at once
 			err = ioutil.WriteFile(filepath.Join(tmpdir, "test.txt"), []byte(`test`), os.ModePerm)
@@ -0,0 +1,176 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/go-version"
+	"github.com/mudler/luet/pkg/api/core/types"
+)
+
+// anyVersion is the loosest version constraint
+const anyVersion = ">=0"
+
+// exactVersion parses v, unless it is a selector
+func exactVersion(v string) (*version.Version, bool) {
+	if (&types.Package{Version: v}).IsSelector() {
+		return nil, false
+	}
+	ver, err := version.NewVersion(v)
+	return ver, err == nil
+}
+
+// relaxedConstraint widens the version constraint v by level steps:
+// an exact version to its minor series, then to its major series,
+// then to any version. Selectors are relaxed to any version at once.
+func relaxedConstraint(v string, level int) string {
+	ver, ok := exactVersion(v)
+	if !ok {
+		return anyVersion
+	}
+
+	seg := ver.Segments()
+	switch level {
+	case 1:
+		return fmt.Sprintf(">=%d.%d.0, <%d.%d.0", seg[0], seg[1], seg[0], seg[1]+1)
+	case 2:
+		return fmt.Sprintf(">=%d.0.0, <%d.0.0", seg[0], seg[0]+1)
+	default:
+		return anyVersion
+	}
+}
+
+// maxRelaxation is the level at which the constraint v accepts any version
+func maxRelaxation(v string) int {
+	if _, ok := exactVersion(v); ok {
+		return 3
+	}
+	return 1
+}
+
+// packagePriority returns the priority of the first repository providing p
+func (re Repositories) packagePriority(p *types.Package) int {
+	sort.Sort(re)
+	for _, r := range re {
+		if _, err := r.GetTree().GetDatabase().FindPackage(p); err == nil {
+			return r.GetPriority()
+		}
+	}
+	return 0
+}
+
+// conflictRelaxation tracks the constraint relaxed of a wanted package,
+// which can be listed more than once
+type conflictRelaxation struct {
+	indexes  []int
+	original string
+	level    int
+	tried    map[string]bool
+}
+
+// candidate returns the best version of the relaxed constraint which
+// wasn't tried yet, relaxing it one more level when none is left
+func (r *conflictRelaxation) candidate(p *types.Package, definitions types.PackageDatabase) (*types.Package, string) {
+	for {
+		if r.level > 0 {
+			constraint := relaxedConstraint(r.original, r.level)
+			matches, _ := definitions.FindPackages(&types.Package{Category: p.GetCategory(), Name: p.GetName(), Version: constraint})
+
+			untried := types.Packages{}
+			for _, m := range matches {
+				if !r.tried[m.GetVersion()] {
+					untried = append(untried, m)
+				}
+			}
+			if len(untried) > 0 {
+				best := untried.Best(nil)
+				r.tried[best.GetVersion()] = true
+				if c, err := definitions.FindPackage(best); err == nil {
+					best = c
+				}
+				return best, constraint
+			}
+		}
+		if r.level >= maxRelaxation(r.original) {
+			return nil, ""
+		}
+		r.level++
+	}
+}
+
+// solveRetryingConflicts solves p. When the solution conflicts, the
+// version constraint of the lowest priority wanted package is relaxed
+// and the solver run again, up to conflict_retries times. Each retry
+// tries the best version of the relaxed constraint not tried yet.
+func (l *LuetInstaller) solveRetryingConflicts(syncedRepos Repositories, p types.Packages, installed, definitions types.PackageDatabase) (types.PackagesAssertions, error) {
+	solution, err := l.solve(p, installed, definitions)
+	retries := l.Options.SolverOptions.InstallRetriesOnConflict
+	if err == nil || retries <= 0 {
+		return solution, err
+	}
+
+	// Lowest priority first, the later requested first among the same priority
+	relaxations := []*conflictRelaxation{}
+	byName := map[string]*conflictRelaxation{}
+	for i, w := range p {
+		if r, ok := byName[w.GetPackageName()]; ok {
+			r.indexes = append(r.indexes, i)
+			continue
+		}
+		r := &conflictRelaxation{indexes: []int{i}, original: w.GetVersion(), tried: map[string]bool{w.GetVersion(): true}}
+		byName[w.GetPackageName()] = r
+		relaxations = append(relaxations, r)
+	}
+	priorities := map[int]int{}
+	for _, r := range relaxations {
+		priorities[r.indexes[0]] = syncedRepos.packagePriority(p[r.indexes[0]])
+	}
+	sort.SliceStable(relaxations, func(i, j int) bool {
+		a, b := relaxations[i].indexes[0], relaxations[j].indexes[0]
+		if priorities[a] != priorities[b] {
+			return priorities[a] > priorities[b]
+		}
+		return a > b
+	})
+
+	wanted := append(types.Packages{}, p...)
+	firstErr := err
+	for attempt := 1; attempt <= retries && len(relaxations) > 0; {
+		r := relaxations[0]
+		w := p[r.indexes[0]]
+		candidate, constraint := r.candidate(w, definitions)
+		if candidate == nil {
+			// Nothing left to try for this package, move to the next one
+			relaxations = relaxations[1:]
+			continue
+		}
+
+		l.Options.Context.Info(fmt.Sprintf("Conflict detected, relaxing %s from %s to %s and trying %s (attempt %d of %d)",
+			w.GetPackageName(), r.original, constraint, candidate.HumanReadableString(), attempt, retries))
+		for _, i := range r.indexes {
+			wanted[i] = candidate
+		}
+		solution, err = l.solve(wanted, installed, definitions)
+		if err == nil {
+			return solution, nil
+		}
+		l.Options.Context.Debug("Relaxed solution failed:", err.Error())
+		attempt++
+	}
+	return nil, firstErr
+}
@@ -0,0 +1,132 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	artifact "github.com/mudler/luet/pkg/api/core/types/artifact"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Conflict retries", func() {
+	var dir string
+	var repos types.LuetRepositories
+
+	// repository, name, version and definition extras
+	fixtures := [][4]string{
+		{"main", "lib", "1.0", ""},
+		{"main", "app", "1.0", "requires:\n- category: test\n  name: lib\n  version: \">=0\"\n"},
+		{"extra", "tool", "1.2.3", "conflicts:\n- category: test\n  name: lib\n  version: \">=0\"\n"},
+		{"extra", "tool", "1.2.1", ""},
+		{"extra", "tool", "1.1.0", ""},
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "conflicts")
+		Expect(err).ToNot(HaveOccurred())
+
+		for _, f := range fixtures {
+			p := &types.Package{Category: "test", Name: f[1], Version: f[2]}
+			p.Path = filepath.Join(dir, f[0], "tree", p.Name, p.Version)
+			Expect(os.MkdirAll(p.Path, os.ModePerm)).ToNot(HaveOccurred())
+			def := fmt.Sprintf("category: test\nname: %s\nversion: \"%s\"\n%s", p.Name, p.Version, f[3])
+			Expect(ioutil.WriteFile(filepath.Join(p.Path, types.PackageDefinitionFile), []byte(def), 0600)).ToNot(HaveOccurred())
+
+			src := filepath.Join(dir, "src", p.GetFingerPrint())
+			Expect(os.MkdirAll(src, os.ModePerm)).ToNot(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(src, p.GetFingerPrint()), []byte(p.Version), 0600)).ToNot(HaveOccurred())
+
+			repodir := filepath.Join(dir, f[0], "repo")
+			Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+			a := artifact.NewPackageArtifact(filepath.Join(repodir, p.GetFingerPrint()+".package.tar"))
+			Expect(a.Compress(src, 1)).ToNot(HaveOccurred())
+			a.CompileSpec = &types.LuetCompilationSpec{Package: p}
+			Expect(a.WriteYAML(repodir)).ToNot(HaveOccurred())
+		}
+
+		repos = types.LuetRepositories{}
+		for name, priority := range map[string]int{"main": 1, "extra": 10} {
+			repodir := filepath.Join(dir, name, "repo")
+			repo, err := GenerateRepository(
+				WithName(name),
+				WithType("disk"),
+				WithUrls(repodir),
+				WithPriority(priority),
+				WithSource(repodir),
+				WithTree(filepath.Join(dir, name, "tree")),
+				WithContext(context.NewContext()),
+				WithDatabase(pkg.NewInMemoryDatabase(false)),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+			repos = append(repos, *repo.LuetRepository)
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	install := func(retries int) (*System, error) {
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+
+		opts := ctx.Config.Solver
+		opts.InstallRetriesOnConflict = retries
+		inst := NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 1, Context: ctx, SolverOptions: opts,
+			PackageRepositories: repos,
+		})
+
+		fakeroot, err := ioutil.TempDir(dir, "root")
+		Expect(err).ToNot(HaveOccurred())
+		system := &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+		return system, inst.Install(types.Packages{
+			{Category: "test", Name: "tool", Version: "1.2.3"},
+			{Category: "test", Name: "app", Version: "1.0"},
+		}, system)
+	}
+
+	It("fails on conflicts by default", func() {
+		_, err := install(0)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("relaxes the constraint of the lowest priority package", func() {
+		system, err := install(1)
+		Expect(err).ToNot(HaveOccurred())
+
+		tool, err := system.Database.FindPackages(&types.Package{Category: "test", Name: "tool", Version: ">=0"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tool).To(HaveLen(1))
+		Expect(tool[0].GetVersion()).To(Equal("1.2.1"))
+
+		_, err = system.Database.FindPackage(&types.Package{Category: "test", Name: "lib", Version: "1.0"})
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
@@ -0,0 +1,62 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mudler/luet/pkg/api/core/logger"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pkg/errors"
+)
+
+// askConsent prompts for the packages matching requires_consent.
+// Consent is asked once per package even if questions are disabled,
+// and it fails with ErrConsentRequired when there is no terminal to ask to.
+// Packages with a license in auto_accept_licenses are not prompted for.
+func (l *LuetInstaller) askConsent(matches map[string]ArtifactMatch) error {
+	cfg := l.Options.Context.GetConfig()
+	if len(cfg.PackageRequiresConsent) == 0 {
+		return nil
+	}
+
+	packs := types.Packages{}
+	for _, m := range matches {
+		if _, ok := l.consented.Load(m.Package.GetFingerPrint()); !ok && cfg.RequiresConsent(m.Package) {
+			packs = append(packs, m.Package)
+		}
+	}
+	sort.Slice(packs, func(i, j int) bool { return packs[i].HumanReadableString() < packs[j].HumanReadableString() })
+
+	for _, p := range packs {
+		if cfg.IsLicenseAutoAccepted(p.GetLicense()) {
+			l.Options.Context.Info(fmt.Sprintf("Auto-accepted license %s of package %s", p.GetLicense(), p.HumanReadableString()))
+			l.consented.Store(p.GetFingerPrint(), true)
+			continue
+		}
+		if !logger.IsInputTerminal() {
+			return errors.Wrap(types.ErrConsentRequired, p.HumanReadableString())
+		}
+
+		l.Options.Context.Info(fmt.Sprintf("Package %s requires your consent to install. Type 'yes' to continue", p.HumanReadableString()))
+		if answer, _ := l.readAnswer(); answer != "yes" {
+			return errors.New("Aborted by user")
+		}
+		l.consented.Store(p.GetFingerPrint(), true)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Consent", func() {
+	It("requires consent for matching packages without a terminal", func() {
+		dir, err := ioutil.TempDir("", "consent")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		packs := writeArtifacts(dir, 2)
+
+		repo, err := GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		ctx.Config.PackageRequiresConsent = []string{"test/p1"}
+
+		inst := NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 1, Context: ctx,
+			PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+		})
+
+		fakeroot := filepath.Join(dir, "root")
+		Expect(os.MkdirAll(fakeroot, os.ModePerm)).ToNot(HaveOccurred())
+		system := &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+
+		err = inst.Install(packs, system)
+		Expect(errors.Is(err, types.ErrConsentRequired)).To(BeTrue())
+		Expect(system.Database.World()).To(BeEmpty())
+
+		Expect(inst.Install(packs[:1], system)).ToNot(HaveOccurred())
+		Expect(len(system.Database.World())).To(Equal(1))
+	})
+})
@@ -0,0 +1,98 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/mudler/luet/pkg/api/core/types/artifact"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Documentation strip", func() {
+	install := func(strip bool) string {
+		dir, err := ioutil.TempDir("", "docs")
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		packs := writeArtifacts(dir, 1)
+
+		// Repackage p0 with its documentation
+		src := filepath.Join(dir, "src", "p0")
+		for _, f := range []string{"usr/share/man/man1/p0.1", "usr/share/doc/p0/README", "usr/share/info/p0.info", "usr/share/gtk-doc/html/p0/index.html"} {
+			Expect(os.MkdirAll(filepath.Dir(filepath.Join(src, f)), os.ModePerm)).ToNot(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(src, f), []byte("doc"), 0600)).ToNot(HaveOccurred())
+		}
+		p := &types.Package{Category: "test", Name: "p0", Version: "1.0", Path: filepath.Join(dir, "tree", "test", "p0")}
+		a := artifact.NewPackageArtifact(filepath.Join(repodir, p.GetFingerPrint()+".package.tar"))
+		Expect(a.Compress(src, 1)).ToNot(HaveOccurred())
+		a.CompileSpec = &types.LuetCompilationSpec{Package: p}
+		Expect(a.WriteYAML(repodir)).ToNot(HaveOccurred())
+
+		repo, err := GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		ctx.Config.DocumentationStrip = strip
+
+		inst := NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 1, Context: ctx,
+			PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+		})
+
+		fakeroot := filepath.Join(dir, "root")
+		Expect(os.MkdirAll(fakeroot, os.ModePerm)).ToNot(HaveOccurred())
+		system := &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+		Expect(inst.Install(packs, system)).ToNot(HaveOccurred())
+		Expect(filepath.Join(fakeroot, "p0")).To(BeARegularFile())
+		return fakeroot
+	}
+
+	It("skips the documentation when enabled", func() {
+		fakeroot := install(true)
+		for _, f := range []string{"usr/share/man/man1", "usr/share/doc/p0", "usr/share/info/p0.info", "usr/share/gtk-doc/html"} {
+			Expect(filepath.Join(fakeroot, f)).ToNot(BeAnExistingFile())
+		}
+	})
+
+	It("installs the documentation by default", func() {
+		fakeroot := install(false)
+		Expect(filepath.Join(fakeroot, "usr/share/man/man1/p0.1")).To(BeARegularFile())
+		Expect(filepath.Join(fakeroot, "usr/share/doc/p0/README")).To(BeARegularFile())
+	})
+})
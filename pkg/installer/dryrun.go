@@ -0,0 +1,89 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pterm/pterm"
+)
+
+const (
+	DryRunInstall  = "install"
+	DryRunRemove   = "remove"
+	DryRunFinalize = "finalize"
+)
+
+// DryRunAction is an operation which would have been performed
+// on the system if dry run was disabled
+type DryRunAction struct {
+	Type   string
+	Target string
+	Reason string
+}
+
+// DryRunPlan collects the actions skipped during a dry run
+type DryRunPlan struct {
+	sync.Mutex
+	Actions []DryRunAction
+}
+
+// Add appends an action to the plan
+func (p *DryRunPlan) Add(t, target, reason string) {
+	p.Lock()
+	defer p.Unlock()
+	p.Actions = append(p.Actions, DryRunAction{Type: t, Target: target, Reason: reason})
+}
+
+func (l *LuetInstaller) dryRun() bool {
+	return l.Options.Context.GetConfig().General.DryRun
+}
+
+func (l *LuetInstaller) planMatches(t string, matches map[string]ArtifactMatch, requested types.Packages) {
+	for _, m := range matches {
+		reason := "dependency"
+		if _, err := requested.Find(m.Package.GetPackageName()); err == nil {
+			reason = "requested"
+		}
+		if m.Repository != nil {
+			reason += " (from " + m.Repository.GetName() + ")"
+		}
+		l.DryRunPlan.Add(t, m.Package.HumanReadableString(), reason)
+	}
+}
+
+func (l *LuetInstaller) planPackages(t string, packs []*types.Package, reason string) {
+	for _, p := range packs {
+		l.DryRunPlan.Add(t, p.HumanReadableString(), reason)
+	}
+}
+
+func (l *LuetInstaller) printDryRunPlan() {
+	if !l.dryRun() {
+		return
+	}
+
+	l.Options.Context.Info("Dry run, no changes were made to the system. Plan:")
+	fmt.Println()
+	d := pterm.TableData{{"Action", "Target", "Reason"}}
+	for _, a := range l.DryRunPlan.Actions {
+		d = append(d, []string{a.Type, a.Target, a.Reason})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(d).Render()
+	fmt.Println()
+}
@@ -0,0 +1,130 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	artifact "github.com/mudler/luet/pkg/api/core/types/artifact"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dry run", func() {
+	var dir string
+	var ctx *context.Context
+	var inst *LuetInstaller
+	var system *System
+
+	a := &types.Package{Category: "test", Name: "a", Version: "1.0"}
+	newA := &types.Package{Category: "test", Name: "a", Version: "1.1"}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "dryrun")
+		Expect(err).ToNot(HaveOccurred())
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		for _, f := range []*types.Package{a, newA} {
+			p := f.Clone()
+			p.Path = filepath.Join(dir, "tree", p.Name, p.Version)
+			Expect(os.MkdirAll(p.Path, os.ModePerm)).ToNot(HaveOccurred())
+			def := fmt.Sprintf("category: test\nname: %s\nversion: \"%s\"\n", p.Name, p.Version)
+			Expect(ioutil.WriteFile(filepath.Join(p.Path, types.PackageDefinitionFile), []byte(def), 0600)).ToNot(HaveOccurred())
+
+			src := filepath.Join(dir, "src", p.GetFingerPrint())
+			Expect(os.MkdirAll(src, os.ModePerm)).ToNot(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(src, "a"), []byte(p.Version), 0600)).ToNot(HaveOccurred())
+
+			art := artifact.NewPackageArtifact(filepath.Join(repodir, p.GetFingerPrint()+".package.tar"))
+			Expect(art.Compress(src, 1)).ToNot(HaveOccurred())
+			art.CompileSpec = &types.LuetCompilationSpec{Package: p}
+			Expect(art.WriteYAML(repodir)).ToNot(HaveOccurred())
+		}
+
+		repo, err := GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+		ctx = context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		cached := *repo.LuetRepository
+		cached.Cached = true
+		inst = NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 2, Context: ctx,
+			PackageRepositories: types.LuetRepositories{cached},
+		})
+
+		fakeroot, err := ioutil.TempDir(dir, "root")
+		Expect(err).ToNot(HaveOccurred())
+		system = &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("doesn't install nor sync the repositories to disk", func() {
+		ctx.Config.General.DryRun = true
+
+		Expect(inst.Install(types.Packages{a}, system)).ToNot(HaveOccurred())
+
+		Expect(inst.DryRunPlan.Actions).To(ContainElement(DryRunAction{
+			Type: DryRunInstall, Target: a.HumanReadableString(), Reason: "requested (from test)",
+		}))
+		Expect(filepath.Join(dir, "db")).ToNot(BeAnExistingFile())
+		Expect(filepath.Join(system.Target, "a")).ToNot(BeAnExistingFile())
+		Expect(system.Database.World()).To(BeEmpty())
+	})
+
+	It("leaves the system and the cached repositories untouched on upgrade", func() {
+		Expect(inst.Install(types.Packages{a}, system)).ToNot(HaveOccurred())
+
+		repodir := filepath.Join(dir, "db", "repos", "test")
+		synctime, err := ioutil.ReadFile(filepath.Join(repodir, "SYNCTIME"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(os.RemoveAll(filepath.Join(repodir, types.DatabaseFile))).ToNot(HaveOccurred())
+
+		ctx.Config.General.DryRun = true
+		Expect(inst.Upgrade(system)).ToNot(HaveOccurred())
+
+		Expect(inst.DryRunPlan.Actions).ToNot(BeEmpty())
+		Expect(ioutil.ReadFile(filepath.Join(repodir, "SYNCTIME"))).To(Equal(synctime))
+		Expect(filepath.Join(repodir, types.DatabaseFile)).ToNot(BeAnExistingFile())
+		Expect(ioutil.ReadFile(filepath.Join(system.Target, "a"))).To(Equal([]byte(a.Version)))
+		Expect(system.Database.World()).To(HaveLen(1))
+		Expect(system.Database.World()[0].GetVersion()).To(Equal(a.Version))
+	})
+})
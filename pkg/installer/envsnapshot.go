@@ -0,0 +1,38 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pkg/errors"
+)
+
+// snapshotEnvironmentOnFailure writes the environment snapshot if the
+// install failed and EnvironmentSnapshotOnFailure is enabled, adding
+// its path to the error
+func (l *LuetInstaller) snapshotEnvironmentOnFailure(toInstall map[string]ArtifactMatch, err *error) {
+	cfg := l.Options.Context.GetConfig()
+	if *err == nil || !cfg.EnvironmentSnapshotOnFailure {
+		return
+	}
+
+	path, serr := cfg.WriteEnvironmentSnapshot(&types.InstallPlan{Install: matchedPackages(toInstall)}, *err)
+	if serr != nil {
+		l.Options.Context.Warning("failed writing the environment snapshot:", serr.Error())
+		return
+	}
+	*err = errors.Wrapf(*err, "environment snapshot written to %s", path)
+}
@@ -0,0 +1,80 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/mudler/luet/pkg/api/core/types/artifact"
+	"github.com/pkg/errors"
+)
+
+// ErrPackageNotFound is returned when an artifact can't be downloaded from
+// its repository nor from any repository of the fallback chain
+var ErrPackageNotFound = errors.New("package not found")
+
+// downloadArtifact downloads the artifact of the match from its repository.
+// If that fails, the repositories of the fallback chain are tried in
+// order: they are synced when first needed, even if disabled.
+func (l *LuetInstaller) downloadArtifact(m ArtifactMatch, ctx types.Context) (*artifact.PackageArtifact, error) {
+	a, err := m.Repository.Client(ctx).DownloadArtifact(m.Artifact)
+	cfg := ctx.GetConfig()
+	if err == nil || len(cfg.RepositoryFallbackChain) == 0 {
+		return a, err
+	}
+
+	for _, name := range cfg.RepositoryFallbackChain {
+		if name == m.Repository.GetName() {
+			continue
+		}
+		repo, ferr := l.fallbackRepository(name, ctx)
+		if ferr != nil {
+			ctx.Warning("Skipping fallback repository", name, ":", ferr.Error())
+			continue
+		}
+		fa, ferr := repo.SearchArtefact(m.Package)
+		if ferr != nil {
+			continue
+		}
+
+		ctx.Info(":arrows_counterclockwise: Downloading", m.Package.HumanReadableString(), "from fallback repository", name)
+		a, ferr := repo.Client(ctx).DownloadArtifact(fa)
+		if ferr == nil {
+			return a, nil
+		}
+		ctx.Warning("Failed downloading", m.Package.HumanReadableString(), "from fallback repository", name, ":", ferr.Error())
+	}
+
+	return nil, errors.Wrapf(ErrPackageNotFound, "%s: %s", m.Package.HumanReadableString(), err.Error())
+}
+
+// fallbackRepository returns the synced system repository of the fallback chain
+func (l *LuetInstaller) fallbackRepository(name string, ctx types.Context) (*LuetSystemRepository, error) {
+	if r, ok := l.fallbacks.Load(name); ok {
+		return r.(*LuetSystemRepository), nil
+	}
+
+	cfg := ctx.GetConfig()
+	repo, err := cfg.GetSystemRepository(name)
+	if err != nil {
+		return nil, err
+	}
+	synced, err := NewSystemRepository(*repo).sync(ctx, false, l.dryRun())
+	if err != nil {
+		return nil, errors.Wrapf(err, "while syncing repository %s", name)
+	}
+	r, _ := l.fallbacks.LoadOrStore(name, synced)
+	return r.(*LuetSystemRepository), nil
+}
@@ -0,0 +1,115 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	fileHelper "github.com/mudler/luet/pkg/helpers/file"
+	. "github.com/mudler/luet/pkg/installer"
+	"github.com/pkg/errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fallback chain", func() {
+	var dir string
+	var ctx *context.Context
+	var primary *LuetSystemRepository
+	var packs types.Packages
+
+	generate := func(name, repodir string) *LuetSystemRepository {
+		repo, err := GenerateRepository(
+			WithName(name),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+		return repo
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "fallback")
+		Expect(err).ToNot(HaveOccurred())
+
+		repodir := filepath.Join(dir, "repo")
+		mirrordir := filepath.Join(dir, "mirror")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		packs = writeArtifacts(dir, 1)
+		Expect(fileHelper.CopyDir(repodir, mirrordir)).ToNot(HaveOccurred())
+
+		primary = generate("primary", repodir)
+		mirror := generate("mirror", mirrordir)
+		mirror.Enable = false
+
+		// The primary repository index is available, its artifacts are not
+		tarballs, err := filepath.Glob(filepath.Join(repodir, "*.package.tar*"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tarballs).ToNot(BeEmpty())
+		for _, t := range tarballs {
+			Expect(os.Remove(t)).ToNot(HaveOccurred())
+		}
+
+		ctx = context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		ctx.Config.SystemRepositories = types.LuetRepositories{*primary.LuetRepository, *mirror.LuetRepository}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	install := func() error {
+		inst := NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 1, Context: ctx,
+			PackageRepositories: types.LuetRepositories{*primary.LuetRepository},
+		})
+		return inst.Install(packs, &System{Database: pkg.NewInMemoryDatabase(false), Target: filepath.Join(dir, "root")})
+	}
+
+	It("downloads from the fallback repositories", func() {
+		ctx.Config.RepositoryFallbackChain = []string{"unknown", "mirror"}
+		Expect(install()).ToNot(HaveOccurred())
+		Expect(filepath.Join(dir, "root", packs[0].GetName())).To(BeARegularFile())
+	})
+
+	It("fails when no fallback repository has the package", func() {
+		ctx.Config.RepositoryFallbackChain = []string{"unknown"}
+		err := install()
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, ErrPackageNotFound)).To(BeTrue())
+	})
+
+	It("doesn't fall back without a chain", func() {
+		err := install()
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, ErrPackageNotFound)).To(BeFalse())
+	})
+})
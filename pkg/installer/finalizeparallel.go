@@ -0,0 +1,188 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/mudler/luet/pkg/api/core/types"
+)
+
+// finalizerJob is the parsed finalizer of a package
+type finalizerJob struct {
+	pack      *types.Package
+	finalizer *LuetFinalizer
+}
+
+// pathTrie indexes paths by their components. owners are the jobs owning
+// the path of the node, through the ones owning it or any path below it.
+type pathTrie struct {
+	children map[string]*pathTrie
+	owners   map[int]bool
+	through  map[int]bool
+}
+
+func newPathTrie() *pathTrie {
+	return &pathTrie{children: map[string]*pathTrie{}, owners: map[int]bool{}, through: map[int]bool{}}
+}
+
+// insert adds path to the index, owned by job. It returns the other jobs
+// owning the same path, one of its parents or a path below it.
+func (t *pathTrie) insert(path string, job int) map[int]bool {
+	overlaps := map[int]bool{}
+	node := t
+	for _, c := range strings.Split(filepath.ToSlash(filepath.Clean(path)), "/") {
+		if c == "" || c == "." {
+			continue
+		}
+		for o := range node.owners {
+			overlaps[o] = true
+		}
+		next, ok := node.children[c]
+		if !ok {
+			next = newPathTrie()
+			node.children[c] = next
+		}
+		node.through[job] = true
+		node = next
+	}
+	if node == t {
+		return overlaps
+	}
+	for o := range node.through {
+		overlaps[o] = true
+	}
+	node.through[job] = true
+	node.owners[job] = true
+	delete(overlaps, job)
+	return overlaps
+}
+
+// finalizerOverlaps returns, for each job, the previous jobs whose package
+// shares any file with its own. Directories found in the rootfs are
+// skipped, as packages commonly ship the same ones.
+func (s *System) finalizerOverlaps(jobs []finalizerJob) [][]int {
+	index := newPathTrie()
+	overlaps := make([][]int, len(jobs))
+	for i, j := range jobs {
+		files, _ := s.Database.GetPackageFiles(j.pack)
+		previous := map[int]bool{}
+		for _, f := range files {
+			if fi, err := os.Lstat(filepath.Join(s.Target, f)); err == nil && fi.IsDir() {
+				continue
+			}
+			for o := range index.insert(f, i) {
+				previous[o] = true
+			}
+		}
+		for o := range previous {
+			overlaps[i] = append(overlaps[i], o)
+		}
+		sort.Ints(overlaps[i])
+	}
+	return overlaps
+}
+
+// finalizerDependencies returns, for each job, the previous jobs whose
+// package is one of its dependencies. Requirements are resolved against
+// the system database, following the packages without a finalizer and
+// the provides.
+func (s *System) finalizerDependencies(jobs []finalizerJob) [][]int {
+	byName := map[string]int{}
+	for i, j := range jobs {
+		byName[j.pack.GetPackageName()] = i
+	}
+
+	deps := make([][]int, len(jobs))
+	for i, j := range jobs {
+		visited := map[string]bool{j.pack.GetPackageName(): true}
+		queue := append([]*types.Package{}, j.pack.GetRequires()...)
+		for len(queue) > 0 {
+			r := queue[0]
+			queue = queue[1:]
+
+			resolved, err := s.Database.FindPackages(r)
+			if err != nil || len(resolved) == 0 {
+				resolved = types.Packages{r}
+			}
+			for _, p := range resolved {
+				name := p.GetPackageName()
+				if visited[name] {
+					continue
+				}
+				visited[name] = true
+
+				if o, ok := byName[name]; ok {
+					if o < i {
+						deps[i] = append(deps[i], o)
+					}
+					queue = append(queue, jobs[o].pack.GetRequires()...)
+					continue
+				}
+				if installed, err := s.Database.FindPackage(p); err == nil {
+					queue = append(queue, installed.GetRequires()...)
+				}
+			}
+		}
+		sort.Ints(deps[i])
+	}
+	return deps
+}
+
+// runFinalizersParallel runs up to parallelism finalizers at once, in
+// order. A finalizer starts after the ones of the previous packages
+// it depends on, or sharing files with its own, are done.
+func (s *System) runFinalizersParallel(jobs []finalizerJob, parallelism int, run func(finalizerJob) error) error {
+	var errs error
+	waits := s.finalizerOverlaps(jobs)
+	for i, deps := range s.finalizerDependencies(jobs) {
+		waits[i] = append(waits[i], deps...)
+	}
+
+	done := make([]chan struct{}, len(jobs))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	m := sync.Mutex{}
+	sem := make(chan struct{}, parallelism)
+	wg := &sync.WaitGroup{}
+	for i := range jobs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer close(done[i])
+			for _, o := range waits[i] {
+				<-done[o]
+			}
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if err := run(jobs[i]); err != nil {
+				m.Lock()
+				errs = multierror.Append(errs, err)
+				m.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
@@ -16,8 +16,10 @@
 package installer
 
 import (
+	"context"
 	"os"
 	"os/exec"
+	"time"
 
 	"github.com/ghodss/yaml"
 	"github.com/mudler/luet/pkg/api/core/types"
@@ -28,6 +30,13 @@ import (
 	"github.com/pkg/errors"
 )
 
+// ErrFinalizerTimeout is returned when a finalizer runs longer than the finalizer timeout
+var ErrFinalizerTimeout = errors.New("finalizer timed out")
+
+// finalizerWaitDelay is how long the output of a timed out
+// finalizer is waited for, after it got killed
+const finalizerWaitDelay = time.Second
+
 type LuetFinalizer struct {
 	Shell     []string `json:"shell"`
 	Install   []string `json:"install"`
@@ -48,26 +57,48 @@ func (f *LuetFinalizer) RunInstall(ctx types.Context, s *System) error {
 		}
 	}
 
-	for _, c := range f.Install {
-		toRun := append(args, c)
-		ctx.Info(":shell: Executing finalizer on ", s.Target, cmd, toRun)
-		if s.Target == string(os.PathSeparator) {
-			cmd := exec.Command(cmd, toRun...)
-			cmd.Env = ctx.GetConfig().FinalizerEnvs.Slice()
-			stdoutStderr, err := cmd.CombinedOutput()
-			if err != nil {
-				return errors.Wrap(err, "Failed running command: "+string(stdoutStderr))
-			}
-			ctx.Info(string(stdoutStderr))
-		} else {
-			b := box.NewBox(cmd, toRun, []string{}, ctx.GetConfig().FinalizerEnvs.Slice(), s.Target, false, true, true)
-			err := b.Run()
-			if err != nil {
-				return errors.Wrap(err, "Failed running command ")
+	cfg := ctx.GetConfig()
+
+	// The timeout covers the whole finalizer, not the single commands
+	execCtx := cfg.General.GetParentContext()
+	if cfg.FinalizerTimeout > 0 {
+		var cancel context.CancelFunc
+		execCtx, cancel = context.WithTimeout(execCtx, cfg.FinalizerTimeout)
+		defer cancel()
+	}
+
+	return withCapabilities(cfg.System.CapabilityAdd, cfg.System.CapabilityDrop, func() error {
+		for _, c := range f.Install {
+			toRun := append(args, c)
+			ctx.Info(":shell: Executing finalizer on ", s.Target, cmd, toRun)
+			if s.Target == string(os.PathSeparator) || cfg.RunHooksOnHost {
+				// Outside the chroot the hook gets the rootfs path to operate on
+				cmd := exec.CommandContext(execCtx, cmd, toRun...)
+				cmd.Env = append(cfg.FinalizerEnvs.Slice(), "LUET_ROOTFS="+s.Target)
+				cmd.WaitDelay = finalizerWaitDelay
+				stdoutStderr, err := cmd.CombinedOutput()
+				if err != nil && errors.Is(execCtx.Err(), context.DeadlineExceeded) {
+					return errors.Wrapf(ErrFinalizerTimeout, "'%s' after %s, partial output: %s", c, cfg.FinalizerTimeout, stdoutStderr)
+				}
+				if err != nil {
+					return errors.Wrap(err, "Failed running command: "+string(stdoutStderr))
+				}
+				ctx.Info(string(stdoutStderr))
+			} else {
+				b := box.NewBox(cmd, toRun, []string{}, cfg.FinalizerEnvs.Slice(), s.Target, false, true, true)
+				b.(*box.DefaultBox).Context = execCtx
+				err := b.Run()
+				if err != nil && errors.Is(execCtx.Err(), context.DeadlineExceeded) {
+					// The box output is streamed, it was already printed
+					return errors.Wrapf(ErrFinalizerTimeout, "'%s' after %s", c, cfg.FinalizerTimeout)
+				}
+				if err != nil {
+					return errors.Wrap(err, "Failed running command ")
+				}
 			}
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
 // TODO: We don't store uninstall finalizers ?!
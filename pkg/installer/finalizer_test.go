@@ -0,0 +1,346 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Finalizer", func() {
+	Context("Outside chroot", func() {
+		It("runs on the host with LUET_ROOTFS", func() {
+			dir, err := ioutil.TempDir("", "finalizer")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			ctx := context.NewContext()
+			ctx.Config.RunHooksOnHost = true
+
+			f := &LuetFinalizer{Install: []string{"echo $LUET_ROOTFS > $LUET_ROOTFS/hook"}}
+			Expect(f.RunInstall(ctx, &System{Target: dir})).ToNot(HaveOccurred())
+
+			content, err := ioutil.ReadFile(filepath.Join(dir, "hook"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(Equal(dir + "\n"))
+		})
+	})
+
+	Context("Timeout", func() {
+		It("kills finalizers running too long, keeping their output", func() {
+			ctx := context.NewContext()
+			ctx.Config.RunHooksOnHost = true
+			ctx.Config.FinalizerTimeout = 200 * time.Millisecond
+
+			f := &LuetFinalizer{Install: []string{"echo started; sleep 5"}}
+			start := time.Now()
+			err := f.RunInstall(ctx, &System{Target: os.TempDir()})
+			Expect(err).To(MatchError(ErrFinalizerTimeout))
+			Expect(err.Error()).To(ContainSubstring("started"))
+			Expect(time.Since(start)).To(BeNumerically("<", 4*time.Second))
+		})
+
+		It("doesn't apply to finalizers completing in time", func() {
+			ctx := context.NewContext()
+			ctx.Config.RunHooksOnHost = true
+			ctx.Config.FinalizerTimeout = 5 * time.Second
+
+			f := &LuetFinalizer{Install: []string{"true"}}
+			Expect(f.RunInstall(ctx, &System{Target: os.TempDir()})).ToNot(HaveOccurred())
+		})
+	})
+
+	Context("Capabilities", func() {
+		It("fails on unknown capabilities", func() {
+			ctx := context.NewContext()
+			ctx.Config.RunHooksOnHost = true
+			ctx.Config.System.CapabilityAdd = []string{"CAP_FOO"}
+
+			f := &LuetFinalizer{Install: []string{"true"}}
+			Expect(f.RunInstall(ctx, &System{Target: os.TempDir()})).To(HaveOccurred())
+		})
+
+		It("fails on capabilities which aren't permitted", func() {
+			if runtime.GOOS != "linux" || os.Geteuid() == 0 {
+				Skip("requires an unprivileged user on linux")
+			}
+			ctx := context.NewContext()
+			ctx.Config.RunHooksOnHost = true
+			ctx.Config.System.CapabilityAdd = []string{"sys_admin"}
+
+			f := &LuetFinalizer{Install: []string{"true"}}
+			err := f.RunInstall(ctx, &System{Target: os.TempDir()})
+			Expect(errors.Is(err, ErrCapabilityNotPermitted)).To(BeTrue())
+		})
+
+		It("raises ambient capabilities for the hooks", func() {
+			if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+				Skip("requires root on linux")
+			}
+			dir, err := ioutil.TempDir("", "finalizer")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			ctx := context.NewContext()
+			ctx.Config.RunHooksOnHost = true
+			ctx.Config.System.CapabilityAdd = []string{"net_admin"}
+
+			f := &LuetFinalizer{Install: []string{"grep CapAmb /proc/self/status > $LUET_ROOTFS/caps"}}
+			Expect(f.RunInstall(ctx, &System{Target: dir})).ToNot(HaveOccurred())
+
+			content, err := ioutil.ReadFile(filepath.Join(dir, "caps"))
+			Expect(err).ToNot(HaveOccurred())
+			// CAP_NET_ADMIN is bit 12
+			Expect(strings.TrimSpace(string(content))).To(HaveSuffix("0000000000001000"))
+		})
+	})
+
+	Context("Read-only mounts", func() {
+		It("mounts the host paths in the rootfs while finalizers run", func() {
+			if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+				Skip("requires root on linux")
+			}
+			dir, err := ioutil.TempDir("", "romounts")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			certs := filepath.Join(dir, "host", "certs")
+			Expect(os.MkdirAll(certs, os.ModePerm)).ToNot(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(certs, "ca.pem"), []byte("cert"), 0644)).ToNot(HaveOccurred())
+
+			repodir := filepath.Join(dir, "repo")
+			Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+			packs := writeArtifacts(dir, 1)
+			Expect(ioutil.WriteFile(filepath.Join(dir, "tree", "test", "p0", "finalize.yaml"), []byte(
+				"install:\n"+
+					"- cat $LUET_ROOTFS"+certs+"/ca.pem > $LUET_ROOTFS/read\n"+
+					"- touch $LUET_ROOTFS"+certs+"/new || touch $LUET_ROOTFS/readonly\n"+
+					"- grep -c $LUET_ROOTFS"+certs+" /proc/self/mountinfo > $LUET_ROOTFS/mounted\n",
+			), 0600)).ToNot(HaveOccurred())
+
+			repo, err := GenerateRepository(
+				WithName("test"),
+				WithType("disk"),
+				WithUrls(repodir),
+				WithPriority(1),
+				WithSource(repodir),
+				WithTree(filepath.Join(dir, "tree")),
+				WithContext(context.NewContext()),
+				WithDatabase(pkg.NewInMemoryDatabase(false)),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+			ctx := context.NewContext()
+			ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+			ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+			ctx.Config.RunHooksOnHost = true
+			ctx.Config.RootfsReadOnlyMounts = []string{certs, filepath.Join(dir, "missing")}
+
+			inst := NewLuetInstaller(LuetInstallerOptions{
+				Concurrency: 1, Context: ctx,
+				PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+			})
+
+			fakeroot := filepath.Join(dir, "root")
+			Expect(os.MkdirAll(fakeroot, os.ModePerm)).ToNot(HaveOccurred())
+			system := &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+
+			Expect(inst.Install(packs, system)).ToNot(HaveOccurred())
+
+			content, err := ioutil.ReadFile(filepath.Join(fakeroot, "read"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(Equal("cert"))
+			Expect(filepath.Join(fakeroot, "readonly")).To(BeAnExistingFile())
+			Expect(filepath.Join(certs, "new")).ToNot(BeAnExistingFile())
+			content, err = ioutil.ReadFile(filepath.Join(fakeroot, "mounted"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.TrimSpace(string(content))).To(Equal("1"))
+
+			// Unmounted, with the mountpoints created removed
+			mountinfo, err := ioutil.ReadFile("/proc/self/mountinfo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(mountinfo)).ToNot(ContainSubstring(fakeroot))
+			Expect(filepath.Join(fakeroot, strings.Split(dir, string(os.PathSeparator))[1])).ToNot(BeAnExistingFile())
+			Expect(filepath.Join(certs, "ca.pem")).To(BeAnExistingFile())
+		})
+	})
+
+	Context("Bootstrap mode", func() {
+		It("skips finalizers until finalize is called", func() {
+			dir, err := ioutil.TempDir("", "bootstrap")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			repodir := filepath.Join(dir, "repo")
+			Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+			packs := writeArtifacts(dir, 1)
+			Expect(ioutil.WriteFile(filepath.Join(dir, "tree", "test", "p0", "finalize.yaml"),
+				[]byte("install:\n- touch $LUET_ROOTFS/finalized\n"), 0600)).ToNot(HaveOccurred())
+
+			repo, err := GenerateRepository(
+				WithName("test"),
+				WithType("disk"),
+				WithUrls(repodir),
+				WithPriority(1),
+				WithSource(repodir),
+				WithTree(filepath.Join(dir, "tree")),
+				WithContext(context.NewContext()),
+				WithDatabase(pkg.NewInMemoryDatabase(false)),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+			ctx := context.NewContext()
+			ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+			ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+			ctx.Config.RunHooksOnHost = true
+			ctx.Config.BootstrapMode = true
+
+			inst := NewLuetInstaller(LuetInstallerOptions{
+				Concurrency: 1, Context: ctx,
+				PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+			})
+
+			fakeroot := filepath.Join(dir, "root")
+			Expect(os.MkdirAll(fakeroot, os.ModePerm)).ToNot(HaveOccurred())
+			system := &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+
+			Expect(inst.Install(packs, system)).ToNot(HaveOccurred())
+			Expect(filepath.Join(fakeroot, "p0")).To(BeAnExistingFile())
+			Expect(filepath.Join(fakeroot, "finalized")).ToNot(BeAnExistingFile())
+
+			Expect(inst.Finalize(nil, system)).ToNot(HaveOccurred())
+			Expect(filepath.Join(fakeroot, "finalized")).ToNot(BeAnExistingFile())
+
+			ctx.Config.BootstrapMode = false
+			Expect(inst.Finalize(nil, system)).ToNot(HaveOccurred())
+			Expect(filepath.Join(fakeroot, "finalized")).To(BeAnExistingFile())
+		})
+	})
+
+	Context("Parallelism", func() {
+		var dir, fakeroot string
+		var system *System
+		var packs types.Packages
+
+		// Finalizers waiting for each other, and holding a lock
+		// on the shared file while appending to it
+		wait := func(name, other string) string {
+			return "install:\n" +
+				"- touch $LUET_ROOTFS/started-" + name + "\n" +
+				"- for i in $(seq 10); do [ -e $LUET_ROOTFS/started-" + other + " ] && exit 0; sleep 0.1; done; exit 1\n"
+		}
+		lock := func(name string) string {
+			return "install:\n" +
+				"- mkdir $LUET_ROOTFS/shared.lock || touch $LUET_ROOTFS/concurrent; sleep 0.3; echo " + name + " >> $LUET_ROOTFS/etc/shared.conf; rmdir $LUET_ROOTFS/shared.lock\n"
+		}
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "parallelism")
+			Expect(err).ToNot(HaveOccurred())
+			fakeroot = filepath.Join(dir, "root")
+			Expect(os.MkdirAll(filepath.Join(fakeroot, "etc"), os.ModePerm)).ToNot(HaveOccurred())
+			system = &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+
+			packs = types.Packages{}
+			for _, f := range [][3]string{
+				{"c", lock("c"), "etc/shared.conf"},
+				{"a", wait("a", "b"), "etc/a.conf"},
+				{"d", lock("d"), "etc/shared.conf"},
+				{"b", wait("b", "a"), "etc/b.conf"},
+			} {
+				p := &types.Package{Category: "test", Name: f[0], Version: "1.0"}
+				p.Path = filepath.Join(dir, "tree", p.Name)
+				Expect(os.MkdirAll(p.Path, os.ModePerm)).ToNot(HaveOccurred())
+				Expect(ioutil.WriteFile(filepath.Join(p.Path, types.PackageDefinitionFile),
+					[]byte("category: test\nname: "+p.Name+"\nversion: \"1.0\"\n"), 0600)).ToNot(HaveOccurred())
+				Expect(ioutil.WriteFile(filepath.Join(p.Path, "finalize.yaml"), []byte(f[1]), 0600)).ToNot(HaveOccurred())
+				Expect(system.Database.SetPackageFiles(&types.PackageFile{
+					PackageFingerprint: p.GetFingerPrint(), Files: []string{"etc", f[2]},
+				})).ToNot(HaveOccurred())
+				packs = append(packs, p)
+			}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("runs finalizers of packages without shared files at the same time", func() {
+			ctx := context.NewContext()
+			ctx.Config.RunHooksOnHost = true
+			ctx.Config.General.FinalizeParallelism = 4
+
+			Expect(system.ExecuteFinalizers(ctx, packs)).ToNot(HaveOccurred())
+
+			Expect(filepath.Join(fakeroot, "concurrent")).ToNot(BeAnExistingFile())
+			content, err := ioutil.ReadFile(filepath.Join(fakeroot, "etc", "shared.conf"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(Equal("c\nd\n"))
+		})
+
+		It("runs the finalizers of the dependencies first", func() {
+			deps := types.Packages{}
+			for _, f := range [][3]string{
+				{"x", "install:\n- sleep 0.3; touch $LUET_ROOTFS/done-x\n", ""},
+				{"y", "install:\n- test -e $LUET_ROOTFS/done-x\n", "x"},
+			} {
+				p := &types.Package{Category: "test", Name: f[0], Version: "1.0"}
+				if f[2] != "" {
+					p.PackageRequires = []*types.Package{{Category: "test", Name: f[2], Version: ">=0"}}
+				}
+				p.Path = filepath.Join(dir, "tree", p.Name)
+				Expect(os.MkdirAll(p.Path, os.ModePerm)).ToNot(HaveOccurred())
+				Expect(ioutil.WriteFile(filepath.Join(p.Path, types.PackageDefinitionFile),
+					[]byte("category: test\nname: "+p.Name+"\nversion: \"1.0\"\n"), 0600)).ToNot(HaveOccurred())
+				Expect(ioutil.WriteFile(filepath.Join(p.Path, "finalize.yaml"), []byte(f[1]), 0600)).ToNot(HaveOccurred())
+				Expect(system.Database.SetPackageFiles(&types.PackageFile{
+					PackageFingerprint: p.GetFingerPrint(), Files: []string{"etc/" + p.Name + ".conf"},
+				})).ToNot(HaveOccurred())
+				deps = append(deps, p)
+			}
+
+			ctx := context.NewContext()
+			ctx.Config.RunHooksOnHost = true
+			ctx.Config.General.FinalizeParallelism = 4
+
+			Expect(system.ExecuteFinalizers(ctx, deps)).ToNot(HaveOccurred())
+		})
+
+		It("runs them one at a time by default", func() {
+			ctx := context.NewContext()
+			ctx.Config.RunHooksOnHost = true
+
+			Expect(system.ExecuteFinalizers(ctx, packs)).To(HaveOccurred())
+			Expect(filepath.Join(fakeroot, "concurrent")).ToNot(BeAnExistingFile())
+		})
+	})
+})
@@ -0,0 +1,86 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"encoding/json"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/mudler/luet/pkg/api/core/types/artifact"
+	"github.com/pkg/errors"
+)
+
+// ComputeInstallFootprint returns the size in bytes that installing the
+// matches would take on disk. The archive size is used for artifacts
+// which don't record their installed size.
+func ComputeInstallFootprint(matches map[string]ArtifactMatch) int64 {
+	var size int64
+	for _, m := range matches {
+		if m.Artifact == nil {
+			continue
+		}
+		if m.Artifact.InstalledSize > 0 {
+			size += m.Artifact.InstalledSize
+		} else {
+			size += m.Artifact.Size
+		}
+	}
+	return size
+}
+
+// CheckInstallFootprint returns types.ErrInstallSizeLimitExceeded if the
+// matches exceed the configured MaxInstallSizeMB
+func (l *LuetInstaller) CheckInstallFootprint(matches map[string]ArtifactMatch) error {
+	max := l.Options.Context.GetConfig().System.MaxInstallSizeMB
+	if max <= 0 {
+		return nil
+	}
+
+	size := ComputeInstallFootprint(matches)
+	if size > max*1024*1024 {
+		return errors.Wrapf(types.ErrInstallSizeLimitExceeded, "install takes %d bytes, maximum allowed is %d MB", size, max)
+	}
+	return nil
+}
+
+// CheckStorageQuota returns a types.StorageQuotaExceeded error if
+// downloading and installing the matches would exceed the storage quota.
+// The database growth is estimated from the package metadata and files.
+func (l *LuetInstaller) CheckStorageQuota(matches map[string]ArtifactMatch) error {
+	cfg := l.Options.Context.GetConfig()
+	if cfg.StorageQuota.CacheMaxGB <= 0 && cfg.StorageQuota.DatabaseMaxMB <= 0 {
+		return nil
+	}
+
+	cache := artifact.NewCache(cfg.System.PkgsCachePath)
+	var cacheGrowth, databaseGrowth int64
+	for _, m := range matches {
+		if m.Artifact == nil {
+			continue
+		}
+		if _, err := cache.Get(m.Artifact); err != nil {
+			cacheGrowth += m.Artifact.Size
+		}
+		if dat, err := json.Marshal(m.Package); err == nil {
+			databaseGrowth += int64(len(dat))
+		}
+		for _, f := range m.Artifact.Files {
+			databaseGrowth += int64(len(f))
+		}
+	}
+
+	return cfg.CheckStorageQuota(cacheGrowth, databaseGrowth)
+}
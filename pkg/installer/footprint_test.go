@@ -0,0 +1,118 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/mudler/luet/pkg/api/core/types/artifact"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Install footprint", func() {
+	It("refuses installs over the size limit", func() {
+		dir, err := ioutil.TempDir("", "footprint")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		src := filepath.Join(dir, "src")
+		Expect(os.MkdirAll(src, os.ModePerm)).ToNot(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(src, "data"), make([]byte, 2*1024*1024), 0600)).ToNot(HaveOccurred())
+
+		a := artifact.NewPackageArtifact(filepath.Join(dir, "foo.tar"))
+		Expect(a.Compress(src, 1)).ToNot(HaveOccurred())
+
+		p := &types.Package{Category: "test", Name: "foo", Version: "1.0"}
+		matches := map[string]ArtifactMatch{p.GetFingerPrint(): {Package: p, Artifact: a}}
+		Expect(ComputeInstallFootprint(matches)).To(Equal(int64(2 * 1024 * 1024)))
+
+		ctx := context.NewContext()
+		ctx.Config.System.MaxInstallSizeMB = 1
+		inst := NewLuetInstaller(LuetInstallerOptions{Context: ctx})
+		err = inst.CheckInstallFootprint(matches)
+		Expect(errors.Is(err, types.ErrInstallSizeLimitExceeded)).To(BeTrue())
+
+		ctx.Config.System.MaxInstallSizeMB = 3
+		Expect(inst.CheckInstallFootprint(matches)).ToNot(HaveOccurred())
+	})
+})
+
+var _ = Describe("Storage quota", func() {
+	It("refuses installs over the cache quota", func() {
+		dir, err := ioutil.TempDir("", "quota")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		src := filepath.Join(dir, "src")
+		Expect(os.MkdirAll(src, os.ModePerm)).ToNot(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(src, "data"), make([]byte, 1024*1024), 0600)).ToNot(HaveOccurred())
+
+		a := artifact.NewPackageArtifact(filepath.Join(dir, "foo.tar"))
+		Expect(a.Compress(src, 1)).ToNot(HaveOccurred())
+		Expect(a.Hash()).ToNot(HaveOccurred())
+
+		p := &types.Package{Category: "test", Name: "foo", Version: "1.0"}
+		matches := map[string]ArtifactMatch{p.GetFingerPrint(): {Package: p, Artifact: a}}
+
+		ctx := context.NewContext()
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		ctx.Config.StorageQuota.CacheMaxGB = 0.0005
+		inst := NewLuetInstaller(LuetInstallerOptions{Context: ctx})
+
+		err = inst.CheckStorageQuota(matches)
+		quota := &types.StorageQuotaExceeded{}
+		Expect(errors.As(err, &quota)).To(BeTrue())
+		Expect(quota.Component).To(Equal(types.StorageComponentCache))
+		Expect(quota.Projected).To(BeNumerically(">=", a.Size))
+
+		ctx.Config.StorageQuota.CacheMaxGB = 0.01
+		Expect(inst.CheckStorageQuota(matches)).ToNot(HaveOccurred())
+	})
+
+	It("refuses installs over the database quota", func() {
+		dir, err := ioutil.TempDir("", "quota")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		ctx := context.NewContext()
+		ctx.Config.System.DatabaseEngine = "boltdb"
+		ctx.Config.System.DatabasePath = dir
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		Expect(ioutil.WriteFile(ctx.Config.GetSystemDBPath(), make([]byte, 1024*1024), 0600)).ToNot(HaveOccurred())
+		ctx.Config.StorageQuota.DatabaseMaxMB = 1
+
+		p := &types.Package{Category: "test", Name: "foo", Version: "1.0"}
+		matches := map[string]ArtifactMatch{p.GetFingerPrint(): {Package: p, Artifact: &artifact.PackageArtifact{Files: []string{"usr/bin/foo"}}}}
+		inst := NewLuetInstaller(LuetInstallerOptions{Context: ctx})
+
+		err = inst.CheckStorageQuota(matches)
+		quota := &types.StorageQuotaExceeded{}
+		Expect(errors.As(err, &quota)).To(BeTrue())
+		Expect(quota.Component).To(Equal(types.StorageComponentDatabase))
+		Expect(quota.Limit).To(Equal(int64(1024 * 1024)))
+
+		ctx.Config.StorageQuota.DatabaseMaxMB = 2
+		Expect(inst.CheckStorageQuota(matches)).ToNot(HaveOccurred())
+	})
+})
@@ -0,0 +1,45 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import "github.com/mudler/luet/pkg/api/core/types"
+
+// skipHeld drops the upgrades of the packages matching package_holds
+func (l *LuetInstaller) skipHeld(uninstall, toInstall types.Packages) (types.Packages, types.Packages) {
+	cfg := l.Options.Context.GetConfig()
+	if len(cfg.PackageHolds) == 0 {
+		return uninstall, toInstall
+	}
+
+	held := map[string]bool{}
+	keep := types.Packages{}
+	for _, p := range uninstall {
+		if cfg.IsHeld(p) {
+			l.Options.Context.Info("Package", p.HumanReadableString(), "is held, skipping its upgrade")
+			held[p.GetPackageName()] = true
+			continue
+		}
+		keep = append(keep, p)
+	}
+
+	install := types.Packages{}
+	for _, p := range toInstall {
+		if !held[p.GetPackageName()] {
+			install = append(install, p)
+		}
+	}
+	return keep, install
+}
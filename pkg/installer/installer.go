@@ -16,10 +16,14 @@
 package installer
 
 import (
+	"archive/tar"
+	"bufio"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strings"
 	"sync"
@@ -28,10 +32,12 @@ import (
 
 	"github.com/mudler/luet/pkg/api/core/config"
 	"github.com/mudler/luet/pkg/api/core/logger"
+	"github.com/mudler/luet/pkg/api/core/metrics"
 	"github.com/mudler/luet/pkg/helpers"
 	"github.com/mudler/luet/pkg/tree"
 
 	"github.com/pterm/pterm"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/mudler/luet/pkg/api/core/bus"
 	"github.com/mudler/luet/pkg/api/core/types"
@@ -64,16 +70,88 @@ type LuetInstallerOptions struct {
 
 type LuetInstaller struct {
 	Options LuetInstallerOptions
+
+	// DryRunPlan holds the actions skipped when running in dry run mode
+	DryRunPlan *DryRunPlan
+
+	// consented are the packages the user agreed to install
+	consented sync.Map
+
+	// confirmed and declined are the packages accepted and skipped
+	// with interactive_install, stdin reads the answers.
+	// askPackages keeps the Ask option, which is reset once the
+	// transaction is accepted.
+	confirmed   sync.Map
+	declined    sync.Map
+	stdin       *bufio.Scanner
+	askPackages bool
+
+	// symlinks are the symlinks created by the installer,
+	// path to the name of the owning package
+	symlinks sync.Map
+
+	// TraceID identifies the last operation in the tracing backend,
+	// it is empty if tracing is disabled
+	TraceID  string
+	traceCtx context.Context
+
+	// snapshotting is set while an operation runs on a snapshot, see snapshot
+	snapshotting bool
+
+	// fallbacks are the synced repositories of the fallback chain
+	fallbacks sync.Map
 }
 
 type ArtifactMatch struct {
 	Package    *types.Package
 	Artifact   *artifact.PackageArtifact
 	Repository Repository
+
+	// planOrder is the position of the package in the plan
+	// returned by the PostSolveHook, 0 if not set
+	planOrder int
 }
 
 func NewLuetInstaller(opts LuetInstallerOptions) *LuetInstaller {
-	return &LuetInstaller{Options: opts}
+	return &LuetInstaller{Options: opts, DryRunPlan: &DryRunPlan{}, askPackages: opts.Ask}
+}
+
+// resolver returns the package resolver selected by the solver options.
+// The grpc resolver connects to the plugin set in the luet config.
+func (l *LuetInstaller) resolver() types.PackageResolver {
+	if l.Options.SolverOptions.Type == solver.GRPCResolverType {
+		return solver.NewConflictResolver(
+			l.Options.SolverOptions.ConflictResolutionStrategy,
+			solver.NewGRPCResolver(l.Options.Context.GetConfig().CustomSolverPlugin),
+		)
+	}
+	return solver.NewSolverFromOptions(l.Options.SolverOptions)
+}
+
+// syncDatabase copies the repositories packages in d, dropping the
+// ones not matching the annotation filters and the suppressed provides
+func (l *LuetInstaller) syncDatabase(syncedRepos Repositories, d types.PackageDatabase) {
+	cfg := l.Options.Context.GetConfig()
+	if len(cfg.SkipProvides) == 0 {
+		syncedRepos.SyncDatabase(d)
+	} else {
+		// Provides are indexed on creation, strip them beforehand
+		all := pkg.NewInMemoryDatabase(false)
+		syncedRepos.SyncDatabase(all)
+		for _, p := range all.World() {
+			d.CreatePackage(cfg.StripProvides(p))
+		}
+	}
+
+	if len(cfg.AnnotationFilters) == 0 {
+		return
+	}
+	for _, p := range d.World() {
+		if !cfg.MatchAnnotationFilters(p) {
+			l.Options.Context.Debug("Excluding", p.HumanReadableString(), "by annotation filters")
+			d.RemovePackage(p)
+		}
+	}
 }
 
 // computeUpgrade returns the packages to be uninstalled and installed in a system to perform an upgrade
@@ -84,23 +162,27 @@ func (l *LuetInstaller) computeUpgrade(syncedRepos Repositories, s *System) (typ
 	var err error
 	// First match packages against repositories by priority
 	allRepos := pkg.NewInMemoryDatabase(false)
-	syncedRepos.SyncDatabase(allRepos)
+	l.syncDatabase(syncedRepos, allRepos)
 	// compute a "big" world
 	solv := solver.NewResolver(
 		types.SolverOptions{
-			Type:        l.Options.SolverOptions.Implementation,
-			Concurrency: l.Options.Concurrency},
+			Type:           l.Options.SolverOptions.Implementation,
+			Concurrency:    l.Options.Concurrency,
+			BacktrackLimit: l.Options.SolverOptions.BacktrackLimit},
 		s.Database, allRepos, pkg.NewInMemoryDatabase(false),
-		solver.NewSolverFromOptions(l.Options.SolverOptions))
+		l.resolver())
 	var solution types.PackagesAssertions
 
+	endSolve := l.span("solve")
 	if l.Options.SolverUpgrade {
 		uninstall, solution, err = solv.UpgradeUniverse(l.Options.RemoveUnavailableOnUpgrade)
+		endSolve(&err)
 		if err != nil {
 			return uninstall, toInstall, errors.Wrap(err, "Failed solving solution for upgrade")
 		}
 	} else {
 		uninstall, solution, err = solv.Upgrade(l.Options.FullUninstall, true)
+		endSolve(&err)
 		if err != nil {
 			return uninstall, toInstall, errors.Wrap(err, "Failed solving solution for upgrade")
 		}
@@ -133,12 +215,20 @@ func (l *LuetInstaller) computeUpgrade(syncedRepos Repositories, s *System) (typ
 		}
 	}
 
+	uninstall, toInstall = l.skipHeld(uninstall, toInstall)
 	return uninstall, toInstall, nil
 }
 
 // Upgrade upgrades a System based on the Installer options. Returns error in case of failure
-func (l *LuetInstaller) Upgrade(s *System) error {
+func (l *LuetInstaller) Upgrade(s *System) (err error) {
+	defer l.trace("upgrade")(&err)
+	rollback, err := l.snapshot(s)
+	if err != nil {
+		return err
+	}
+	defer rollback(&err)
 	l.Options.Context.Screen("Upgrade")
+	defer l.printDryRunPlan()
 	syncedRepos, err := l.SyncRepositories()
 	if err != nil {
 		return err
@@ -149,18 +239,39 @@ func (l *LuetInstaller) Upgrade(s *System) error {
 		l.Options.Context.Info(":memo: note: will consider new build revisions while upgrading")
 	}
 
-	return l.checkAndUpgrade(syncedRepos, s)
+	if err := l.checkAndUpgrade(syncedRepos, s); err != nil {
+		return err
+	}
+
+	if l.Options.Context.GetConfig().PackageRetentionPolicy.Enabled() && !l.dryRun() {
+		freed, err := l.ApplyRetentionPolicy()
+		if err != nil {
+			l.Options.Context.Warning("Failed applying the retention policy:", err.Error())
+		} else if freed > 0 {
+			l.Options.Context.Info(fmt.Sprintf("Retention policy freed %d bytes from the packages cache", freed))
+		}
+	}
+	return nil
 }
 
+// SyncRepositories syncs the enabled repositories. In dry run mode the
+// cached data is only read and nothing is written to the system.
 func (l *LuetInstaller) SyncRepositories() (Repositories, error) {
+	return l.syncRepositories(l.dryRun())
+}
+
+// syncRepositories syncs the enabled repositories without writing
+// them to the system when readOnly is set
+func (l *LuetInstaller) syncRepositories(readOnly bool) (Repositories, error) {
 	l.Options.Context.Spinner()
 	defer l.Options.Context.SpinnerStop()
 
 	var errs error
 	syncedRepos := Repositories{}
 
-	for _, r := range SystemRepositories(l.Options.PackageRepositories) {
-		repo, err := r.Sync(l.Options.Context, false)
+	cfg := l.Options.Context.GetConfig()
+	for _, r := range SystemRepositories(l.Options.PackageRepositories, cfg.GetSystemArch()) {
+		repo, err := r.sync(l.Options.Context, false, readOnly)
 		if err == nil {
 			syncedRepos = append(syncedRepos, repo)
 		} else {
@@ -174,7 +285,14 @@ func (l *LuetInstaller) SyncRepositories() (Repositories, error) {
 	return syncedRepos, errs
 }
 
-func (l *LuetInstaller) Swap(toRemove types.Packages, toInstall types.Packages, s *System) error {
+func (l *LuetInstaller) Swap(toRemove types.Packages, toInstall types.Packages, s *System) (err error) {
+	defer l.trace("swap")(&err)
+	rollback, err := l.snapshot(s)
+	if err != nil {
+		return err
+	}
+	defer rollback(&err)
+	defer l.printDryRunPlan()
 	syncedRepos, err := l.SyncRepositories()
 	if err != nil {
 		return err
@@ -202,17 +320,17 @@ func (l *LuetInstaller) Swap(toRemove types.Packages, toInstall types.Packages,
 	return l.swap(o, syncedRepos, toRemoveFinal, toInstall, s)
 }
 
-func (l *LuetInstaller) computeSwap(o Option, syncedRepos Repositories, toRemove types.Packages, toInstall types.Packages, s *System) (map[string]ArtifactMatch, types.Packages, types.PackagesAssertions, types.PackageDatabase, error) {
+func (l *LuetInstaller) computeSwap(o Option, syncedRepos Repositories, toRemove types.Packages, toInstall types.Packages, s *System) (map[string]ArtifactMatch, types.Packages, types.Packages, types.PackagesAssertions, types.PackageDatabase, error) {
 
 	allRepos := pkg.NewInMemoryDatabase(false)
-	syncedRepos.SyncDatabase(allRepos)
+	l.syncDatabase(syncedRepos, allRepos)
 
 	toInstall = syncedRepos.ResolveSelectors(toInstall)
 
 	// First check what would have been done
 	installedtmp, err := s.Database.Copy()
 	if err != nil {
-		return nil, nil, nil, nil, errors.Wrap(err, "Failed create temporary in-memory db")
+		return nil, nil, nil, nil, nil, errors.Wrap(err, "Failed create temporary in-memory db")
 	}
 
 	systemAfterChanges := &System{Database: installedtmp}
@@ -220,29 +338,44 @@ func (l *LuetInstaller) computeSwap(o Option, syncedRepos Repositories, toRemove
 	packs, err := l.computeUninstall(o, systemAfterChanges, toRemove...)
 	if err != nil && !o.Force {
 		l.Options.Context.Error("Failed computing uninstall for ", packsToList(toRemove))
-		return nil, nil, nil, nil, errors.Wrap(err, "computing uninstall "+packsToList(toRemove))
+		return nil, nil, nil, nil, nil, errors.Wrap(err, "computing uninstall "+packsToList(toRemove))
 	}
 	for _, p := range packs {
 		err = systemAfterChanges.Database.RemovePackage(p)
 		if err != nil {
-			return nil, nil, nil, nil, errors.Wrap(err, "Failed removing package from database")
+			return nil, nil, nil, nil, nil, errors.Wrap(err, "Failed removing package from database")
 		}
 	}
 
 	match, packages, assertions, allRepos, err := l.computeInstall(o, syncedRepos, toInstall, systemAfterChanges)
+	if err != nil {
+		return match, toRemove, packages, assertions, allRepos, err
+	}
 	for _, p := range toInstall {
 		assertions = append(assertions, types.PackageAssert{Package: p, Value: true})
 	}
-	return match, packages, assertions, allRepos, err
+
+	match, toRemove, err = l.postSolve(syncedRepos, match, toRemove, systemAfterChanges)
+	packages, assertions = withPlanned(match, packages, assertions)
+	return match, toRemove, packages, assertions, allRepos, err
 }
 
 func (l *LuetInstaller) swap(o Option, syncedRepos Repositories, toRemove types.Packages, toInstall types.Packages, s *System) error {
 
-	match, packages, assertions, allRepos, err := l.computeSwap(o, syncedRepos, toRemove, toInstall, s)
+	match, toRemove, packages, assertions, allRepos, err := l.computeSwap(o, syncedRepos, toRemove, toInstall, s)
 	if err != nil {
 		return errors.Wrap(err, "failed computing package replacement")
 	}
 
+	if l.dryRun() {
+		l.planPackages(DryRunRemove, toRemove, "replaced")
+		l.planMatches(DryRunInstall, match, toInstall)
+		if toFinalize, err := l.getFinalizers(allRepos, assertions, match, o.NoDeps); err == nil {
+			l.planPackages(DryRunFinalize, toFinalize, "finalizer")
+		}
+		return nil
+	}
+
 	if l.Options.Ask {
 		// if len(toRemove) > 0 {
 		// 	l.Options.Context.Info(":recycle: Packages that are going to be removed from the system:\n ", Yellow(packsToList(toRemove)).BgBlack().String())
@@ -257,13 +390,17 @@ func (l *LuetInstaller) swap(o Option, syncedRepos Repositories, toRemove types.
 		printMatchUpgrade(match, toRemove)
 
 		l.Options.Context.Info("By going forward, you are also accepting the licenses of the packages that you are going to install in your system.")
-		if l.Options.Context.Ask() {
+		if l.ask() {
 			l.Options.Ask = false // Don't prompt anymore
 		} else {
 			return errors.New("Aborted by user")
 		}
 	}
 
+	if err := l.preInstall(match, s); err != nil {
+		return err
+	}
+
 	// First match packages against repositories by priority
 	if err := l.download(syncedRepos, match); err != nil {
 		return errors.Wrap(err, "Pre-downloading packages")
@@ -281,13 +418,15 @@ func (l *LuetInstaller) swap(o Option, syncedRepos Repositories, toRemove types.
 		return nil
 	}
 
+	progress := types.NewInstallProgress(l.Options.Context.GetConfig().System.InstallProgressCallback, len(match))
 	ops, err := l.generateRunOps(toRemove, match, Option{
 		Force:              o.Force,
 		NoDeps:             false,
 		OnlyDeps:           o.OnlyDeps,
 		RunFinalizers:      false,
 		CheckFileConflicts: false,
-	}, o, syncedRepos, packages, assertions, allRepos, s)
+		InTransaction:      true,
+	}, o, syncedRepos, packages, assertions, allRepos, s, progress)
 	if err != nil {
 		return errors.Wrap(err, "failed computing installer options")
 	}
@@ -297,12 +436,22 @@ func (l *LuetInstaller) swap(o Option, syncedRepos Repositories, toRemove types.
 		return errors.Wrap(err, "failed running installer options")
 	}
 
+	l.dropDeclined(match)
+
+	if err := l.updateAlternatives(match, toRemove, s); err != nil {
+		return err
+	}
+
+	if err := l.writeInstallManifest(match, s); err != nil {
+		return err
+	}
+
 	toFinalize, err := l.getFinalizers(allRepos, assertions, match, o.NoDeps)
 	if err != nil {
 		return errors.Wrap(err, "failed getting package to finalize")
 	}
 
-	return s.ExecuteFinalizers(l.Options.Context, toFinalize)
+	return l.executeFinalizers(toFinalize, s)
 }
 
 type Option struct {
@@ -315,6 +464,11 @@ type Option struct {
 	RunFinalizers      bool
 
 	CheckFileConflicts bool
+
+	// InTransaction is set when the caller runs the preInstall,
+	// alternatives and manifest steps and tracks the install
+	// progress once for a bigger transaction, as swap does
+	InTransaction bool
 }
 
 type operation struct {
@@ -329,6 +483,7 @@ type installOperation struct {
 	Assertions  types.PackagesAssertions
 	Database    types.PackageDatabase
 	Matches     map[string]ArtifactMatch
+	Progress    *types.InstallProgress
 }
 
 // installerOp is the operation that is sent to the
@@ -350,13 +505,19 @@ func (l *LuetInstaller) runOps(ops []installerOp, s *System) error {
 		go l.installerOpWorker(i, wg, systemLock, all, s)
 	}
 
+	parent := l.parentContext()
+OPS:
 	for _, c := range ops {
-		all <- c
+		select {
+		case all <- c:
+		case <-parent.Done():
+			break OPS
+		}
 	}
 	close(all)
 	wg.Wait()
 
-	return nil
+	return parent.Err()
 }
 
 // TODO: use installerOpWorker in place of all the other workers.
@@ -385,7 +546,30 @@ func (l *LuetInstaller) installerOpWorker(i int, wg *sync.WaitGroup, systemLock
 			}
 		}
 
+		// Ask before replacing anything, declined packages keep the installed version
+		declined := map[string]bool{}
+		systemLock.Lock()
+		for _, pp := range p.Install {
+			if !l.confirmInstall(pp.Package) {
+				declined[pp.Package.GetPackageName()] = true
+				l.declined.Store(pp.Package.GetFingerPrint(), true)
+				pp.Progress.Step(pp.Package.HumanReadableString())
+			}
+		}
+		systemLock.Unlock()
+
+		// Upgraded dependencies stay marked as such
+		dependencies := map[string]bool{}
+		for _, pp := range p.Uninstall {
+			if installed, err := s.Database.FindPackage(pp.Package); err == nil && isDependency(installed) {
+				dependencies[installed.GetPackageName()] = true
+			}
+		}
+
 		for _, pp := range p.Uninstall {
+			if declined[pp.Package.GetPackageName()] {
+				continue
+			}
 
 			l.Options.Context.Debug("Replacing package inplace")
 			toUninstall, uninstall, err := l.generateUninstallFn(pp.Option, s, installedFiles, pp.Package)
@@ -403,6 +587,9 @@ func (l *LuetInstaller) installerOpWorker(i int, wg *sync.WaitGroup, systemLock
 			}
 		}
 		for _, pp := range p.Install {
+			if declined[pp.Package.GetPackageName()] {
+				continue
+			}
 			artMatch := pp.Matches[pp.Package.GetFingerPrint()]
 			ass := pp.Assertions.Search(pp.Package.GetFingerPrint())
 			packageToInstall, _ := pp.Packages.Find(pp.Package.GetPackageName())
@@ -416,7 +603,11 @@ func (l *LuetInstaller) installerOpWorker(i int, wg *sync.WaitGroup, systemLock
 				types.PackagesAssertions{*ass},
 				pp.Database,
 				s,
+				pp.Progress,
 			)
+			if err == nil && dependencies[packageToInstall.GetPackageName()] {
+				err = markDependency(s, packageToInstall)
+			}
 			systemLock.Unlock()
 			if err != nil {
 				l.Options.Context.Error(err)
@@ -430,14 +621,16 @@ func (l *LuetInstaller) installerOpWorker(i int, wg *sync.WaitGroup, systemLock
 // checks wheter we can uninstall and install in place and compose installer worker ops
 func (l *LuetInstaller) generateRunOps(
 	toUninstall types.Packages, installMatch map[string]ArtifactMatch, installOpt, uninstallOpt Option,
-	syncedRepos Repositories, toInstall types.Packages, solution types.PackagesAssertions, allRepos types.PackageDatabase, s *System) (resOps []installerOp, err error) {
+	syncedRepos Repositories, toInstall types.Packages, solution types.PackagesAssertions, allRepos types.PackageDatabase, s *System,
+	progress *types.InstallProgress) (resOps []installerOp, err error) {
 
 	uOpts := []operation{}
 	for _, u := range toUninstall {
 		uOpts = append(uOpts, operation{Package: u, Option: uninstallOpt})
 	}
+	cfg := l.Options.Context.GetConfig()
 	iOpts := []installOperation{}
-	for _, u := range installMatch {
+	for _, u := range orderedMatches(installMatch, cfg.GetPackageInstallOrder()) {
 		iOpts = append(iOpts, installOperation{
 			operation: operation{
 				Package: u.Package,
@@ -448,6 +641,7 @@ func (l *LuetInstaller) generateRunOps(
 			Reposiories: syncedRepos,
 			Assertions:  solution,
 			Database:    allRepos,
+			Progress:    progress,
 		})
 	}
 	resOps = append(resOps, installerOp{
@@ -488,9 +682,9 @@ func (l *LuetInstaller) checkAndUpgrade(r Repositories, s *System) error {
 		OnlyDeps:           false,
 	}
 
-	if l.Options.Ask {
+	if l.Options.Ask && !l.dryRun() {
 		l.Options.Context.Info("By going forward, you are also accepting the licenses of the packages that you are going to install in your system.")
-		if l.Options.Context.Ask() {
+		if l.ask() {
 			l.Options.Ask = false // Don't prompt anymore
 			return l.swap(o, r, uninstall, toInstall, s)
 		} else {
@@ -528,8 +722,15 @@ func (l *LuetInstaller) checkAndUpgrade(r Repositories, s *System) error {
 	return err
 }
 
-func (l *LuetInstaller) Install(cp types.Packages, s *System) error {
+func (l *LuetInstaller) Install(cp types.Packages, s *System) (err error) {
+	defer l.trace("install")(&err)
+	rollback, err := l.snapshot(s)
+	if err != nil {
+		return err
+	}
+	defer rollback(&err)
 	l.Options.Context.Screen("Install")
+	defer l.printDryRunPlan()
 	syncedRepos, err := l.SyncRepositories()
 	if err != nil {
 		return err
@@ -606,32 +807,46 @@ func (l *LuetInstaller) Install(cp types.Packages, s *System) error {
 		}
 	}
 
+	match, toRemove, err := l.postSolve(syncedRepos, match, nil, s)
+	if err != nil {
+		return err
+	}
+	packages, assertions = withPlanned(match, packages, assertions)
+
 	// Check if we have to process something, or return to the user an error
 	if len(match) == 0 {
 		l.Options.Context.Info("No packages to install")
 		if !solver.IsRelaxedResolver(l.Options.SolverOptions) && !allInstalled {
 			return fmt.Errorf("could not find packages to install from the repositories in the system")
 		}
-		return nil
+		if err := l.removePlanned(toRemove, s); err != nil {
+			return err
+		}
+		return l.markRequested(s, cp)
 	}
 
 	l.Options.Context.Info("Packages that are going to be installed in the system:")
 
 	printMatches(match)
 
-	if l.Options.Ask {
+	if l.Options.Ask && !l.dryRun() {
 		l.Options.Context.Info("By going forward, you are also accepting the licenses of the packages that you are going to install in your system.")
-		if l.Options.Context.Ask() {
-			l.Options.Ask = false // Don't prompt anymore
-			return l.install(o, syncedRepos, match, packages, assertions, allRepos, s)
-		} else {
+		if !l.ask() {
 			return errors.New("Aborted by user")
 		}
+		l.Options.Ask = false // Don't prompt anymore
+	}
+	if err := l.removePlanned(toRemove, s); err != nil {
+		return err
 	}
-	return l.install(o, syncedRepos, match, packages, assertions, allRepos, s)
+	if err := l.install(o, syncedRepos, match, packages, assertions, allRepos, s, nil); err != nil {
+		return err
+	}
+	return l.markRequested(s, cp)
 }
 
-func (l *LuetInstaller) download(syncedRepos Repositories, toDownload map[string]ArtifactMatch) error {
+func (l *LuetInstaller) download(syncedRepos Repositories, toDownload map[string]ArtifactMatch) (err error) {
+	defer l.span("download", attribute.Int("packages", len(toDownload)))(&err)
 
 	// Don't attempt to download stuff that is already in cache
 	missArtifacts := false
@@ -670,22 +885,45 @@ func (l *LuetInstaller) download(syncedRepos Repositories, toDownload map[string
 	}
 
 	// Download
+	var errs error
+	var errsLock sync.Mutex
 	for i := 0; i < l.Options.Concurrency; i++ {
 		wg.Add(1)
-		go l.downloadWorker(i, wg, pb, all, ctx)
+		go func(i int) {
+			defer wg.Done()
+			if err := l.downloadWorker(i, pb, all, ctx); err != nil {
+				errsLock.Lock()
+				errs = multierror.Append(errs, err)
+				errsLock.Unlock()
+			}
+		}(i)
 	}
+	parent := l.parentContext()
+DOWNLOAD:
 	for _, c := range toDownload {
-		all <- c
+		select {
+		case all <- c:
+		case <-parent.Done():
+			break DOWNLOAD
+		}
 	}
 	close(all)
 	wg.Wait()
+
+	if err := parent.Err(); err != nil {
+		return errors.Wrap(err, "download aborted")
+	}
+	if errs != nil && !l.Options.Force {
+		return errs
+	}
 	return nil
 }
 
 // Reclaim adds packages to the system database
 // if files from artifacts in the repositories are found
 // in the system target
-func (l *LuetInstaller) Reclaim(s *System) error {
+func (l *LuetInstaller) Reclaim(s *System) (err error) {
+	defer l.trace("reclaim")(&err)
 	syncedRepos, err := l.SyncRepositories()
 	if err != nil {
 		return err
@@ -733,6 +971,55 @@ func (l *LuetInstaller) Reclaim(s *System) error {
 	return nil
 }
 
+// Finalize runs the finalizers of the installed packages, or of all
+// the packages in the system if none is given. Finalizer definitions
+// are taken from the repositories trees.
+func (l *LuetInstaller) Finalize(packs types.Packages, s *System) (err error) {
+	defer l.trace("finalize")(&err)
+	defer l.printDryRunPlan()
+
+	syncedRepos, err := l.SyncRepositories()
+	if err != nil {
+		return err
+	}
+
+	if len(packs) == 0 {
+		packs = s.Database.World()
+	}
+
+	allRepos := pkg.NewInMemoryDatabase(false)
+	l.syncDatabase(syncedRepos, allRepos)
+
+	toFinalize := map[string]ArtifactMatch{}
+	solution := types.PackagesAssertions{}
+	for _, p := range packs {
+		installed, err := s.Database.FindPackage(p)
+		if err != nil {
+			return errors.Wrapf(err, "package '%s' is not installed", p.HumanReadableString())
+		}
+		solution = append(solution, types.PackageAssert{Package: installed, Value: true})
+	REPOS:
+		for _, repo := range syncedRepos {
+			if treePackage, err := repo.GetTree().GetDatabase().FindPackage(installed); err == nil {
+				toFinalize[installed.GetFingerPrint()] = ArtifactMatch{Package: treePackage, Repository: repo}
+				break REPOS
+			}
+		}
+	}
+
+	ordered, err := OrderFinalizers(allRepos, toFinalize, solution)
+	if err != nil {
+		return errors.Wrap(err, "failed ordering finalizers")
+	}
+
+	if l.dryRun() {
+		l.planPackages(DryRunFinalize, ordered, "finalizer")
+		return nil
+	}
+
+	return l.executeFinalizers(ordered, s)
+}
+
 func (l *LuetInstaller) computeInstall(o Option, syncedRepos Repositories, cp types.Packages, s *System) (map[string]ArtifactMatch, types.Packages, types.PackagesAssertions, types.PackageDatabase, error) {
 	var p types.Packages
 	toInstall := map[string]ArtifactMatch{}
@@ -761,24 +1048,19 @@ func (l *LuetInstaller) computeInstall(o Option, syncedRepos Repositories, cp ty
 	//	matches := syncedRepos.PackageMatches(p)
 
 	// compute a "big" world
-	syncedRepos.SyncDatabase(allRepos)
+	l.syncDatabase(syncedRepos, allRepos)
 	p = syncedRepos.ResolveSelectors(p)
 	var packagesToInstall types.Packages
-	var err error
 
-	if !o.NoDeps {
-		solv := solver.NewResolver(types.SolverOptions{
-			Type:        l.Options.SolverOptions.Implementation,
-			Concurrency: l.Options.Concurrency},
-			s.Database, allRepos, pkg.NewInMemoryDatabase(false),
-			solver.NewSolverFromOptions(l.Options.SolverOptions),
-		)
+	installed, err := l.installedView(s, allRepos)
+	if err != nil {
+		return toInstall, p, solution, allRepos, err
+	}
 
-		if l.Options.Relaxed {
-			solution, err = solv.RelaxedInstall(p)
-		} else {
-			solution, err = solv.Install(p)
-		}
+	if !o.NoDeps {
+		endSolve := l.span("solve", attribute.Int("packages", len(p)))
+		solution, err = l.solveRetryingConflicts(syncedRepos, p, installed, allRepos)
+		endSolve(&err)
 		/// TODO: PackageAssertions needs to be a map[fingerprint]pack so lookup is in O(1)
 		if err != nil && !o.Force {
 			return toInstall, p, solution, allRepos, errors.Wrap(err, "Failed solving solution for package")
@@ -786,7 +1068,7 @@ func (l *LuetInstaller) computeInstall(o Option, syncedRepos Repositories, cp ty
 		// Gathers things to install
 		for _, assertion := range solution {
 			if assertion.Value {
-				if _, err := s.Database.FindPackage(assertion.Package); err == nil {
+				if _, err := installed.FindPackage(assertion.Package); err == nil {
 					// skip matching if it is installed already
 					continue
 				}
@@ -795,7 +1077,7 @@ func (l *LuetInstaller) computeInstall(o Option, syncedRepos Repositories, cp ty
 		}
 	} else if !o.OnlyDeps {
 		for _, currentPack := range p {
-			if _, err := s.Database.FindPackage(currentPack); err == nil {
+			if _, err := installed.FindPackage(currentPack); err == nil {
 				// skip matching if it is installed already
 				continue
 			}
@@ -804,28 +1086,95 @@ func (l *LuetInstaller) computeInstall(o Option, syncedRepos Repositories, cp ty
 	}
 	// Gathers things to install
 	for _, currentPack := range packagesToInstall {
-		// Check if package is already installed.
+		if err := l.matchArtifact(syncedRepos, currentPack, s, toInstall); err != nil {
+			return toInstall, p, solution, allRepos, err
+		}
+	}
 
-		matches := syncedRepos.PackageMatches(types.Packages{currentPack})
-		if len(matches) == 0 {
-			return toInstall, p, solution, allRepos, errors.New("Failed matching solutions against repository for " + currentPack.HumanReadableString() + " where are definitions coming from?!")
+	return toInstall, p, solution, allRepos, nil
+}
+
+// matchArtifact looks up the artifact of currentPack in the repositories,
+// adding it in toInstall if not installed already
+func (l *LuetInstaller) matchArtifact(syncedRepos Repositories, currentPack *types.Package, s *System, toInstall map[string]ArtifactMatch) error {
+	matches := syncedRepos.PackageMatches(types.Packages{currentPack})
+	if len(matches) == 0 {
+		return errors.New("Failed matching solutions against repository for " + currentPack.HumanReadableString() + " where are definitions coming from?!")
+	}
+
+	artefact, err := repositoryArtifact(matches[0].Repo, matches[0].Package)
+	if err != nil || artefact == nil {
+		return err
+	}
+	repo, artefact := l.pickMirror(syncedRepos, matches[0], artefact)
+
+	currentPack.SetBuildTimestamp(artefact.CompileSpec.GetPackage().GetBuildTimestamp())
+	// Filter out already installed
+	if _, err := s.Database.FindPackage(currentPack); err != nil {
+		toInstall[currentPack.GetFingerPrint()] = ArtifactMatch{Package: currentPack, Artifact: artefact, Repository: repo}
+	}
+	return nil
+}
+
+// repositoryArtifact returns the artifact of the package in the repository index, if any
+func repositoryArtifact(r *LuetSystemRepository, p *types.Package) (*artifact.PackageArtifact, error) {
+	for _, artefact := range r.GetIndex() {
+		if artefact.CompileSpec.GetPackage() == nil {
+			return nil, errors.New("Package in compilespec empty")
 		}
-	A:
-		for _, artefact := range matches[0].Repo.GetIndex() {
-			if artefact.CompileSpec.GetPackage() == nil {
-				return toInstall, p, solution, allRepos, errors.New("Package in compilespec empty")
-			}
-			if matches[0].Package.Matches(artefact.CompileSpec.GetPackage()) {
-				currentPack.SetBuildTimestamp(artefact.CompileSpec.GetPackage().GetBuildTimestamp())
-				// Filter out already installed
-				if _, err := s.Database.FindPackage(currentPack); err != nil {
-					toInstall[currentPack.GetFingerPrint()] = ArtifactMatch{Package: currentPack, Artifact: artefact, Repository: matches[0].Repo}
-				}
-				break A
-			}
+		if p.Matches(artefact.CompileSpec.GetPackage()) {
+			return artefact, nil
 		}
 	}
-	return toInstall, p, solution, allRepos, nil
+	return nil, nil
+}
+
+// pickMirror chooses by weight among the repositories with the priority of the
+// match which serve an identical artifact, see LuetConfig.PickRepository
+func (l *LuetInstaller) pickMirror(syncedRepos Repositories, match PackageMatch, a *artifact.PackageArtifact) (*LuetSystemRepository, *artifact.PackageArtifact) {
+	names := []string{match.Repo.GetName()}
+	mirrors := map[string]*LuetSystemRepository{match.Repo.GetName(): match.Repo}
+	artifacts := map[string]*artifact.PackageArtifact{match.Repo.GetName(): a}
+
+	for _, r := range syncedRepos {
+		if r == match.Repo || r.GetPriority() != match.Repo.GetPriority() {
+			continue
+		}
+		p, err := r.GetTree().GetDatabase().FindPackage(match.Package)
+		if err != nil {
+			continue
+		}
+		ra, err := repositoryArtifact(r, p)
+		if err != nil || ra == nil || !reflect.DeepEqual(ra.Checksums, a.Checksums) {
+			continue
+		}
+		names = append(names, r.GetName())
+		mirrors[r.GetName()] = r
+		artifacts[r.GetName()] = ra
+	}
+
+	if len(names) == 1 {
+		return match.Repo, a
+	}
+	cfg := l.Options.Context.GetConfig()
+	name := cfg.PickRepository(names)
+	if name == "" {
+		return match.Repo, a
+	}
+	return mirrors[name], artifacts[name]
+}
+
+// executeFinalizers runs the finalizers of the packages, unless
+// bootstrap mode is enabled
+func (l *LuetInstaller) executeFinalizers(toFinalize []*types.Package, s *System) (err error) {
+	defer l.span("finalize", attribute.Int("packages", len(toFinalize)))(&err)
+	if l.Options.Context.GetConfig().BootstrapMode {
+		if len(toFinalize) > 0 {
+			l.Options.Context.Info("Bootstrap mode enabled, skipping finalizers. Run 'luet finalize' once the rootfs is complete")
+		}
+		return nil
+	}
+	return s.ExecuteFinalizers(l.Options.Context, toFinalize)
 }
 
 func (l *LuetInstaller) getFinalizers(allRepos types.PackageDatabase, solution types.PackagesAssertions, toInstall map[string]ArtifactMatch, nodeps bool) ([]*types.Package, error) {
@@ -892,7 +1241,55 @@ func (l *LuetInstaller) checkFileconflicts(toInstall map[string]ArtifactMatch, c
 	return nil
 }
 
-func (l *LuetInstaller) install(o Option, syncedRepos Repositories, toInstall map[string]ArtifactMatch, p types.Packages, solution types.PackagesAssertions, allRepos types.PackageDatabase, s *System) error {
+// preInstall runs the checks gating the installation of the matches and
+// prepares the rootfs layout. Installs and swaps call it before removing
+// or writing anything in the system.
+func (l *LuetInstaller) preInstall(toInstall map[string]ArtifactMatch, s *System) error {
+	if err := l.CheckInstallFootprint(toInstall); err != nil {
+		return err
+	}
+
+	if err := l.CheckStorageQuota(toInstall); err != nil {
+		return err
+	}
+
+	l.securityWarnings(matchedPackages(toInstall))
+
+	if err := l.askConsent(toInstall); err != nil {
+		return err
+	}
+
+	if err := l.peerReview(toInstall); err != nil {
+		return err
+	}
+
+	if l.Options.DownloadOnly {
+		return nil
+	}
+
+	return errors.Wrap(l.prepareLayout(s), "while preparing the rootfs layout")
+}
+
+// install installs the matches in the system. The install steps are reported
+// to progress when installing in a transaction, otherwise to a new tracker.
+func (l *LuetInstaller) install(o Option, syncedRepos Repositories, toInstall map[string]ArtifactMatch, p types.Packages, solution types.PackagesAssertions, allRepos types.PackageDatabase, s *System, progress *types.InstallProgress) (err error) {
+	defer l.snapshotEnvironmentOnFailure(toInstall, &err)
+
+	if l.dryRun() {
+		l.planMatches(DryRunInstall, toInstall, p)
+		if o.RunFinalizers {
+			if toFinalize, err := l.getFinalizers(allRepos, solution, toInstall, o.NoDeps); err == nil {
+				l.planPackages(DryRunFinalize, toFinalize, "finalizer")
+			}
+		}
+		return nil
+	}
+
+	if !o.InTransaction {
+		if err := l.preInstall(toInstall, s); err != nil {
+			return err
+		}
+	}
 
 	// Download packages in parallel first
 	if err := l.download(syncedRepos, toInstall); err != nil {
@@ -914,48 +1311,84 @@ func (l *LuetInstaller) install(o Option, syncedRepos Repositories, toInstall ma
 		return nil
 	}
 
-	all := make(chan ArtifactMatch)
-
-	wg := new(sync.WaitGroup)
 	installLock := &sync.Mutex{}
 
-	// Do the real install
-	for i := 0; i < l.Options.Concurrency; i++ {
-		wg.Add(1)
-		go l.installerWorker(i, wg, installLock, all, s)
+	cfg := l.Options.Context.GetConfig()
+	if !o.InTransaction {
+		progress = types.NewInstallProgress(cfg.System.InstallProgressCallback, len(toInstall))
 	}
 
-	for _, c := range toInstall {
-		all <- c
+	// Do the real install, a dependency layer at a time
+	parent := l.parentContext()
+	for _, layer := range installLayers(toInstall, cfg.GetPackageInstallOrder()) {
+		all := make(chan ArtifactMatch)
+		wg := new(sync.WaitGroup)
+		for i := 0; i < l.Options.Concurrency; i++ {
+			wg.Add(1)
+			go l.installerWorker(i, wg, installLock, all, s, progress)
+		}
+
+	INSTALL:
+		for _, c := range layer {
+			select {
+			case all <- c:
+			case <-parent.Done():
+				break INSTALL
+			}
+		}
+		close(all)
+		wg.Wait()
+
+		if parent.Err() != nil {
+			break
+		}
 	}
-	close(all)
-	wg.Wait()
+
+	if err := parent.Err(); err != nil {
+		return errors.Wrap(err, "install aborted")
+	}
+
+	l.dropDeclined(toInstall)
 
 	for _, c := range toInstall {
 		// Annotate to the system that the package was installed
-		_, err := s.Database.CreatePackage(c.Package)
+		cfg.AddMetadataExtras(c.Package)
+		pack := c.Package
+		if _, err := p.Find(pack.GetPackageName()); err != nil {
+			pack = asDependency(pack)
+		}
+		_, err := s.Database.CreatePackage(pack)
 		if err != nil && !o.Force {
 			return errors.Wrap(err, "Failed creating package")
 		}
 		bus.Manager.Publish(bus.EventPackageInstall, c)
 	}
 
-	if !o.RunFinalizers {
-		return nil
+	if !o.InTransaction {
+		if err := l.updateAlternatives(toInstall, nil, s); err != nil {
+			return err
+		}
 	}
 
-	toFinalize, err := l.getFinalizers(allRepos, solution, toInstall, o.NoDeps)
-	if err != nil {
-		return errors.Wrap(err, "failed getting package to finalize")
+	if o.RunFinalizers {
+		toFinalize, err := l.getFinalizers(allRepos, solution, toInstall, o.NoDeps)
+		if err != nil {
+			return errors.Wrap(err, "failed getting package to finalize")
+		}
+
+		if err := l.executeFinalizers(toFinalize, s); err != nil {
+			return err
+		}
 	}
 
-	return s.ExecuteFinalizers(l.Options.Context, toFinalize)
+	if o.InTransaction {
+		return nil
+	}
+	return l.writeInstallManifest(toInstall, s)
 }
 
 func (l *LuetInstaller) getPackage(a ArtifactMatch, ctx types.Context) (artifact *artifact.PackageArtifact, err error) {
-	cli := a.Repository.Client(ctx)
-
-	artifact, err = cli.DownloadArtifact(a.Artifact)
+	artifact, err = l.downloadArtifact(a, ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "Error on download artifact")
 	}
@@ -979,25 +1412,75 @@ func (l *LuetInstaller) installPackage(m ArtifactMatch, s *System) error {
 		return errors.Wrap(err, "Could not open package archive")
 	}
 
-	err = a.Unpack(l.Options.Context, s.Target, true)
+	cfg := l.Options.Context.GetConfig()
+	var filters []func(h *tar.Header) (bool, error)
+	excluded := func(f string) bool {
+		return cfg.IsFileExcluded(m.Package, f) || cfg.General.IsLocaleExcluded(f) || cfg.IsDocumentationStripped(f)
+	}
+	if len(cfg.GetExcludePatterns(m.Package)) > 0 || len(cfg.General.LocaleWhitelist) > 0 || cfg.DocumentationStrip {
+		filters = append(filters, func(h *tar.Header) (bool, error) {
+			return !excluded(h.Name), nil
+		})
+
+		installed := []string{}
+		for _, f := range files {
+			if !excluded(f) {
+				installed = append(installed, f)
+			}
+		}
+		files = installed
+	}
+
+	if len(cfg.GetLayoutMapping()) > 0 {
+		filters = append(filters, layoutFilter(&cfg))
+		for i := range files {
+			files[i] = cfg.MapLayoutPath(files[i])
+		}
+	}
+
+	endExtract := l.span("extract", attribute.String("package", m.Package.HumanReadableString()))
+	err = a.Unpack(l.Options.Context, s.Target, true, filters...)
+	endExtract(&err)
 	if err != nil && !l.Options.Force {
 		return errors.Wrap(err, "error met while unpacking package "+a.Path)
 	}
 
+	// Symlinks are tracked as package files, so they are removed on uninstall
+	links, err := l.createSymlinks(m.Package, s)
+	if err != nil && !l.Options.Force {
+		return errors.Wrap(err, "error met while creating symlinks for package "+m.Package.HumanReadableString())
+	}
+	files = append(files, links...)
+
 	// First create client and download
 	// Then unpack to system
-	return s.Database.SetPackageFiles(&types.PackageFile{PackageFingerprint: m.Package.GetFingerPrint(), Files: files})
+	if err := s.Database.SetPackageFiles(&types.PackageFile{PackageFingerprint: m.Package.GetFingerPrint(), Files: files}); err != nil {
+		return err
+	}
+	metrics.PackagesInstalled.Inc()
+	return nil
 }
 
-func (l *LuetInstaller) downloadWorker(i int, wg *sync.WaitGroup, pb *pterm.ProgressbarPrinter, c <-chan ArtifactMatch, ctx types.Context) error {
-	defer wg.Done()
+// parentContext returns the context luet operations are bound to
+func (l *LuetInstaller) parentContext() context.Context {
+	if l.traceCtx != nil {
+		return l.traceCtx
+	}
+	return l.Options.Context.GetConfig().General.GetParentContext()
+}
 
+// downloadWorker downloads the artifacts received from c into the cache.
+// Failures don't stop the worker, they are returned once c is drained.
+func (l *LuetInstaller) downloadWorker(i int, pb *pterm.ProgressbarPrinter, c <-chan ArtifactMatch, ctx types.Context) (errs error) {
 	for p := range c {
 		// TODO: Keep trace of what was added from the tar, and save it into system
-		_, err := l.getPackage(p, ctx)
+		a, err := l.getPackage(p, ctx)
+		if err == nil {
+			err = l.logChecksum(p, a, ctx)
+		}
 		if err != nil {
 			l.Options.Context.Error("Failed downloading package "+p.Package.GetName(), err.Error())
-			return errors.Wrap(err, "Failed downloading package "+p.Package.GetName())
+			errs = multierror.Append(errs, errors.Wrap(err, "Failed downloading package "+p.Package.GetName()))
 		} else {
 			l.Options.Context.Success(":package: Package ", p.Package.HumanReadableString(), "downloaded")
 		}
@@ -1006,15 +1489,21 @@ func (l *LuetInstaller) downloadWorker(i int, wg *sync.WaitGroup, pb *pterm.Prog
 		}
 	}
 
-	return nil
+	return errs
 }
 
-func (l *LuetInstaller) installerWorker(i int, wg *sync.WaitGroup, installLock *sync.Mutex, c <-chan ArtifactMatch, s *System) error {
+func (l *LuetInstaller) installerWorker(i int, wg *sync.WaitGroup, installLock *sync.Mutex, c <-chan ArtifactMatch, s *System, progress *types.InstallProgress) error {
 	defer wg.Done()
 
 	for p := range c {
 		// TODO: Keep trace of what was added from the tar, and save it into system
 		installLock.Lock()
+		if !l.confirmInstall(p.Package) {
+			installLock.Unlock()
+			l.declined.Store(p.Package.GetFingerPrint(), true)
+			progress.Step(p.Package.HumanReadableString())
+			continue
+		}
 		err := l.installPackage(p, s)
 		installLock.Unlock()
 		if err != nil && !l.Options.Force {
@@ -1027,6 +1516,7 @@ func (l *LuetInstaller) installerWorker(i int, wg *sync.WaitGroup, installLock *
 		} else if err != nil && l.Options.Force {
 			l.Options.Context.Info(":package: Package ", p.Package.HumanReadableString(), "installed with failures (forced install)")
 		}
+		progress.Step(p.Package.HumanReadableString())
 	}
 
 	return nil
@@ -1210,22 +1700,26 @@ func (l *LuetInstaller) computeUninstall(o Option, s *System, packs ...*types.Pa
 	if !o.NoDeps {
 		solv := solver.NewResolver(
 			types.SolverOptions{
-				Type:        l.Options.SolverOptions.Implementation,
-				Concurrency: l.Options.Concurrency,
+				Type:           l.Options.SolverOptions.Implementation,
+				Concurrency:    l.Options.Concurrency,
+				BacktrackLimit: l.Options.SolverOptions.BacktrackLimit,
 			},
 			installedtmp,
 			installedtmp,
 			pkg.NewInMemoryDatabase(false),
-			solver.NewSolverFromOptions(l.Options.SolverOptions))
+			l.resolver())
 		var solution types.Packages
 		var err error
+		endSolve := l.span("solve", attribute.Int("packages", len(packs)))
 		if o.FullCleanUninstall {
 			solution, err = solv.UninstallUniverse(packs)
+			endSolve(&err)
 			if err != nil {
 				return toUninstall, errors.Wrap(err, "Could not solve the uninstall constraints. Tip: try with --solver-type qlearning or with --force, or by removing packages excluding their dependencies with --nodeps")
 			}
 		} else {
 			solution, err = solv.Uninstall(checkConflicts, full, packs...)
+			endSolve(&err)
 			if err != nil && !l.Options.Force {
 				return toUninstall, errors.Wrap(err, "Could not solve the uninstall constraints. Tip: try with --solver-type qlearning or with --force, or by removing packages excluding their dependencies with --nodeps")
 			}
@@ -1289,8 +1783,15 @@ func (l *LuetInstaller) generateUninstallFn(o Option, s *System, filesToInstall
 	return toUninstall, uninstall, nil
 }
 
-func (l *LuetInstaller) Uninstall(s *System, packs ...*types.Package) error {
+func (l *LuetInstaller) Uninstall(s *System, packs ...*types.Package) (err error) {
+	defer l.trace("uninstall")(&err)
+	rollback, err := l.snapshot(s)
+	if err != nil {
+		return err
+	}
+	defer rollback(&err)
 	l.Options.Context.Screen("Uninstall")
+	defer l.printDryRunPlan()
 
 	l.Options.Context.Spinner()
 	o := Option{
@@ -1299,21 +1800,34 @@ func (l *LuetInstaller) Uninstall(s *System, packs ...*types.Package) error {
 		CheckConflicts:     l.Options.CheckConflicts,
 		FullCleanUninstall: l.Options.FullCleanUninstall,
 	}
-	toUninstall, uninstall, err := l.generateUninstallFn(o, s, map[string]interface{}{}, packs...)
+	toUninstall, uninstallFn, err := l.generateUninstallFn(o, s, map[string]interface{}{}, packs...)
 	if err != nil {
 		return errors.Wrap(err, "while computing uninstall")
 	}
 	l.Options.Context.SpinnerStop()
 
+	uninstall := func() error {
+		if err := uninstallFn(); err != nil {
+			return err
+		}
+		return l.autoRemove(s, toUninstall)
+	}
+
 	if len(toUninstall) == 0 {
 		l.Options.Context.Info("Nothing to do")
 		return nil
 	}
 
+	if l.dryRun() {
+		l.planPackages(DryRunRemove, toUninstall, "uninstall")
+		l.planPackages(DryRunRemove, l.plannedOrphans(s, toUninstall), "not required anymore")
+		return nil
+	}
+
 	if l.Options.Ask {
 		l.Options.Context.Info(":recycle: Packages that are going to be removed from the system:")
 		printList(toUninstall)
-		if l.Options.Context.Ask() {
+		if l.ask() {
 			l.Options.Ask = false // Don't prompt anymore
 			return uninstall()
 		} else {
@@ -0,0 +1,85 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mudler/luet/pkg/api/core/logger"
+	"github.com/mudler/luet/pkg/api/core/types"
+)
+
+func (l *LuetInstaller) interactiveInstall() bool {
+	return l.Options.Context.GetConfig().PackageInteractiveInstall && l.askPackages && logger.IsInputTerminal()
+}
+
+// confirmInstall prompts before extracting a package when interactive_install
+// is enabled. Packages are always accepted without a terminal or with --yes.
+// Packages are asked for once, swaps confirm them before removing the
+// replaced packages. Callers must hold the install lock, so prompts don't interleave.
+func (l *LuetInstaller) confirmInstall(p *types.Package) bool {
+	if !l.interactiveInstall() {
+		return true
+	}
+	if _, ok := l.confirmed.Load(p.GetFingerPrint()); ok {
+		return true
+	}
+
+	l.Options.Context.Info(fmt.Sprintf("Install %s? [Y/n]: ", p.HumanReadableString()))
+	answer, ok := l.readAnswer()
+	if !ok {
+		return false
+	}
+	switch answer {
+	case "", "y", "yes":
+		l.confirmed.Store(p.GetFingerPrint(), true)
+		return true
+	}
+	return false
+}
+
+// ask asks the user to confirm the operation. It shares readAnswer
+// with the other prompts, so buffered answers aren't lost.
+func (l *LuetInstaller) ask() bool {
+	l.Options.Context.Info("Do you want to continue with this operation? [y/N]: ")
+	answer, _ := l.readAnswer()
+	return answer == "y" || answer == "yes"
+}
+
+// readAnswer reads a line typed by the user, lowercased and trimmed.
+// It returns false once stdin is closed.
+func (l *LuetInstaller) readAnswer() (string, bool) {
+	if l.stdin == nil {
+		l.stdin = bufio.NewScanner(os.Stdin)
+	}
+	if !l.stdin.Scan() {
+		return "", false
+	}
+	return strings.ToLower(strings.TrimSpace(l.stdin.Text())), true
+}
+
+// dropDeclined removes the packages skipped by the user from the transaction
+func (l *LuetInstaller) dropDeclined(toInstall map[string]ArtifactMatch) {
+	for k, m := range toInstall {
+		if _, ok := l.declined.LoadAndDelete(m.Package.GetFingerPrint()); ok {
+			l.Options.Context.Warning("Package", m.Package.HumanReadableString(), "was skipped, packages depending on it might not work")
+			delete(toInstall, k)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pkg/errors"
+)
+
+// prepareLayout makes sure the rootfs follows the configured layout.
+// With usrmerge, /bin, /lib and /sbin are symlinked to their /usr equivalents.
+func (l *LuetInstaller) prepareLayout(s *System) error {
+	cfg := l.Options.Context.GetConfig()
+	if cfg.RootfsLayout != types.RootfsLayoutUsrMerge {
+		return nil
+	}
+
+	for from, to := range types.UsrMergeMapping {
+		link := filepath.Join(s.Target, from)
+		if err := os.MkdirAll(filepath.Join(s.Target, to), os.ModePerm); err != nil {
+			return errors.Wrapf(err, "while creating %s", to)
+		}
+
+		fi, err := os.Lstat(link)
+		switch {
+		case err == nil && fi.Mode()&os.ModeSymlink != 0:
+			continue
+		case err == nil:
+			return errors.Errorf("rootfs is not usrmerged: /%s is not a symlink", from)
+		case !os.IsNotExist(err):
+			return err
+		}
+
+		target, err := filepath.Rel(filepath.Dir(link), filepath.Join(s.Target, to))
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(target, link); err != nil {
+			return errors.Wrapf(err, "while creating symlink /%s", from)
+		}
+		l.Options.Context.Debug("Created usrmerge symlink", "/"+from, "->", target)
+	}
+	return nil
+}
+
+// layoutFilter redirects the archive entries according to the layout mapping
+func layoutFilter(cfg *types.LuetConfig) func(h *tar.Header) (bool, error) {
+	return func(h *tar.Header) (bool, error) {
+		h.Name = cfg.MapLayoutPath(h.Name)
+		switch h.Typeflag {
+		case tar.TypeLink:
+			h.Linkname = cfg.MapLayoutPath(h.Linkname)
+		case tar.TypeSymlink:
+			if strings.HasPrefix(h.Linkname, "/") {
+				h.Linkname = cfg.MapLayoutPath(h.Linkname)
+			}
+		}
+		return true, nil
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/mudler/luet/pkg/api/core/types/artifact"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rootfs layout", func() {
+	var dir, fakeroot string
+	var repo *LuetSystemRepository
+	var packs types.Packages
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "layout")
+		Expect(err).ToNot(HaveOccurred())
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		packs = writeArtifacts(dir, 1)
+
+		// Ship a binary in /bin
+		src := filepath.Join(dir, "src", "p0")
+		Expect(os.MkdirAll(filepath.Join(src, "bin"), os.ModePerm)).ToNot(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(src, "bin", "tool"), []byte("tool"), 0755)).ToNot(HaveOccurred())
+		p := &types.Package{Category: "test", Name: "p0", Version: "1.0", Path: filepath.Join(dir, "tree", "test", "p0")}
+		a := artifact.NewPackageArtifact(filepath.Join(repodir, p.GetFingerPrint()+".package.tar"))
+		Expect(a.Compress(src, 1)).ToNot(HaveOccurred())
+		a.CompileSpec = &types.LuetCompilationSpec{Package: p}
+		Expect(a.WriteYAML(repodir)).ToNot(HaveOccurred())
+
+		repo, err = GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+		fakeroot = filepath.Join(dir, "root")
+		Expect(os.MkdirAll(fakeroot, os.ModePerm)).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	install := func(layout string, mapping map[string]string) (*System, error) {
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		ctx.Config.RootfsLayout = layout
+		ctx.Config.LayoutMapping = mapping
+
+		inst := NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 1, Context: ctx,
+			PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+		})
+
+		system := &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+		return system, inst.Install(packs, system)
+	}
+
+	It("links /bin to /usr/bin with usrmerge", func() {
+		system, err := install(types.RootfsLayoutUsrMerge, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		link, err := os.Readlink(filepath.Join(fakeroot, "bin"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(link).To(Equal("usr/bin"))
+		Expect(filepath.Join(fakeroot, "usr", "bin", "tool")).To(BeARegularFile())
+
+		files, err := system.Database.GetPackageFiles(packs[0])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(ContainElement("usr/bin/tool"))
+	})
+
+	It("refuses a rootfs which is not usrmerged", func() {
+		Expect(os.MkdirAll(filepath.Join(fakeroot, "bin"), os.ModePerm)).ToNot(HaveOccurred())
+		_, err := install(types.RootfsLayoutUsrMerge, nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("redirects paths with a custom layout", func() {
+		_, err := install(types.RootfsLayoutCustom, map[string]string{"/bin": "/opt/tools/bin"})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(filepath.Join(fakeroot, "opt", "tools", "bin", "tool")).To(BeARegularFile())
+		Expect(filepath.Join(fakeroot, "p0")).To(BeARegularFile())
+		Expect(filepath.Join(fakeroot, "bin")).ToNot(BeAnExistingFile())
+	})
+})
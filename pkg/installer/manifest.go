@@ -0,0 +1,112 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// ManifestEntry is a document of the install manifest,
+// recording the packages installed by a transaction
+type ManifestEntry struct {
+	Timestamp time.Time         `yaml:"timestamp"`
+	Packages  []ManifestPackage `yaml:"packages"`
+}
+
+// ManifestPackage is a package installed by a transaction
+type ManifestPackage struct {
+	Category   string            `yaml:"category"`
+	Name       string            `yaml:"name"`
+	Version    string            `yaml:"version"`
+	Repository string            `yaml:"repository,omitempty"`
+	Checksums  map[string]string `yaml:"checksums,omitempty"`
+}
+
+// ReadInstallManifest reads all the entries of an install manifest
+func ReadInstallManifest(path string) ([]ManifestEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []ManifestEntry{}
+	dec := yaml.NewDecoder(f)
+	for {
+		e := ManifestEntry{}
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid install manifest %s", path)
+		}
+		entries = append(entries, e)
+	}
+}
+
+// writeInstallManifest appends the matches installed in the system
+// to the install manifest, if enabled
+func (l *LuetInstaller) writeInstallManifest(matches map[string]ArtifactMatch, s *System) error {
+	cfg := l.Options.Context.GetConfig()
+	if !cfg.InstallManifest.Enabled || len(matches) == 0 {
+		return nil
+	}
+
+	e := ManifestEntry{Timestamp: time.Now().UTC()}
+	for _, m := range matches {
+		if _, err := s.Database.FindPackage(m.Package); err != nil {
+			continue
+		}
+		p := ManifestPackage{Category: m.Package.GetCategory(), Name: m.Package.GetName(), Version: m.Package.GetVersion()}
+		if m.Repository != nil {
+			p.Repository = m.Repository.GetName()
+		}
+		if m.Artifact != nil && len(m.Artifact.Checksums) > 0 {
+			p.Checksums = m.Artifact.Checksums
+		}
+		e.Packages = append(e.Packages, p)
+	}
+	if len(e.Packages) == 0 {
+		return nil
+	}
+	sort.Slice(e.Packages, func(i, j int) bool {
+		return e.Packages[i].Category+"/"+e.Packages[i].Name < e.Packages[j].Category+"/"+e.Packages[j].Name
+	})
+
+	dat, err := yaml.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cfg.InstallManifest.Path), os.ModePerm); err != nil {
+		return errors.Wrap(err, "while writing the install manifest")
+	}
+	f, err := os.OpenFile(cfg.InstallManifest.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "while writing the install manifest")
+	}
+	defer f.Close()
+	_, err = f.Write(append([]byte("---\n"), dat...))
+	return err
+}
@@ -0,0 +1,127 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Install manifest", func() {
+	It("appends a document for each transaction", func() {
+		dir, err := ioutil.TempDir("", "manifest")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		packs := writeArtifacts(dir, 3)
+
+		repo, err := GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+		manifest := filepath.Join(dir, "audit", "manifest.yaml")
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		ctx.Config.InstallManifest = types.LuetInstallManifest{Enabled: true, Path: manifest}
+
+		inst := NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 1, Context: ctx,
+			PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+		})
+
+		system := &System{Database: pkg.NewInMemoryDatabase(false), Target: filepath.Join(dir, "root")}
+		Expect(inst.Install(packs[:2], system)).ToNot(HaveOccurred())
+		Expect(inst.Install(packs[2:], system)).ToNot(HaveOccurred())
+
+		entries, err := ReadInstallManifest(manifest)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Packages).To(HaveLen(2))
+		Expect(entries[0].Timestamp.IsZero()).To(BeFalse())
+
+		p := entries[0].Packages[0]
+		Expect(p.Category + "/" + p.Name + "@" + p.Version).To(Equal("test/p0@1.0"))
+		Expect(p.Repository).To(Equal("test"))
+		Expect(p.Checksums).ToNot(BeEmpty())
+		Expect(entries[1].Packages[0].Name).To(Equal("p2"))
+	})
+
+	It("records upgrades", func() {
+		dir, err := ioutil.TempDir("", "manifest")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		writeArtifacts(dir, 1)
+
+		repo, err := GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+		manifest := filepath.Join(dir, "audit", "manifest.yaml")
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		ctx.Config.InstallManifest = types.LuetInstallManifest{Enabled: true, Path: manifest}
+
+		inst := NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 1, Context: ctx,
+			PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+		})
+
+		system := &System{Database: pkg.NewInMemoryDatabase(false), Target: filepath.Join(dir, "root")}
+		_, err = system.Database.CreatePackage(&types.Package{Category: "test", Name: "p0", Version: "0.9"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(inst.Upgrade(system)).ToNot(HaveOccurred())
+
+		entries, err := ReadInstallManifest(manifest)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Packages).To(HaveLen(1))
+		Expect(entries[0].Packages[0].Version).To(Equal("1.0"))
+	})
+})
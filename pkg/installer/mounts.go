@@ -0,0 +1,115 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/containerd/continuity/fs"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pkg/errors"
+)
+
+// readOnlyMount is a host path bind mounted read-only into the rootfs.
+// created is the topmost mountpoint component missing in the rootfs.
+type readOnlyMount struct {
+	target, created string
+}
+
+// mountpoint creates the target of a bind mount of src, returning
+// the topmost path which had to be created, if any
+func mountpoint(src, target string) (string, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return "", err
+	}
+
+	created := ""
+	for p := target; ; p = filepath.Dir(p) {
+		if _, err := os.Lstat(p); err == nil {
+			break
+		}
+		created = p
+	}
+
+	if info.IsDir() {
+		return created, os.MkdirAll(target, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return created, err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE, 0644)
+	if err != nil {
+		return created, err
+	}
+	return created, f.Close()
+}
+
+// mountReadOnly bind mounts the rootfs_ro_mounts host paths read-only
+// into the rootfs, returning a function undoing them. Missing host
+// paths are skipped.
+func (s *System) mountReadOnly(ctx types.Context) (func(), error) {
+	cfg := ctx.GetConfig()
+	mounts := []readOnlyMount{}
+	unmount := func() {
+		for i := len(mounts) - 1; i >= 0; i-- {
+			m := mounts[i]
+			ctx.Debug("Unmounting", m.target)
+			if err := unmountReadOnly(m.target); err != nil {
+				ctx.Warning("Failed unmounting", m.target+":", err.Error())
+				continue
+			}
+			// Drop the mountpoints created, unless the finalizers used them
+			for p := m.target; m.created != ""; p = filepath.Dir(p) {
+				if os.Remove(p) != nil || p == m.created {
+					break
+				}
+			}
+		}
+	}
+
+	if s.Target == "" || filepath.Clean(s.Target) == string(os.PathSeparator) {
+		return unmount, nil
+	}
+
+	for _, src := range cfg.RootfsReadOnlyMounts {
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			ctx.Warning("Host path", src, "doesn't exist, not mounting it in the rootfs")
+			continue
+		}
+
+		// Symlinks in the rootfs are resolved inside of it
+		target, err := fs.RootPath(s.Target, src)
+		created := ""
+		if err == nil {
+			created, err = mountpoint(src, target)
+		}
+		if err == nil {
+			err = bindMountReadOnly(src, target)
+		}
+		if err != nil {
+			if created != "" {
+				os.RemoveAll(created)
+			}
+			unmount()
+			return nil, errors.Wrapf(err, "while mounting %s read-only in the rootfs", src)
+		}
+		ctx.Debug("Mounted", src, "read-only at", target)
+		mounts = append(mounts, readOnlyMount{target: target, created: created})
+	}
+	return unmount, nil
+}
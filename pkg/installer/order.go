@@ -0,0 +1,135 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"sort"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+)
+
+// installLayers splits the matches in dependency layers: the packages of
+// a layer only require packages of the previous ones, so they can be
+// installed in parallel. Ties are broken according to the install order,
+// topological keeps them sorted by fingerprint. Dependency cycles are
+// installed in the last layer. Matches ordered by the PostSolveHook
+// are installed one at a time, in the order of the plan.
+func installLayers(matches map[string]ArtifactMatch, order string) [][]ArtifactMatch {
+	for _, m := range matches {
+		if m.planOrder > 0 {
+			return planLayers(matches, order)
+		}
+	}
+
+	byName := map[string][]string{}
+	for fp, m := range matches {
+		byName[m.Package.GetPackageName()] = append(byName[m.Package.GetPackageName()], fp)
+	}
+
+	// deps are the fingerprints of the matches each match requires
+	deps := map[string]map[string]bool{}
+	for fp, m := range matches {
+		deps[fp] = map[string]bool{}
+		for _, re := range m.Package.GetRequires() {
+			for _, d := range byName[re.GetPackageName()] {
+				if d != fp {
+					deps[fp][d] = true
+				}
+			}
+		}
+	}
+
+	layers := [][]ArtifactMatch{}
+	done := map[string]bool{}
+	for len(done) < len(matches) {
+		ready := []string{}
+		for fp := range matches {
+			if done[fp] {
+				continue
+			}
+			blocked := false
+			for d := range deps[fp] {
+				if !done[d] {
+					blocked = true
+					break
+				}
+			}
+			if !blocked {
+				ready = append(ready, fp)
+			}
+		}
+
+		if len(ready) == 0 {
+			for fp := range matches {
+				if !done[fp] {
+					ready = append(ready, fp)
+				}
+			}
+		}
+
+		layer := []ArtifactMatch{}
+		for _, fp := range ready {
+			done[fp] = true
+			layer = append(layer, matches[fp])
+		}
+		sortLayer(layer, order)
+		layers = append(layers, layer)
+	}
+	return layers
+}
+
+func sortLayer(layer []ArtifactMatch, order string) {
+	sort.SliceStable(layer, func(i, j int) bool {
+		a, b := layer[i], layer[j]
+		switch order {
+		case types.InstallOrderAlphabetical:
+			return a.Package.HumanReadableString() < b.Package.HumanReadableString()
+		case types.InstallOrderSizeAsc, types.InstallOrderSizeDesc:
+			if a.Artifact.InstalledSize != b.Artifact.InstalledSize {
+				return (a.Artifact.InstalledSize < b.Artifact.InstalledSize) == (order == types.InstallOrderSizeAsc)
+			}
+		}
+		return a.Package.GetFingerPrint() < b.Package.GetFingerPrint()
+	})
+}
+
+// planLayers returns a layer for each match, in the order of the plan
+func planLayers(matches map[string]ArtifactMatch, order string) [][]ArtifactMatch {
+	ordered := []ArtifactMatch{}
+	for _, m := range matches {
+		ordered = append(ordered, m)
+	}
+	sortLayer(ordered, order)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i].planOrder, ordered[j].planOrder
+		return a != 0 && (b == 0 || a < b)
+	})
+
+	layers := [][]ArtifactMatch{}
+	for _, m := range ordered {
+		layers = append(layers, []ArtifactMatch{m})
+	}
+	return layers
+}
+
+// orderedMatches returns the matches in install order
+func orderedMatches(matches map[string]ArtifactMatch, order string) []ArtifactMatch {
+	res := []ArtifactMatch{}
+	for _, layer := range installLayers(matches, order) {
+		res = append(res, layer...)
+	}
+	return res
+}
@@ -0,0 +1,168 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	artifact "github.com/mudler/luet/pkg/api/core/types/artifact"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Install order", func() {
+	var dir string
+	var repo *LuetSystemRepository
+
+	// name, size of the content and requirement
+	fixtures := [][3]string{
+		{"app", "1", "lib"},
+		{"lib", "40", "base"},
+		{"base", "30", ""},
+		{"tool", "20", ""},
+		{"zed", "10", ""},
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "order")
+		Expect(err).ToNot(HaveOccurred())
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+
+		for _, f := range fixtures {
+			p := &types.Package{Category: "test", Name: f[0], Version: "1.0"}
+			p.Path = filepath.Join(dir, "tree", p.Name)
+			Expect(os.MkdirAll(p.Path, os.ModePerm)).ToNot(HaveOccurred())
+			def := fmt.Sprintf("category: test\nname: %s\nversion: \"1.0\"\n", p.Name)
+			if f[2] != "" {
+				def += fmt.Sprintf("requires:\n- category: test\n  name: %s\n  version: \">=0\"\n", f[2])
+			}
+			Expect(ioutil.WriteFile(filepath.Join(p.Path, types.PackageDefinitionFile), []byte(def), 0600)).ToNot(HaveOccurred())
+
+			var size int
+			fmt.Sscanf(f[1], "%d", &size)
+			src := filepath.Join(dir, "src", p.Name)
+			Expect(os.MkdirAll(src, os.ModePerm)).ToNot(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(src, p.Name), []byte(strings.Repeat("x", size)), 0600)).ToNot(HaveOccurred())
+
+			a := artifact.NewPackageArtifact(filepath.Join(repodir, p.GetFingerPrint()+".package.tar"))
+			Expect(a.Compress(src, 1)).ToNot(HaveOccurred())
+			a.CompileSpec = &types.LuetCompilationSpec{Package: p}
+			Expect(a.WriteYAML(repodir)).ToNot(HaveOccurred())
+		}
+
+		repo, err = GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	install := func(order string) []string {
+		installed := []string{}
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		ctx.Config.PackageInstallOrder = order
+		ctx.Config.System.InstallProgressCallback = func(p string, _, _ int) {
+			installed = append(installed, strings.TrimSuffix(strings.TrimPrefix(p, "test/"), "-1.0"))
+		}
+
+		inst := NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 1, Context: ctx,
+			PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+		})
+		system := &System{Database: pkg.NewInMemoryDatabase(false), Target: filepath.Join(dir, "root-"+order)}
+		packs := types.Packages{}
+		for _, f := range fixtures {
+			packs = append(packs, &types.Package{Category: "test", Name: f[0], Version: "1.0"})
+		}
+		Expect(inst.Install(packs, system)).ToNot(HaveOccurred())
+		return installed
+	}
+
+	indexOf := func(s []string, e string) int {
+		for i := range s {
+			if s[i] == e {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for _, order := range []string{types.InstallOrderTopological, types.InstallOrderAlphabetical, types.InstallOrderSizeAsc, types.InstallOrderSizeDesc} {
+		order := order
+		It("installs the dependencies first with "+order, func() {
+			installed := install(order)
+			Expect(len(installed)).To(Equal(len(fixtures)))
+			Expect(indexOf(installed, "base")).To(BeNumerically("<", indexOf(installed, "lib")))
+			Expect(indexOf(installed, "lib")).To(BeNumerically("<", indexOf(installed, "app")))
+		})
+	}
+
+	It("breaks the ties of a layer", func() {
+		Expect(install(types.InstallOrderAlphabetical)[:3]).To(Equal([]string{"base", "tool", "zed"}))
+		Expect(install(types.InstallOrderSizeAsc)[:3]).To(Equal([]string{"zed", "tool", "base"}))
+		Expect(install(types.InstallOrderSizeDesc)[:3]).To(Equal([]string{"base", "tool", "zed"}))
+	})
+
+	It("reports the progress of a swap over all its packages", func() {
+		steps := []string{}
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		ctx.Config.PackageInstallOrder = types.InstallOrderAlphabetical
+		ctx.Config.System.InstallProgressCallback = func(p string, step, total int) {
+			steps = append(steps, fmt.Sprintf("%s %d/%d", p, step, total))
+		}
+
+		inst := NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 1, Context: ctx,
+			PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+		})
+		system := &System{Database: pkg.NewInMemoryDatabase(false), Target: filepath.Join(dir, "root")}
+		old := &types.Package{Category: "test", Name: "old", Version: "0.1"}
+		_, err := system.Database.CreatePackage(old)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(inst.Swap(types.Packages{old}, types.Packages{
+			{Category: "test", Name: "tool", Version: "1.0"},
+			{Category: "test", Name: "zed", Version: "1.0"},
+		}, system)).ToNot(HaveOccurred())
+		Expect(steps).To(Equal([]string{"test/tool-1.0 1/2", "test/zed-1.0 2/2"}))
+	})
+})
@@ -0,0 +1,38 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import "fmt"
+
+// peerReview waits for the approval of the peer_review quorum
+// before installing the packages
+func (l *LuetInstaller) peerReview(toInstall map[string]ArtifactMatch) error {
+	cfg := l.Options.Context.GetConfig()
+	if !cfg.PeerReview.Enabled || len(toInstall) == 0 {
+		return nil
+	}
+
+	l.Options.Context.Info(fmt.Sprintf("Waiting for the approval of %d peers", cfg.PeerReview.QuorumSize))
+	approvals, err := cfg.RequestPeerReview(matchedPackages(toInstall))
+	if err != nil {
+		return err
+	}
+	for _, a := range approvals {
+		l.Options.Context.Info("Install approved by", a.Reviewer)
+		l.Options.Context.Debug("Signature of", a.Reviewer+":", a.Signature)
+	}
+	return nil
+}
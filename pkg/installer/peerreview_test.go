@@ -0,0 +1,148 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Peer review", func() {
+	It("installs only the approved packages", func() {
+		dir, err := ioutil.TempDir("", "review")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		packs := writeArtifacts(dir, 2)
+
+		repo, err := GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+		// The peer rejects test/p1
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req types.PeerReviewRequest
+			Expect(json.NewDecoder(r.Body).Decode(&req)).To(Succeed())
+			resp := types.PeerReviewResponse{Approved: true, Reviewer: "alice", Signature: "sig"}
+			for _, p := range req.Packages {
+				if p.Name == "p1" {
+					resp = types.PeerReviewResponse{Reviewer: "alice", Reason: "p1 is not allowed"}
+				}
+			}
+			json.NewEncoder(w).Encode(resp)
+		}))
+		defer ts.Close()
+
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		ctx.Config.PeerReview = types.LuetPeerReview{Enabled: true, QuorumSize: 1, PeerEndpoints: []string{ts.URL}}
+
+		inst := NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 1, Context: ctx,
+			PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+		})
+
+		fakeroot := filepath.Join(dir, "root")
+		Expect(os.MkdirAll(fakeroot, os.ModePerm)).ToNot(HaveOccurred())
+		system := &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+
+		err = inst.Install(packs, system)
+		Expect(errors.Is(err, types.ErrPeerReviewRejected)).To(BeTrue())
+		Expect(system.Database.World()).To(BeEmpty())
+
+		Expect(inst.Install(packs[:1], system)).ToNot(HaveOccurred())
+		Expect(len(system.Database.World())).To(Equal(1))
+	})
+
+	It("reviews upgrades before replacing the installed packages", func() {
+		dir, err := ioutil.TempDir("", "review")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		writeArtifacts(dir, 1)
+
+		repo, err := GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+		reviewed := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reviewed++
+			json.NewEncoder(w).Encode(types.PeerReviewResponse{Reviewer: "alice", Reason: "no upgrades today"})
+		}))
+		defer ts.Close()
+
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		ctx.Config.PeerReview = types.LuetPeerReview{Enabled: true, QuorumSize: 1, PeerEndpoints: []string{ts.URL}}
+
+		inst := NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 1, Context: ctx,
+			PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+		})
+
+		fakeroot := filepath.Join(dir, "root")
+		Expect(os.MkdirAll(fakeroot, os.ModePerm)).ToNot(HaveOccurred())
+		system := &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+		old := &types.Package{Category: "test", Name: "p0", Version: "0.9"}
+		_, err = system.Database.CreatePackage(old)
+		Expect(err).ToNot(HaveOccurred())
+
+		err = inst.Upgrade(system)
+		Expect(errors.Is(err, types.ErrPeerReviewRejected)).To(BeTrue())
+		Expect(reviewed).To(Equal(1))
+
+		_, err = system.Database.FindPackage(old)
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
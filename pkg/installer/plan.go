@@ -0,0 +1,90 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pkg/errors"
+)
+
+// GetFinalSystemPackagePlan computes the changes that installing cp would
+// apply to the system, including the upgrades performed beforehand,
+// without touching the system. Repositories are synced read only and
+// the sizes are estimated from their index.
+func (l *LuetInstaller) GetFinalSystemPackagePlan(cp types.Packages, s *System) (*types.InstallPlan, error) {
+	syncedRepos, err := l.syncRepositories(true)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &types.InstallPlan{}
+	matches := map[string]ArtifactMatch{}
+
+	if len(s.Database.World()) > 0 && !l.Options.Relaxed {
+		uninstall, toInstall, err := l.computeUpgrade(syncedRepos, s)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed computing upgrade")
+		}
+
+		upgrades, _, _, _, _, err := l.computeSwap(Option{Force: true, NoDeps: true}, syncedRepos, uninstall, toInstall, s)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed computing upgrade")
+		}
+		for k, m := range upgrades {
+			matches[k] = m
+		}
+
+		for _, u := range uninstall {
+			if p, err := toInstall.Find(u.GetPackageName()); err == nil {
+				plan.Upgrade = append(plan.Upgrade, types.PackageUpgrade{From: u, To: p})
+			} else {
+				plan.Remove = append(plan.Remove, u)
+			}
+		}
+	}
+
+	match, _, _, _, err := l.computeInstall(Option{
+		NoDeps:   l.Options.NoDeps,
+		Force:    l.Options.Force,
+		OnlyDeps: l.Options.OnlyDeps,
+	}, syncedRepos, cp, s)
+	if err != nil {
+		return nil, err
+	}
+	match, toRemove, err := l.postSolve(syncedRepos, match, nil, s)
+	if err != nil {
+		return nil, err
+	}
+	plan.Remove = append(plan.Remove, toRemove...)
+	for k, m := range match {
+		matches[k] = m
+	}
+
+	for _, m := range matches {
+		if !plan.IsUpgrade(m.Package) {
+			plan.Install = append(plan.Install, m.Package)
+		}
+
+		plan.InstallSize += m.Artifact.InstalledSize
+		if _, err := m.Repository.Client(l.Options.Context).CacheGet(m.Artifact); err != nil {
+			plan.DownloadSize += m.Artifact.Size
+		}
+	}
+
+	plan.SecurityWarnings = l.securityWarnings(matchedPackages(matches))
+
+	return plan, nil
+}
@@ -0,0 +1,138 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	artifact "github.com/mudler/luet/pkg/api/core/types/artifact"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Install plan", func() {
+	var dir string
+	var ctx *context.Context
+	var inst *LuetInstaller
+	var system *System
+
+	a := &types.Package{Category: "test", Name: "a", Version: "1.0"}
+	b := &types.Package{Category: "test", Name: "b", Version: "1.0"}
+	newB := &types.Package{Category: "test", Name: "b", Version: "1.1"}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "plan")
+		Expect(err).ToNot(HaveOccurred())
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		for _, f := range []*types.Package{a, b, newB} {
+			p := f.Clone()
+			p.Path = filepath.Join(dir, "tree", p.Name, p.Version)
+			Expect(os.MkdirAll(p.Path, os.ModePerm)).ToNot(HaveOccurred())
+			def := fmt.Sprintf("category: test\nname: %s\nversion: \"%s\"\n", p.Name, p.Version)
+			Expect(ioutil.WriteFile(filepath.Join(p.Path, types.PackageDefinitionFile), []byte(def), 0600)).ToNot(HaveOccurred())
+
+			src := filepath.Join(dir, "src", p.GetFingerPrint())
+			Expect(os.MkdirAll(src, os.ModePerm)).ToNot(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(src, p.GetFingerPrint()), []byte(p.Version), 0600)).ToNot(HaveOccurred())
+
+			art := artifact.NewPackageArtifact(filepath.Join(repodir, p.GetFingerPrint()+".package.tar"))
+			Expect(art.Compress(src, 1)).ToNot(HaveOccurred())
+			if p.Name == "a" {
+				// as built before the sizes were recorded
+				art.Size, art.InstalledSize = 0, 0
+			}
+			art.CompileSpec = &types.LuetCompilationSpec{Package: p}
+			Expect(art.WriteYAML(repodir)).ToNot(HaveOccurred())
+		}
+
+		repo, err := GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+		ctx = context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		cached := *repo.LuetRepository
+		cached.Cached = true
+		inst = NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 2, Context: ctx,
+			PackageRepositories: types.LuetRepositories{cached},
+		})
+
+		fakeroot, err := ioutil.TempDir(dir, "root")
+		Expect(err).ToNot(HaveOccurred())
+		system = &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+		_, err = system.Database.CreatePackage(b.Clone())
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("lists the installs and the upgrades", func() {
+		plan, err := inst.GetFinalSystemPackagePlan(types.Packages{a}, system)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(plan.Install).To(HaveLen(1))
+		Expect(plan.Install[0].GetFingerPrint()).To(Equal(a.GetFingerPrint()))
+		Expect(plan.Upgrade).To(HaveLen(1))
+		Expect(plan.Upgrade[0].From.GetVersion()).To(Equal("1.0"))
+		Expect(plan.Upgrade[0].To.GetVersion()).To(Equal("1.1"))
+		Expect(plan.Remove).To(BeEmpty())
+	})
+
+	It("estimates the sizes of all the artifacts from the repository", func() {
+		plan, err := inst.GetFinalSystemPackagePlan(types.Packages{a}, system)
+		Expect(err).ToNot(HaveOccurred())
+
+		// the content of a and of the b upgrade, the artifact of a
+		// has no sizes in its metadata
+		Expect(plan.InstallSize).To(Equal(int64(len(a.Version) + len(newB.Version))))
+		Expect(plan.DownloadSize).To(BeNumerically(">", plan.InstallSize))
+	})
+
+	It("doesn't write to the system", func() {
+		_, err := inst.GetFinalSystemPackagePlan(types.Packages{a}, system)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(filepath.Join(dir, "db")).ToNot(BeAnExistingFile())
+		files, err := ioutil.ReadDir(system.Target)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(BeEmpty())
+		Expect(system.Database.World()).To(HaveLen(1))
+	})
+})
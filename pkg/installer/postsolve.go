@@ -0,0 +1,142 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"fmt"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pkg/errors"
+)
+
+// postSolve runs the configured PostSolveHook against the plan of the
+// changes computed by the solver and checks the packages to install
+// against the blacklist and the allowed licenses. It returns the matches
+// and the packages to remove of the plan returned by the hook.
+func (l *LuetInstaller) postSolve(syncedRepos Repositories, toInstall map[string]ArtifactMatch, toRemove types.Packages, s *System) (map[string]ArtifactMatch, types.Packages, error) {
+	cfg := l.Options.Context.GetConfig()
+	if cfg.PostSolveHook != nil {
+		plan, err := cfg.PostSolveHook(solvedPlan(toInstall, toRemove, cfg.GetPackageInstallOrder()))
+		if err != nil {
+			return toInstall, toRemove, errors.Wrap(err, "post solve hook failed")
+		}
+		if plan == nil {
+			return toInstall, toRemove, errors.New("post solve hook returned no plan")
+		}
+		toInstall, toRemove, err = l.applyPlan(syncedRepos, toInstall, plan, s)
+		if err != nil {
+			return toInstall, toRemove, err
+		}
+	}
+
+	for _, m := range orderedMatches(toInstall, cfg.GetPackageInstallOrder()) {
+		if cfg.IsBlacklisted(m.Package) {
+			return toInstall, toRemove, fmt.Errorf("package '%s' is blacklisted", m.Package.HumanReadableString())
+		}
+		if !cfg.IsLicenseAllowed(m.Package) {
+			return toInstall, toRemove, fmt.Errorf("package '%s' has a disallowed license '%s'", m.Package.HumanReadableString(), m.Package.GetLicense())
+		}
+	}
+	return toInstall, toRemove, nil
+}
+
+// solvedPlan returns the plan of the matches to install in install order,
+// the removed packages replaced by a match are listed as upgrades
+func solvedPlan(toInstall map[string]ArtifactMatch, toRemove types.Packages, order string) *types.InstallPlan {
+	plan := &types.InstallPlan{}
+	upgraded := map[string]bool{}
+	for _, m := range orderedMatches(toInstall, order) {
+		if from, err := toRemove.Find(m.Package.GetPackageName()); err == nil {
+			plan.Upgrade = append(plan.Upgrade, types.PackageUpgrade{From: from, To: m.Package})
+			upgraded[from.GetFingerPrint()] = true
+			continue
+		}
+		plan.Install = append(plan.Install, m.Package)
+	}
+	for _, p := range toRemove {
+		if !upgraded[p.GetFingerPrint()] {
+			plan.Remove = append(plan.Remove, p)
+		}
+	}
+	return plan
+}
+
+// applyPlan returns the matches and the packages to remove of the plan.
+// Matches keep the order of the plan: upgrades first, then installs.
+func (l *LuetInstaller) applyPlan(syncedRepos Repositories, solved map[string]ArtifactMatch, plan *types.InstallPlan, s *System) (map[string]ArtifactMatch, types.Packages, error) {
+	toInstall := map[string]ArtifactMatch{}
+	toRemove := types.Packages{}
+
+	add := func(p *types.Package) error {
+		fp := p.GetFingerPrint()
+		if m, ok := solved[fp]; ok {
+			toInstall[fp] = m
+		} else if err := l.matchArtifact(syncedRepos, p, s, toInstall); err != nil {
+			return errors.Wrapf(err, "while matching %s added by the post solve hook", p.HumanReadableString())
+		}
+		if m, ok := toInstall[fp]; ok && m.planOrder == 0 {
+			m.planOrder = len(toInstall)
+			toInstall[fp] = m
+		}
+		return nil
+	}
+
+	for _, u := range plan.Upgrade {
+		toRemove = append(toRemove, u.From)
+		if err := add(u.To); err != nil {
+			return solved, nil, err
+		}
+	}
+	for _, p := range plan.Install {
+		if err := add(p); err != nil {
+			return solved, nil, err
+		}
+	}
+	toRemove = append(toRemove, plan.Remove...)
+
+	return toInstall, toRemove, nil
+}
+
+// removePlanned removes the packages the PostSolveHook planned to
+// remove along with an install
+func (l *LuetInstaller) removePlanned(toRemove types.Packages, s *System) error {
+	if len(toRemove) == 0 {
+		return nil
+	}
+	if l.dryRun() {
+		l.planPackages(DryRunRemove, toRemove, "post solve hook")
+		return nil
+	}
+
+	l.Options.Context.Info(":recycle: Packages that are going to be removed from the system:", packsToList(toRemove))
+	_, uninstall, err := l.generateUninstallFn(Option{Force: l.Options.Force, NoDeps: true}, s, map[string]interface{}{}, toRemove...)
+	if err != nil {
+		return errors.Wrap(err, "while computing the removals of the post solve hook")
+	}
+	return uninstall()
+}
+
+// withPlanned adds the matches the PostSolveHook added to the plan to
+// the solution and to the requested packages
+func withPlanned(toInstall map[string]ArtifactMatch, packages types.Packages, solution types.PackagesAssertions) (types.Packages, types.PackagesAssertions) {
+	for fp, m := range toInstall {
+		if solution.Search(fp) == nil {
+			solution = append(solution, types.PackageAssert{Package: m.Package, Value: true})
+			packages = append(packages, m.Package)
+		}
+	}
+	return packages, solution
+}
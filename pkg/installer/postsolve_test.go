@@ -0,0 +1,171 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	artifact "github.com/mudler/luet/pkg/api/core/types/artifact"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Post solve hook", func() {
+	var dir string
+	var ctx *context.Context
+	var inst *LuetInstaller
+	var system *System
+
+	a := &types.Package{Category: "test", Name: "a", Version: "1.0"}
+	b := &types.Package{Category: "test", Name: "b", Version: "1.0"}
+	c := &types.Package{Category: "test", Name: "c", Version: "1.0"}
+	newB := &types.Package{Category: "test", Name: "b", Version: "1.1"}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "postsolve")
+		Expect(err).ToNot(HaveOccurred())
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		for _, f := range []*types.Package{a, b, c, newB} {
+			p := f.Clone()
+			p.Path = filepath.Join(dir, "tree", p.Name, p.Version)
+			Expect(os.MkdirAll(p.Path, os.ModePerm)).ToNot(HaveOccurred())
+			def := fmt.Sprintf("category: test\nname: %s\nversion: \"%s\"\n", p.Name, p.Version)
+			Expect(ioutil.WriteFile(filepath.Join(p.Path, types.PackageDefinitionFile), []byte(def), 0600)).ToNot(HaveOccurred())
+
+			src := filepath.Join(dir, "src", p.GetFingerPrint())
+			Expect(os.MkdirAll(src, os.ModePerm)).ToNot(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(src, p.GetFingerPrint()), []byte(p.Version), 0600)).ToNot(HaveOccurred())
+
+			art := artifact.NewPackageArtifact(filepath.Join(repodir, p.GetFingerPrint()+".package.tar"))
+			Expect(art.Compress(src, 1)).ToNot(HaveOccurred())
+			art.CompileSpec = &types.LuetCompilationSpec{Package: p}
+			Expect(art.WriteYAML(repodir)).ToNot(HaveOccurred())
+		}
+
+		repo, err := GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+		ctx = context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		inst = NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 2, Context: ctx,
+			PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+		})
+
+		fakeroot, err := ioutil.TempDir(dir, "root")
+		Expect(err).ToNot(HaveOccurred())
+		system = &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	installed := func(p *types.Package) bool {
+		_, err := system.Database.FindPackage(p)
+		return err == nil
+	}
+
+	It("installs the packages in the order of the plan", func() {
+		order := []string{}
+		ctx.Config.System.InstallProgressCallback = func(p string, step, total int) {
+			order = append(order, p)
+		}
+		ctx.Config.PostSolveHook = func(plan *types.InstallPlan) (*types.InstallPlan, error) {
+			Expect(plan.Install).To(HaveLen(3))
+			plan.Install = types.Packages{c, a, b}
+			return plan, nil
+		}
+
+		Expect(inst.Install(types.Packages{a, b, c}, system)).ToNot(HaveOccurred())
+		Expect(order).To(Equal([]string{c.HumanReadableString(), a.HumanReadableString(), b.HumanReadableString()}))
+	})
+
+	It("checks the packages added by the hook against the blacklist", func() {
+		ctx.Config.PackageBlacklist = []string{"test/c"}
+		ctx.Config.PostSolveHook = func(plan *types.InstallPlan) (*types.InstallPlan, error) {
+			plan.Install = append(plan.Install, c)
+			return plan, nil
+		}
+
+		err := inst.Install(types.Packages{a}, system)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("blacklisted"))
+		Expect(installed(a)).To(BeFalse())
+	})
+
+	It("removes the packages planned for removal", func() {
+		Expect(inst.Install(types.Packages{c}, system)).ToNot(HaveOccurred())
+
+		ctx.Config.PostSolveHook = func(plan *types.InstallPlan) (*types.InstallPlan, error) {
+			plan.Remove = append(plan.Remove, c)
+			return plan, nil
+		}
+		Expect(inst.Install(types.Packages{a}, system)).ToNot(HaveOccurred())
+		Expect(installed(a)).To(BeTrue())
+		Expect(installed(c)).To(BeFalse())
+	})
+
+	It("gets the upgrades in the plan", func() {
+		Expect(inst.Install(types.Packages{b}, system)).ToNot(HaveOccurred())
+
+		var upgrades []types.PackageUpgrade
+		ctx.Config.PostSolveHook = func(plan *types.InstallPlan) (*types.InstallPlan, error) {
+			upgrades = plan.Upgrade
+			plan.Install = append(plan.Install, c)
+			return plan, nil
+		}
+		Expect(inst.Upgrade(system)).ToNot(HaveOccurred())
+
+		Expect(upgrades).To(HaveLen(1))
+		Expect(upgrades[0].From.GetVersion()).To(Equal("1.0"))
+		Expect(upgrades[0].To.GetVersion()).To(Equal("1.1"))
+		Expect(installed(b)).To(BeFalse())
+		Expect(installed(newB)).To(BeTrue())
+		Expect(installed(c)).To(BeTrue())
+	})
+
+	It("aborts when the hook returns no plan", func() {
+		ctx.Config.PostSolveHook = func(plan *types.InstallPlan) (*types.InstallPlan, error) {
+			return nil, nil
+		}
+
+		Expect(inst.Install(types.Packages{a}, system)).To(HaveOccurred())
+		Expect(installed(a)).To(BeFalse())
+	})
+})
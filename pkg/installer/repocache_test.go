@@ -0,0 +1,122 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Repository cache priority", func() {
+	var dir, repodir string
+	var repo types.LuetRepository
+	var ctx *context.Context
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "repocache")
+		Expect(err).ToNot(HaveOccurred())
+
+		repodir = filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		writeArtifacts(dir, 2)
+
+		r, err := GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(r.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+		repo = *r.LuetRepository
+		repo.Cached = true
+
+		ctx = context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	sync := func() (*LuetSystemRepository, error) {
+		return NewSystemRepository(repo).Sync(ctx, false)
+	}
+
+	It("uses the cached data when the repository is unreachable", func() {
+		_, err := sync()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(os.RemoveAll(repodir)).ToNot(HaveOccurred())
+
+		for _, p := range []string{types.RepoCacheCacheFirst, types.RepoCacheLiveFirst, types.RepoCacheCacheOnly} {
+			ctx.Config.RepositoryCachePriority = p
+			synced, err := sync()
+			Expect(err).ToNot(HaveOccurred(), p)
+			Expect(synced.GetTree().GetDatabase().World()).To(HaveLen(2), p)
+		}
+	})
+
+	It("fetches the repository first with live-first", func() {
+		_, err := sync()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(os.Remove(filepath.Join(repodir, REPOSITORY_SPECFILE))).ToNot(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(repodir, REPOSITORY_SPECFILE), []byte("name: test\ntype: disk\nrevision: 2\n"), 0600)).ToNot(HaveOccurred())
+
+		ctx.Config.RepositoryCachePriority = types.RepoCacheLiveFirst
+		_, err = sync()
+		Expect(err).To(HaveOccurred())
+
+		ctx.Config.RepositoryCachePriority = types.RepoCacheCacheFirst
+		_, err = sync()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("writes the repository database", func() {
+		ctx.Config.SystemRepositories = types.LuetRepositories{repo}
+		ctx.Config.OpenDatabase = pkg.NewBoltDatabase
+		_, err := ctx.Config.GetSystemRepoDatabase("test")
+		Expect(errors.Is(err, types.ErrRepositoryNotCached)).To(BeTrue())
+
+		_, err = sync()
+		Expect(err).ToNot(HaveOccurred())
+
+		db, err := ctx.Config.GetSystemRepoDatabase("test")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(db.World()).To(HaveLen(2))
+	})
+
+	It("fails with cache-only when nothing is cached", func() {
+		ctx.Config.RepositoryCachePriority = types.RepoCacheCacheOnly
+		_, err := sync()
+		Expect(errors.Is(err, types.ErrRepositoryNotCached)).To(BeTrue())
+	})
+})
@@ -46,6 +46,7 @@ import (
 const (
 	REPOSITORY_METAFILE  = "repository.meta.yaml"
 	REPOSITORY_SPECFILE  = "repository.yaml"
+	REPOSITORY_KEYFILE   = "repository.key.asc"
 	TREE_TARBALL         = "tree.tar"
 	COMPILERTREE_TARBALL = "compilertree.tar"
 
@@ -62,6 +63,9 @@ type LuetRepositoryFile struct {
 	FileName        string                          `json:"filename"`
 	CompressionType types.CompressionImplementation `json:"compressiontype,omitempty"`
 	Checksums       artifact.Checksums              `json:"checksums,omitempty"`
+
+	// Alternatives are the same file with other compressions
+	Alternatives []LuetRepositoryFile `json:"alternatives,omitempty"`
 }
 
 type LuetSystemRepository struct {
@@ -75,6 +79,9 @@ type LuetSystemRepository struct {
 	ForcePush       bool                          `json:"-"`
 
 	imagePrefix, snapshotID string
+
+	// indexCompressions are the extra compressions of the repository files
+	indexCompressions []types.CompressionImplementation
 }
 
 type LuetSystemRepositoryMetadata struct {
@@ -105,9 +112,10 @@ func NewLuetSystemRepositoryMetadata(file string, removeFile bool) (*LuetSystemR
 
 // SystemRepositories returns the repositories from the local configuration file
 // it filters the available repositories returning the ones that are enabled
-func SystemRepositories(t types.LuetRepositories) Repositories {
+// on a system of the given architecture
+func SystemRepositories(t types.LuetRepositories, arch string) Repositories {
 	repos := Repositories{}
-	for _, repo := range t.Enabled() {
+	for _, repo := range t.EnabledOn(arch) {
 		r := NewSystemRepository(repo)
 		repos = append(repos, r)
 	}
@@ -128,7 +136,8 @@ func LoadBuildTree(t tree.Builder, db types.PackageDatabase, ctx types.Context)
 		RepoDir:      make(map[*LuetSystemRepository]string),
 	}
 
-	repos := SystemRepositories(ctx.GetConfig().SystemRepositories)
+	cfg := ctx.GetConfig()
+	repos := SystemRepositories(cfg.SystemRepositories, cfg.GetSystemArch())
 	for _, r := range repos {
 		repodir, err := ctx.TempDir(r.Name)
 		if err != nil {
@@ -352,14 +361,15 @@ func GenerateRepository(p ...RepositoryOption) (*LuetSystemRepository, error) {
 	}
 
 	repo := &LuetSystemRepository{
-		LuetRepository:  types.NewLuetRepository(c.Name, c.Type, c.Description, c.Urls, c.Priority, true, false),
-		Tree:            tree.NewInstallerRecipe(runtimeTree, c.runtimeParser...),
-		BuildTree:       btr,
-		RepositoryFiles: map[string]LuetRepositoryFile{},
-		PushImages:      c.PushImages,
-		ForcePush:       c.Force,
-		Backend:         c.CompilerBackend,
-		imagePrefix:     c.ImagePrefix,
+		LuetRepository:    types.NewLuetRepository(c.Name, c.Type, c.Description, c.Urls, c.Priority, true, false),
+		Tree:              tree.NewInstallerRecipe(runtimeTree, c.runtimeParser...),
+		BuildTree:         btr,
+		RepositoryFiles:   map[string]LuetRepositoryFile{},
+		PushImages:        c.PushImages,
+		ForcePush:         c.Force,
+		Backend:           c.CompilerBackend,
+		imagePrefix:       c.ImagePrefix,
+		indexCompressions: c.IndexCompressions,
 	}
 
 	if err := repo.initialize(c.context, c.Src); err != nil {
@@ -672,7 +682,30 @@ func (r *LuetSystemRepository) AddRepositoryFile(src, fileKey, repositoryRoot st
 		//	r.SetRepositoryFile(fileKey, treeFile)
 	}
 
-	a := artifact.NewPackageArtifact(filepath.Join(repositoryRoot, treeFile.GetFileName()))
+	base := treeFile.GetFileName()
+	// Alternatives are created first, as compressing removes the
+	// intermediate tarball which might be the main file
+	treeFile.Alternatives = nil
+	for _, c := range r.indexCompressions {
+		if c == treeFile.GetCompressionType() {
+			continue
+		}
+		alt := artifact.NewPackageArtifact(filepath.Join(repositoryRoot, base))
+		alt.CompressionType = c
+		if err := alt.Compress(src, 1); err != nil {
+			return nil, errors.Wrapf(err, "Error met while creating the %s archive", c)
+		}
+		if err := alt.Hash(); err != nil {
+			return nil, errors.Wrapf(err, "Failed generating checksums for the %s archive", c)
+		}
+		treeFile.Alternatives = append(treeFile.Alternatives, LuetRepositoryFile{
+			FileName:        path.Base(alt.Path),
+			CompressionType: c,
+			Checksums:       alt.Checksums,
+		})
+	}
+
+	a := artifact.NewPackageArtifact(filepath.Join(repositoryRoot, base))
 	a.CompressionType = treeFile.GetCompressionType()
 	err = a.Compress(src, 1)
 	if err != nil {
@@ -767,6 +800,13 @@ func (r *LuetSystemRepository) Write(ctx types.Context, dst string, resetRevisio
 }
 
 func (r *LuetSystemRepository) Client(ctx types.Context) Client {
+	cfg := ctx.GetConfig()
+	auth, err := cfg.GetRepositoryCredentials(r.LuetRepository)
+	if err != nil {
+		ctx.Warning("Failed getting credentials for repository", r.GetName(), ":", err.Error())
+		auth = r.GetAuthentication()
+	}
+
 	switch r.GetType() {
 	case DiskRepositoryType:
 		return client.NewLocalClient(client.RepoData{Urls: r.GetUrls()}, ctx)
@@ -774,14 +814,14 @@ func (r *LuetSystemRepository) Client(ctx types.Context) Client {
 		return client.NewHttpClient(
 			client.RepoData{
 				Urls:           r.GetUrls(),
-				Authentication: r.GetAuthentication(),
+				Authentication: auth,
 			}, ctx)
 
 	case DockerRepositoryType:
 		return client.NewDockerClient(
 			client.RepoData{
 				Urls:           r.GetUrls(),
-				Authentication: r.GetAuthentication(),
+				Authentication: auth,
 				Verify:         r.Verify,
 			}, ctx)
 	}
@@ -798,13 +838,26 @@ func (r *LuetSystemRepository) SearchArtefact(p *types.Package) (*artifact.Packa
 	return nil, errors.New("Not found")
 }
 
-func (r *LuetSystemRepository) getRepoFile(c Client, key string) (*artifact.PackageArtifact, error) {
+func (r *LuetSystemRepository) getRepoFile(ctx types.Context, c Client, key string) (*artifact.PackageArtifact, error) {
 
-	treeFile, err := r.GetRepositoryFile(key)
+	file, err := r.GetRepositoryFile(key)
 	if err != nil {
 		return nil, errors.Wrapf(err, "key %s not present in the repository", key)
 	}
 
+	if preferred, ok := file.Preferred(ctx.GetConfig().RepositoryCompressionHint); ok {
+		a, err := downloadRepoFile(c, preferred)
+		if err == nil {
+			return a, nil
+		}
+		ctx.Debug("Failed fetching", preferred.GetFileName(), "falling back to", file.GetFileName()+":", err.Error())
+	}
+
+	return downloadRepoFile(c, file)
+}
+
+func downloadRepoFile(c Client, treeFile LuetRepositoryFile) (*artifact.PackageArtifact, error) {
+
 	// Get Tree
 	downloadedTreeFile, err := c.DownloadFile(treeFile.GetFileName())
 	if err != nil {
@@ -837,7 +890,7 @@ func (r *LuetSystemRepository) SyncBuildMetadata(ctx types.Context, path string)
 		return errors.New("no client could be generated from repository")
 	}
 
-	a, err := repo.getRepoFile(c, REPOFILE_COMPILER_TREE_KEY)
+	a, err := repo.getRepoFile(ctx, c, REPOFILE_COMPILER_TREE_KEY)
 	if err != nil {
 		return fmt.Errorf("failed while getting: %s", REPOFILE_COMPILER_TREE_KEY)
 	}
@@ -874,11 +927,66 @@ func (r *LuetSystemRepository) referenceID() string {
 	return repositoryReferenceID
 }
 
+// verify checks the detached signature of the downloaded repository
+// index when repo_verification is enabled
+func (r *LuetSystemRepository) verify(ctx types.Context, c Client, file string, readOnly bool) error {
+	verification := ctx.GetConfig().RepositoryVerification
+	if !verification.Enabled {
+		return nil
+	}
+
+	signature, err := c.DownloadFile(r.referenceID() + ".asc")
+	if err != nil {
+		return errors.Wrapf(types.ErrRepoSignatureInvalid, "while downloading signature of %s: %s", r.GetName(), err.Error())
+	}
+	defer os.RemoveAll(signature)
+
+	key, removeKey := r.trustedKey(ctx, c, file, signature, readOnly)
+	defer removeKey()
+	if key != "" {
+		verification.TrustedKeys = append([]string{key}, verification.TrustedKeys...)
+	}
+
+	if err := verification.Verify(file, signature); err != nil {
+		return errors.Wrapf(err, "repository %s", r.GetName())
+	}
+	ctx.Debug("Signature of the repository", r.GetName(), "verified")
+	return nil
+}
+
+// writeDatabase stores the packages of the repository tree in a boltdb
+// database at path, see LuetConfig.GetSystemRepoDatabase
+func (r *LuetSystemRepository) writeDatabase(path string) error {
+	tmp := path + ".new"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	if err := r.GetTree().GetDatabase().Clone(pkg.NewBoltDatabase(tmp)); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
 func (r *LuetSystemRepository) Sync(ctx types.Context, force bool) (*LuetSystemRepository, error) {
+	return r.sync(ctx, force, false)
+}
+
+// sync retrieves the repository data. When readOnly is set the local
+// cache is only read: updates are unpacked in temporary directories
+// and nothing is written in the repositories dir of the system.
+func (r *LuetSystemRepository) sync(ctx types.Context, force, readOnly bool) (*LuetSystemRepository, error) {
 	var repoUpdated bool = false
 	var treefs, metafs string
 
-	repobasedir := ctx.GetConfig().System.GetRepoDatabaseDirPath(r.GetName())
+	var repobasedir string
+	if readOnly {
+		// GetRepoDatabaseDirPath would create the directory
+		repobasedir = filepath.Join(ctx.GetConfig().System.DatabasePath, "repos/"+r.GetName())
+	} else {
+		repobasedir = ctx.GetConfig().System.GetRepoDatabaseDirPath(r.GetName())
+	}
+	priority := ctx.GetConfig().RepositoryCachePriority
 
 	toTimeSync := false
 	dat, err := ioutil.ReadFile(filepath.Join(repobasedir, "SYNCTIME"))
@@ -906,21 +1014,44 @@ func (r *LuetSystemRepository) Sync(ctx types.Context, force bool) (*LuetSystemR
 	repoFile := filepath.Join(repobasedir, repositoryReferenceID)
 
 	_, repoExistsErr := os.Stat(repoFile)
-	if toTimeSync || force || os.IsNotExist(repoExistsErr) {
+	fetch := toTimeSync || force || os.IsNotExist(repoExistsErr)
+	switch priority {
+	case types.RepoCacheLiveFirst:
+		fetch = true
+	case types.RepoCacheCacheOnly:
+		if repoExistsErr != nil {
+			return nil, errors.Wrapf(types.ErrRepositoryNotCached, "repository %s", r.GetName())
+		}
+		fetch = false
+	}
+
+	if fetch {
 		// Retrieve remote repository.yaml for retrieve revision and date
 		file, err = c.DownloadFile(repositoryReferenceID)
-		if err != nil {
+		if err != nil && priority == types.RepoCacheLiveFirst && repoExistsErr == nil {
+			ctx.Warning("Failed downloading", repositoryReferenceID, "of", r.Name, "using the cached data:", err.Error())
+			fetch = false
+		} else if err != nil {
 			return nil, errors.Wrap(err, "while downloading "+repositoryReferenceID)
 		}
+	}
+
+	if fetch {
+		if err := r.verify(ctx, c, file, readOnly); err != nil {
+			os.RemoveAll(file)
+			return nil, err
+		}
 		downloadedRepoMeta, err = r.ReadSpecFile(file)
 		if err != nil {
 			return nil, err
 		}
 		defer os.RemoveAll(file)
-		defer func() {
-			now := time.Now().Format(time.RFC3339)
-			ioutil.WriteFile(filepath.Join(repobasedir, "SYNCTIME"), []byte(now), os.ModePerm)
-		}()
+		if !readOnly {
+			defer func() {
+				now := time.Now().Format(time.RFC3339)
+				ioutil.WriteFile(filepath.Join(repobasedir, "SYNCTIME"), []byte(now), os.ModePerm)
+			}()
+		}
 	} else {
 		downloadedRepoMeta, err = r.ReadSpecFile(repoFile)
 		if err != nil {
@@ -929,16 +1060,19 @@ func (r *LuetSystemRepository) Sync(ctx types.Context, force bool) (*LuetSystemR
 		repoUpdated = true
 	}
 
-	if r.Cached {
-		if !force {
-			localRepo, _ := r.ReadSpecFile(filepath.Join(repobasedir, repositoryReferenceID))
-			if localRepo != nil {
-				if localRepo.GetRevision() == downloadedRepoMeta.GetRevision() &&
-					localRepo.GetLastUpdate() == downloadedRepoMeta.GetLastUpdate() {
-					repoUpdated = true
-				}
+	if r.Cached && !force {
+		localRepo, _ := r.ReadSpecFile(filepath.Join(repobasedir, repositoryReferenceID))
+		if localRepo != nil {
+			if localRepo.GetRevision() == downloadedRepoMeta.GetRevision() &&
+				localRepo.GetLastUpdate() == downloadedRepoMeta.GetLastUpdate() {
+				repoUpdated = true
 			}
 		}
+	}
+
+	// A read only sync can use the cached tree only if it is current
+	cached := r.Cached && (!readOnly || repoUpdated)
+	if cached {
 		if r.GetTreePath() == "" {
 			treefs = filepath.Join(repobasedir, "treefs")
 		} else {
@@ -964,7 +1098,7 @@ func (r *LuetSystemRepository) Sync(ctx types.Context, force bool) (*LuetSystemR
 	// treeFile and metaFile must be present, they aren't optional
 	if !repoUpdated {
 
-		treeFileArtifact, err := downloadedRepoMeta.getRepoFile(c, REPOFILE_TREE_KEY)
+		treeFileArtifact, err := downloadedRepoMeta.getRepoFile(ctx, c, REPOFILE_TREE_KEY)
 		if err != nil {
 			return nil, errors.Wrapf(err, "while fetching '%s'", REPOFILE_TREE_KEY)
 		}
@@ -972,7 +1106,7 @@ func (r *LuetSystemRepository) Sync(ctx types.Context, force bool) (*LuetSystemR
 
 		ctx.Debug("Tree tarball for the repository " + r.GetName() + " downloaded correctly.")
 
-		metaFileArtifact, err := downloadedRepoMeta.getRepoFile(c, REPOFILE_META_KEY)
+		metaFileArtifact, err := downloadedRepoMeta.getRepoFile(ctx, c, REPOFILE_META_KEY)
 		if err != nil {
 			return nil, errors.Wrapf(err, "while fetching '%s'", REPOFILE_META_KEY)
 		}
@@ -980,7 +1114,7 @@ func (r *LuetSystemRepository) Sync(ctx types.Context, force bool) (*LuetSystemR
 
 		ctx.Debug("Metadata tarball for the repository " + r.GetName() + " downloaded correctly.")
 
-		if r.Cached {
+		if cached {
 			// Copy updated repository.yaml file to repo dir now that the tree is synced.
 			err = fileHelper.CopyFile(file, filepath.Join(repobasedir, repositoryReferenceID))
 			if err != nil {
@@ -1042,6 +1176,18 @@ func (r *LuetSystemRepository) Sync(ctx types.Context, force bool) (*LuetSystemR
 	// while remotely it could be advertized differently
 	r.fill(downloadedRepoMeta)
 
+	if f := ctx.GetConfig().RepoSyncFilter; f != nil {
+		if err := downloadedRepoMeta.filterPackages(f); err != nil {
+			return nil, errors.Wrap(err, "while filtering repository packages")
+		}
+	}
+
+	if dbPath := filepath.Join(repobasedir, types.DatabaseFile); cached && !readOnly && (!repoUpdated || !fileHelper.Exists(dbPath)) {
+		if err := downloadedRepoMeta.writeDatabase(dbPath); err != nil {
+			return nil, errors.Wrap(err, "while writing the repository database")
+		}
+	}
+
 	if !repoUpdated {
 		ctx.Info(
 			fmt.Sprintf(":information_source: Repository: %s Priority: %d Type: %s",
@@ -1049,9 +1195,36 @@ func (r *LuetSystemRepository) Sync(ctx types.Context, force bool) (*LuetSystemR
 				downloadedRepoMeta.GetPriority(),
 				downloadedRepoMeta.GetType()))
 	}
+
+	if !readOnly {
+		runPostSyncHooks(ctx, r.GetName())
+	}
+
 	return downloadedRepoMeta, nil
 }
 
+// filterPackages drops from the index and the tree the packages
+// rejected by the sync filter
+func (r *LuetSystemRepository) filterPackages(f func(*types.LuetRepository, *types.Package) bool) error {
+	index := compiler.ArtifactIndex{}
+	for _, a := range r.GetIndex() {
+		if a.CompileSpec == nil || a.CompileSpec.GetPackage() == nil || f(r.LuetRepository, a.CompileSpec.GetPackage()) {
+			index = append(index, a)
+		}
+	}
+	r.SetIndex(index)
+
+	db := r.GetTree().GetDatabase()
+	for _, p := range db.World() {
+		if !f(r.LuetRepository, p) {
+			if err := db.RemovePackage(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (r *LuetSystemRepository) fill(r2 *LuetSystemRepository) {
 	r2.SetUrls(r.GetUrls())
 	r2.SetAuthentication(r.GetAuthentication())
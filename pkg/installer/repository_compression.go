@@ -0,0 +1,58 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"runtime"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+)
+
+// autoCompressions returns the compressions ordered from the fastest
+// to decompress. gzip is decompressed in parallel only with several
+// CPUs, otherwise the uncompressed file is preferred to it.
+func autoCompressions() []types.CompressionImplementation {
+	if runtime.NumCPU() > 1 {
+		return []types.CompressionImplementation{types.Zstandard, types.GZip, types.None}
+	}
+	return []types.CompressionImplementation{types.Zstandard, types.None, types.GZip}
+}
+
+// Preferred returns the alternative of the file matching the
+// compression hint, see LuetConfig.RepositoryCompressionHint.
+// It returns false if the file itself is the preferred one.
+func (f LuetRepositoryFile) Preferred(hint string) (LuetRepositoryFile, bool) {
+	if hint == "" || len(f.Alternatives) == 0 {
+		return f, false
+	}
+
+	wanted := []types.CompressionImplementation{types.CompressionImplementation(hint)}
+	if hint == types.CompressionHintAuto {
+		wanted = autoCompressions()
+	}
+
+	for _, c := range wanted {
+		if c == f.GetCompressionType() {
+			return f, false
+		}
+		for _, alt := range f.Alternatives {
+			if alt.GetCompressionType() == c {
+				return alt, true
+			}
+		}
+	}
+	return f, false
+}
@@ -0,0 +1,102 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Preferred compression", func() {
+	file := LuetRepositoryFile{
+		FileName:        "tree.tar.gz",
+		CompressionType: types.GZip,
+		Alternatives: []LuetRepositoryFile{
+			{FileName: "tree.tar.zst", CompressionType: types.Zstandard},
+			{FileName: "tree.tar", CompressionType: types.None},
+		},
+	}
+
+	It("picks the alternative matching the hint", func() {
+		_, ok := file.Preferred("")
+		Expect(ok).To(BeFalse())
+		_, ok = file.Preferred("gzip")
+		Expect(ok).To(BeFalse())
+
+		f, ok := file.Preferred("none")
+		Expect(ok).To(BeTrue())
+		Expect(f.GetFileName()).To(Equal("tree.tar"))
+
+		f, ok = file.Preferred(types.CompressionHintAuto)
+		Expect(ok).To(BeTrue())
+		Expect(f.GetCompressionType()).To(Equal(types.Zstandard))
+
+		_, ok = LuetRepositoryFile{FileName: "tree.tar.gz", CompressionType: types.GZip}.Preferred("zstd")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("syncs the index with the preferred compression", func() {
+		dir, err := ioutil.TempDir("", "compression")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		writeArtifacts(dir, 1)
+
+		repo, err := GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+			WithIndexCompressions(types.Zstandard),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+		tree, err := repo.GetRepositoryFile(REPOFILE_TREE_KEY)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tree.Alternatives).To(HaveLen(1))
+		Expect(filepath.Join(repodir, tree.Alternatives[0].GetFileName())).To(BeARegularFile())
+
+		// Only the zstd tree is available
+		Expect(os.Remove(filepath.Join(repodir, tree.GetFileName()))).ToNot(HaveOccurred())
+
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		_, err = NewSystemRepository(*repo.LuetRepository).Sync(ctx, true)
+		Expect(err).To(HaveOccurred())
+
+		ctx.Config.RepositoryCompressionHint = "zstd"
+		synced, err := NewSystemRepository(*repo.LuetRepository).Sync(ctx, true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(synced.GetIndex()).To(HaveLen(1))
+	})
+})
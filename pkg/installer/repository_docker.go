@@ -84,6 +84,8 @@ func (l *dockerRepositoryGenerator) Initialize(path string, db types.PackageData
 			return nil
 		}
 
+		fillSizes(l.context, a, a.Path)
+
 		packageImage := fmt.Sprintf("%s:%s", l.imagePrefix, a.CompileSpec.GetPackage().ImageID())
 
 		if l.imagePush && l.b.ImageAvailable(packageImage) && !l.force {
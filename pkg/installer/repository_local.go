@@ -71,6 +71,8 @@ func buildPackageIndex(ctx types.Context, path string, db types.PackageDatabase)
 			return nil
 		}
 
+		fillSizes(ctx, a, filepath.Join(filepath.Dir(currentpath), filepath.Base(a.Path)))
+
 		art = append(art, a)
 
 		return nil
@@ -139,3 +141,18 @@ func (g *localRepositoryGenerator) Generate(r *LuetSystemRepository, dst string,
 	})
 	return nil
 }
+
+// fillSizes records the sizes of artifacts whose metadata lacks them,
+// as the ones built by older versions, from their archive at path
+func fillSizes(ctx types.Context, a *artifact.PackageArtifact, path string) {
+	if a.Size != 0 {
+		return
+	}
+	sized := a.ShallowCopy()
+	sized.Path = path
+	if err := sized.ComputeSizes(); err != nil {
+		ctx.Debug("Failed computing the sizes of", path, err.Error())
+		return
+	}
+	a.Size, a.InstalledSize = sized.Size, sized.InstalledSize
+}
@@ -32,6 +32,7 @@ type RepositoryConfig struct {
 	DB                      types.PackageDatabase
 	CompilerBackend         compiler.CompilerBackend
 	ImagePrefix             string
+	IndexCompressions       []types.CompressionImplementation
 
 	context                                         types.Context
 	PushImages, Force, FromRepository, FromMetadata bool
@@ -179,3 +180,12 @@ func WithPriority(b int) func(cfg *RepositoryConfig) error {
 		return nil
 	}
 }
+
+// WithIndexCompressions publishes the repository index files
+// also with the given compressions, see LuetRepositoryFile.Alternatives
+func WithIndexCompressions(c ...types.CompressionImplementation) func(cfg *RepositoryConfig) error {
+	return func(cfg *RepositoryConfig) error {
+		cfg.IndexCompressions = c
+		return nil
+	}
+}
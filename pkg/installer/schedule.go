@@ -0,0 +1,82 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/robfig/cron/v3"
+)
+
+// Scheduler runs functions on cron expressions, it is implemented by cron.Cron
+type Scheduler interface {
+	AddFunc(spec string, cmd func()) (cron.EntryID, error)
+	Start()
+	Stop() context.Context
+}
+
+// ScheduledSync syncs the enabled system repositories on the
+// general.scheduled_sync cron expression. Syncs never overlap.
+type ScheduledSync struct {
+	lock      sync.Locker
+	ctx       types.Context
+	scheduler Scheduler
+}
+
+// NewScheduledSync returns a ScheduledSync using the scheduler,
+// a cron.Cron in the local time zone is used if nil. The syncs hold
+// lock, shared with the other operations on the system if given.
+func NewScheduledSync(ctx types.Context, s Scheduler, lock sync.Locker) *ScheduledSync {
+	if s == nil {
+		s = cron.New()
+	}
+	if lock == nil {
+		lock = &sync.Mutex{}
+	}
+	return &ScheduledSync{lock: lock, ctx: ctx, scheduler: s}
+}
+
+// Start schedules the syncs
+func (s *ScheduledSync) Start() error {
+	if _, err := s.scheduler.AddFunc(s.ctx.GetConfig().General.ScheduledSync.CronExpr, s.run); err != nil {
+		return err
+	}
+	s.scheduler.Start()
+	return nil
+}
+
+// Stop stops the scheduler, waiting for the running sync
+func (s *ScheduledSync) Stop() {
+	<-s.scheduler.Stop().Done()
+}
+
+func (s *ScheduledSync) run() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.ctx.Debug("Running scheduled repositories sync")
+	cfg := s.ctx.GetConfig()
+	for _, r := range cfg.SystemRepositories {
+		if !r.Enabled() {
+			continue
+		}
+		if _, err := NewSystemRepository(r).Sync(s.ctx, true); err != nil {
+			s.ctx.Warning("Scheduled sync of repository", r.Name, "failed:", err.Error())
+		}
+	}
+}
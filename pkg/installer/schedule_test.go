@@ -0,0 +1,133 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	gocontext "context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+	"github.com/robfig/cron/v3"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeScheduler runs the jobs when the clock is advanced
+type fakeScheduler struct {
+	schedules []cron.Schedule
+	jobs      []func()
+	started   bool
+}
+
+func (f *fakeScheduler) AddFunc(spec string, cmd func()) (cron.EntryID, error) {
+	s, err := cron.ParseStandard(spec)
+	if err != nil {
+		return 0, err
+	}
+	f.schedules = append(f.schedules, s)
+	f.jobs = append(f.jobs, cmd)
+	return cron.EntryID(len(f.jobs)), nil
+}
+
+func (f *fakeScheduler) Start() { f.started = true }
+
+func (f *fakeScheduler) Stop() gocontext.Context {
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	cancel()
+	return ctx
+}
+
+// advance runs the jobs due from now to until, returning when they ran
+func (f *fakeScheduler) advance(now, until time.Time) []time.Time {
+	runs := []time.Time{}
+	for i, s := range f.schedules {
+		for t := s.Next(now); !t.After(until); t = s.Next(t) {
+			f.jobs[i]()
+			runs = append(runs, t)
+		}
+	}
+	return runs
+}
+
+var _ = Describe("Scheduled sync", func() {
+	It("syncs the repositories on the cron schedule", func() {
+		dir, err := ioutil.TempDir("", "schedule")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		writeArtifacts(dir, 1)
+
+		repo, err := GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+		synced := filepath.Join(dir, "synced")
+		hook := filepath.Join(dir, "hook.sh")
+		Expect(ioutil.WriteFile(hook, []byte("#!/bin/sh\necho \"$1\" >> "+synced+"\n"), 0755)).To(Succeed())
+
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		ctx.Config.PostSyncHooks = []string{hook}
+		ctx.Config.SystemRepositories = types.LuetRepositories{*repo.LuetRepository}
+		ctx.Config.General.ScheduledSync = types.LuetScheduledSync{Enabled: true, CronExpr: "0 3 * * *"}
+
+		scheduler := &fakeScheduler{}
+		s := NewScheduledSync(ctx, scheduler, nil)
+		Expect(s.Start()).ToNot(HaveOccurred())
+		Expect(scheduler.started).To(BeTrue())
+
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		Expect(scheduler.advance(start, start.Add(2*time.Hour))).To(BeEmpty())
+		Expect(synced).ToNot(BeAnExistingFile())
+
+		runs := scheduler.advance(start, start.Add(50*time.Hour))
+		Expect(runs).To(Equal([]time.Time{
+			time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC),
+			time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC),
+		}))
+
+		data, err := ioutil.ReadFile(synced)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(strings.Split(strings.TrimSpace(string(data)), "\n")).To(Equal([]string{"test", "test"}))
+		s.Stop()
+	})
+
+	It("refuses invalid cron expressions", func() {
+		ctx := context.NewContext()
+		ctx.Config.General.ScheduledSync = types.LuetScheduledSync{Enabled: true, CronExpr: "every day"}
+		Expect(NewScheduledSync(ctx, &fakeScheduler{}, nil).Start()).To(HaveOccurred())
+	})
+})
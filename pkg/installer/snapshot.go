@@ -0,0 +1,303 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pkg/errors"
+)
+
+const snapshotPrefix = "luet-"
+
+// SnapshotInfo describes a snapshot of the rootfs taken by luet
+type SnapshotInfo struct {
+	ID      string
+	Backend string
+	Created time.Time
+}
+
+// snapshotter takes and restores the snapshots of a rootfs
+type snapshotter interface {
+	create(id string) error
+	delete(id string) error
+	rollback(id string) error
+	list() ([]string, error)
+	// checkRollback returns an error if the rootfs can't be rolled back
+	// while the system database at dbPath is in use
+	checkRollback(dbPath string) error
+}
+
+func newSnapshotter(backend, rootfs string) (snapshotter, error) {
+	switch backend {
+	case types.SnapshotBtrfs:
+		return &btrfsSnapshotter{rootfs: filepath.Clean(rootfs)}, nil
+	case types.SnapshotZFS:
+		return &zfsSnapshotter{rootfs: rootfs}, nil
+	case "":
+		return nil, errors.New("no snapshotting backend configured")
+	default:
+		return nil, fmt.Errorf("invalid snapshotting backend '%s'", backend)
+	}
+}
+
+func snapshotCommand(name string, args ...string) (string, error) {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return "", errors.Wrapf(err, "%s %s: %s", name, strings.Join(args, " "), string(out))
+	}
+	return string(out), nil
+}
+
+// btrfsSnapshotter keeps read-only snapshots of the rootfs subvolume
+// in a .luet-snapshots directory next to it
+type btrfsSnapshotter struct {
+	rootfs string
+}
+
+func (b *btrfsSnapshotter) dir() string {
+	return filepath.Join(filepath.Dir(b.rootfs), ".luet-snapshots", filepath.Base(b.rootfs))
+}
+
+func (b *btrfsSnapshotter) create(id string) error {
+	if err := os.MkdirAll(b.dir(), os.ModePerm); err != nil {
+		return err
+	}
+	_, err := snapshotCommand("btrfs", "subvolume", "snapshot", "-r", b.rootfs, filepath.Join(b.dir(), id))
+	return err
+}
+
+func (b *btrfsSnapshotter) delete(id string) error {
+	_, err := snapshotCommand("btrfs", "subvolume", "delete", filepath.Join(b.dir(), id))
+	return err
+}
+
+// checkRollback refuses the rollbacks replacing a subvolume in use: the
+// mounted ones, as /, can't be deleted, and the system database kept
+// open in the rootfs would be lost.
+func (b *btrfsSnapshotter) checkRollback(dbPath string) error {
+	mounted, err := isMountPoint(b.rootfs)
+	if err != nil {
+		return err
+	}
+	if mounted {
+		return fmt.Errorf("btrfs rollback of the mounted subvolume %s is not supported, "+
+			"make a writable snapshot of %s the default subvolume and reboot instead", b.rootfs, b.dir())
+	}
+	if rel, err := filepath.Rel(b.rootfs, filepath.Clean(dbPath)); err == nil && !strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("btrfs rollback of %s is not supported while the system database %s is inside it", b.rootfs, dbPath)
+	}
+	return nil
+}
+
+// isMountPoint returns true if a filesystem is mounted on path
+func isMountPoint(path string) (bool, error) {
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false, err
+	}
+
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return false, errors.Wrap(err, "while reading the mount table")
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// The mount point is the 5th field, with spaces escaped as \040
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 4 && strings.ReplaceAll(fields[4], `\040`, " ") == path {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// rollback replaces the rootfs subvolume with a writable snapshot of id
+func (b *btrfsSnapshotter) rollback(id string) error {
+	restored := b.rootfs + ".luet-rollback"
+	if _, err := snapshotCommand("btrfs", "subvolume", "snapshot", filepath.Join(b.dir(), id), restored); err != nil {
+		return err
+	}
+	if _, err := snapshotCommand("btrfs", "subvolume", "delete", b.rootfs); err != nil {
+		snapshotCommand("btrfs", "subvolume", "delete", restored)
+		return err
+	}
+	return os.Rename(restored, b.rootfs)
+}
+
+func (b *btrfsSnapshotter) list() ([]string, error) {
+	entries, err := os.ReadDir(b.dir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, e := range entries {
+		ids = append(ids, e.Name())
+	}
+	return ids, nil
+}
+
+// zfsSnapshotter snapshots the dataset mounted on the rootfs
+type zfsSnapshotter struct {
+	rootfs  string
+	dataset string
+}
+
+func (z *zfsSnapshotter) getDataset() (string, error) {
+	if z.dataset != "" {
+		return z.dataset, nil
+	}
+	out, err := snapshotCommand("zfs", "list", "-H", "-o", "name", z.rootfs)
+	if err != nil {
+		return "", err
+	}
+	z.dataset = strings.TrimSpace(out)
+	return z.dataset, nil
+}
+
+func (z *zfsSnapshotter) run(action string, id string, args ...string) error {
+	ds, err := z.getDataset()
+	if err != nil {
+		return err
+	}
+	_, err = snapshotCommand("zfs", append(append([]string{action}, args...), ds+"@"+id)...)
+	return err
+}
+
+func (z *zfsSnapshotter) create(id string) error   { return z.run("snapshot", id) }
+func (z *zfsSnapshotter) delete(id string) error   { return z.run("destroy", id) }
+func (z *zfsSnapshotter) rollback(id string) error { return z.run("rollback", id, "-r") }
+
+// checkRollback accepts any dataset, zfs rolls back mounted ones in place
+func (z *zfsSnapshotter) checkRollback(string) error { return nil }
+
+func (z *zfsSnapshotter) list() ([]string, error) {
+	ds, err := z.getDataset()
+	if err != nil {
+		return nil, err
+	}
+	out, err := snapshotCommand("zfs", "list", "-H", "-t", "snapshot", "-o", "name", ds)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, l := range strings.Split(out, "\n") {
+		if i := strings.Index(l, "@"); i >= 0 {
+			ids = append(ids, strings.TrimSpace(l[i+1:]))
+		}
+	}
+	return ids, nil
+}
+
+func (l *LuetInstaller) snapshotter(rootfs string) (snapshotter, error) {
+	return newSnapshotter(l.Options.Context.GetConfig().SnapshottingBackend, rootfs)
+}
+
+// ListSnapshots returns the snapshots of the rootfs taken by luet, oldest first
+func (l *LuetInstaller) ListSnapshots() ([]SnapshotInfo, error) {
+	cfg := l.Options.Context.GetConfig()
+	s, err := l.snapshotter(cfg.System.Rootfs)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := s.list()
+	if err != nil {
+		return nil, errors.Wrap(err, "while listing snapshots")
+	}
+
+	res := []SnapshotInfo{}
+	for _, id := range ids {
+		if !strings.HasPrefix(id, snapshotPrefix) {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimPrefix(id, snapshotPrefix), 10, 64)
+		if err != nil {
+			continue
+		}
+		res = append(res, SnapshotInfo{ID: id, Backend: cfg.SnapshottingBackend, Created: time.Unix(0, n)})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Created.Before(res[j].Created) })
+	return res, nil
+}
+
+// RollbackToSnapshot restores the rootfs to the snapshot with the given id
+func (l *LuetInstaller) RollbackToSnapshot(id string) error {
+	s, err := l.snapshotter(l.Options.Context.GetConfig().System.Rootfs)
+	if err != nil {
+		return err
+	}
+	if err := s.checkRollback(l.Options.Context.GetConfig().System.GetSystemDBPath()); err != nil {
+		return err
+	}
+	if err := s.rollback(id); err != nil {
+		return errors.Wrapf(err, "while rolling back to snapshot %s", id)
+	}
+	return nil
+}
+
+// snapshot takes a snapshot of the system target before an operation
+// changing it. The returned function rolls back to the snapshot if the
+// operation failed, and deletes it otherwise. Operations called by a
+// running one share its snapshot.
+func (l *LuetInstaller) snapshot(sys *System) (func(*error), error) {
+	cfg := l.Options.Context.GetConfig()
+	if cfg.SnapshottingBackend == "" || l.dryRun() || l.snapshotting {
+		return func(*error) {}, nil
+	}
+
+	s, err := l.snapshotter(sys.Target)
+	if err != nil {
+		return nil, err
+	}
+	// Refuse the operation upfront rather than failing to roll it back
+	if err := s.checkRollback(cfg.System.GetSystemDBPath()); err != nil {
+		return nil, err
+	}
+	id := fmt.Sprintf("%s%d", snapshotPrefix, time.Now().UnixNano())
+	if err := s.create(id); err != nil {
+		return nil, errors.Wrap(err, "while taking a snapshot")
+	}
+	l.Options.Context.Debug("Taken snapshot", id, "of", sys.Target)
+	l.snapshotting = true
+
+	return func(opErr *error) {
+		l.snapshotting = false
+		if *opErr != nil {
+			l.Options.Context.Warning("Operation failed, rolling back to snapshot", id)
+			if err := s.rollback(id); err != nil {
+				l.Options.Context.Error("Failed rolling back to snapshot", id, err.Error())
+				return
+			}
+		}
+		if err := s.delete(id); err != nil {
+			l.Options.Context.Warning("Failed deleting snapshot", id, err.Error())
+		}
+	}, nil
+}
@@ -0,0 +1,222 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeZFS is a zfs command logging its arguments, with a single
+// pool/root dataset holding two luet snapshots
+const fakeZFS = `#!/bin/sh
+echo "$@" >> %s
+case "$*" in
+  "list -H -t snapshot -o name pool/root") printf 'pool/root@luet-200\npool/root@manual\npool/root@luet-100\n' ;;
+  "list -H -o name "*) echo pool/root ;;
+esac
+`
+
+// fakeBtrfs is a btrfs command logging its arguments
+const fakeBtrfs = `#!/bin/sh
+echo "$@" >> %s
+`
+
+var _ = Describe("Snapshots", func() {
+	var dir, log, path string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "snapshots")
+		Expect(err).ToNot(HaveOccurred())
+
+		bin := filepath.Join(dir, "bin")
+		Expect(os.MkdirAll(bin, os.ModePerm)).To(Succeed())
+		log = filepath.Join(dir, "zfs.log")
+		Expect(ioutil.WriteFile(filepath.Join(bin, "zfs"), []byte(fmt.Sprintf(fakeZFS, log)), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(bin, "btrfs"), []byte(fmt.Sprintf(fakeBtrfs, log)), 0755)).To(Succeed())
+
+		path = os.Getenv("PATH")
+		os.Setenv("PATH", bin+string(os.PathListSeparator)+path)
+	})
+
+	AfterEach(func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	})
+
+	calls := func() []string {
+		dat, err := ioutil.ReadFile(log)
+		Expect(err).ToNot(HaveOccurred())
+		os.Remove(log)
+		res := []string{}
+		for _, l := range strings.Split(strings.TrimSpace(string(dat)), "\n") {
+			f := strings.Fields(l)
+			if i := strings.LastIndex(f[len(f)-1], "luet-"); i >= 0 {
+				f[len(f)-1] = f[len(f)-1][:i] + "luet"
+			}
+			res = append(res, strings.Join(f, " "))
+		}
+		return res
+	}
+
+	It("snapshots the rootfs around installs", func() {
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		packs := writeArtifacts(dir, 2)
+
+		repo, err := GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		ctx.Config.SnapshottingBackend = types.SnapshotZFS
+		ctx.Config.PackageRequiresConsent = []string{"test/p1"}
+
+		inst := NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 1, Context: ctx,
+			PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+		})
+
+		fakeroot := filepath.Join(dir, "root")
+		Expect(os.MkdirAll(fakeroot, os.ModePerm)).ToNot(HaveOccurred())
+		system := &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+
+		Expect(inst.Install(packs[:1], system)).To(Succeed())
+		Expect(calls()).To(Equal([]string{
+			"list -H -o name " + fakeroot,
+			"snapshot pool/root@luet",
+			"destroy pool/root@luet",
+		}))
+
+		err = inst.Install(packs[1:], system)
+		Expect(errors.Is(err, types.ErrConsentRequired)).To(BeTrue())
+		Expect(calls()).To(Equal([]string{
+			"list -H -o name " + fakeroot,
+			"snapshot pool/root@luet",
+			"rollback -r pool/root@luet",
+			"destroy pool/root@luet",
+		}))
+	})
+
+	It("lists and rolls back to the luet snapshots", func() {
+		ctx := context.NewContext()
+		ctx.Config.System.Rootfs = "/"
+		ctx.Config.SnapshottingBackend = types.SnapshotZFS
+		inst := NewLuetInstaller(LuetInstallerOptions{Context: ctx})
+
+		snapshots, err := inst.ListSnapshots()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(snapshots)).To(Equal(2))
+		Expect(snapshots[0].ID).To(Equal("luet-100"))
+		Expect(snapshots[1].ID).To(Equal("luet-200"))
+		Expect(snapshots[1].Backend).To(Equal(types.SnapshotZFS))
+
+		Expect(inst.RollbackToSnapshot("luet-100")).To(Succeed())
+		Expect(calls()).To(ContainElement("rollback -r pool/root@luet"))
+	})
+
+	Context("btrfs", func() {
+		It("refuses to roll back a mounted subvolume", func() {
+			ctx := context.NewContext()
+			ctx.Config.System.Rootfs = "/"
+			ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+			ctx.Config.SnapshottingBackend = types.SnapshotBtrfs
+			inst := NewLuetInstaller(LuetInstallerOptions{Context: ctx})
+
+			err := inst.RollbackToSnapshot("luet-100")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("mounted subvolume /"))
+			Expect(log).ToNot(BeAnExistingFile())
+		})
+
+		It("refuses installs it couldn't roll back before changing the rootfs", func() {
+			repodir := filepath.Join(dir, "repo")
+			Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+			packs := writeArtifacts(dir, 2)
+
+			repo, err := GenerateRepository(
+				WithName("test"),
+				WithType("disk"),
+				WithUrls(repodir),
+				WithPriority(1),
+				WithSource(repodir),
+				WithTree(filepath.Join(dir, "tree")),
+				WithContext(context.NewContext()),
+				WithDatabase(pkg.NewInMemoryDatabase(false)),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+			fakeroot := filepath.Join(dir, "root")
+			Expect(os.MkdirAll(fakeroot, os.ModePerm)).ToNot(HaveOccurred())
+
+			// The system database is in the rootfs
+			ctx := context.NewContext()
+			ctx.Config.System.DatabasePath = filepath.Join(fakeroot, "var", "db")
+			ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+			ctx.Config.SnapshottingBackend = types.SnapshotBtrfs
+
+			inst := NewLuetInstaller(LuetInstallerOptions{
+				Concurrency: 1, Context: ctx,
+				PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+			})
+			system := &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+
+			err = inst.Install(packs[:1], system)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("system database"))
+			Expect(log).ToNot(BeAnExistingFile())
+			Expect(system.Database.World()).To(BeEmpty())
+
+			ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+			Expect(inst.Install(packs[:1], system)).To(Succeed())
+			Expect(calls()).To(Equal([]string{
+				"subvolume snapshot -r " + fakeroot + " " + filepath.Join(dir, ".luet-snapshots", "root", "luet"),
+				"subvolume delete " + filepath.Join(dir, ".luet-snapshots", "root", "luet"),
+			}))
+		})
+	})
+
+	It("requires a backend", func() {
+		inst := NewLuetInstaller(LuetInstallerOptions{Context: context.NewContext()})
+		_, err := inst.ListSnapshots()
+		Expect(err).To(HaveOccurred())
+	})
+})
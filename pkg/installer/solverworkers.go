@@ -0,0 +1,160 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	"github.com/mudler/luet/pkg/solver"
+)
+
+// closure returns the names of the packages p requires or conflicts with,
+// recursively, p included
+func closure(p *types.Package, definitions types.PackageDatabase, names map[string]bool) {
+	if names[p.GetPackageName()] {
+		return
+	}
+	names[p.GetPackageName()] = true
+	for _, re := range append(p.GetRequires(), p.GetConflicts()...) {
+		names[re.GetPackageName()] = true
+		versions, _ := re.Expand(definitions)
+		for _, v := range versions {
+			closure(v, definitions, names)
+		}
+	}
+}
+
+// partitionPackages groups the packages sharing any requirement or
+// conflict, so that distinct groups can be solved independently
+func partitionPackages(packs types.Packages, definitions types.PackageDatabase) []types.Packages {
+	groups := []types.Packages{}
+	names := []map[string]bool{}
+
+	for _, p := range packs {
+		c := map[string]bool{}
+		closure(p, definitions, c)
+
+		group := types.Packages{p}
+		// Merge the groups overlapping with the closure of p
+		for i := 0; i < len(groups); i++ {
+			overlaps := false
+			for n := range c {
+				if names[i][n] {
+					overlaps = true
+					break
+				}
+			}
+			if !overlaps {
+				continue
+			}
+			group = append(groups[i], group...)
+			for n := range names[i] {
+				c[n] = true
+			}
+			groups = append(groups[:i], groups[i+1:]...)
+			names = append(names[:i], names[i+1:]...)
+			i--
+		}
+		groups = append(groups, group)
+		names = append(names, c)
+	}
+	return groups
+}
+
+// mergeSolutions joins the solutions of independent groups. A package
+// not needed by a group is needed anyway if another group requires it,
+// two versions of the same package can't be both required.
+func mergeSolutions(solutions []types.PackagesAssertions) (types.PackagesAssertions, error) {
+	res := types.PackagesAssertions{}
+	index := map[string]int{}
+	required := map[string]*types.Package{}
+
+	for _, solution := range solutions {
+		for _, a := range solution {
+			if a.Value {
+				if other, ok := required[a.Package.GetPackageName()]; ok && other.GetFingerPrint() != a.Package.GetFingerPrint() {
+					return nil, fmt.Errorf("conflicting solutions: both %s and %s are required", other.HumanReadableString(), a.Package.HumanReadableString())
+				}
+				required[a.Package.GetPackageName()] = a.Package
+			}
+
+			fp := a.Package.GetFingerPrint()
+			if i, ok := index[fp]; ok {
+				if a.Value {
+					res[i] = a
+				}
+				continue
+			}
+			index[fp] = len(res)
+			res = append(res, a)
+		}
+	}
+	return res, nil
+}
+
+func (l *LuetInstaller) solveGroup(p types.Packages, installed, definitions types.PackageDatabase) (types.PackagesAssertions, error) {
+	solv := solver.NewResolver(types.SolverOptions{
+		Type:              l.Options.SolverOptions.Implementation,
+		Concurrency:       l.Options.Concurrency,
+		BacktrackLimit:    l.Options.SolverOptions.BacktrackLimit,
+		ExpandConstraints: l.Options.Context.GetConfig().SolverConstraintExpansion},
+		installed, definitions, pkg.NewInMemoryDatabase(false),
+		l.resolver(),
+	)
+	if l.Options.Relaxed {
+		return solv.RelaxedInstall(p)
+	}
+	return solv.Install(p)
+}
+
+// solve computes the install solution of p. With more than one solver
+// worker, independent groups of packages are solved in parallel.
+func (l *LuetInstaller) solve(p types.Packages, installed, definitions types.PackageDatabase) (types.PackagesAssertions, error) {
+	workers := l.Options.Context.GetConfig().General.SolverWorkers
+	if workers <= 1 {
+		return l.solveGroup(p, installed, definitions)
+	}
+
+	groups := partitionPackages(p, definitions)
+	if len(groups) == 1 {
+		return l.solveGroup(p, installed, definitions)
+	}
+
+	solutions := make([]types.PackagesAssertions, len(groups))
+	errs := make([]error, len(groups))
+	sem := make(chan struct{}, workers)
+	wg := &sync.WaitGroup{}
+	for i := range groups {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			solutions[i], errs[i] = l.solveGroup(groups[i], installed, definitions)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mergeSolutions(solutions)
+}
@@ -0,0 +1,90 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pkg/errors"
+)
+
+// createSymlinks applies the configured symlink rules for the package,
+// returning the links created, relative to the system target.
+// Symlinks owned by other packages are replaced only with Force.
+func (l *LuetInstaller) createSymlinks(p *types.Package, s *System) ([]string, error) {
+	cfg := l.Options.Context.GetConfig()
+	created := []string{}
+
+	for _, r := range cfg.GetSymlinkRules(p) {
+		to := filepath.Join(s.Target, r.To)
+		from := filepath.Join(s.Target, r.From)
+		rel := strings.TrimPrefix(filepath.Clean(r.To), "/")
+
+		if fi, err := os.Lstat(to); err == nil {
+			if fi.Mode()&os.ModeSymlink == 0 {
+				l.Options.Context.Warning("Not creating symlink", r.To, "for", p.HumanReadableString(), ": file exists and is not a symlink")
+				continue
+			}
+			owner, err := l.symlinkOwner(rel, s)
+			if err != nil {
+				return created, err
+			}
+			if owner != "" && owner != p.GetPackageName() && !l.Options.Force {
+				l.Options.Context.Warning("Not creating symlink", r.To, "for", p.HumanReadableString(), ": it is owned by", owner)
+				continue
+			}
+			if err := os.Remove(to); err != nil {
+				return created, errors.Wrapf(err, "while replacing symlink %s", r.To)
+			}
+		}
+
+		if err := os.MkdirAll(filepath.Dir(to), os.ModePerm); err != nil {
+			return created, errors.Wrapf(err, "while creating symlink %s", r.To)
+		}
+
+		target, err := filepath.Rel(filepath.Dir(to), from)
+		if err != nil {
+			return created, errors.Wrapf(err, "while creating symlink %s", r.To)
+		}
+
+		if err := os.Symlink(target, to); err != nil {
+			return created, errors.Wrapf(err, "while creating symlink %s", r.To)
+		}
+		l.Options.Context.Debug("Created symlink", r.To, "->", r.From, "for", p.HumanReadableString())
+		l.symlinks.Store(rel, p.GetPackageName())
+		created = append(created, rel)
+	}
+	return created, nil
+}
+
+// symlinkOwner returns the name of the package owning the symlink, either
+// in the system database or among the ones being installed, if any
+func (l *LuetInstaller) symlinkOwner(rel string, s *System) (string, error) {
+	exists, owner, err := s.ExistsPackageFile(rel)
+	if err != nil {
+		return "", errors.Wrapf(err, "while checking the owner of symlink %s", rel)
+	}
+	if exists {
+		return owner.GetPackageName(), nil
+	}
+	if name, ok := l.symlinks.Load(rel); ok {
+		return name.(string), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,131 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	artifact "github.com/mudler/luet/pkg/api/core/types/artifact"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Symlink rules", func() {
+	var dir string
+	var repos types.LuetRepositories
+	var system *System
+
+	a := &types.Package{Category: "test", Name: "a", Version: "1.0"}
+	b := &types.Package{Category: "test", Name: "b", Version: "1.0"}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "symlinks")
+		Expect(err).ToNot(HaveOccurred())
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		for _, f := range []*types.Package{a, b} {
+			p := f.Clone()
+			p.Path = filepath.Join(dir, "tree", p.Name)
+			Expect(os.MkdirAll(p.Path, os.ModePerm)).ToNot(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(p.Path, types.PackageDefinitionFile),
+				[]byte("category: test\nname: "+p.Name+"\nversion: \"1.0\"\n"), 0600)).ToNot(HaveOccurred())
+
+			src := filepath.Join(dir, "src", p.Name)
+			Expect(os.MkdirAll(filepath.Join(src, "lib", p.Name), os.ModePerm)).ToNot(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(src, "lib", p.Name, "tool"), []byte(p.Name), 0600)).ToNot(HaveOccurred())
+
+			art := artifact.NewPackageArtifact(filepath.Join(repodir, p.GetFingerPrint()+".package.tar"))
+			Expect(art.Compress(src, 1)).ToNot(HaveOccurred())
+			art.CompileSpec = &types.LuetCompilationSpec{Package: p}
+			Expect(art.WriteYAML(repodir)).ToNot(HaveOccurred())
+		}
+
+		repo, err := GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+		repos = types.LuetRepositories{*repo.LuetRepository}
+
+		fakeroot := filepath.Join(dir, "root")
+		Expect(os.MkdirAll(fakeroot, os.ModePerm)).ToNot(HaveOccurred())
+		system = &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	installer := func(force bool) *LuetInstaller {
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		ctx.Config.SymlinkPackages = []types.SymlinkRule{
+			{PackagePattern: "test/a", From: "lib/a/tool", To: "bin/tool"},
+			{PackagePattern: "test/b", From: "lib/b/tool", To: "bin/tool"},
+		}
+		return NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 1, Context: ctx, Force: force,
+			PackageRepositories: repos,
+		})
+	}
+
+	link := func() string {
+		target, err := os.Readlink(filepath.Join(system.Target, "bin", "tool"))
+		Expect(err).ToNot(HaveOccurred())
+		return target
+	}
+
+	It("replaces symlinks not owned by any package", func() {
+		Expect(os.MkdirAll(filepath.Join(system.Target, "bin"), os.ModePerm)).ToNot(HaveOccurred())
+		Expect(os.Symlink("missing", filepath.Join(system.Target, "bin", "tool"))).ToNot(HaveOccurred())
+
+		Expect(installer(false).Install(types.Packages{a}, system)).ToNot(HaveOccurred())
+		Expect(link()).To(Equal("../lib/a/tool"))
+	})
+
+	It("keeps symlinks owned by other packages", func() {
+		Expect(installer(false).Install(types.Packages{a}, system)).ToNot(HaveOccurred())
+		Expect(installer(false).Install(types.Packages{b}, system)).ToNot(HaveOccurred())
+		Expect(link()).To(Equal("../lib/a/tool"))
+
+		files, err := system.Database.GetPackageFiles(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).ToNot(ContainElement("bin/tool"))
+	})
+
+	It("replaces symlinks owned by other packages with force", func() {
+		Expect(installer(false).Install(types.Packages{a}, system)).ToNot(HaveOccurred())
+		Expect(installer(true).Install(types.Packages{b}, system)).ToNot(HaveOccurred())
+		Expect(link()).To(Equal("../lib/b/tool"))
+	})
+})
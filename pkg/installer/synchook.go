@@ -0,0 +1,43 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+)
+
+// runPostSyncHooks executes the post sync hooks with the repository name as argument.
+// Their output goes to the logger, failures are only logged.
+func runPostSyncHooks(ctx types.Context, repo string) {
+	cfg := ctx.GetConfig()
+	for _, hook := range cfg.PostSyncHooks {
+		ctx.Debug("Running post sync hook", hook, "for repository", repo)
+		cmd := exec.CommandContext(cfg.General.GetParentContext(), hook, repo)
+		out, err := cmd.CombinedOutput()
+
+		scanner := bufio.NewScanner(bytes.NewReader(out))
+		for scanner.Scan() {
+			ctx.Info(hook+":", scanner.Text())
+		}
+		if err != nil {
+			ctx.Warning("Post sync hook", hook, "failed for repository", repo+":", err.Error())
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/logger"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Post sync hooks", func() {
+	It("runs the hooks after the sync, ignoring their failures", func() {
+		dir, err := ioutil.TempDir("", "synchook")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		writeArtifacts(dir, 1)
+
+		repo, err := GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+
+		synced := filepath.Join(dir, "synced")
+		failing := filepath.Join(dir, "failing.sh")
+		notify := filepath.Join(dir, "notify.sh")
+		Expect(ioutil.WriteFile(failing, []byte("#!/bin/sh\necho broken mirror\nexit 1\n"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(notify, []byte("#!/bin/sh\necho \"$1\" > "+synced+"\necho notified $1\n"), 0755)).To(Succeed())
+
+		logPath := filepath.Join(dir, "log")
+		l, err := logger.New(logger.WithFileLogging(logPath, ""))
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx := context.NewContext(context.WithLogger(l))
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		ctx.Config.PostSyncHooks = []string{failing, filepath.Join(dir, "missing"), notify}
+
+		r, err := NewSystemRepository(*repo.LuetRepository).Sync(ctx, true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(r).ToNot(BeNil())
+
+		data, err := ioutil.ReadFile(synced)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal("test\n"))
+
+		log, err := ioutil.ReadFile(logPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(log)).To(ContainSubstring("broken mirror"))
+		Expect(string(log)).To(ContainSubstring("notified test"))
+		Expect(string(log)).To(ContainSubstring("failed for repository"))
+	})
+})
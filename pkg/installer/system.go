@@ -10,6 +10,7 @@ import (
 	"github.com/mudler/luet/pkg/api/core/types"
 	fileHelper "github.com/mudler/luet/pkg/helpers/file"
 	"github.com/mudler/luet/pkg/tree"
+	"github.com/pkg/errors"
 )
 
 type System struct {
@@ -24,6 +25,25 @@ func (s *System) World() (types.Packages, error) {
 	return s.Database.World(), nil
 }
 
+// GetPackageMetadata returns the labels and the annotations of the
+// installed package, including the metadata extras added at install
+// time. Annotations take precedence over labels with the same key.
+func (s *System) GetPackageMetadata(p *types.Package) map[string]string {
+	installed, err := s.Database.FindPackage(p)
+	if err != nil {
+		return nil
+	}
+
+	res := map[string]string{}
+	for k, v := range installed.GetLabels() {
+		res[k] = v
+	}
+	for k, v := range installed.Annotations {
+		res[string(k)] = v
+	}
+	return res
+}
+
 func (s *System) OSCheck(ctx types.Context) (notFound types.Packages) {
 	s.buildFileIndex()
 	s.Lock()
@@ -44,6 +64,7 @@ func (s *System) OSCheck(ctx types.Context) (notFound types.Packages) {
 func (s *System) ExecuteFinalizers(ctx types.Context, packs []*types.Package) error {
 	var errs error
 	executedFinalizer := map[string]bool{}
+	jobs := []finalizerJob{}
 	for _, p := range packs {
 		if !fileHelper.Exists(p.Rel(tree.FinalizerFile)) {
 			continue
@@ -58,19 +79,49 @@ func (s *System) ExecuteFinalizers(ctx types.Context, packs []*types.Package) er
 
 		if _, exists := executedFinalizer[p.GetFingerPrint()]; !exists {
 			executedFinalizer[p.GetFingerPrint()] = true
-			ctx.Info("Executing finalizer for " + p.HumanReadableString())
 			finalizer, err := NewLuetFinalizerFromYaml([]byte(out))
 			if err != nil {
 				ctx.Warning("Failed reading finalizer for ", p.HumanReadableString(), err.Error())
 				errs = multierror.Append(errs, err)
 				continue
 			}
-			err = finalizer.RunInstall(ctx, s)
-			if err != nil {
-				ctx.Warning("Failed running finalizer for ", p.HumanReadableString(), err.Error())
-				errs = multierror.Append(errs, err)
-				continue
-			}
+			jobs = append(jobs, finalizerJob{pack: p, finalizer: finalizer})
+		}
+	}
+
+	if len(jobs) == 0 {
+		return errs
+	}
+
+	// The read-only mounts are kept until all the finalizers ran
+	unmount, err := s.mountReadOnly(ctx)
+	if err != nil {
+		return multierror.Append(errs, err)
+	}
+	defer unmount()
+
+	run := func(j finalizerJob) error {
+		ctx.Info("Executing finalizer for " + j.pack.HumanReadableString())
+		err := j.finalizer.RunInstall(ctx, s)
+		if errors.Is(err, ErrFinalizerTimeout) {
+			ctx.Error("Finalizer", j.pack.Rel(tree.FinalizerFile), "of", j.pack.HumanReadableString(), "timed out:", err.Error())
+		}
+		if err != nil {
+			ctx.Warning("Failed running finalizer for ", j.pack.HumanReadableString(), err.Error())
+		}
+		return err
+	}
+
+	if parallelism := ctx.GetConfig().General.FinalizeParallelism; parallelism > 1 {
+		if err := s.runFinalizersParallel(jobs, parallelism, run); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+		return errs
+	}
+
+	for _, j := range jobs {
+		if err := run(j); err != nil {
+			errs = multierror.Append(errs, err)
 		}
 	}
 	return errs
@@ -106,6 +157,7 @@ func (s *System) Clean() {
 	s.Lock()
 	defer s.Unlock()
 	s.fileIndex = nil
+	s.fileIndexPackages = nil
 }
 
 func (s *System) FileIndex() map[string]*types.Package {
@@ -0,0 +1,72 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	fileHelper "github.com/mudler/luet/pkg/helpers/file"
+)
+
+// trustedKey returns the key pinned for the repository when
+// trust_on_first_use is enabled. On the first contact the key served
+// by the repository is pinned, if it signs the downloaded index.
+// Read-only syncs trust it without pinning it. The returned function
+// removes the key if it wasn't pinned.
+func (r *LuetSystemRepository) trustedKey(ctx types.Context, c Client, file, signature string, readOnly bool) (string, func()) {
+	config := ctx.GetConfig()
+	if !config.TrustOnFirstUse {
+		return "", func() {}
+	}
+
+	pinned := config.System.GetTrustedKeyPath(r.GetName())
+	if fileHelper.Exists(pinned) {
+		return pinned, func() {}
+	}
+
+	key, err := c.DownloadFile(REPOSITORY_KEYFILE)
+	if err != nil {
+		ctx.Debug("Repository", r.GetName(), "doesn't provide a signing key:", err.Error())
+		return "", func() {}
+	}
+	remove := func() { os.RemoveAll(key) }
+
+	if err := (types.LuetRepositoryVerification{TrustedKeys: []string{key}}).Verify(file, signature); err != nil {
+		ctx.Warning("The signing key of", r.GetName(), "doesn't match the index signature, not trusting it:", err.Error())
+		remove()
+		return "", func() {}
+	}
+
+	if readOnly {
+		ctx.Debug("Trusting the signing key of", r.GetName(), "on first use, without pinning it")
+		return key, remove
+	}
+	defer remove()
+
+	if err := os.MkdirAll(filepath.Dir(pinned), os.ModePerm); err != nil {
+		ctx.Warning("Failed creating the trusted keys directory:", err.Error())
+		return "", func() {}
+	}
+	if err := fileHelper.CopyFile(key, pinned); err != nil {
+		ctx.Warning("Failed storing the signing key of", r.GetName()+":", err.Error())
+		return "", func() {}
+	}
+
+	ctx.Info("Trusting the signing key of", r.GetName(), "on first use")
+	return pinned, func() {}
+}
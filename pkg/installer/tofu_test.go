@@ -0,0 +1,134 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Trust on first use", func() {
+	var dir, repodir string
+	var repo *LuetSystemRepository
+	var ctx *context.Context
+
+	// publish signs the repository index and serves the signer key
+	publish := func() {
+		signer, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		key := &bytes.Buffer{}
+		w, err := armor.Encode(key, openpgp.PublicKeyType, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(signer.Serialize(w)).To(Succeed())
+		Expect(w.Close()).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(repodir, REPOSITORY_KEYFILE), key.Bytes(), 0600)).To(Succeed())
+
+		index, err := os.Open(filepath.Join(repodir, REPOSITORY_SPECFILE))
+		Expect(err).ToNot(HaveOccurred())
+		defer index.Close()
+		sig := &bytes.Buffer{}
+		Expect(openpgp.ArmoredDetachSign(sig, signer, index, nil)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(repodir, REPOSITORY_SPECFILE+".asc"), sig.Bytes(), 0600)).To(Succeed())
+	}
+
+	sync := func() error {
+		_, err := NewSystemRepository(*repo.LuetRepository).Sync(ctx, true)
+		return err
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "tofu")
+		Expect(err).ToNot(HaveOccurred())
+
+		repodir = filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		writeArtifacts(dir, 1)
+
+		repo, err = GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+		publish()
+
+		ctx = context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		ctx.Config.RepositoryVerification.Enabled = true
+		ctx.Config.TrustOnFirstUse = true
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("pins the key on the first sync", func() {
+		Expect(sync()).To(Succeed())
+		Expect(ctx.Config.System.GetTrustedKeyPath("test")).To(BeARegularFile())
+		Expect(sync()).To(Succeed())
+	})
+
+	It("doesn't pin the key in dry run", func() {
+		ctx.Config.General.DryRun = true
+		inst := NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 1, Context: ctx,
+			PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+		})
+		repos, err := inst.SyncRepositories()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(repos)).To(Equal(1))
+		Expect(ctx.Config.System.GetTrustedKeyPath("test")).ToNot(BeAnExistingFile())
+	})
+
+	It("keeps the pinned keys in the trusted keys directory", func() {
+		trusted := filepath.Join(ctx.Config.System.DatabasePath, types.TrustedKeysDir)
+		Expect(filepath.Dir(ctx.Config.System.GetTrustedKeyPath("../x"))).To(Equal(trusted))
+	})
+
+	It("refuses a different key after the first sync", func() {
+		Expect(sync()).To(Succeed())
+		publish()
+		Expect(errors.Is(sync(), types.ErrRepoSignatureInvalid)).To(BeTrue())
+	})
+
+	It("requires pre-configured keys without trust on first use", func() {
+		ctx.Config.TrustOnFirstUse = false
+		Expect(errors.Is(sync(), types.ErrRepoSignatureInvalid)).To(BeTrue())
+		Expect(ctx.Config.System.GetTrustedKeyPath("test")).ToNot(BeAnExistingFile())
+	})
+})
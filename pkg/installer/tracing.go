@@ -0,0 +1,46 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"github.com/mudler/luet/pkg/api/core/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// trace opens the root span of a top-level operation and records its
+// trace ID. Operations called by a running one join its trace.
+// The returned function ends the span with the operation error.
+func (l *LuetInstaller) trace(name string) func(*error) {
+	if l.traceCtx != nil {
+		return l.span(name)
+	}
+
+	ctx, span := tracing.Start(l.Options.Context.GetConfig().General.GetParentContext(), name)
+	l.traceCtx = ctx
+	l.TraceID = tracing.TraceID(ctx)
+	return func(err *error) {
+		tracing.End(span, *err)
+		l.traceCtx = nil
+	}
+}
+
+// span opens a child span of the running operation
+func (l *LuetInstaller) span(name string, attrs ...attribute.KeyValue) func(*error) {
+	_, span := tracing.Start(l.parentContext(), name, attrs...)
+	return func(err *error) {
+		tracing.End(span, *err)
+	}
+}
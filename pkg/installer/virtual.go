@@ -0,0 +1,50 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer
+
+import (
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pkg/errors"
+)
+
+// installedView returns the system database the solver resolves against,
+// including the packages provided by the host. The host provided packages
+// are also added to the definitions, as repositories might not have them.
+func (l *LuetInstaller) installedView(s *System, definitions types.PackageDatabase) (types.PackageDatabase, error) {
+	cfg := l.Options.Context.GetConfig()
+	virtuals := cfg.GetHostProvides()
+	if len(virtuals) == 0 {
+		return s.Database, nil
+	}
+
+	installed, err := s.Database.Copy()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range virtuals {
+		if _, err := installed.FindPackage(p); err != nil {
+			if _, err := installed.CreatePackage(p); err != nil {
+				return nil, errors.Wrapf(err, "while adding host provided package %s", p.HumanReadableString())
+			}
+		}
+		if _, err := definitions.FindPackage(p); err != nil {
+			if _, err := definitions.CreatePackage(p); err != nil {
+				return nil, errors.Wrapf(err, "while adding host provided package %s", p.HumanReadableString())
+			}
+		}
+	}
+	return installed, nil
+}
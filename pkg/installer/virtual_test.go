@@ -0,0 +1,97 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Host provides", func() {
+	var dir string
+	var repo *LuetSystemRepository
+	var packs types.Packages
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "hostprovides")
+		Expect(err).ToNot(HaveOccurred())
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		packs = writeArtifacts(dir, 1)
+		Expect(ioutil.WriteFile(filepath.Join(dir, "tree", "test", "p0", types.PackageDefinitionFile),
+			[]byte("category: test\nname: p0\nversion: \"1.0\"\nrequires:\n- category: sys\n  name: libc\n  version: \">=2.0\"\n"), 0600)).ToNot(HaveOccurred())
+
+		repo, err = GenerateRepository(
+			WithName("test"),
+			WithType("disk"),
+			WithUrls(repodir),
+			WithPriority(1),
+			WithSource(repodir),
+			WithTree(filepath.Join(dir, "tree")),
+			WithContext(context.NewContext()),
+			WithDatabase(pkg.NewInMemoryDatabase(false)),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(repo.Write(context.NewContext(), repodir, false, false)).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	install := func(provides []types.VirtualPackage) (*System, error) {
+		ctx := context.NewContext()
+		ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+		ctx.Config.System.PkgsCachePath = filepath.Join(dir, "cache")
+		ctx.Config.ProvideVirtualPackages = provides
+
+		inst := NewLuetInstaller(LuetInstallerOptions{
+			Concurrency: 1, Context: ctx,
+			PackageRepositories: types.LuetRepositories{*repo.LuetRepository},
+		})
+
+		fakeroot := filepath.Join(dir, "root")
+		Expect(os.MkdirAll(fakeroot, os.ModePerm)).ToNot(HaveOccurred())
+		system := &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+		return system, inst.Install(packs, system)
+	}
+
+	It("fails if the dependency is missing", func() {
+		_, err := install(nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("considers host provided packages installed", func() {
+		system, err := install([]types.VirtualPackage{{Category: "sys", Name: "libc", Version: "2.31"}})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = system.Database.FindPackage(packs[0])
+		Expect(err).ToNot(HaveOccurred())
+		_, err = system.Database.FindPackage(&types.Package{Category: "sys", Name: "libc", Version: "2.31"})
+		Expect(err).To(HaveOccurred())
+	})
+})
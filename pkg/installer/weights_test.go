@@ -0,0 +1,92 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package installer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/context"
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	fileHelper "github.com/mudler/luet/pkg/helpers/file"
+	. "github.com/mudler/luet/pkg/installer"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Repository weights", func() {
+	It("downloads from the mirrors serving the package by weight", func() {
+		dir, err := ioutil.TempDir("", "weights")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		repodir := filepath.Join(dir, "repo")
+		Expect(os.MkdirAll(repodir, os.ModePerm)).ToNot(HaveOccurred())
+		packs := writeArtifacts(dir, 1)
+
+		// The mirror serves the same artifacts
+		mirrordir := filepath.Join(dir, "mirror")
+		Expect(fileHelper.CopyDir(repodir, mirrordir)).ToNot(HaveOccurred())
+
+		repos := types.LuetRepositories{}
+		for name, d := range map[string]string{"main": repodir, "mirror": mirrordir} {
+			repo, err := GenerateRepository(
+				WithName(name),
+				WithType("disk"),
+				WithUrls(d),
+				WithPriority(1),
+				WithSource(d),
+				WithTree(filepath.Join(dir, "tree")),
+				WithContext(context.NewContext()),
+				WithDatabase(pkg.NewInMemoryDatabase(false)),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(repo.Write(context.NewContext(), d, false, false)).ToNot(HaveOccurred())
+			repos = append(repos, *repo.LuetRepository)
+		}
+
+		// Only the mirror can serve the package
+		Expect(os.Remove(filepath.Join(repodir, packs[0].GetFingerPrint()+".package.tar"))).ToNot(HaveOccurred())
+
+		install := func(weights map[string]int) error {
+			ctx := context.NewContext()
+			ctx.Config.System.DatabasePath = filepath.Join(dir, "db")
+			ctx.Config.System.PkgsCachePath, err = ioutil.TempDir(dir, "cache")
+			Expect(err).ToNot(HaveOccurred())
+			ctx.Config.SystemRepositoryWeights = weights
+
+			inst := NewLuetInstaller(LuetInstallerOptions{
+				Concurrency: 1, Context: ctx,
+				PackageRepositories: repos,
+			})
+
+			fakeroot, err := ioutil.TempDir(dir, "root")
+			Expect(err).ToNot(HaveOccurred())
+			system := &System{Database: pkg.NewInMemoryDatabase(false), Target: fakeroot}
+			if err := inst.Install(packs, system); err != nil {
+				return err
+			}
+			Expect(filepath.Join(fakeroot, "p0")).To(BeARegularFile())
+			return nil
+		}
+
+		Expect(install(map[string]int{"main": 0, "mirror": 1})).ToNot(HaveOccurred())
+		Expect(install(map[string]int{"main": 1, "mirror": 0})).To(HaveOccurred())
+	})
+})
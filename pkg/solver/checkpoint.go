@@ -0,0 +1,179 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package solver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ecooper/qlearning"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pkg/errors"
+)
+
+// CheckpointInterval is the number of qlearning iterations
+// between two checkpoints
+const CheckpointInterval = 100
+
+// QTable is a qlearning.Agent storing the Q-values of the
+// state actions, it can be serialized to resume a resolution
+type QTable struct {
+	Q            map[string]map[string]float32 `json:"q"`
+	LearningRate float32                       `json:"rate"`
+	Discount     float32                       `json:"discount"`
+}
+
+// NewQTable returns an empty QTable with the given learning rate and discount
+func NewQTable(lr, d float32) *QTable {
+	return &QTable{Q: map[string]map[string]float32{}, LearningRate: lr, Discount: d}
+}
+
+func (t *QTable) actions(state string) map[string]float32 {
+	if _, ok := t.Q[state]; !ok {
+		t.Q[state] = map[string]float32{}
+	}
+	return t.Q[state]
+}
+
+// Learn updates the Q-value of the action with the reward,
+// see https://en.wikipedia.org/wiki/Q-learning#Algorithm
+func (t *QTable) Learn(action *qlearning.StateAction, reward qlearning.Rewarder) {
+	current := action.State.String()
+	next := action.Action.Apply(action.State).String()
+
+	actions := t.actions(current)
+
+	maxNextVal := float32(0.0)
+	for _, v := range t.actions(next) {
+		if v > maxNextVal {
+			maxNextVal = v
+		}
+	}
+
+	currentVal := actions[action.Action.String()]
+	actions[action.Action.String()] = currentVal + t.LearningRate*(reward.Reward(action)+t.Discount*maxNextVal-currentVal)
+}
+
+// Value returns the Q-value of the action in the state
+func (t *QTable) Value(state qlearning.State, action qlearning.Action) float32 {
+	return t.actions(state.String())[action.String()]
+}
+
+func (t *QTable) String() string {
+	return fmt.Sprintf("%v", t.Q)
+}
+
+// Checkpoint is the progress of a qlearning resolution
+type Checkpoint struct {
+	// Targets identifies the resolution, checkpoints of
+	// different targets are not resumed
+	Targets   string          `json:"targets"`
+	Iteration int             `json:"iteration"`
+	Attempts  int             `json:"attempts"`
+	ToAttempt int             `json:"to_attempt"`
+	Attempted map[string]bool `json:"attempted"`
+
+	ObservedDelta       int      `json:"observed_delta"`
+	ObservedDeltaChoice []string `json:"observed_delta_choice"`
+
+	Agent *QTable `json:"agent"`
+}
+
+// ReadCheckpoint reads a checkpoint written by the qlearning resolver
+func ReadCheckpoint(path string) (*Checkpoint, error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Checkpoint{}
+	if err := json.Unmarshal(dat, c); err != nil {
+		return nil, errors.Wrapf(err, "invalid solver checkpoint %s", path)
+	}
+	return c, nil
+}
+
+// Write stores the checkpoint in path, replacing it atomically
+func (c *Checkpoint) Write(path string) error {
+	dat, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return errors.Wrap(err, "while writing solver checkpoint")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(dat); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "while writing solver checkpoint")
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (resolver *QLearningResolver) checkpoint(iteration int) *Checkpoint {
+	c := &Checkpoint{
+		Targets:       fmt.Sprintf("%v", resolver.Targets),
+		Iteration:     iteration,
+		Attempts:      resolver.attempts,
+		ToAttempt:     resolver.ToAttempt,
+		Attempted:     resolver.Attempted,
+		ObservedDelta: resolver.observedDelta,
+		Agent:         resolver.Agent,
+	}
+	for _, p := range resolver.observedDeltaChoice {
+		c.ObservedDeltaChoice = append(c.ObservedDeltaChoice, p.String())
+	}
+	return c
+}
+
+// resume restores the progress of the checkpoint file, returning
+// the iteration to restart from. Missing checkpoints or checkpoints
+// of other resolutions are ignored.
+func (resolver *QLearningResolver) resume() (int, error) {
+	c, err := ReadCheckpoint(resolver.CheckpointFile)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if c.Targets != fmt.Sprintf("%v", resolver.Targets) || c.Agent == nil {
+		return 0, nil
+	}
+
+	if c.Agent.Q == nil {
+		c.Agent.Q = map[string]map[string]float32{}
+	}
+	if c.Attempted == nil {
+		c.Attempted = map[string]bool{}
+	}
+	resolver.Agent = c.Agent
+	resolver.attempts = c.Attempts
+	resolver.ToAttempt = c.ToAttempt
+	resolver.Attempted = c.Attempted
+	resolver.observedDelta = c.ObservedDelta
+	resolver.observedDeltaChoice = types.Packages{}
+	for _, p := range c.ObservedDeltaChoice {
+		resolver.observedDeltaChoice = append(resolver.observedDeltaChoice, types.PackageFromString(p))
+	}
+	return c.Iteration, nil
+}
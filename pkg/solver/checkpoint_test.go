@@ -0,0 +1,111 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package solver_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/mudler/luet/pkg/solver"
+)
+
+var _ = Describe("Solver checkpoint", func() {
+	var dir, file string
+	var s types.PackageSolver
+	var A, C, D *types.Package
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "checkpoint")
+		Expect(err).ToNot(HaveOccurred())
+		file = filepath.Join(dir, "checkpoint.json")
+
+		dbInstalled := pkg.NewInMemoryDatabase(false)
+		dbDefinitions := pkg.NewInMemoryDatabase(false)
+		s = NewSolver(types.SolverOptions{Type: types.SolverSingleCoreSimple}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+
+		C = types.NewPackage("C", "", []*types.Package{}, []*types.Package{})
+		B := types.NewPackage("B", "", []*types.Package{}, []*types.Package{C})
+		A = types.NewPackage("A", "", []*types.Package{B}, []*types.Package{})
+		D = types.NewPackage("D", "", []*types.Package{}, []*types.Package{})
+		for _, p := range []*types.Package{A, B, C, D} {
+			_, err := dbDefinitions.CreatePackage(p)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		_, err = dbInstalled.CreatePackage(C)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("stores the Q-table", func() {
+		t := NewQTable(0.7, 1.0)
+		t.Q["state"] = map[string]float32{"action": 2.5}
+		Expect((&Checkpoint{Targets: "foo", Iteration: 100, Agent: t}).Write(file)).ToNot(HaveOccurred())
+
+		c, err := ReadCheckpoint(file)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.Iteration).To(Equal(100))
+		Expect(c.Agent).To(Equal(t))
+	})
+
+	It("resumes the resolution from the checkpoint", func() {
+		c := &Checkpoint{
+			Targets:             fmt.Sprintf("%v", types.Packages{A, D}),
+			Iteration:           100,
+			Attempts:            0,
+			Attempted:           map[string]bool{},
+			ObservedDeltaChoice: []string{D.String()},
+			Agent:               NewQTable(0.7, 1.0),
+		}
+		Expect(c.Write(file)).ToNot(HaveOccurred())
+
+		r := SimpleQLearningSolver().(*QLearningResolver)
+		r.CheckpointFile = file
+		s.SetResolver(r)
+
+		// No attempts left, the solution is the checkpointed one
+		solution, err := s.Install([]*types.Package{A, D})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(solution).ToNot(ContainElement(types.PackageAssert{Package: A, Value: true}))
+		Expect(solution).To(ContainElement(types.PackageAssert{Package: D, Value: true}))
+
+		_, err = os.Stat(file)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("ignores the checkpoints of other targets", func() {
+		Expect((&Checkpoint{Targets: "foo", Agent: NewQTable(0.7, 1.0)}).Write(file)).ToNot(HaveOccurred())
+
+		r := SimpleQLearningSolver().(*QLearningResolver)
+		r.CheckpointFile = file
+		s.SetResolver(r)
+
+		solution, err := s.Install([]*types.Package{A, D})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(solution).To(ContainElement(types.PackageAssert{Package: D, Value: true}))
+		Expect(solution).To(ContainElement(types.PackageAssert{Package: C, Value: true}))
+	})
+})
@@ -0,0 +1,145 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package solver
+
+import (
+	"github.com/crillab/gophersat/bf"
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	"github.com/pkg/errors"
+)
+
+// ErrUnresolvedConflict is returned by the fail conflict strategy
+var ErrUnresolvedConflict = errors.New("conflict requires user intervention")
+
+// ConflictResolver handles unsat cases according to a conflict strategy.
+// When the strategy can't find a solution, the Fallback resolver is used.
+type ConflictResolver struct {
+	Strategy string
+	Fallback types.PackageResolver
+}
+
+// NewConflictResolver wraps fallback with the given conflict strategy.
+// An empty strategy returns fallback as is.
+func NewConflictResolver(strategy string, fallback types.PackageResolver) types.PackageResolver {
+	if strategy == "" {
+		return fallback
+	}
+	return &ConflictResolver{Strategy: strategy, Fallback: fallback}
+}
+
+func (r *ConflictResolver) fallback(f bf.Formula, s types.PackageSolver) (types.PackagesAssertions, error) {
+	if r.Fallback == nil {
+		return (&Explainer{}).Solve(f, s)
+	}
+	return r.Fallback.Solve(f, s)
+}
+
+// Solve implements types.PackageResolver
+func (r *ConflictResolver) Solve(f bf.Formula, s types.PackageSolver) (types.PackagesAssertions, error) {
+	solv, ok := s.(*Solver)
+	if !ok {
+		return r.fallback(f, s)
+	}
+
+	wanted := solv.Wanted
+	installed := solv.Installed()
+
+	switch r.Strategy {
+	case types.ConflictFail:
+		_, err := (&Explainer{}).Solve(f, s)
+		if err != nil {
+			return nil, errors.Wrap(ErrUnresolvedConflict, err.Error())
+		}
+		return nil, ErrUnresolvedConflict
+	case types.ConflictPreferInstalled:
+		// Drop the wanted packages conflicting with the system
+		wanted = types.Packages{}
+		for _, w := range solv.Wanted {
+			_, err := solv.solveWith(types.Packages{w}, installed)
+			if errors.Is(err, ErrBacktrackLimitExceeded) {
+				return nil, err
+			}
+			if err == nil {
+				wanted = append(wanted, w)
+			}
+		}
+	case types.ConflictPreferNewer:
+		// Drop the installed packages conflicting with the wanted ones
+		installed = types.Packages{}
+		for _, i := range solv.Installed() {
+			_, err := solv.solveWith(solv.Wanted, types.Packages{i})
+			if errors.Is(err, ErrBacktrackLimitExceeded) {
+				return nil, err
+			}
+			if err == nil {
+				installed = append(installed, i)
+			}
+		}
+	default:
+		return r.fallback(f, s)
+	}
+
+	ass, err := solv.solveWith(wanted, installed)
+	if errors.Is(err, ErrBacktrackLimitExceeded) {
+		return nil, err
+	}
+	if err != nil {
+		return r.fallback(f, s)
+	}
+	return ass, nil
+}
+
+// solveWith solves the wanted packages against the given installed set,
+// without invoking the resolver
+func (s *Solver) solveWith(wanted, installed types.Packages) (types.PackagesAssertions, error) {
+	if len(wanted) == 0 {
+		// Nothing left to install, the system stays as is
+		ass := types.PackagesAssertions{}
+		for _, p := range installed {
+			ass = append(ass, types.PackageAssert{Package: p, Value: true})
+		}
+		return ass, nil
+	}
+
+	installedDB := pkg.NewInMemoryDatabase(false)
+	for _, p := range installed {
+		if _, err := installedDB.CreatePackage(p); err != nil {
+			return nil, err
+		}
+	}
+
+	s2 := &Solver{
+		InstalledDatabase:  installedDB,
+		DefinitionDatabase: s.DefinitionDatabase,
+		SolverDatabase:     pkg.NewInMemoryDatabase(false),
+		Wanted:             wanted,
+	}
+
+	f, err := s2.BuildFormula()
+	if err != nil {
+		return nil, err
+	}
+	model, _, err := s2.solve(f)
+	if err != nil {
+		// Backtracks are accounted on the solver resolving the conflict
+		if err := s.backtrack(wanted); err != nil {
+			return nil, err
+		}
+		return nil, err
+	}
+	return DecodeModel(model, s2.SolverDatabase)
+}
@@ -0,0 +1,68 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package solver
+
+import (
+	"github.com/crillab/gophersat/bf"
+	"github.com/mudler/luet/pkg/api/core/types"
+)
+
+// BuildExpandedWorld builds the formula of the packages reachable from the
+// wanted and the installed ones through their dependency edges, instead
+// of the whole world. Duplicated and always true constraints are dropped.
+// Packages outside of the dependency graph don't appear in the solution.
+func (s *Solver) BuildExpandedWorld(includeInstalled bool) (bf.Formula, error) {
+	var formulas []bf.Formula
+	if includeInstalled {
+		solvable, err := s.BuildInstalled()
+		if err != nil {
+			return nil, err
+		}
+		formulas = append(formulas, solvable)
+	}
+
+	seen := map[string]bool{}
+	var packages types.Packages
+	roots := append(types.Packages{}, s.Wanted...)
+	for _, p := range append(roots, s.Installed()...) {
+		for _, dep := range append(p.Related(s.DefinitionDatabase), p) {
+			if !seen[dep.GetFingerPrint()] && !dep.IsSelector() {
+				seen[dep.GetFingerPrint()] = true
+				packages = append(packages, dep)
+			}
+		}
+	}
+
+	constraints := map[string]bool{}
+	for _, p := range packages {
+		solvable, err := p.BuildFormula(s.DefinitionDatabase, s.SolverDatabase)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range solvable {
+			if f == bf.True || constraints[f.String()] {
+				continue
+			}
+			constraints[f.String()] = true
+			formulas = append(formulas, f)
+		}
+	}
+
+	if len(formulas) == 0 {
+		return bf.True, nil
+	}
+	return bf.And(formulas...), nil
+}
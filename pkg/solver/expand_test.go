@@ -0,0 +1,83 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package solver_test
+
+import (
+	types "github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/mudler/luet/pkg/solver"
+)
+
+var _ = Describe("Constraint expansion", func() {
+	var dbInstalled, dbDefinitions types.PackageDatabase
+
+	B1 := types.NewPackage("B", "1.1", []*types.Package{}, []*types.Package{})
+	B2 := types.NewPackage("B", "1.2", []*types.Package{}, []*types.Package{})
+	A := types.NewPackage("A", "1.0", []*types.Package{
+		types.NewPackage("B", ">=0", []*types.Package{}, []*types.Package{}),
+	}, []*types.Package{})
+	C := types.NewPackage("C", "1.0", []*types.Package{}, []*types.Package{})
+	D := types.NewPackage("D", "1.0", []*types.Package{}, []*types.Package{C})
+
+	BeforeEach(func() {
+		dbInstalled = pkg.NewInMemoryDatabase(false)
+		dbDefinitions = pkg.NewInMemoryDatabase(false)
+		for _, p := range []*types.Package{A, B1, B2, C, D} {
+			_, err := dbDefinitions.CreatePackage(p)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		_, err := dbInstalled.CreatePackage(C)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	solve := func(expand bool, wanted ...*types.Package) (types.PackagesAssertions, error) {
+		s := NewSolver(types.SolverOptions{Type: types.SolverSingleCoreSimple, ExpandConstraints: expand}, dbInstalled, dbDefinitions, pkg.NewInMemoryDatabase(false))
+		return s.Install(wanted)
+	}
+
+	It("finds the same packages to install as the whole world", func() {
+		full, err := solve(false, A)
+		Expect(err).ToNot(HaveOccurred())
+		expanded, err := solve(true, A)
+		Expect(err).ToNot(HaveOccurred())
+
+		for _, a := range []types.PackageAssert{{Package: A, Value: true}, {Package: B2, Value: true}, {Package: B1, Value: false}, {Package: C, Value: true}} {
+			Expect(full).To(ContainElement(a))
+			Expect(expanded).To(ContainElement(a))
+		}
+	})
+
+	It("leaves out the packages outside of the dependency graph", func() {
+		full, err := solve(false, A)
+		Expect(err).ToNot(HaveOccurred())
+		expanded, err := solve(true, A)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(full).To(ContainElement(types.PackageAssert{Package: D, Value: false}))
+		for _, a := range expanded {
+			Expect(a.Package.GetName()).ToNot(Equal("D"))
+		}
+		Expect(len(expanded)).To(BeNumerically("<", len(full)))
+	})
+
+	It("keeps the conflicts with the installed packages", func() {
+		_, err := solve(true, D)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,142 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package solver
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/crillab/gophersat/bf"
+	"github.com/mudler/luet/pkg/api/core/types"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+)
+
+const (
+	GRPCResolverType = "grpc"
+
+	pluginResolveMethod = "/solver.SolverPlugin/Resolve"
+	pluginCodec         = "json"
+
+	DefaultPluginTimeout = 5 * time.Minute
+)
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// jsonCodec encodes plugin messages as JSON, see plugin.proto
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return pluginCodec }
+
+// Dependency is a package reference exchanged with solver plugins
+type Dependency struct {
+	Category string `json:"category,omitempty"`
+	Name     string `json:"name"`
+	Version  string `json:"version,omitempty"`
+}
+
+type resolveRequest struct {
+	Dependencies []Dependency `json:"dependencies"`
+}
+
+type resolveResponse struct {
+	Packages []Dependency `json:"packages"`
+}
+
+// GRPCResolver forwards unsat cases to an external solver plugin
+// listening on a unix socket or on a TCP address.
+type GRPCResolver struct {
+	Address string
+	Timeout time.Duration
+}
+
+// NewGRPCResolver returns a resolver which delegates to the plugin at address.
+// Absolute paths are treated as unix sockets.
+func NewGRPCResolver(address string) types.PackageResolver {
+	return &GRPCResolver{Address: address, Timeout: DefaultPluginTimeout}
+}
+
+func (r *GRPCResolver) target() string {
+	if strings.HasPrefix(r.Address, "/") {
+		return "unix://" + r.Address
+	}
+	return r.Address
+}
+
+// Resolve asks the plugin for the packages satisfying deps
+func (r *GRPCResolver) Resolve(deps []Dependency) (types.Packages, error) {
+	if r.Address == "" {
+		return nil, errors.New("no solver plugin address configured")
+	}
+
+	conn, err := grpc.Dial(r.target(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, errors.Wrapf(err, "while connecting to solver plugin %s", r.Address)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.Timeout)
+	defer cancel()
+
+	resp := &resolveResponse{}
+	err = conn.Invoke(ctx, pluginResolveMethod, &resolveRequest{Dependencies: deps}, resp, grpc.CallContentSubtype(pluginCodec))
+	if err != nil {
+		return nil, errors.Wrap(err, "solver plugin failed resolving dependencies")
+	}
+
+	res := types.Packages{}
+	for _, d := range resp.Packages {
+		res = append(res, &types.Package{Category: d.Category, Name: d.Name, Version: d.Version})
+	}
+	return res, nil
+}
+
+// Solve implements types.PackageResolver by sending the wanted set to the plugin
+func (r *GRPCResolver) Solve(f bf.Formula, s types.PackageSolver) (types.PackagesAssertions, error) {
+	solv, ok := s.(*Solver)
+	if !ok {
+		return nil, errors.New("solver plugin requires the default solver")
+	}
+
+	deps := []Dependency{}
+	for _, p := range solv.Wanted {
+		deps = append(deps, Dependency{Category: p.GetCategory(), Name: p.GetName(), Version: p.GetVersion()})
+	}
+
+	packs, err := r.Resolve(deps)
+	if err != nil {
+		return nil, err
+	}
+
+	var ass types.PackagesAssertions
+	for _, p := range packs {
+		if solv.DefinitionDatabase != nil {
+			if found, err := solv.DefinitionDatabase.FindPackage(p); err == nil {
+				p = found
+			}
+		}
+		ass = append(ass, types.PackageAssert{Package: p, Value: true})
+	}
+	return ass, nil
+}
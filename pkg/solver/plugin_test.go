@@ -0,0 +1,112 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package solver_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+
+	. "github.com/mudler/luet/pkg/solver"
+)
+
+type pluginRequest struct {
+	Dependencies []Dependency `json:"dependencies"`
+}
+
+type pluginResponse struct {
+	Packages []Dependency `json:"packages"`
+}
+
+// startPlugin serves a solver plugin which returns only the first dependency
+func startPlugin(socket string) *grpc.Server {
+	srv := grpc.NewServer()
+	srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "solver.SolverPlugin",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Resolve",
+			Handler: func(_ interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := &pluginRequest{}
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				return &pluginResponse{Packages: req.Dependencies[:1]}, nil
+			},
+		}},
+	}, struct{}{})
+
+	l, err := net.Listen("unix", socket)
+	Expect(err).ToNot(HaveOccurred())
+	go srv.Serve(l)
+	return srv
+}
+
+var _ = Describe("GRPC Resolver", func() {
+	var socket string
+	var srv *grpc.Server
+
+	BeforeEach(func() {
+		dir, err := os.MkdirTemp("", "plugin")
+		Expect(err).ToNot(HaveOccurred())
+		socket = filepath.Join(dir, "solver.sock")
+		srv = startPlugin(socket)
+	})
+
+	AfterEach(func() {
+		srv.Stop()
+		os.RemoveAll(filepath.Dir(socket))
+	})
+
+	It("forwards dependencies to the plugin", func() {
+		r := NewGRPCResolver(socket).(*GRPCResolver)
+		packs, err := r.Resolve([]Dependency{{Category: "app", Name: "A", Version: "1.0"}, {Name: "B"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(packs)).To(Equal(1))
+		Expect(packs[0].HumanReadableString()).To(Equal("app/A-1.0"))
+	})
+
+	It("resolves unsat cases with the plugin", func() {
+		db := pkg.NewInMemoryDatabase(false)
+		dbInstalled := pkg.NewInMemoryDatabase(false)
+		dbDefinitions := pkg.NewInMemoryDatabase(false)
+		s := NewResolver(types.SolverOptions{Type: types.SolverSingleCoreSimple}, dbInstalled, dbDefinitions, db, NewGRPCResolver(socket))
+
+		C := types.NewPackage("C", "", []*types.Package{}, []*types.Package{})
+		D := types.NewPackage("D", "", []*types.Package{}, []*types.Package{})
+		B := types.NewPackage("B", "", []*types.Package{}, []*types.Package{C})
+		A := types.NewPackage("A", "", []*types.Package{B}, []*types.Package{})
+
+		for _, p := range []*types.Package{A, B, C, D} {
+			_, err := dbDefinitions.CreatePackage(p)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		_, err := dbInstalled.CreatePackage(C)
+		Expect(err).ToNot(HaveOccurred())
+
+		solution, err := s.Install([]*types.Package{D, A})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(solution).To(ContainElement(types.PackageAssert{Package: D, Value: true}))
+		Expect(solution).ToNot(ContainElement(types.PackageAssert{Package: A, Value: true}))
+	})
+})
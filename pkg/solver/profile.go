@@ -0,0 +1,192 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package solver
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultProfilingFile is the trace file name used, in the temporary
+// directory, when profiling is enabled without a path
+const DefaultProfilingFile = "luet-solver-trace.jsonl"
+
+// SolverStep is a single iteration of the qlearning resolver,
+// written as a JSON line when solver profiling is enabled
+type SolverStep struct {
+	Iteration int       `json:"iteration"`
+	State     []string  `json:"state"`
+	Reward    float64   `json:"reward"`
+	Action    string    `json:"action"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Profiler appends solver steps to a trace file
+type Profiler struct {
+	sync.Mutex
+	path string
+	f    *os.File
+	enc  *json.Encoder
+}
+
+// NewProfiler returns a profiler writing to path. The file is
+// opened on the first recorded step.
+func NewProfiler(path string) *Profiler {
+	return &Profiler{path: path}
+}
+
+// Record writes a step to the trace file
+func (p *Profiler) Record(s SolverStep) error {
+	p.Lock()
+	defer p.Unlock()
+	if p.f == nil {
+		f, err := os.OpenFile(p.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return errors.Wrap(err, "while opening solver trace file")
+		}
+		p.f = f
+		p.enc = json.NewEncoder(f)
+	}
+	return p.enc.Encode(s)
+}
+
+// Close closes the trace file, it can be reopened by Record
+func (p *Profiler) Close() error {
+	p.Lock()
+	defer p.Unlock()
+	if p.f == nil {
+		return nil
+	}
+	err := p.f.Close()
+	p.f = nil
+	return err
+}
+
+// ReadTrace reads all the steps of a trace file
+func ReadTrace(path string) ([]SolverStep, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	steps := []SolverStep{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		s := SolverStep{}
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			return nil, errors.Wrapf(err, "invalid trace at line %d", line)
+		}
+		steps = append(steps, s)
+	}
+	return steps, scanner.Err()
+}
+
+// TraceStats are aggregated statistics of a solver trace
+type TraceStats struct {
+	Steps           int
+	Runs            int
+	PositiveRewards int
+	NegativeRewards int
+	MeanReward      float64
+	MaxReward       float64
+	MinReward       float64
+	// ConvergedAt is the first iteration of the last run reaching the maximum reward
+	ConvergedAt int
+	Duration    time.Duration
+	// Actions counts how many times each action was taken
+	Actions map[string]int
+}
+
+// TopActions returns the n most taken actions
+func (t TraceStats) TopActions(n int) []string {
+	actions := make([]string, 0, len(t.Actions))
+	for a := range t.Actions {
+		actions = append(actions, a)
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		if t.Actions[actions[i]] == t.Actions[actions[j]] {
+			return actions[i] < actions[j]
+		}
+		return t.Actions[actions[i]] > t.Actions[actions[j]]
+	})
+	if n < len(actions) {
+		actions = actions[:n]
+	}
+	return actions
+}
+
+// AnalyzeTrace computes statistics over the steps of a trace. A trace
+// file can contain several solver runs, each restarting from iteration 1.
+func AnalyzeTrace(steps []SolverStep) TraceStats {
+	stats := TraceStats{Steps: len(steps), Actions: map[string]int{}}
+	if len(steps) == 0 {
+		return stats
+	}
+
+	stats.MaxReward, stats.MinReward = steps[0].Reward, steps[0].Reward
+	var sum float64
+	first, last := steps[0].Timestamp, steps[0].Timestamp
+	runStart := 0
+	for i, s := range steps {
+		if i == 0 || s.Iteration <= steps[i-1].Iteration {
+			stats.Runs++
+			runStart = i
+		}
+		sum += s.Reward
+		if s.Reward > 0 {
+			stats.PositiveRewards++
+		} else {
+			stats.NegativeRewards++
+		}
+		if s.Reward > stats.MaxReward {
+			stats.MaxReward = s.Reward
+		}
+		if s.Reward < stats.MinReward {
+			stats.MinReward = s.Reward
+		}
+		if s.Timestamp.Before(first) {
+			first = s.Timestamp
+		}
+		if s.Timestamp.After(last) {
+			last = s.Timestamp
+		}
+		stats.Actions[s.Action]++
+	}
+
+	runMax := steps[runStart].Reward
+	stats.ConvergedAt = steps[runStart].Iteration
+	for _, s := range steps[runStart:] {
+		if s.Reward > runMax {
+			runMax = s.Reward
+			stats.ConvergedAt = s.Iteration
+		}
+	}
+
+	stats.MeanReward = sum / float64(len(steps))
+	stats.Duration = last.Sub(first)
+	return stats
+}
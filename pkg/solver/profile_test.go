@@ -0,0 +1,89 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package solver_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mudler/luet/pkg/api/core/types"
+	pkg "github.com/mudler/luet/pkg/database"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/mudler/luet/pkg/solver"
+)
+
+var _ = Describe("Solver profiling", func() {
+	It("writes a trace of the qlearning steps", func() {
+		dir, err := os.MkdirTemp("", "profiling")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		trace := filepath.Join(dir, "trace.jsonl")
+
+		db := pkg.NewInMemoryDatabase(false)
+		dbInstalled := pkg.NewInMemoryDatabase(false)
+		dbDefinitions := pkg.NewInMemoryDatabase(false)
+		s := NewResolver(types.SolverOptions{Type: types.SolverSingleCoreSimple}, dbInstalled, dbDefinitions, db,
+			NewSolverFromOptions(types.LuetSolverOptions{Type: QLearningResolverType, SolverProfiling: true, SolverProfilingPath: trace}))
+
+		C := types.NewPackage("C", "", []*types.Package{}, []*types.Package{})
+		B := types.NewPackage("B", "", []*types.Package{}, []*types.Package{C})
+		A := types.NewPackage("A", "", []*types.Package{B}, []*types.Package{})
+		D := types.NewPackage("D", "", []*types.Package{}, []*types.Package{})
+		for _, p := range []*types.Package{A, B, C, D} {
+			_, err := dbDefinitions.CreatePackage(p)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		_, err = dbInstalled.CreatePackage(C)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = s.Install([]*types.Package{A, D})
+		Expect(err).ToNot(HaveOccurred())
+
+		steps, err := ReadTrace(trace)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(steps)).To(BeNumerically(">", 0))
+		Expect(steps[0].Iteration).To(Equal(1))
+		Expect(steps[0].Action).ToNot(BeEmpty())
+
+		stats := AnalyzeTrace(steps)
+		Expect(stats.Steps).To(Equal(len(steps)))
+		Expect(stats.Runs).To(Equal(1))
+		Expect(stats.PositiveRewards).To(BeNumerically(">", 0))
+	})
+
+	It("computes statistics over several runs", func() {
+		now := time.Now()
+		stats := AnalyzeTrace([]SolverStep{
+			{Iteration: 1, Reward: -1000, Action: "a", Timestamp: now},
+			{Iteration: 2, Reward: 12, Action: "b", Timestamp: now.Add(time.Second)},
+			{Iteration: 1, Reward: 6, Action: "b", Timestamp: now.Add(2 * time.Second)},
+			{Iteration: 2, Reward: 8, Action: "a", Timestamp: now.Add(3 * time.Second)},
+			{Iteration: 3, Reward: 8, Action: "b", Timestamp: now.Add(4 * time.Second)},
+		})
+		Expect(stats.Steps).To(Equal(5))
+		Expect(stats.Runs).To(Equal(2))
+		Expect(stats.PositiveRewards).To(Equal(4))
+		Expect(stats.NegativeRewards).To(Equal(1))
+		Expect(stats.MinReward).To(Equal(-1000.0))
+		Expect(stats.MaxReward).To(Equal(12.0))
+		Expect(stats.ConvergedAt).To(Equal(2))
+		Expect(stats.Duration).To(Equal(4 * time.Second))
+		Expect(stats.TopActions(1)).To(Equal([]string{"b"}))
+	})
+})
@@ -18,7 +18,9 @@ package solver
 import (
 	"encoding/json"
 	"fmt"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/crillab/gophersat/bf"
 	"github.com/mudler/luet/pkg/api/core/types"
@@ -69,7 +71,15 @@ type QLearningResolver struct {
 	observedDelta       int
 	observedDeltaChoice types.Packages
 
-	Agent *qlearning.SimpleAgent
+	Agent *QTable
+
+	// Profiler, if set, records every learning step
+	Profiler   *Profiler
+	lastReward float32
+
+	// CheckpointFile, if set, stores the progress every CheckpointInterval
+	// iterations, and an existing checkpoint of the same targets is resumed
+	CheckpointFile string
 }
 
 func SimpleQLearningSolver() types.PackageResolver {
@@ -79,7 +89,7 @@ func SimpleQLearningSolver() types.PackageResolver {
 // Defaults LearningRate 0.7, Discount 1.0
 func NewQLearningResolver(LearningRate, Discount float32, MaxAttempts, initialObservedDelta int) types.PackageResolver {
 	return &QLearningResolver{
-		Agent:         qlearning.NewSimpleAgent(LearningRate, Discount),
+		Agent:         NewQTable(LearningRate, Discount),
 		observedDelta: initialObservedDelta,
 		Attempts:      MaxAttempts,
 	}
@@ -96,7 +106,7 @@ func (resolver *QLearningResolver) Solve(f bf.Formula, s types.PackageSolver) (t
 
 	// Our agent by default has a learning rate of 0.7 and discount of 1.0.
 	if resolver.Agent == nil {
-		resolver.Agent = qlearning.NewSimpleAgent(DefaultLearningRate, DefaultDiscount) // FIXME: Remove hardcoded values
+		resolver.Agent = NewQTable(DefaultLearningRate, DefaultDiscount) // FIXME: Remove hardcoded values
 	}
 
 	// 3 are the action domains, counting noop regardless if enabled or not
@@ -108,7 +118,20 @@ func (resolver *QLearningResolver) Solve(f bf.Formula, s types.PackageSolver) (t
 
 	resolver.Attempted = make(map[string]bool, len(resolver.Targets))
 
-	for resolver.IsComplete() == Going {
+	if resolver.Profiler != nil {
+		defer resolver.Profiler.Close()
+	}
+
+	start := 1
+	if resolver.CheckpointFile != "" {
+		resumed, err := resolver.resume()
+		if err != nil {
+			return nil, err
+		}
+		start += resumed
+	}
+
+	for iteration := start; resolver.IsComplete() == Going; iteration++ {
 		// Pick the next move, which is going to be a letter choice.
 		action := qlearning.Next(resolver.Agent, resolver)
 
@@ -118,6 +141,18 @@ func (resolver *QLearningResolver) Solve(f bf.Formula, s types.PackageSolver) (t
 		// negative.
 		resolver.Agent.Learn(action, resolver)
 
+		if resolver.Profiler != nil {
+			if err := resolver.Profiler.Record(resolver.step(iteration, action)); err != nil {
+				return nil, err
+			}
+		}
+
+		if resolver.CheckpointFile != "" && iteration%CheckpointInterval == 0 {
+			if err := resolver.checkpoint(iteration).Write(resolver.CheckpointFile); err != nil {
+				return nil, err
+			}
+		}
+
 		// Reward doesn't change state so we can check what the
 		// reward would be for this action, and report how the
 		// env changed.
@@ -132,6 +167,9 @@ func (resolver *QLearningResolver) Solve(f bf.Formula, s types.PackageSolver) (t
 	// If we get good result, take it
 	// Take the result also if we did  reached overall maximum attempts
 	if resolver.IsComplete() == Solved || resolver.IsComplete() == NoSolution {
+		if resolver.CheckpointFile != "" {
+			os.Remove(resolver.CheckpointFile)
+		}
 
 		if len(resolver.observedDeltaChoice) != 0 {
 			// Take the minimum delta observed choice result, and consume it (Try sets the wanted list)
@@ -145,6 +183,20 @@ func (resolver *QLearningResolver) Solve(f bf.Formula, s types.PackageSolver) (t
 
 }
 
+func (resolver *QLearningResolver) step(iteration int, action *qlearning.StateAction) SolverStep {
+	state := []string{}
+	for _, p := range resolver.Solver.(*Solver).Wanted {
+		state = append(state, p.String())
+	}
+	return SolverStep{
+		Iteration: iteration,
+		State:     state,
+		Reward:    float64(resolver.lastReward),
+		Action:    action.Action.String(),
+		Timestamp: time.Now(),
+	}
+}
+
 // Returns the current state.
 func (resolver *QLearningResolver) IsComplete() int {
 	if resolver.attempts < 1 {
@@ -189,6 +241,10 @@ func (resolver *QLearningResolver) Try(c Choice) error {
 	}
 
 	_, err := resolver.Solver.Solve()
+	if errors.Is(err, ErrBacktrackLimitExceeded) {
+		// Stop exploring, the final attempt returns the error
+		resolver.attempts = 0
+	}
 
 	return err
 }
@@ -217,6 +273,12 @@ func (resolver *QLearningResolver) Choose(c Choice) bool {
 // member of the qlearning.Rewarder interface. If the choice will make sat the formula, a positive score is returned.
 // Otherwise, a static -1000 is returned.
 func (resolver *QLearningResolver) Reward(action *qlearning.StateAction) float32 {
+	r := resolver.reward(action)
+	resolver.lastReward = r
+	return r
+}
+
+func (resolver *QLearningResolver) reward(action *qlearning.StateAction) float32 {
 	choice := action.Action.(*Choice)
 
 	//_, err := resolver.Solver.Solve()
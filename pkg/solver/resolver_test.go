@@ -16,6 +16,9 @@
 package solver_test
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/mudler/luet/pkg/api/core/types"
 
 	pkg "github.com/mudler/luet/pkg/database"
@@ -40,6 +43,98 @@ var _ = Describe("Resolver", func() {
 	})
 
 	Context("Conflict set", func() {
+		Context("Conflict strategies", func() {
+			var A, B, C *types.Package
+
+			BeforeEach(func() {
+				C = types.NewPackage("C", "", []*types.Package{}, []*types.Package{})
+				B = types.NewPackage("B", "", []*types.Package{}, []*types.Package{C})
+				A = types.NewPackage("A", "", []*types.Package{B}, []*types.Package{})
+
+				for _, p := range []*types.Package{A, B, C} {
+					_, err := dbDefinitions.CreatePackage(p)
+					Expect(err).ToNot(HaveOccurred())
+				}
+				_, err := dbInstalled.CreatePackage(C)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("keeps the installed packages with prefer-installed", func() {
+				s.SetResolver(NewConflictResolver(types.ConflictPreferInstalled, nil))
+				solution, err := s.Install([]*types.Package{A})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(solution).To(ContainElement(types.PackageAssert{Package: C, Value: true}))
+				Expect(solution).ToNot(ContainElement(types.PackageAssert{Package: A, Value: true}))
+			})
+
+			It("replaces the installed packages with prefer-newer", func() {
+				s.SetResolver(NewConflictResolver(types.ConflictPreferNewer, nil))
+				solution, err := s.Install([]*types.Package{A})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(solution).To(ContainElement(types.PackageAssert{Package: A, Value: true}))
+				Expect(solution).To(ContainElement(types.PackageAssert{Package: B, Value: true}))
+				Expect(solution).ToNot(ContainElement(types.PackageAssert{Package: C, Value: true}))
+			})
+
+			It("fails with the fail strategy", func() {
+				s.SetResolver(NewConflictResolver(types.ConflictFail, &Explainer{}))
+				_, err := s.Install([]*types.Package{A})
+				Expect(errors.Is(err, ErrUnresolvedConflict)).To(BeTrue())
+			})
+		})
+
+		Context("Backtrack limit", func() {
+			// Each wanted package conflicts with the installed C: prefer-installed
+			// backtracks once for the whole set, then once per package: n+1 in total
+			conflicting := func(n int) types.Packages {
+				C := types.NewPackage("C", "", []*types.Package{}, []*types.Package{})
+				B := types.NewPackage("B", "", []*types.Package{}, []*types.Package{C})
+				_, err := dbInstalled.CreatePackage(C)
+				Expect(err).ToNot(HaveOccurred())
+
+				wanted := types.Packages{}
+				for _, p := range []*types.Package{B, C} {
+					_, err := dbDefinitions.CreatePackage(p)
+					Expect(err).ToNot(HaveOccurred())
+				}
+				for i := 0; i < n; i++ {
+					w := types.NewPackage(fmt.Sprintf("W%d", i), "", []*types.Package{B}, []*types.Package{})
+					_, err := dbDefinitions.CreatePackage(w)
+					Expect(err).ToNot(HaveOccurred())
+					wanted = append(wanted, w)
+				}
+				return wanted
+			}
+
+			for _, n := range []int{1, 3, 5} {
+				n := n
+				It(fmt.Sprintf("allows exactly %d backtracks", n+1), func() {
+					wanted := conflicting(n)
+					s = NewResolver(types.SolverOptions{Type: types.SolverSingleCoreSimple, BacktrackLimit: n + 1},
+						dbInstalled, dbDefinitions, db, NewConflictResolver(types.ConflictPreferInstalled, nil))
+					_, err := s.Install(wanted)
+					Expect(err).ToNot(HaveOccurred())
+				})
+
+				It(fmt.Sprintf("fails when limited to %d backtracks", n), func() {
+					wanted := conflicting(n)
+					s = NewResolver(types.SolverOptions{Type: types.SolverSingleCoreSimple, BacktrackLimit: n},
+						dbInstalled, dbDefinitions, db, NewConflictResolver(types.ConflictPreferInstalled, nil))
+					_, err := s.Install(wanted)
+					Expect(errors.Is(err, ErrBacktrackLimitExceeded)).To(BeTrue())
+					Expect(err.Error()).To(ContainSubstring(fmt.Sprintf("W%d", n-1)))
+				})
+			}
+
+			It("stops the qlearning resolver", func() {
+				wanted := conflicting(2)
+				s = NewResolver(types.SolverOptions{Type: types.SolverSingleCoreSimple, BacktrackLimit: 2},
+					dbInstalled, dbDefinitions, db, SimpleQLearningSolver())
+				_, err := s.Install(wanted)
+				Expect(errors.Is(err, ErrBacktrackLimitExceeded)).To(BeTrue())
+			})
+		})
+
 		Context("Explainer", func() {
 			It("is unsolvable - as we something we ask to install conflict with system stuff", func() {
 				C := types.NewPackage("C", "", []*types.Package{}, []*types.Package{})
@@ -19,16 +19,20 @@ import (
 
 	//. "github.com/mudler/luet/pkg/logger"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/crillab/gophersat/bf"
+	"github.com/mudler/luet/pkg/api/core/metrics"
 	"github.com/mudler/luet/pkg/api/core/types"
 	pkg "github.com/mudler/luet/pkg/database"
 )
 
-var AvailableResolvers = strings.Join([]string{QLearningResolverType}, " ")
+var AvailableResolvers = strings.Join([]string{QLearningResolverType, GRPCResolverType}, " ")
 
 // Solver is the default solver for luet
 type Solver struct {
@@ -38,8 +42,19 @@ type Solver struct {
 	InstalledDatabase  types.PackageDatabase
 
 	Resolver types.PackageResolver
+
+	// BacktrackLimit caps the unsat attempts made while resolving
+	// conflicts, 0 means unlimited
+	BacktrackLimit int
+	backtracks     int
+
+	// ExpandConstraints builds the formula with BuildExpandedWorld
+	ExpandConstraints bool
 }
 
+// ErrBacktrackLimitExceeded is returned when resolving conflicts takes more than BacktrackLimit backtracks
+var ErrBacktrackLimitExceeded = errors.New("backtrack limit exceeded")
+
 // IsRelaxedResolver returns true wether a solver might
 // take action on user side, by removing some installation constraints
 // or taking automated actions (e.g. qlearning)
@@ -54,13 +69,30 @@ func NewSolver(t types.SolverOptions, installed types.PackageDatabase, definitio
 }
 
 func NewSolverFromOptions(t types.LuetSolverOptions) types.PackageResolver {
+	return NewConflictResolver(t.ConflictResolutionStrategy, newResolverFromOptions(t))
+}
+
+func newResolverFromOptions(t types.LuetSolverOptions) types.PackageResolver {
 	switch t.Type {
 	case QLearningResolverType:
+		r := SimpleQLearningSolver()
 		if t.LearnRate != 0.0 {
-			return NewQLearningResolver(t.LearnRate, t.Discount, t.MaxAttempts, 999999)
-
+			r = NewQLearningResolver(t.LearnRate, t.Discount, t.MaxAttempts, 999999)
+		}
+		if t.SolverProfiling {
+			path := t.SolverProfilingPath
+			if path == "" {
+				path = filepath.Join(os.TempDir(), DefaultProfilingFile)
+			}
+			r.(*QLearningResolver).Profiler = NewProfiler(path)
+		}
+		if t.SolverCheckpointFile != "" {
+			if t.NoCheckpoint {
+				os.Remove(t.SolverCheckpointFile)
+			}
+			r.(*QLearningResolver).CheckpointFile = t.SolverCheckpointFile
 		}
-		return SimpleQLearningSolver()
+		return r
 	}
 
 	return &Explainer{}
@@ -74,7 +106,7 @@ func NewResolver(t types.SolverOptions, installed types.PackageDatabase, definit
 	var s types.PackageSolver
 	switch t.Type {
 	default:
-		s = &Solver{InstalledDatabase: installed, DefinitionDatabase: definitiondb, SolverDatabase: solverdb, Resolver: re}
+		s = &Solver{InstalledDatabase: installed, DefinitionDatabase: definitiondb, SolverDatabase: solverdb, Resolver: re, BacktrackLimit: t.BacktrackLimit, ExpandConstraints: t.ExpandConstraints}
 	}
 
 	return s
@@ -539,7 +571,7 @@ func assertionToMemDB(assertions types.PackagesAssertions) types.PackageDatabase
 func (s *Solver) upgrade(psToUpgrade, psToNotUpgrade types.Packages, fn func(defDB types.PackageDatabase, installDB types.PackageDatabase) (types.Packages, types.Packages, types.PackageDatabase, []*types.Package), defDB types.PackageDatabase, installDB types.PackageDatabase, checkconflicts, full bool) (types.Packages, types.PackagesAssertions, error) {
 
 	toUninstall, toInstall, installedcopy, packsToUpgrade := fn(defDB, installDB)
-	s2 := NewSolver(types.SolverOptions{Type: types.SolverSingleCoreSimple}, installedcopy, defDB, pkg.NewInMemoryDatabase(false))
+	s2 := NewSolver(types.SolverOptions{Type: types.SolverSingleCoreSimple, BacktrackLimit: s.BacktrackLimit, ExpandConstraints: s.ExpandConstraints}, installedcopy, defDB, pkg.NewInMemoryDatabase(false))
 	s2.SetResolver(s.Resolver)
 	if !full {
 		ass := types.PackagesAssertions{}
@@ -712,7 +744,11 @@ func (s *Solver) Uninstall(checkconflicts, full bool, packs ...*types.Package) (
 // BuildFormula builds the main solving formula that is evaluated by the sat solver.
 func (s *Solver) BuildFormula() (bf.Formula, error) {
 	var formulas []bf.Formula
-	r, err := s.BuildWorld(false)
+	build := s.BuildWorld
+	if s.ExpandConstraints {
+		build = s.BuildExpandedWorld
+	}
+	r, err := build(false)
 	if err != nil {
 		return nil, err
 	}
@@ -748,14 +784,34 @@ func (s *Solver) BuildFormula() (bf.Formula, error) {
 }
 
 func (s *Solver) solve(f bf.Formula) (map[string]bool, bf.Formula, error) {
+	start := time.Now()
 	model := bf.Solve(f)
+	metrics.SolverDuration.Observe(time.Since(start).Seconds())
 	if model == nil {
+		if err := s.backtrack(s.Wanted); err != nil {
+			return model, f, err
+		}
 		return model, f, errors.New("Unsolvable")
 	}
 
 	return model, f, nil
 }
 
+// backtrack accounts an unsat attempt with the wanted packages,
+// failing once BacktrackLimit is exceeded
+func (s *Solver) backtrack(wanted types.Packages) error {
+	s.backtracks++
+	if s.BacktrackLimit <= 0 || s.backtracks <= s.BacktrackLimit {
+		return nil
+	}
+
+	conflict := []string{}
+	for _, p := range wanted {
+		conflict = append(conflict, p.HumanReadableString())
+	}
+	return errors.Wrapf(ErrBacktrackLimitExceeded, "gave up after %d backtracks, last conflict wanting [%s]", s.BacktrackLimit, strings.Join(conflict, ", "))
+}
+
 // Solve builds the formula given the current state and returns package assertions
 func (s *Solver) Solve() (types.PackagesAssertions, error) {
 	var model map[string]bool
@@ -768,6 +824,9 @@ func (s *Solver) Solve() (types.PackagesAssertions, error) {
 	}
 
 	model, _, err = s.solve(f)
+	if errors.Is(err, ErrBacktrackLimitExceeded) {
+		return nil, err
+	}
 	if err != nil && s.Resolver != nil {
 		return s.Resolver.Solve(f, s)
 	}
@@ -782,6 +841,7 @@ func (s *Solver) Solve() (types.PackagesAssertions, error) {
 // Install given a list of packages, returns package assertions to indicate the packages that must be installed in the system in order
 // to statisfy all the constraints
 func (s *Solver) RelaxedInstall(c types.Packages) (types.PackagesAssertions, error) {
+	s.backtracks = 0
 
 	coll, err := s.getList(s.DefinitionDatabase, c)
 	if err != nil {
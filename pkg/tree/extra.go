@@ -0,0 +1,52 @@
+// Copyright © 2022 Ettore Di Giacinto <mudler@mocaccino.org>
+//
+// This program is free software; you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation; either version 2 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License along
+// with this program; if not, see <http://www.gnu.org/licenses/>.
+
+package tree
+
+import (
+	"fmt"
+
+	pkg "github.com/mudler/luet/pkg/database"
+)
+
+// LoadExtraDirs loads the specs of the extra package dirs in the builders,
+// merging them with the trees already loaded. It fails if a package
+// (same category, name and version) is defined in two different dirs.
+func LoadExtraDirs(dirs []string, builders ...Builder) error {
+	if len(builders) == 0 {
+		return nil
+	}
+	db := builders[0].GetDatabase()
+
+	for _, dir := range dirs {
+		scratch := NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+		if err := scratch.Load(dir); err != nil {
+			return err
+		}
+		for _, p := range scratch.GetDatabase().World() {
+			if existing, err := db.FindPackage(p); err == nil {
+				return fmt.Errorf("package %s is defined in both %s and %s",
+					p.HumanReadableString(), existing.GetPath(), p.GetPath())
+			}
+		}
+
+		for _, b := range builders {
+			if err := b.Load(dir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -23,6 +23,7 @@ package tree_test
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -188,4 +189,53 @@ var _ = Describe("Tree", func() {
 		})
 	})
 
+	Context("Extra package dirs", func() {
+		writeSpec := func(dir, name, version string) {
+			d := filepath.Join(dir, name)
+			Expect(os.MkdirAll(d, 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(d, "definition.yaml"),
+				[]byte("category: test\nname: "+name+"\nversion: \""+version+"\"\n"), 0644)).To(Succeed())
+		}
+
+		It("merges the specs of the extra dirs", func() {
+			primary, err := ioutil.TempDir("", "tree")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(primary)
+			extra, err := ioutil.TempDir("", "tree")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(extra)
+
+			writeSpec(primary, "a", "1.0")
+			writeSpec(extra, "b", "1.0")
+			writeSpec(extra, "a", "2.0")
+
+			generalRecipe := NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+			Expect(generalRecipe.Load(primary)).To(Succeed())
+			Expect(LoadExtraDirs([]string{extra}, generalRecipe)).To(Succeed())
+
+			Expect(len(generalRecipe.GetDatabase().World())).To(Equal(3))
+			Expect(generalRecipe.GetSourcePath()).To(Equal([]string{primary, extra}))
+		})
+
+		It("fails when a package is defined twice", func() {
+			primary, err := ioutil.TempDir("", "tree")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(primary)
+			extra, err := ioutil.TempDir("", "tree")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(extra)
+
+			writeSpec(primary, "a", "1.0")
+			writeSpec(extra, "a", "1.0")
+
+			generalRecipe := NewCompilerRecipe(pkg.NewInMemoryDatabase(false))
+			Expect(generalRecipe.Load(primary)).To(Succeed())
+			err = LoadExtraDirs([]string{extra}, generalRecipe)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(filepath.Join(primary, "a")))
+			Expect(err.Error()).To(ContainSubstring(filepath.Join(extra, "a")))
+			Expect(generalRecipe.GetSourcePath()).To(Equal([]string{primary}))
+		})
+	})
+
 })